@@ -3,9 +3,13 @@ package cobra
 import (
 	"bufio"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/ngeojiajun/go-filecrypt/pkg/container"
 	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
@@ -24,11 +28,21 @@ var (
 	decryptKey       string
 	decryptFrom      string
 	decryptTo        string
+	decryptOffset    int64
+	decryptLength    int64
+	decryptMetadata  bool
+)
+
+var (
+	ErrNoOriginalName = errors.New("the file does not record its original name, pass the path of the output file")
 )
 
 func init() {
 	rootCmd.AddCommand(decryptCmd)
-	addCommonFlags(decryptCmd, &decryptOverwrite, &decryptKey, &decryptFrom, &decryptTo)
+	addCommonFlags(decryptCmd, &decryptOverwrite, &decryptKey, &decryptFrom, &decryptTo, "Output file path, or directory to decrypt into under the original name")
+	decryptCmd.Flags().Int64Var(&decryptOffset, "offset", 0, "Offset of the plaintext to start decrypting from (the content is not authenticated)")
+	decryptCmd.Flags().Int64Var(&decryptLength, "length", -1, "Number of plaintext bytes to decrypt, default to the end of the content (the content is not authenticated)")
+	decryptCmd.Flags().BoolVar(&decryptMetadata, "metadata", true, "Restore the modification time of the original file when it is recorded")
 }
 
 func decrypt(cmd *cobra.Command, args []string) {
@@ -36,14 +50,9 @@ func decrypt(cmd *cobra.Command, args []string) {
 	if err != nil {
 		log.Fatalf("invalid hex key: %v", err)
 	}
-	alg := types.SlotKeyAlgAESGCM128
-	for _, alg := range []types.SlotKeyAlgorithm{types.SlotKeyAlgAESGCM128, types.SlotKeyAlgAESGCM256} {
-		if alg.KeySize() == len(key) {
-			break
-		}
-	}
-	if alg == types.SlotKeyAlgEnd {
-		log.Fatalf("invalid key length: expected %d or %d hex characters", 2*types.SlotKeyAlgAESGCM128.KeySize(), 2*types.SlotKeyAlgAESGCM256.KeySize())
+	alg, err := slotAlgorithmForKey(key)
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	cfg := &Config{
@@ -52,6 +61,10 @@ func decrypt(cmd *cobra.Command, args []string) {
 		From:      decryptFrom,
 		To:        decryptTo,
 		SlotAlg:   alg,
+		Range:     cmd.Flags().Changed("offset") || cmd.Flags().Changed("length"),
+		Offset:    decryptOffset,
+		Length:    decryptLength,
+		Metadata:  decryptMetadata,
 	}
 
 	validateFlags(cfg)
@@ -74,23 +87,87 @@ func ProcessDecryption(cfg *Config) error {
 	if err != nil {
 		return fmt.Errorf("error happened, while unsealing the file: %v", err)
 	}
+	output := ""
 	defer (func() {
 		fileContainer.Close()
-		if err != nil {
-			os.Remove(cfg.To)
+		if err != nil && output != "" {
+			os.Remove(output)
 		}
 	})()
 
+	metadata, err := fileContainer.GetMetadata()
+	if err == container.ErrNoMetadata {
+		metadata, err = nil, nil
+	}
+	if err != nil {
+		return fmt.Errorf("error happened, while reading the metadata: %v", err)
+	}
+	target, err := outputPath(cfg, metadata)
+	if err != nil {
+		return err
+	}
+
 	// Open the plaintext file
-	plaintext, err := os.Create(cfg.To)
+	plaintext, err := os.Create(target)
 	if err != nil {
-		return fmt.Errorf("IO error happened, while creating the file (%s): %v", cfg.To, err)
+		return fmt.Errorf("IO error happened, while creating the file (%s): %v", target, err)
 	}
+	output = target
 	plaintextBuffered := bufio.NewWriterSize(plaintext, BufSize)
 	defer plaintext.Close() // Auto close it
-	err = fileContainer.DecryptStream(plaintextBuffered)
+	if cfg.Range {
+		err = decryptRange(fileContainer, plaintextBuffered, cfg)
+	} else {
+		err = fileContainer.DecryptStream(plaintextBuffered)
+	}
 	if err == nil {
 		err = plaintextBuffered.Flush()
 	}
+	// A range is not the original file, so it does not get its modification time
+	if err == nil && cfg.Metadata && metadata != nil && !metadata.ModTime.IsZero() && !cfg.Range {
+		err = os.Chtimes(output, time.Time{}, metadata.ModTime)
+	}
 	return err
 }
+
+// Path of the plaintext, when cfg.To is a directory the original name recorded in the metadata is used inside it
+func outputPath(cfg *Config, metadata *types.FileMetadata) (string, error) {
+	info, err := os.Stat(cfg.To)
+	if err != nil || !info.IsDir() {
+		return cfg.To, nil
+	}
+	if metadata == nil {
+		return "", ErrNoOriginalName
+	}
+	// Only the base name is used so the metadata cannot point outside the directory
+	name := filepath.Base(filepath.FromSlash(metadata.Name))
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		return "", ErrNoOriginalName
+	}
+	target := filepath.Join(cfg.To, name)
+	if exists, err := FileExists(target); err != nil {
+		return "", err
+	} else if exists && !cfg.Overwrite {
+		return "", fmt.Errorf("%s already exists, use -overwrite to overwrite the file", target)
+	}
+	absFrom, _ := filepath.Abs(cfg.From)
+	absTo, _ := filepath.Abs(target)
+	if absFrom == absTo {
+		return "", fmt.Errorf("from and to must be different paths")
+	}
+	return target, nil
+}
+
+// Decrypt only the range requested, note that partial reads are not authenticated
+func decryptRange(fileContainer *container.ContainerFile, writer io.Writer, cfg *Config) error {
+	length := cfg.Length
+	if length < 0 {
+		size, err := fileContainer.EstimateContentSize()
+		if err != nil {
+			return err
+		}
+		length = size - cfg.Offset
+	}
+	log.Print("Decrypting a range of the file, the content will not be authenticated")
+	return fileContainer.DecryptRange(writer, cfg.Offset, length)
+}
@@ -0,0 +1,143 @@
+package cobra
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/ngeojiajun/go-filecrypt/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Encrypt a random file into a temp directory, returns the plaintext and the config used
+func encryptTestFile(t *testing.T, size int) ([]byte, *Config) {
+	dir := t.TempDir()
+	plainText, err := utils.GenerateRandomBytes(size)
+	assert.NoError(t, err, "cannot generate plaintext")
+	key, err := utils.GenerateRandomBytes(types.SlotKeyAlgAESGCM256.KeySize())
+	assert.NoError(t, err, "cannot generate key")
+	cfg := &Config{
+		Key:     key,
+		From:    filepath.Join(dir, "plain.bin"),
+		To:      filepath.Join(dir, "plain.bin.crpt"),
+		SlotAlg: types.SlotKeyAlgAESGCM256,
+	}
+	err = os.WriteFile(cfg.From, plainText, 0600)
+	assert.NoError(t, err, "cannot write the plaintext")
+	err = ProcessEncryption(cfg)
+	assert.NoError(t, err, "cannot encrypt the file")
+	return plainText, cfg
+}
+
+// Decrypt only a range of the file end to end
+func TestProcessDecryptionRange(t *testing.T) {
+	plainText, encCfg := encryptTestFile(t, 10000)
+	cfg := &Config{
+		Key:     encCfg.Key,
+		From:    encCfg.To,
+		To:      filepath.Join(t.TempDir(), "range.bin"),
+		SlotAlg: encCfg.SlotAlg,
+		Range:   true,
+		Offset:  1234,
+		Length:  4321,
+	}
+	err := ProcessDecryption(cfg)
+	assert.NoError(t, err, "cannot decrypt the range")
+	decrypted, err := os.ReadFile(cfg.To)
+	assert.NoError(t, err, "cannot read the output")
+	assert.Equal(t, plainText[1234:1234+4321], decrypted)
+
+	// Until the end of the content
+	cfg.Length = -1
+	err = ProcessDecryption(cfg)
+	assert.NoError(t, err, "cannot decrypt the range")
+	decrypted, err = os.ReadFile(cfg.To)
+	assert.NoError(t, err, "cannot read the output")
+	assert.Equal(t, plainText[1234:], decrypted)
+
+	// Past the end of the content
+	cfg.Length = 10000
+	err = ProcessDecryption(cfg)
+	assert.Error(t, err, "the range should be out of bounds")
+	_, err = os.Stat(cfg.To)
+	assert.True(t, os.IsNotExist(err), "the output should be removed on failure")
+}
+
+// Without a range the whole content is decrypted and authenticated
+func TestProcessDecryptionWhole(t *testing.T) {
+	plainText, encCfg := encryptTestFile(t, 10000)
+	cfg := &Config{
+		Key:     encCfg.Key,
+		From:    encCfg.To,
+		To:      filepath.Join(t.TempDir(), "whole.bin"),
+		SlotAlg: encCfg.SlotAlg,
+	}
+	err := ProcessDecryption(cfg)
+	assert.NoError(t, err, "cannot decrypt the file")
+	decrypted, err := os.ReadFile(cfg.To)
+	assert.NoError(t, err, "cannot read the output")
+	assert.Equal(t, plainText, decrypted)
+
+	// A tampered content is refused
+	data, err := os.ReadFile(encCfg.To)
+	assert.NoError(t, err, "cannot read the file")
+	data[len(data)-100] ^= 0x01
+	assert.NoError(t, os.WriteFile(encCfg.To, data, 0600), "cannot tamper the file")
+	err = ProcessDecryption(cfg)
+	assert.ErrorIs(t, err, utils.ErrAuthenticationFailed)
+}
+
+// The slot algorithm follows the length of the key
+func TestSlotAlgorithmForKey(t *testing.T) {
+	alg, err := slotAlgorithmForKey(make([]byte, 16))
+	assert.NoError(t, err)
+	assert.Equal(t, types.SlotKeyAlgAESGCM128, alg)
+	alg, err = slotAlgorithmForKey(make([]byte, 32))
+	assert.NoError(t, err)
+	assert.Equal(t, types.SlotKeyAlgAESGCM256, alg)
+	_, err = slotAlgorithmForKey(make([]byte, 24))
+	assert.Error(t, err)
+}
+
+// Decrypting into a directory restores the original name and modification time
+func TestProcessDecryptionRestoresMetadata(t *testing.T) {
+	plainText, encCfg := encryptTestFile(t, 1000)
+	modTime := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.NoError(t, os.Chtimes(encCfg.From, modTime, modTime))
+	encCfg.Metadata = true
+	encCfg.Overwrite = true
+	assert.NoError(t, ProcessEncryption(encCfg), "cannot encrypt the file")
+
+	dir := t.TempDir()
+	cfg := &Config{
+		Key:      encCfg.Key,
+		From:     encCfg.To,
+		To:       dir,
+		SlotAlg:  encCfg.SlotAlg,
+		Metadata: true,
+	}
+	err := ProcessDecryption(cfg)
+	assert.NoError(t, err, "cannot decrypt the file")
+	output := filepath.Join(dir, "plain.bin")
+	decrypted, err := os.ReadFile(output)
+	assert.NoError(t, err, "cannot read the output")
+	assert.Equal(t, plainText, decrypted)
+	info, err := os.Stat(output)
+	assert.NoError(t, err)
+	assert.True(t, modTime.Equal(info.ModTime()), "the modification time should be restored")
+
+	// The restored file is not overwritten unless asked
+	err = ProcessDecryption(cfg)
+	assert.Error(t, err, "the output already exists")
+	_, err = os.Stat(output)
+	assert.NoError(t, err, "the existing output must be kept")
+
+	// Without the metadata the name cannot be restored
+	encCfg.Metadata = false
+	assert.NoError(t, ProcessEncryption(encCfg), "cannot encrypt the file")
+	cfg.To = t.TempDir()
+	err = ProcessDecryption(cfg)
+	assert.ErrorIs(t, err, ErrNoOriginalName)
+}
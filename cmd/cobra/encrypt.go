@@ -25,11 +25,13 @@ var (
 	encryptFrom      string
 	encryptTo        string
 	encryptAlg       types.SlotKeyAlgorithm
+	encryptMetadata  bool
 )
 
 func init() {
 	rootCmd.AddCommand(encryptCmd)
-	addCommonFlags(encryptCmd, &encryptOverwrite, &encryptKey, &encryptFrom, &encryptTo)
+	addCommonFlags(encryptCmd, &encryptOverwrite, &encryptKey, &encryptFrom, &encryptTo, "Output file path of the encrypted file")
+	encryptCmd.Flags().BoolVar(&encryptMetadata, "metadata", true, "Store the name, size and modification time of the input encrypted in the header")
 }
 
 func encrypt(cmd *cobra.Command, args []string) {
@@ -38,14 +40,9 @@ func encrypt(cmd *cobra.Command, args []string) {
 		log.Fatalf("invalid hex key: %v", err)
 	}
 
-	for _, alg := range []types.SlotKeyAlgorithm{types.SlotKeyAlgAESGCM128, types.SlotKeyAlgAESGCM256} {
-		if alg.KeySize() == len(key) {
-			encryptAlg = alg
-			break
-		}
-	}
-	if encryptAlg == types.SlotKeyAlgEnd {
-		log.Fatalf("invalid key length: expected %d or %d hex characters", 2*types.SlotKeyAlgAESGCM128.KeySize(), 2*types.SlotKeyAlgAESGCM256.KeySize())
+	encryptAlg, err = slotAlgorithmForKey(key)
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	cfg := &Config{
@@ -54,6 +51,7 @@ func encrypt(cmd *cobra.Command, args []string) {
 		From:      encryptFrom,
 		To:        encryptTo,
 		SlotAlg:   encryptAlg,
+		Metadata:  encryptMetadata,
 	}
 
 	validateFlags(cfg)
@@ -68,32 +66,23 @@ func encrypt(cmd *cobra.Command, args []string) {
 }
 
 func ProcessEncryption(cfg *Config) error {
-	fileContainer, err := container.NewContainerFile(cfg.To, types.EncAlgAESCTR256)
-	if err != nil {
-		return fmt.Errorf("IO error happened, while creating the file: %v", err)
-	}
-	err = fileContainer.AddKeySlot(cfg.SlotAlg, cfg.Key)
-	if err == nil {
-		err = fileContainer.WriteHeader()
-	}
-	if err != nil {
-		fileContainer.Close()
-		os.Remove(cfg.To)
-		return fmt.Errorf("cannot prepare the file: %v", err)
-	}
-	defer (func() {
-		fileContainer.Close()
-		if err != nil {
-			os.Remove(cfg.To)
-		}
-	})()
-
 	// Open the plaintext file
 	plaintext, err := os.Open(cfg.From)
 	if err != nil {
 		return fmt.Errorf("IO error happened, while creating the file (%s): %v", cfg.From, err)
 	}
 	defer plaintext.Close() // Auto close it
-	err = fileContainer.EncryptStream(bufio.NewReaderSize(plaintext, BufSize))
-	return err
+	// The builder only replaces cfg.To once the container is complete
+	builder := container.NewBuilder(cfg.To).
+		WithAlgorithm(types.EncAlgAESCTR256).
+		AddSlot(cfg.SlotAlg, cfg.Key).
+		EncryptFrom(bufio.NewReaderSize(plaintext, BufSize))
+	if cfg.Metadata {
+		metadata, err := container.MetadataFromFile(cfg.From)
+		if err != nil {
+			return fmt.Errorf("IO error happened, while reading the metadata of the file (%s): %v", cfg.From, err)
+		}
+		builder.WithMetadata(metadata)
+	}
+	return builder.Build()
 }
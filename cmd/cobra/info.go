@@ -0,0 +1,125 @@
+package cobra
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+var infoCmd = &cobra.Command{
+	Use:   "info <file>",
+	Short: "Show the header of an encrypted file",
+	Long:  `Show the format version, the algorithm, the flags and the key slots of an encrypted file. No key is required.`,
+	Args:  cobra.ExactArgs(1),
+	Run:   info,
+}
+
+func init() {
+	rootCmd.AddCommand(infoCmd)
+}
+
+func info(cmd *cobra.Command, args []string) {
+	if err := PrintInfo(args[0], cmd.OutOrStdout()); err != nil {
+		log.Fatalf("Error happened: %v", err)
+	}
+}
+
+// Readable name of the content algorithm
+func encryptionAlgorithmName(alg types.EncryptionAlgorithm) string {
+	switch alg {
+	case types.EncAlgAESCTR128:
+		return "aes-ctr-128"
+	case types.EncAlgAESCTR192:
+		return "aes-ctr-192"
+	case types.EncAlgAESCTR256:
+		return "aes-ctr-256"
+	case types.EncAlgAESGCM128:
+		return "aes-gcm-128"
+	case types.EncAlgAESGCM256:
+		return "aes-gcm-256"
+	case types.EncAlgChaCha20Poly1305:
+		return "chacha20-poly1305"
+	default:
+		return fmt.Sprintf("unknown (%d)", alg)
+	}
+}
+
+// Readable names of the header flags in the order of their bits
+var headerFlagNames = []struct {
+	flag uint16
+	name string
+}{
+	{types.HeaderFlagArchive, "archive"},
+	{types.HeaderFlagValueCodecMask, "value"},
+	{types.HeaderFlagTarContent, "tar"},
+	{types.HeaderFlagAuthenticated, "authenticated"},
+	{types.HeaderFlagMetadata, "metadata"},
+	{types.HeaderFlagReadOnly, "read-only"},
+	{types.HeaderFlagContentSaltSize, "content-salt-size"},
+	{types.HeaderFlagChunkedContent, "chunked"},
+	{types.HeaderFlagMultiVolume, "multi-volume"},
+	{types.HeaderFlagCompactHeader, "compact"},
+	{types.HeaderFlagChecksumTrailer, "checksum"},
+	{types.HeaderFlagHeaderBound, "header-bound"},
+	{types.HeaderFlagDoubleBuffered, "double-buffered"},
+	{types.HeaderFlagReauthenticated, "reauthenticated"},
+}
+
+// Names of the flags set, the unknown ones are shown as a mask
+func headerFlagsDescription(flags uint16) string {
+	names := []string{}
+	for _, known := range headerFlagNames {
+		if flags&known.flag != 0 {
+			names = append(names, known.name)
+		}
+	}
+	if unknown := flags &^ types.HeaderFlagKnownMask; unknown != 0 {
+		names = append(names, fmt.Sprintf("unknown (%#04x)", unknown))
+	}
+	if len(names) == 0 {
+		return fmt.Sprintf("%#04x", flags)
+	}
+	return fmt.Sprintf("%#04x (%s)", flags, strings.Join(names, ", "))
+}
+
+// Print what the header of the file tells without unsealing it.
+// A header which cannot be parsed is reported before the error is returned
+func PrintInfo(name string, writer io.Writer) error {
+	fileContainer, err := container.OpenContainerFile(name)
+	if err != nil {
+		fmt.Fprintf(writer, "Header:\t\tinvalid (%v)\n", err)
+		return fmt.Errorf("error happened, while opening the file: %v", err)
+	}
+	defer fileContainer.Close()
+	description := fileContainer.Info()
+	status := "ok"
+	if types.HasUnknownCriticalFlags(description.Flags) {
+		status = "unknown critical flags, the content cannot be read by this version"
+	}
+	size := "unknown"
+	if contentSize, err := fileContainer.EstimateContentSize(); err == nil {
+		size = fmt.Sprintf("%d bytes (estimated)", contentSize)
+	}
+	_, err = fmt.Fprintf(writer, "Header:\t\t%s\nVersion:\t%d.%d\nAlgorithm:\t%s\nFlags:\t\t%s\nHeader size:\t%d bytes\nContent size:\t%s\nSlots:\t\t%d\n",
+		status,
+		description.VersionMajor, description.VersionMinor,
+		encryptionAlgorithmName(description.Algorithm),
+		headerFlagsDescription(description.Flags),
+		description.HeaderSize,
+		size,
+		len(description.Slots))
+	if err != nil {
+		return err
+	}
+	for _, slot := range description.Slots {
+		if _, err := fmt.Fprintf(writer, "  %d\t%s\t%s\n", slot.Index, slotAlgorithmName(slot.Alg), slot.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
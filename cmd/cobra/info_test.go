@@ -0,0 +1,36 @@
+package cobra
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintInfo(t *testing.T) {
+	_, encCfg := encryptTestFile(t, 1000)
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, PrintInfo(encCfg.To, buf), "cannot inspect the file")
+	output := buf.String()
+	assert.Contains(t, output, "Header:\t\tok\n")
+	assert.Contains(t, output, "Algorithm:\taes-ctr-256\n")
+	assert.Contains(t, output, "Content size:\t1000 bytes (estimated)\n")
+	assert.Contains(t, output, "Slots:\t\t1\n  0\taes-gcm-256\t")
+
+	// A file which is not a container is reported
+	name := filepath.Join(t.TempDir(), "garbage.bin")
+	assert.NoError(t, os.WriteFile(name, bytes.Repeat([]byte{0x42}, 100), 0600))
+	buf.Reset()
+	assert.Error(t, PrintInfo(name, buf))
+	assert.Contains(t, buf.String(), "Header:\t\tinvalid")
+}
+
+func TestHeaderFlagsDescription(t *testing.T) {
+	assert.Equal(t, "0x0000", headerFlagsDescription(0))
+	assert.Equal(t, "0x0810 (authenticated, compact)", headerFlagsDescription(types.HeaderFlagAuthenticated|types.HeaderFlagCompactHeader))
+	assert.Equal(t, "0x0041 (archive, unknown (0x0040))", headerFlagsDescription(types.HeaderFlagArchive|1<<6))
+	assert.Equal(t, "0x8000 (reauthenticated)", headerFlagsDescription(types.HeaderFlagReauthenticated))
+}
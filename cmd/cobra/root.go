@@ -4,13 +4,16 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/ngeojiajun/go-filecrypt/pkg/container"
 	"github.com/spf13/cobra"
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "go-filecrypt",
 	Short: "A simple file encryption tool",
-	Long:  `go-filecrypt is a CLI tool for encrypting and decrypting files.`,
+	Long: `go-filecrypt is a CLI tool for encrypting and decrypting files.
+
+Container format version: ` + container.FormatVersion(),
 }
 
 func Execute() {
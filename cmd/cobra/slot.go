@@ -0,0 +1,306 @@
+package cobra
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+
+	"github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+var slotCmd = &cobra.Command{
+	Use:   "slot",
+	Short: "Manage the key slots of a file",
+	Long:  `List, add and remove the key slots of an encrypted file. The header is rewritten in place.`,
+}
+
+var slotListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the key slots",
+	Run:   slotList,
+}
+
+var slotAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Add a key or password slot, unsealing with an existing credential",
+	Run:   slotAdd,
+}
+
+var slotRemoveCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Remove a key slot by its index, unsealing with an existing credential",
+	Run:   slotRemove,
+}
+
+var slotChangeCmd = &cobra.Command{
+	Use:   "change",
+	Short: "Change the key or password of a slot in place, unsealing with its current credential",
+	Run:   slotChange,
+}
+
+var (
+	slotFile        string
+	slotKey         string
+	slotPassword    string
+	slotNewKey      string
+	slotNewPassword string
+	slotKDF         string
+	slotIndex       int
+)
+
+// Parameters of the slot subcommands
+type SlotConfig struct {
+	File        string
+	Key         []byte // Existing key unsealing the file
+	Password    []byte // Existing password unsealing the file, used when Key is empty
+	NewKey      []byte // Key of the slot to add
+	NewPassword []byte // Password of the slot to add, used when NewKey is empty
+	KDF         string // Derivation of the password slot to add: argon2id (default), scrypt or pbkdf2
+	Index       int    // Index of the slot to remove or change
+}
+
+var (
+	ErrSlotCredentialMissing = errors.New("a key or a password is required")
+	ErrSlotKDFUnknown        = errors.New("the key derivation must be argon2id, scrypt or pbkdf2")
+)
+
+func init() {
+	rootCmd.AddCommand(slotCmd)
+	slotCmd.AddCommand(slotListCmd, slotAddCmd, slotRemoveCmd, slotChangeCmd)
+	slotCmd.PersistentFlags().StringVarP(&slotFile, "file", "f", "", "Encrypted file path")
+	slotCmd.MarkPersistentFlagRequired("file")
+	for _, cmd := range []*cobra.Command{slotAddCmd, slotRemoveCmd, slotChangeCmd} {
+		cmd.Flags().StringVarP(&slotKey, "key", "k", "", "Hex-encoded key unsealing the file")
+		cmd.Flags().StringVarP(&slotPassword, "password", "p", "", "Password unsealing the file")
+	}
+	for _, cmd := range []*cobra.Command{slotAddCmd, slotChangeCmd} {
+		cmd.Flags().StringVar(&slotNewKey, "new-key", "", "Hex-encoded key of the new slot")
+		cmd.Flags().StringVar(&slotNewPassword, "new-password", "", "Password of the new slot")
+	}
+	slotAddCmd.Flags().StringVar(&slotKDF, "kdf", "argon2id", "Key derivation of the new password slot: argon2id, scrypt or pbkdf2")
+	slotRemoveCmd.Flags().IntVarP(&slotIndex, "index", "i", -1, "Index of the slot to remove, as shown by slot list")
+	slotRemoveCmd.MarkFlagRequired("index")
+	slotChangeCmd.Flags().IntVarP(&slotIndex, "index", "i", -1, "Index of the slot to change, as shown by slot list")
+	slotChangeCmd.MarkFlagRequired("index")
+}
+
+// Build the configuration from the flags
+func slotConfigFromFlags() *SlotConfig {
+	cfg := &SlotConfig{
+		File:        slotFile,
+		Password:    []byte(slotPassword),
+		NewPassword: []byte(slotNewPassword),
+		KDF:         slotKDF,
+		Index:       slotIndex,
+	}
+	var err error
+	if cfg.Key, err = hex.DecodeString(slotKey); err != nil {
+		log.Fatalf("invalid hex key: %v", err)
+	}
+	if cfg.NewKey, err = hex.DecodeString(slotNewKey); err != nil {
+		log.Fatalf("invalid hex key: %v", err)
+	}
+	return cfg
+}
+
+func slotList(cmd *cobra.Command, args []string) {
+	if err := ListSlots(slotFile, cmd.OutOrStdout()); err != nil {
+		log.Fatalf("Error happened: %v", err)
+	}
+}
+
+func slotAdd(cmd *cobra.Command, args []string) {
+	if err := AddSlot(slotConfigFromFlags()); err != nil {
+		log.Fatalf("Error happened: %v", err)
+	}
+	log.Print("Done")
+}
+
+func slotRemove(cmd *cobra.Command, args []string) {
+	if err := RemoveSlot(slotConfigFromFlags()); err != nil {
+		log.Fatalf("Error happened: %v", err)
+	}
+	log.Print("Done")
+}
+
+func slotChange(cmd *cobra.Command, args []string) {
+	if err := ChangeSlot(slotConfigFromFlags()); err != nil {
+		log.Fatalf("Error happened: %v", err)
+	}
+	log.Print("Done")
+}
+
+// Readable name of the slot algorithm
+func slotAlgorithmName(alg types.SlotKeyAlgorithm) string {
+	switch alg {
+	case types.SlotKeyAlgAESGCM128:
+		return "aes-gcm-128"
+	case types.SlotKeyAlgAESGCM256:
+		return "aes-gcm-256"
+	case types.SlotKeyAlgExternalKMS:
+		return "kms"
+	case types.SlotKeyAlgTokenHMAC:
+		return "token-hmac"
+	case types.SlotKeyAlgAnonymous:
+		return "anonymous"
+	case types.SlotKeyAlgAESGCMSIV256:
+		return "aes-gcm-siv-256"
+	case types.SlotKeyAlgTPM:
+		return "tpm"
+	case types.SlotKeyAlgArgon2id:
+		return "password"
+	case types.SlotKeyAlgScrypt:
+		return "password-scrypt"
+	case types.SlotKeyAlgPBKDF2SHA256:
+		return "password-pbkdf2"
+	case types.SlotKeyAlgRSAOAEP2048:
+		return "rsa-oaep"
+	case types.SlotKeyAlgX25519:
+		return "x25519"
+	case types.SlotKeyAlgEnd:
+		return "destroyed"
+	default:
+		return fmt.Sprintf("unknown (%d)", alg)
+	}
+}
+
+// Print the index, the algorithm and the identifier of every slot
+func ListSlots(name string, writer io.Writer) error {
+	fileContainer, err := container.OpenContainerFile(name)
+	if err != nil {
+		return fmt.Errorf("error happened, while opening the file: %v", err)
+	}
+	defer fileContainer.Close()
+	for _, slot := range fileContainer.GetSlots() {
+		if _, err := fmt.Fprintf(writer, "%d\t%s\t%s\n", slot.Index, slotAlgorithmName(slot.Alg), slot.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Open the file for update and unseal it with the existing credential
+func openForSlotChange(cfg *SlotConfig) (*container.ContainerFile, error) {
+	if len(cfg.Key) == 0 && len(cfg.Password) == 0 {
+		return nil, ErrSlotCredentialMissing
+	}
+	fileContainer, err := container.OpenContainerFileForUpdate(cfg.File)
+	if err != nil {
+		return nil, fmt.Errorf("error happened, while opening the file: %v", err)
+	}
+	switch {
+	case len(cfg.Key) != 0:
+		var alg types.SlotKeyAlgorithm
+		if alg, err = slotAlgorithmForKey(cfg.Key); err == nil {
+			err = fileContainer.Unseal(alg, cfg.Key)
+		}
+	default:
+		err = fileContainer.UnsealWithPassword(cfg.Password)
+	}
+	if err != nil {
+		fileContainer.Close()
+		return nil, fmt.Errorf("error happened, while unsealing the file: %v", err)
+	}
+	return fileContainer, nil
+}
+
+// Rewrite the header in place and close the file
+func commitSlotChange(fileContainer *container.ContainerFile) error {
+	if err := fileContainer.UpdateHeader(); err != nil {
+		fileContainer.Close()
+		return fmt.Errorf("error happened, while writing the header: %v", err)
+	}
+	return fileContainer.Close()
+}
+
+// Add a key or password slot to the file
+func AddSlot(cfg *SlotConfig) error {
+	if len(cfg.NewKey) == 0 && len(cfg.NewPassword) == 0 {
+		return fmt.Errorf("the new slot needs a key or a password: %w", ErrSlotCredentialMissing)
+	}
+	if len(cfg.NewKey) == 0 && !slices.Contains([]string{"", "argon2id", "scrypt", "pbkdf2"}, cfg.KDF) {
+		return ErrSlotKDFUnknown
+	}
+	fileContainer, err := openForSlotChange(cfg)
+	if err != nil {
+		return err
+	}
+	if len(cfg.NewKey) != 0 {
+		var alg types.SlotKeyAlgorithm
+		if alg, err = slotAlgorithmForKey(cfg.NewKey); err == nil {
+			err = fileContainer.AddKeySlot(alg, cfg.NewKey)
+		}
+	} else {
+		err = addPasswordSlot(fileContainer, cfg)
+	}
+	if err != nil {
+		fileContainer.Close()
+		return fmt.Errorf("error happened, while adding the slot: %v", err)
+	}
+	return commitSlotChange(fileContainer)
+}
+
+// Add the password slot with the derivation selected, the default cost of each derivation is used
+func addPasswordSlot(fileContainer *container.ContainerFile, cfg *SlotConfig) error {
+	switch cfg.KDF {
+	case "", "argon2id":
+		return fileContainer.AddPasswordSlot(cfg.NewPassword)
+	case "scrypt":
+		return fileContainer.AddScryptPasswordSlot(cfg.NewPassword, types.DefaultScryptParams)
+	case "pbkdf2":
+		return fileContainer.AddPBKDF2PasswordSlot(cfg.NewPassword, types.DefaultPBKDF2Params)
+	default:
+		return ErrSlotKDFUnknown
+	}
+}
+
+// Remove the slot at the index from the file, the last slot cannot be removed.
+// The slot is dropped when the header is rewritten, so the indices of the following slots shift
+func RemoveSlot(cfg *SlotConfig) error {
+	fileContainer, err := openForSlotChange(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.Index < 0 {
+		err = container.ErrSlotInvalidRemove
+	} else {
+		err = fileContainer.RemoveKeySlotByIndex(cfg.Index)
+	}
+	if err != nil {
+		fileContainer.Close()
+		return fmt.Errorf("error happened, while removing the slot: %v", err)
+	}
+	return commitSlotChange(fileContainer)
+}
+
+// Replace the key or password of the slot at the index, the current credential must be the one of that slot.
+// The slot keeps its index and the content is not encrypted again
+func ChangeSlot(cfg *SlotConfig) error {
+	oldKey, newKey := cfg.Key, cfg.NewKey
+	if len(oldKey) == 0 {
+		oldKey = cfg.Password
+	}
+	if len(newKey) == 0 {
+		newKey = cfg.NewPassword
+	}
+	if len(oldKey) == 0 {
+		return ErrSlotCredentialMissing
+	}
+	if len(newKey) == 0 {
+		return fmt.Errorf("the slot needs a new key or a new password: %w", ErrSlotCredentialMissing)
+	}
+	fileContainer, err := container.OpenContainerFileForUpdate(cfg.File)
+	if err != nil {
+		return fmt.Errorf("error happened, while opening the file: %v", err)
+	}
+	defer fileContainer.Close()
+	if err := fileContainer.ChangeSlotKey(cfg.Index, oldKey, newKey); err != nil {
+		return fmt.Errorf("error happened, while changing the slot: %w", err)
+	}
+	return fileContainer.Close()
+}
@@ -0,0 +1,108 @@
+package cobra
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/ngeojiajun/go-filecrypt/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Add a password and a key slot, then remove the original slot and decrypt with the new ones
+func TestSlotSubcommands(t *testing.T) {
+	// The password slots use Argon2id, which can be left out of the build, see the no_* build tags
+	if !slices.Contains(container.Capabilities().SlotAlgorithms, types.SlotKeyAlgArgon2id) {
+		t.Skip("Argon2id is not compiled in")
+	}
+	plainText, encCfg := encryptTestFile(t, 1000)
+	newKey, err := utils.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate key")
+
+	list := func() []string {
+		buf := bytes.NewBuffer(nil)
+		assert.NoError(t, ListSlots(encCfg.To, buf), "cannot list the slots")
+		return strings.Split(strings.TrimSpace(buf.String()), "\n")
+	}
+	lines := list()
+	assert.Len(t, lines, 1)
+	assert.True(t, strings.HasPrefix(lines[0], "0\taes-gcm-256\t"))
+
+	// An existing credential is required
+	err = AddSlot(&SlotConfig{File: encCfg.To, NewPassword: []byte("hunter2")})
+	assert.ErrorIs(t, err, ErrSlotCredentialMissing)
+	err = AddSlot(&SlotConfig{File: encCfg.To, Key: newKey, NewPassword: []byte("hunter2")})
+	assert.Error(t, err, "a wrong key must not unseal the file")
+
+	err = AddSlot(&SlotConfig{File: encCfg.To, Key: encCfg.Key, NewPassword: []byte("hunter2")})
+	assert.NoError(t, err, "cannot add the password slot")
+	err = AddSlot(&SlotConfig{File: encCfg.To, Password: []byte("hunter2"), NewKey: newKey})
+	assert.NoError(t, err, "cannot add the key slot")
+	lines = list()
+	assert.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[1], "1\tpassword\t"))
+	assert.True(t, strings.HasPrefix(lines[2], "2\taes-gcm-128\t"))
+
+	// The password slots for the systems lacking Argon2id
+	err = AddSlot(&SlotConfig{File: encCfg.To, Key: newKey, NewPassword: []byte("legacy"), KDF: "bcrypt"})
+	assert.ErrorIs(t, err, ErrSlotKDFUnknown)
+	err = AddSlot(&SlotConfig{File: encCfg.To, Key: newKey, NewPassword: []byte("legacy"), KDF: "pbkdf2"})
+	assert.NoError(t, err, "cannot add the pbkdf2 password slot")
+	lines = list()
+	assert.Len(t, lines, 4)
+	assert.True(t, strings.HasPrefix(lines[3], "3\tpassword-pbkdf2\t"))
+	err = RemoveSlot(&SlotConfig{File: encCfg.To, Password: []byte("legacy"), Index: 3})
+	assert.NoError(t, err, "cannot remove the slot with its own password")
+
+	err = RemoveSlot(&SlotConfig{File: encCfg.To, Key: newKey, Index: 0})
+	assert.NoError(t, err, "cannot remove the slot")
+	// The destroyed slot is dropped from the header
+	lines = list()
+	assert.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "0\tpassword\t"))
+	err = RemoveSlot(&SlotConfig{File: encCfg.To, Key: newKey, Index: 5})
+	assert.Error(t, err, "the index is out of bounds")
+
+	// The removed key cannot decrypt anymore, the new one can
+	cfg := &Config{Key: encCfg.Key, From: encCfg.To, To: filepath.Join(t.TempDir(), "plain.bin"), SlotAlg: encCfg.SlotAlg}
+	assert.Error(t, ProcessDecryption(cfg), "the removed slot must not unseal the file")
+	cfg.Key = newKey
+	cfg.SlotAlg, err = slotAlgorithmForKey(newKey)
+	assert.NoError(t, err)
+	assert.NoError(t, ProcessDecryption(cfg), "cannot decrypt with the new key")
+	decrypted, err := os.ReadFile(cfg.To)
+	assert.NoError(t, err, "cannot read the output")
+	assert.Equal(t, plainText, decrypted)
+}
+
+// Change the key of the slot in place, the slot keeps its index
+func TestChangeSlot(t *testing.T) {
+	plainText, encCfg := encryptTestFile(t, 1000)
+	newKey, err := utils.GenerateRandomBytes(32)
+	assert.NoError(t, err, "cannot generate key")
+
+	err = ChangeSlot(&SlotConfig{File: encCfg.To, NewKey: newKey, Index: 0})
+	assert.ErrorIs(t, err, ErrSlotCredentialMissing)
+	err = ChangeSlot(&SlotConfig{File: encCfg.To, Key: encCfg.Key, Index: 0})
+	assert.ErrorIs(t, err, ErrSlotCredentialMissing)
+	err = ChangeSlot(&SlotConfig{File: encCfg.To, Key: newKey, NewKey: newKey, Index: 0})
+	assert.Error(t, err, "a wrong key must not unseal the slot")
+	err = ChangeSlot(&SlotConfig{File: encCfg.To, Key: encCfg.Key, NewKey: newKey, Index: 0})
+	assert.NoError(t, err, "cannot change the slot")
+
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, ListSlots(encCfg.To, buf), "cannot list the slots")
+	assert.True(t, strings.HasPrefix(buf.String(), "0\taes-gcm-256\t"))
+	cfg := &Config{Key: encCfg.Key, From: encCfg.To, To: filepath.Join(t.TempDir(), "plain.bin"), SlotAlg: encCfg.SlotAlg}
+	assert.Error(t, ProcessDecryption(cfg), "the old key must not unseal the file")
+	cfg.Key = newKey
+	assert.NoError(t, ProcessDecryption(cfg), "cannot decrypt with the new key")
+	decrypted, err := os.ReadFile(cfg.To)
+	assert.NoError(t, err, "cannot read the output")
+	assert.Equal(t, plainText, decrypted)
+}
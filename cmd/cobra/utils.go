@@ -1,10 +1,12 @@
 package cobra
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 
+	"github.com/ngeojiajun/go-filecrypt/pkg/container"
 	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
 	"github.com/spf13/cobra"
 )
@@ -15,10 +17,16 @@ type Config struct {
 	From      string
 	To        string
 	SlotAlg   types.SlotKeyAlgorithm
+	Range     bool  // Decrypt only the range given by Offset and Length, the content is then not authenticated
+	Offset    int64 // Offset of the plaintext to start decrypting from, only used with Range
+	Length    int64 // Number of plaintext bytes to decrypt, negative for until the end, only used with Range
+	Metadata  bool  // Store the metadata of the input (encrypt), restore the modification time of the output (decrypt)
 }
 
 const BufSize = 4096 * 4 // 4 * 4kb pages
 
+const EncryptedFileMode os.FileMode = 0600 // Encrypted output is only accessible by the owner
+
 func FileExists(name string) (bool, error) {
 	info, err := os.Stat(name)
 	if err == nil {
@@ -30,6 +38,19 @@ func FileExists(name string) (bool, error) {
 	return false, err
 }
 
+// Slot algorithms selectable from the command line, by the length of the key
+var cliSlotAlgorithms = []types.SlotKeyAlgorithm{types.SlotKeyAlgAESGCM128, types.SlotKeyAlgAESGCM256}
+
+// Pick the slot algorithm matching the length of the key
+func slotAlgorithmForKey(key []byte) (types.SlotKeyAlgorithm, error) {
+	for _, alg := range cliSlotAlgorithms {
+		if container.ValidateKey(alg, key) == nil {
+			return alg, nil
+		}
+	}
+	return types.SlotKeyAlgEnd, fmt.Errorf("invalid key length: expected %d or %d hex characters", 2*types.SlotKeyAlgAESGCM128.KeySize(), 2*types.SlotKeyAlgAESGCM256.KeySize())
+}
+
 func validateFlags(cfg *Config) {
 	if exists, err := FileExists(cfg.From); err != nil {
 		log.Fatalf("IO error happened: %v", err)
@@ -49,11 +70,12 @@ func validateFlags(cfg *Config) {
 	}
 }
 
-func addCommonFlags(cmd *cobra.Command, overwrite *bool, key, from, to *string) {
+// Add the flags shared by encrypt and decrypt, the usage of -to differs between them
+func addCommonFlags(cmd *cobra.Command, overwrite *bool, key, from, to *string, toUsage string) {
 	cmd.Flags().BoolVarP(overwrite, "overwrite", "o", false, "Overwrite file if exists")
 	cmd.Flags().StringVarP(key, "key", "k", "", "Hex-encoded key")
 	cmd.Flags().StringVarP(from, "from", "f", "", "Input file path")
-	cmd.Flags().StringVarP(to, "to", "t", "", "Output file path")
+	cmd.Flags().StringVarP(to, "to", "t", "", toUsage)
 	cmd.MarkFlagRequired("key")
 	cmd.MarkFlagRequired("from")
 	cmd.MarkFlagRequired("to")
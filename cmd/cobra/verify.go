@@ -0,0 +1,88 @@
+package cobra
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the integrity of a file without writing the plaintext",
+	Long:  `Unseal the file and authenticate its whole content. No decrypted data is written anywhere.`,
+	Run:   verify,
+}
+
+var (
+	verifyFile     string
+	verifyKey      string
+	verifyPassword string
+)
+
+// Parameters of the verify command
+type VerifyConfig struct {
+	File     string
+	Key      []byte // Key unsealing the file
+	Password []byte // Password unsealing the file, used when Key is empty
+}
+
+var (
+	ErrVerifyCredentialMissing = errors.New("a key or a password is required")
+)
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+	verifyCmd.Flags().StringVarP(&verifyFile, "file", "f", "", "Encrypted file path")
+	verifyCmd.Flags().StringVarP(&verifyKey, "key", "k", "", "Hex-encoded key unsealing the file")
+	verifyCmd.Flags().StringVarP(&verifyPassword, "password", "p", "", "Password unsealing the file")
+	verifyCmd.MarkFlagRequired("file")
+}
+
+func verify(cmd *cobra.Command, args []string) {
+	key, err := hex.DecodeString(verifyKey)
+	if err != nil {
+		log.Fatalf("invalid hex key: %v", err)
+	}
+	cfg := &VerifyConfig{
+		File:     verifyFile,
+		Key:      key,
+		Password: []byte(verifyPassword),
+	}
+	if err := VerifyFile(cfg); err != nil {
+		log.Fatalf("Verification failed: %v", err)
+	}
+	log.Print("Verification passed")
+}
+
+// Unseal the file and authenticate its content, the plaintext is discarded
+func VerifyFile(cfg *VerifyConfig) error {
+	if len(cfg.Key) == 0 && len(cfg.Password) == 0 {
+		return ErrVerifyCredentialMissing
+	}
+	fileContainer, err := container.OpenContainerFile(cfg.File)
+	if err != nil {
+		return fmt.Errorf("error happened, while opening the file: %v", err)
+	}
+	defer fileContainer.Close()
+	switch {
+	case len(cfg.Key) != 0:
+		var alg types.SlotKeyAlgorithm
+		if alg, err = slotAlgorithmForKey(cfg.Key); err == nil {
+			err = fileContainer.Unseal(alg, cfg.Key)
+		}
+	default:
+		err = fileContainer.UnsealWithPassword(cfg.Password)
+	}
+	if err != nil {
+		return fmt.Errorf("error happened, while unsealing the file: %v", err)
+	}
+	if err := fileContainer.Verify(); err != nil {
+		return fmt.Errorf("error happened, while authenticating the content: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package cobra
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ngeojiajun/go-filecrypt/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyFile(t *testing.T) {
+	_, encCfg := encryptTestFile(t, 10000)
+	err := VerifyFile(&VerifyConfig{File: encCfg.To})
+	assert.ErrorIs(t, err, ErrVerifyCredentialMissing)
+	err = VerifyFile(&VerifyConfig{File: encCfg.To, Key: encCfg.Key})
+	assert.NoError(t, err, "the file should be intact")
+	err = VerifyFile(&VerifyConfig{File: encCfg.To, Key: make([]byte, 32)})
+	assert.Error(t, err, "a wrong key must not unseal the file")
+
+	data, err := os.ReadFile(encCfg.To)
+	assert.NoError(t, err, "cannot read the file")
+	data[len(data)-100] ^= 0x01
+	assert.NoError(t, os.WriteFile(encCfg.To, data, 0600), "cannot tamper the file")
+	err = VerifyFile(&VerifyConfig{File: encCfg.To, Key: encCfg.Key})
+	assert.ErrorIs(t, err, utils.ErrAuthenticationFailed)
+}
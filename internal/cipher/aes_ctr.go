@@ -40,6 +40,39 @@ func aesCTRNewStream(key, iv []byte) (stream cipher.Stream, err error) {
 	return
 }
 
+// Create a CTR stream positioned at the given byte offset of the keystream.
+// The counter is advanced by the number of whole blocks and the remaining bytes are skipped
+func aesCTRNewStreamAt(key, iv []byte, offset int64) (stream cipher.Stream, err error) {
+	if offset < 0 {
+		return nil, ErrInvalidLength
+	}
+	if iv == nil || len(iv) != aes.BlockSize {
+		return nil, ErrIVMissingOrInvalid
+	}
+	stream, err = aesCTRNewStream(key, AESCTRAdvanceIV(iv, uint64(offset/aes.BlockSize)))
+	if err != nil {
+		return
+	}
+	if partial := offset % aes.BlockSize; partial > 0 {
+		discard := make([]byte, partial)
+		stream.XORKeyStream(discard, discard)
+	}
+	return
+}
+
+// AESCTRAdvanceIV returns a copy of the iv where the counter is advanced by the given number of blocks.
+// The whole iv is treated as a big endian counter, the same as the one used by cipher.NewCTR
+func AESCTRAdvanceIV(iv []byte, blocks uint64) []byte {
+	counter := append([]byte(nil), iv...)
+	carry := blocks
+	for i := len(counter) - 1; i >= 0 && carry > 0; i-- {
+		sum := uint64(counter[i]) + (carry & 0xFF)
+		counter[i] = byte(sum)
+		carry = (carry >> 8) + (sum >> 8)
+	}
+	return counter
+}
+
 // Represent a stream reader where any bytes readed will be decrypted
 // TODO: allow seek
 type AESCTRStreamReader struct {
@@ -61,6 +94,20 @@ func NewAESCTRStreamReader(underlaying io.Reader, key, iv []byte, closer io.Clos
 	}, nil
 }
 
+// Create a new stream reader where the underlaying reader is positioned at the given offset of the ciphertext.
+// Optionally provide close handle
+func NewAESCTRStreamReaderAt(underlaying io.Reader, key, iv []byte, offset int64, closer io.Closer) (*AESCTRStreamReader, error) {
+	context, err := aesCTRNewStreamAt(key, iv, offset)
+	if err != nil {
+		return nil, err
+	}
+	return &AESCTRStreamReader{
+		base:    underlaying,
+		context: context,
+		closer:  closer,
+	}, nil
+}
+
 func (ctx *AESCTRStreamReader) Read(p []byte) (int, error) {
 	n, err := ctx.base.Read(p)
 	if n > 0 {
@@ -183,6 +230,8 @@ func AESCTRDecryptDirectAuthenticatedEx(key, ciphertext, iv, authKey []byte) (pl
 // Important: The authentication key should be different from the encryption key to ensure security.
 //
 // Note: The caller are responsible to save the iv for decryption later. IV must be provided and should be unique for each encryption operation.
+//
+// The plaintext reader follows the contract of XORKeyStreamApply, a reader that keeps returning (0, nil) fails with io.ErrNoProgress.
 func AESCTRStreamEncryptAuthenticatedEx(key, iv, authKey []byte, plaintext io.Reader, ciphertext io.Writer) (bytesProcessed int64, err error) {
 	if bytes.Equal(key, authKey) {
 		return 0, ErrAuthenticationKeyReused
@@ -202,10 +251,14 @@ func AESCTRStreamEncryptAuthenticatedEx(key, iv, authKey []byte, plaintext io.Re
 		return
 	}
 	// Write the authentication tag to the end of the ciphertext.
-	_, err = ciphertext.Write(h.Sum(nil))
+	tag := h.Sum(nil)
+	n, err := ciphertext.Write(tag)
 	if err != nil {
 		return 0, err
 	}
+	if n != len(tag) {
+		return 0, io.ErrShortWrite
+	}
 	return
 }
 
@@ -213,6 +266,9 @@ func AESCTRStreamEncryptAuthenticatedEx(key, iv, authKey []byte, plaintext io.Re
 // It writes the plaintext to a writer and returns the number of bytes written or an error if decryption fails or the HMAC authentication failed.
 //
 // Important: The authentication key should be different from the encryption key to ensure security. IV must be provided and should be unique for each decryption operation.
+//
+// The ciphertext reader follows the contract of XORKeyStreamApply, a reader that keeps returning (0, nil) fails with io.ErrNoProgress.
+// A stream ending before a complete tag fails with ErrTruncated, while a complete but mismatching tag fails with ErrAuthenticationFailed.
 func AESCTRStreamDecryptAuthenticatedEx(key, iv, authKey []byte, ciphertext io.Reader, plaintext io.Writer) (bytesProcessed int64, err error) {
 	if bytes.Equal(key, authKey) {
 		return 0, ErrAuthenticationKeyReused
@@ -237,6 +293,10 @@ func AESCTRStreamDecryptAuthenticatedEx(key, iv, authKey []byte, ciphertext io.R
 	if err != nil {
 		return 0, err
 	}
+	// The stream was cut short before the tag, which is not the same as being tampered
+	if len(authTag) < sha256.Size {
+		return bytesProcessed, ErrTruncated
+	}
 	// Recompute the authentication tag
 	if !hmac.Equal(authTag, h.Sum(nil)) {
 		return bytesProcessed, ErrAuthenticationFailed
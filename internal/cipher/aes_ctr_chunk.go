@@ -0,0 +1,81 @@
+package cipher
+
+// File: internal/cipher/aes_ctr_chunk.go
+// This file provides AES-CTR authenticated encryption of individual chunks.
+// Each chunk is independently encrypted and authenticated so it can be verified and replaced alone.
+//
+// Construction: iv (16 bytes) || ciphertext || HMAC-SHA256(iv || index || final || ciphertext)
+// Where index is the big endian uint64 position of the chunk and final is 1 for the last chunk.
+// Binding the index and final marker prevents chunks from being reordered or the stream from being truncated.
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// AESCTRChunkOverhead is the number of bytes added to each chunk
+const AESCTRChunkOverhead = aes.BlockSize + sha256.Size
+
+// Compute the tag of the chunk
+func aesCTRChunkTag(authKey []byte, index uint64, final bool, iv, ciphertext []byte) []byte {
+	h := hmac.New(sha256.New, authKey)
+	var meta [9]byte
+	binary.BigEndian.PutUint64(meta[:8], index)
+	if final {
+		meta[8] = 1
+	}
+	h.Write(iv)
+	h.Write(meta[:])
+	h.Write(ciphertext)
+	return h.Sum(nil)
+}
+
+// AESCTRSealChunk encrypts and authenticates a single chunk using a fresh random iv.
+// It returns the framed chunk (iv || ciphertext || tag) or an error if the operation fails.
+//
+// Important: The authentication key should be different from the encryption key to ensure security.
+func AESCTRSealChunk(key, authKey []byte, index uint64, final bool, plaintext []byte) ([]byte, error) {
+	if bytes.Equal(key, authKey) {
+		return nil, ErrAuthenticationKeyReused
+	}
+	iv, err := GenerateAESIV()
+	if err != nil {
+		return nil, err
+	}
+	stream, err := aesCTRNewStream(key, iv)
+	if err != nil {
+		return nil, err
+	}
+	chunk := make([]byte, aes.BlockSize+len(plaintext), len(plaintext)+AESCTRChunkOverhead)
+	copy(chunk, iv)
+	stream.XORKeyStream(chunk[aes.BlockSize:], plaintext)
+	chunk = append(chunk, aesCTRChunkTag(authKey, index, final, iv, chunk[aes.BlockSize:])...)
+	return chunk, nil
+}
+
+// AESCTROpenChunk verifies and decrypts a single framed chunk (iv || ciphertext || tag).
+// It returns the plaintext or ErrAuthenticationFailed when the chunk, its index or its final marker does not match.
+func AESCTROpenChunk(key, authKey []byte, index uint64, final bool, chunk []byte) ([]byte, error) {
+	if bytes.Equal(key, authKey) {
+		return nil, ErrAuthenticationKeyReused
+	}
+	if len(chunk) < AESCTRChunkOverhead {
+		return nil, ErrInvalidLength
+	}
+	iv := chunk[:aes.BlockSize]
+	ciphertext := chunk[aes.BlockSize : len(chunk)-sha256.Size]
+	tag := chunk[len(chunk)-sha256.Size:]
+	if !hmac.Equal(tag, aesCTRChunkTag(authKey, index, final, iv, ciphertext)) {
+		return nil, ErrAuthenticationFailed
+	}
+	stream, err := aesCTRNewStream(key, iv)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	stream.XORKeyStream(plaintext, ciphertext)
+	return plaintext, nil
+}
@@ -0,0 +1,36 @@
+package cipher_test
+
+import (
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test sealing and opening a chunk, with the index and final marker bound to the tag.
+func TestAESCTRChunk(t *testing.T) {
+	plaintext := []byte("This is a test message for chunks.")
+	key, err := ic.GenerateRandomBytes(32) // AES-256 key size
+	assert.NoError(t, err, "Failed to generate key")
+	authKey, err := ic.GenerateRandomBytes(32) // Different key for authentication
+	assert.NoError(t, err, "Failed to generate authkey")
+
+	chunk, err := ic.AESCTRSealChunk(key, authKey, 3, false, plaintext)
+	assert.NoError(t, err, "Encryption failed")
+	assert.Len(t, chunk, len(plaintext)+ic.AESCTRChunkOverhead)
+
+	decrypted, err := ic.AESCTROpenChunk(key, authKey, 3, false, chunk)
+	assert.NoError(t, err, "Decryption failed")
+	assert.Equal(t, plaintext, decrypted, "Decrypted text does not match original")
+
+	// Moved or marked as the last chunk
+	_, err = ic.AESCTROpenChunk(key, authKey, 4, false, chunk)
+	assert.ErrorIs(t, err, ic.ErrAuthenticationFailed)
+	_, err = ic.AESCTROpenChunk(key, authKey, 3, true, chunk)
+	assert.ErrorIs(t, err, ic.ErrAuthenticationFailed)
+
+	// Tampered
+	chunk[20] ^= 1
+	_, err = ic.AESCTROpenChunk(key, authKey, 3, false, chunk)
+	assert.ErrorIs(t, err, ic.ErrAuthenticationFailed)
+}
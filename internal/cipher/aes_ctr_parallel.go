@@ -0,0 +1,202 @@
+package cipher
+
+// File: internal/cipher/aes_ctr_parallel.go
+// This file provides the parallel AES-CTR engine for large streams.
+//
+// The stream is cut into segments aligned to the counter, every segment is XORed by its own goroutine
+// with the counter advanced to its offset, then the segments are written in order.
+// The output is byte for byte the same as the sequential engine. The HMAC stays sequential, it is computed
+// while the segments are in flight.
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"io"
+
+	_io "github.com/ngeojiajun/go-filecrypt/internal/io"
+)
+
+// Bytes processed by a worker at once, a multiple of the block size so every segment starts on a counter boundary
+const parallelSegmentSize = 256 * 1024
+
+// Segment of the stream in flight
+type ctrSegment struct {
+	data []byte
+	done chan struct{} // closed once the segment is XORed
+}
+
+// Result of the writer goroutine
+type ctrWriteResult struct {
+	written int64
+	err     error
+}
+
+// XORKeyStreamApplyParallel applies the CTR keystream of the block cipher starting at iv on the stream,
+// with up to workers segments XORed at the same time. It returns the total number of bytes written.
+// The reader and writer contracts are the same as XORKeyStreamApply, but the output is only written segment by segment.
+func XORKeyStreamApplyParallel(block cipher.Block, iv []byte, from io.Reader, to io.Writer, workers int) (int64, error) {
+	if workers <= 0 {
+		return 0, ErrInvalidLength
+	}
+	if len(iv) != block.BlockSize() {
+		return 0, ErrIVMissingOrInvalid
+	}
+	// The buffers bound the memory: workers segments in flight and one being written
+	free := make(chan []byte, workers+1)
+	for range cap(free) {
+		free <- make([]byte, parallelSegmentSize)
+	}
+	queue := make(chan *ctrSegment, workers)
+	stop := make(chan struct{})
+	result := make(chan ctrWriteResult, 1)
+	go func() {
+		var r ctrWriteResult
+		for segment := range queue {
+			<-segment.done
+			if r.err == nil && len(segment.data) > 0 {
+				n, err := to.Write(segment.data)
+				r.written += int64(n)
+				if err == nil && n != len(segment.data) {
+					err = io.ErrShortWrite
+				}
+				if err != nil {
+					r.err = err
+					// Stop reading, the segments already queued are only drained
+					close(stop)
+				}
+			}
+			free <- segment.data[:cap(segment.data)]
+		}
+		result <- r
+	}()
+	var offset uint64
+	var readErr error
+read:
+	for {
+		var buf []byte
+		select {
+		case buf = <-free:
+		case <-stop:
+			break read
+		}
+		n, err := fillSegment(from, buf)
+		segment := &ctrSegment{data: buf[:n], done: make(chan struct{})}
+		queue <- segment
+		go func(counter []byte) {
+			cipher.NewCTR(block, counter).XORKeyStream(segment.data, segment.data)
+			close(segment.done)
+		}(AESCTRAdvanceIV(iv, offset/uint64(block.BlockSize())))
+		offset += uint64(n)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			readErr = err
+			break
+		}
+	}
+	close(queue)
+	r := <-result
+	if r.err != nil {
+		return r.written, r.err
+	}
+	return r.written, readErr
+}
+
+// Fill the buffer from the reader, it is only partially filled at the end of the stream or on an error.
+// The empty reads are bounded like XORKeyStreamApply
+func fillSegment(from io.Reader, buf []byte) (int, error) {
+	n, emptyReads := 0, 0
+	for n < len(buf) {
+		read, err := from.Read(buf[n:])
+		n += read
+		if err != nil {
+			return n, err
+		}
+		if read > 0 {
+			emptyReads = 0
+			continue
+		}
+		emptyReads++
+		if emptyReads >= maxConsecutiveEmptyReads {
+			return n, io.ErrNoProgress
+		}
+	}
+	return n, nil
+}
+
+// Create the AES block cipher for the parallel engine, with the same checks as aesCTRNewStream
+func aesCTRNewParallelBlock(key, iv []byte) (cipher.Block, error) {
+	if err := AESVerifyKeySize(key); err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, ErrIVMissingOrInvalid
+	}
+	return aes.NewCipher(key)
+}
+
+// AESCTRStreamEncryptAuthenticatedParallel is AESCTRStreamEncryptAuthenticatedEx spreading the keystream on workers goroutines.
+// The output is the same, one worker falls back to the sequential engine.
+func AESCTRStreamEncryptAuthenticatedParallel(key, iv, authKey []byte, plaintext io.Reader, ciphertext io.Writer, workers int) (bytesProcessed int64, err error) {
+	if workers <= 1 {
+		return AESCTRStreamEncryptAuthenticatedEx(key, iv, authKey, plaintext, ciphertext)
+	}
+	if bytes.Equal(key, authKey) {
+		return 0, ErrAuthenticationKeyReused
+	}
+	block, err := aesCTRNewParallelBlock(key, iv)
+	if err != nil {
+		return 0, err
+	}
+	h := hmac.New(sha256.New, authKey)
+	h.Write(iv)
+	bytesProcessed, err = XORKeyStreamApplyParallel(block, iv, plaintext, io.MultiWriter(ciphertext, h), workers)
+	if err != nil {
+		return
+	}
+	tag := h.Sum(nil)
+	n, err := ciphertext.Write(tag)
+	if err != nil {
+		return 0, err
+	}
+	if n != len(tag) {
+		return 0, io.ErrShortWrite
+	}
+	return
+}
+
+// AESCTRStreamDecryptAuthenticatedParallel is AESCTRStreamDecryptAuthenticatedEx spreading the keystream on workers goroutines.
+// The errors are the same, one worker falls back to the sequential engine.
+func AESCTRStreamDecryptAuthenticatedParallel(key, iv, authKey []byte, ciphertext io.Reader, plaintext io.Writer, workers int) (bytesProcessed int64, err error) {
+	if workers <= 1 {
+		return AESCTRStreamDecryptAuthenticatedEx(key, iv, authKey, ciphertext, plaintext)
+	}
+	if bytes.Equal(key, authKey) {
+		return 0, ErrAuthenticationKeyReused
+	}
+	block, err := aesCTRNewParallelBlock(key, iv)
+	if err != nil {
+		return 0, err
+	}
+	h := hmac.New(sha256.New, authKey)
+	h.Write(iv)
+	innerCipherTextReader := _io.NewTailReader(ciphertext, sha256.Size)
+	bytesProcessed, err = XORKeyStreamApplyParallel(block, iv, io.TeeReader(innerCipherTextReader, h), plaintext, workers)
+	if err != nil {
+		return
+	}
+	authTag, err := innerCipherTextReader.Tail()
+	if err != nil {
+		return 0, err
+	}
+	if len(authTag) < sha256.Size {
+		return bytesProcessed, ErrTruncated
+	}
+	if !hmac.Equal(authTag, h.Sum(nil)) {
+		return bytesProcessed, ErrAuthenticationFailed
+	}
+	return
+}
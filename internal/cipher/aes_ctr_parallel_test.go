@@ -0,0 +1,104 @@
+package cipher_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	"github.com/stretchr/testify/assert"
+)
+
+// Writer failing once it received the given number of bytes
+type failingWriter struct {
+	remaining int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.remaining {
+		n := w.remaining
+		w.remaining = 0
+		return n, errors.New("writer failed")
+	}
+	w.remaining -= len(p)
+	return len(p), nil
+}
+
+// Test the parallel engine produces the same output as the sequential one.
+func TestAESCTRCipherAuthenticatedParallel(t *testing.T) {
+	key, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "Failed to generate key")
+	authKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "Failed to generate authentication key")
+	// The counter wraps around the low bytes in the middle of the stream
+	iv := bytes.Repeat([]byte{0xff}, aes.BlockSize)
+	iv[0] = 0x42
+	const segment = 256 * 1024
+	for _, size := range []int{0, 1, segment - 1, segment, 3*segment + 5} {
+		plaintext := bytes.Repeat([]byte{0x5a}, size)
+		expected := bytes.NewBuffer(nil)
+		_, err := ic.AESCTRStreamEncryptAuthenticatedEx(key, iv, authKey, bytes.NewReader(plaintext), expected)
+		assert.NoError(t, err, "Sequential encryption failed")
+		for _, workers := range []int{2, 4} {
+			ciphertext := bytes.NewBuffer(nil)
+			// Small reads so the segments are filled over several reads
+			n, err := ic.AESCTRStreamEncryptAuthenticatedParallel(key, iv, authKey, iotest.HalfReader(bytes.NewReader(plaintext)), ciphertext, workers)
+			assert.NoError(t, err, "Parallel encryption failed")
+			assert.Equal(t, int64(size), n)
+			assert.Equal(t, expected.Bytes(), ciphertext.Bytes(), "Parallel output differs for %d bytes", size)
+
+			decrypted := bytes.NewBuffer(nil)
+			n, err = ic.AESCTRStreamDecryptAuthenticatedParallel(key, iv, authKey, bytes.NewReader(ciphertext.Bytes()), decrypted, workers)
+			assert.NoError(t, err, "Parallel decryption failed")
+			assert.Equal(t, int64(size), n)
+			assert.True(t, bytes.Equal(plaintext, decrypted.Bytes()), "Decrypted text does not match original")
+		}
+	}
+}
+
+// Test the parallel engine still authenticates the content.
+func TestAESCTRCipherAuthenticatedParallelTampered(t *testing.T) {
+	key, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "Failed to generate key")
+	authKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "Failed to generate authentication key")
+	iv, err := ic.GenerateAESIV()
+	assert.NoError(t, err, "Failed to generate IV")
+	ciphertext := bytes.NewBuffer(nil)
+	_, err = ic.AESCTRStreamEncryptAuthenticatedParallel(key, iv, authKey, bytes.NewReader(make([]byte, 600*1024)), ciphertext, 4)
+	assert.NoError(t, err, "Parallel encryption failed")
+	tampered := ciphertext.Bytes()
+	tampered[300*1024] ^= 1
+	_, err = ic.AESCTRStreamDecryptAuthenticatedParallel(key, iv, authKey, bytes.NewReader(tampered), io.Discard, 4)
+	assert.ErrorIs(t, err, ic.ErrAuthenticationFailed)
+	_, err = ic.AESCTRStreamDecryptAuthenticatedParallel(key, iv, authKey, bytes.NewReader(tampered[:10]), io.Discard, 4)
+	assert.ErrorIs(t, err, ic.ErrTruncated)
+	_, err = ic.AESCTRStreamEncryptAuthenticatedParallel(key, iv, key, bytes.NewReader(nil), io.Discard, 4)
+	assert.ErrorIs(t, err, ic.ErrAuthenticationKeyReused)
+}
+
+// Test the errors of the reader and the writer stop the parallel engine.
+func TestXORKeyStreamApplyParallelErrors(t *testing.T) {
+	key, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "Failed to generate key")
+	iv, err := ic.GenerateAESIV()
+	assert.NoError(t, err, "Failed to generate IV")
+	block, err := aes.NewCipher(key)
+	assert.NoError(t, err, "Failed to create the block cipher")
+
+	readErr := errors.New("reader failed")
+	reader := io.MultiReader(bytes.NewReader(make([]byte, 1000)), iotest.ErrReader(readErr))
+	n, err := ic.XORKeyStreamApplyParallel(block, iv, reader, io.Discard, 4)
+	assert.ErrorIs(t, err, readErr)
+	assert.Equal(t, int64(1000), n, "the bytes read before the error must be processed")
+
+	n, err = ic.XORKeyStreamApplyParallel(block, iv, bytes.NewReader(make([]byte, 2*1024*1024)), &failingWriter{remaining: 300 * 1024}, 4)
+	assert.Error(t, err)
+	assert.Equal(t, int64(300*1024), n)
+
+	_, err = ic.XORKeyStreamApplyParallel(block, iv[:8], bytes.NewReader(nil), io.Discard, 4)
+	assert.ErrorIs(t, err, ic.ErrIVMissingOrInvalid)
+}
@@ -2,6 +2,10 @@ package cipher_test
 
 import (
 	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"errors"
 	"io"
 	"testing"
 
@@ -125,3 +129,178 @@ func TestAESCTRCipherAuthenticatedStreaming(t *testing.T) {
 	assert.Equal(t, int64(len(text)), written, "Short write detected")
 	assert.Equal(t, text, decrypted.String(), "Decrypted text does not match original")
 }
+
+// Test that a truncated stream is reported differently from a tampered one.
+func TestAESCTRCipherAuthenticatedStreamingTruncated(t *testing.T) {
+	const text string = "This is a test message for truncation."
+	key, err := ic.GenerateRandomBytes(32) // AES-256 key size
+	assert.NoError(t, err, "Failed to generate key")
+	iv, err := ic.GenerateRandomBytes(16) // AES block size for CTR mode
+	assert.NoError(t, err, "Failed to generate IV")
+	authKey, err := ic.GenerateRandomBytes(32) // Different key for authentication
+	assert.NoError(t, err, "Failed to generate authkey")
+
+	ciphertext := bytes.NewBuffer(nil)
+	_, err = ic.AESCTRStreamEncryptAuthenticatedEx(key, iv, authKey, bytes.NewReader([]byte(text)), ciphertext)
+	assert.NoError(t, err, "Encryption failed")
+
+	// Cut inside the tag
+	truncated := ciphertext.Bytes()[:sha256.Size-1]
+	_, err = ic.AESCTRStreamDecryptAuthenticatedEx(key, iv, authKey, bytes.NewReader(truncated), io.Discard)
+	assert.ErrorIs(t, err, ic.ErrTruncated)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.NotErrorIs(t, err, ic.ErrAuthenticationFailed)
+
+	// Cut inside the ciphertext, the trailing bytes are then taken as a full but wrong tag
+	truncated = ciphertext.Bytes()[:ciphertext.Len()-1]
+	_, err = ic.AESCTRStreamDecryptAuthenticatedEx(key, iv, authKey, bytes.NewReader(truncated), io.Discard)
+	assert.ErrorIs(t, err, ic.ErrAuthenticationFailed)
+
+	tampered := bytes.Clone(ciphertext.Bytes())
+	tampered[0] ^= 0x01
+	_, err = ic.AESCTRStreamDecryptAuthenticatedEx(key, iv, authKey, bytes.NewReader(tampered), io.Discard)
+	assert.ErrorIs(t, err, ic.ErrAuthenticationFailed)
+	assert.NotErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+// A reader which returns (0, nil) on every other call before handing out data
+type stutteringReader struct {
+	r     io.Reader
+	calls int
+}
+
+func (s *stutteringReader) Read(p []byte) (int, error) {
+	s.calls++
+	if s.calls%2 == 1 {
+		return 0, nil
+	}
+	return s.r.Read(p)
+}
+
+// A reader which never makes progress
+type stalledReader struct{}
+
+func (stalledReader) Read(p []byte) (int, error) {
+	return 0, nil
+}
+
+// Test AES-CTR authenticated streaming with a reader occasionally returning (0, nil).
+func TestAESCTRCipherAuthenticatedStreamingEmptyReads(t *testing.T) {
+	const text string = "This is a test message for readers without progress."
+	key, err := ic.GenerateRandomBytes(32) // AES-256 key size
+	assert.NoError(t, err, "Failed to generate key")
+	iv, err := ic.GenerateRandomBytes(16) // AES block size for CTR mode
+	assert.NoError(t, err, "Failed to generate IV")
+	authKey, err := ic.GenerateRandomBytes(32) // Different key for authentication
+	assert.NoError(t, err, "Failed to generate authkey")
+
+	ciphertext := bytes.NewBuffer(nil)
+	plaintext := &stutteringReader{r: bytes.NewReader([]byte(text))}
+	written, err := ic.AESCTRStreamEncryptAuthenticatedEx(key, iv, authKey, plaintext, ciphertext)
+	assert.NoError(t, err, "Encryption failed")
+	assert.Equal(t, int64(len(text)), written, "Short write detected")
+
+	decrypted := bytes.NewBuffer(nil)
+	_, err = ic.AESCTRStreamDecryptAuthenticatedEx(key, iv, authKey, &stutteringReader{r: ciphertext}, decrypted)
+	assert.NoError(t, err, "Decryption failed")
+	assert.Equal(t, text, decrypted.String(), "Decrypted text does not match original")
+
+	// A reader never making progress must not livelock
+	_, err = ic.AESCTRStreamEncryptAuthenticatedEx(key, iv, authKey, stalledReader{}, io.Discard)
+	assert.ErrorIs(t, err, io.ErrNoProgress)
+}
+
+// Test decrypting from arbitrary offsets of the ciphertext.
+func TestAESCTRCipherStreamingAt(t *testing.T) {
+	plaintext, err := ic.GenerateRandomBytes(1000)
+	assert.NoError(t, err, "Failed to generate plaintext")
+	key, err := ic.GenerateRandomBytes(32) // AES-256 key size
+	assert.NoError(t, err, "Failed to generate key")
+	// Make sure the counter carries across the bytes
+	iv := bytes.Repeat([]byte{0xFF}, 16)
+
+	ciphertext, err := ic.AESCTREncryptDirect(key, plaintext, iv)
+	assert.NoError(t, err, "Encryption failed")
+
+	for _, offset := range []int64{0, 1, 15, 16, 17, 500, 999} {
+		stream, err := ic.NewAESCTRStreamReaderAt(bytes.NewReader(ciphertext[offset:]), key, iv, offset, nil)
+		assert.NoError(t, err, "Cannot create decryption stream")
+		decrypted, err := io.ReadAll(stream)
+		assert.NoError(t, err, "Decryption failed")
+		assert.Equal(t, plaintext[offset:], decrypted, "Decrypted text does not match original at offset %d", offset)
+	}
+}
+
+// Reader returning its whole data together with the error in a single call
+type dataWithErrorReader struct {
+	data []byte
+	err  error
+}
+
+func (r *dataWithErrorReader) Read(p []byte) (int, error) {
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	if len(r.data) == 0 {
+		return n, r.err
+	}
+	return n, nil
+}
+
+// Test the bytes returned together with an error are not dropped.
+func TestXORKeyStreamApplyDataWithError(t *testing.T) {
+	const text string = "This is a test message for readers returning data with the error."
+	key, err := ic.GenerateRandomBytes(32) // AES-256 key size
+	assert.NoError(t, err, "Failed to generate key")
+	iv, err := ic.GenerateRandomBytes(16) // AES block size for CTR mode
+	assert.NoError(t, err, "Failed to generate IV")
+	expected, err := ic.AESCTREncryptDirect(key, []byte(text), iv)
+	assert.NoError(t, err, "Encryption failed")
+
+	newStream := func() cipher.Stream {
+		block, err := aes.NewCipher(key)
+		assert.NoError(t, err, "Failed to create the cipher")
+		return cipher.NewCTR(block, iv)
+	}
+
+	// (n > 0, io.EOF) ends the stream successfully
+	ciphertext := bytes.NewBuffer(nil)
+	written, err := ic.XORKeyStreamApply(newStream(), &dataWithErrorReader{data: []byte(text), err: io.EOF}, ciphertext, 1024)
+	assert.NoError(t, err, "Encryption failed")
+	assert.Equal(t, int64(len(text)), written, "Short write detected")
+	assert.Equal(t, expected, ciphertext.Bytes())
+
+	// (n > 0, err) still writes the bytes before failing
+	failure := errors.New("read failure")
+	ciphertext.Reset()
+	written, err = ic.XORKeyStreamApply(newStream(), &dataWithErrorReader{data: []byte(text), err: failure}, ciphertext, 1024)
+	assert.ErrorIs(t, err, failure)
+	assert.Equal(t, int64(len(text)), written, "Short write detected")
+	assert.Equal(t, expected, ciphertext.Bytes())
+}
+
+// Writer accepting at most limit bytes per call without reporting an error
+type shortWriter struct {
+	limit int
+	buf   bytes.Buffer
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p[:min(len(p), w.limit)])
+}
+
+// Test a short write without error is not silently ignored.
+func TestXORKeyStreamApplyShortWrite(t *testing.T) {
+	key, err := ic.GenerateRandomBytes(32) // AES-256 key size
+	assert.NoError(t, err, "Failed to generate key")
+	iv, err := ic.GenerateRandomBytes(16) // AES block size for CTR mode
+	assert.NoError(t, err, "Failed to generate IV")
+	authKey, err := ic.GenerateRandomBytes(32) // Different key for authentication
+	assert.NoError(t, err, "Failed to generate authkey")
+	plaintext, err := ic.GenerateRandomBytes(1000)
+	assert.NoError(t, err, "Failed to generate plaintext")
+
+	writer := &shortWriter{limit: 100}
+	written, err := ic.AESCTRStreamEncryptAuthenticatedEx(key, iv, authKey, bytes.NewReader(plaintext), writer)
+	assert.ErrorIs(t, err, io.ErrShortWrite)
+	assert.Equal(t, int64(writer.buf.Len()), written, "The bytes accepted must be reported")
+}
@@ -0,0 +1,53 @@
+package cipher
+
+// File: internal/cipher/aes_gcm_chunk.go
+// This file provides AES-GCM encryption of individual chunks, the AEAD counterpart of aes_ctr_chunk.go.
+//
+// Construction: nonce (12 bytes) || ciphertext || tag (16 bytes), where index || final is the additional data.
+// Index is the big endian uint64 position of the chunk and final is 1 for the last chunk,
+// binding them prevents chunks from being reordered or the stream from being truncated.
+// The nonce is random so a chunk can be encrypted again in place under the same key.
+
+import (
+	"encoding/binary"
+)
+
+// AESGCMChunkOverhead is the number of bytes added to each chunk
+const AESGCMChunkOverhead = 12 + 16
+
+// Additional data binding the position of the chunk
+func aeadChunkAdditionalData(index uint64, final bool) []byte {
+	var meta [9]byte
+	binary.BigEndian.PutUint64(meta[:8], index)
+	if final {
+		meta[8] = 1
+	}
+	return meta[:]
+}
+
+// AESGCMSealChunk encrypts and authenticates a single chunk using a fresh random nonce.
+// It returns the framed chunk (nonce || ciphertext || tag) or an error if the operation fails.
+func AESGCMSealChunk(key []byte, index uint64, final bool, plaintext []byte) ([]byte, error) {
+	gcm, err := aesGCMCreateHandles(key, nil)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nil, nil, plaintext, aeadChunkAdditionalData(index, final)), nil
+}
+
+// AESGCMOpenChunk verifies and decrypts a single framed chunk (nonce || ciphertext || tag).
+// It returns the plaintext or ErrAEADAuthenticationFailed when the chunk, its index or its final marker does not match.
+func AESGCMOpenChunk(key []byte, index uint64, final bool, chunk []byte) ([]byte, error) {
+	if len(chunk) < AESGCMChunkOverhead {
+		return nil, ErrInvalidLength
+	}
+	gcm, err := aesGCMCreateHandles(key, nil)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, nil, chunk, aeadChunkAdditionalData(index, final))
+	if err != nil {
+		return nil, ErrAEADAuthenticationFailed
+	}
+	return plaintext, nil
+}
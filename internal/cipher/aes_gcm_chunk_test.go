@@ -0,0 +1,38 @@
+package cipher_test
+
+import (
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test sealing and opening a GCM chunk, with the index and final marker bound as additional data.
+func TestAESGCMChunk(t *testing.T) {
+	plaintext := []byte("This is a test message for chunks.")
+	key, err := ic.GenerateRandomBytes(16) // AES-128 key size
+	assert.NoError(t, err, "Failed to generate key")
+
+	chunk, err := ic.AESGCMSealChunk(key, 3, false, plaintext)
+	assert.NoError(t, err, "Encryption failed")
+	assert.Len(t, chunk, len(plaintext)+ic.AESGCMChunkOverhead)
+
+	decrypted, err := ic.AESGCMOpenChunk(key, 3, false, chunk)
+	assert.NoError(t, err, "Decryption failed")
+	assert.Equal(t, plaintext, decrypted, "Decrypted text does not match original")
+
+	// Moved or marked as the last chunk
+	_, err = ic.AESGCMOpenChunk(key, 4, false, chunk)
+	assert.ErrorIs(t, err, ic.ErrAEADAuthenticationFailed)
+	_, err = ic.AESGCMOpenChunk(key, 3, true, chunk)
+	assert.ErrorIs(t, err, ic.ErrAEADAuthenticationFailed)
+
+	// Tampered
+	chunk[20] ^= 1
+	_, err = ic.AESGCMOpenChunk(key, 3, false, chunk)
+	assert.ErrorIs(t, err, ic.ErrAEADAuthenticationFailed)
+
+	// Too short to hold the nonce and the tag
+	_, err = ic.AESGCMOpenChunk(key, 3, false, chunk[:ic.AESGCMChunkOverhead-1])
+	assert.ErrorIs(t, err, ic.ErrInvalidLength)
+}
@@ -0,0 +1,227 @@
+package cipher
+
+// File: internal/cipher/aes_gcm_siv.go
+// This file provides AES-GCM-SIV (RFC 8452), a nonce-misuse-resistant AEAD.
+// The tag is computed over the plaintext first and then used as the CTR counter, so reusing a nonce
+// only reveals whether two messages are identical instead of breaking the confidentiality like GCM does.
+// It is intended for wrapping small secrets such as root keys, the implementation favours clarity over speed.
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+)
+
+const (
+	aesGCMSIVNonceSize = 12
+	aesGCMSIVTagSize   = 16
+)
+
+type aesGCMSIV struct {
+	keyGeneratingKey cipher.Block
+	keySize          int
+}
+
+// NewAESGCMSIV creates an AES-GCM-SIV AEAD from a 16 or 32 bytes key generating key.
+func NewAESGCMSIV(key []byte) (cipher.AEAD, error) {
+	if len(key) != 16 && len(key) != 32 {
+		return nil, ErrAESKeySizeMismatch
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &aesGCMSIV{keyGeneratingKey: block, keySize: len(key)}, nil
+}
+
+func (a *aesGCMSIV) NonceSize() int {
+	return aesGCMSIVNonceSize
+}
+
+func (a *aesGCMSIV) Overhead() int {
+	return aesGCMSIVTagSize
+}
+
+// Derive the per nonce authentication and encryption keys
+func (a *aesGCMSIV) deriveKeys(nonce []byte) (authKey []byte, encBlock cipher.Block, err error) {
+	var input, output [aes.BlockSize]byte
+	copy(input[4:], nonce)
+	derived := make([]byte, 0, 16+a.keySize)
+	for i := uint32(0); len(derived) < cap(derived); i++ {
+		binary.LittleEndian.PutUint32(input[:4], i)
+		a.keyGeneratingKey.Encrypt(output[:], input[:])
+		derived = append(derived, output[:8]...)
+	}
+	defer WipeBufferSecure(derived)
+	encBlock, err = aes.NewCipher(derived[16:])
+	if err != nil {
+		return nil, nil, err
+	}
+	return append([]byte(nil), derived[:16]...), encBlock, nil
+}
+
+// Compute the tag of the plaintext
+func (a *aesGCMSIV) tag(authKey []byte, encBlock cipher.Block, nonce, plaintext, additionalData []byte) []byte {
+	var lengths [aes.BlockSize]byte
+	binary.LittleEndian.PutUint64(lengths[:8], uint64(len(additionalData))*8)
+	binary.LittleEndian.PutUint64(lengths[8:], uint64(len(plaintext))*8)
+	p := newPolyval(authKey)
+	p.update(additionalData)
+	p.update(plaintext)
+	p.update(lengths[:])
+	s := p.sum()
+	for i := range nonce {
+		s[i] ^= nonce[i]
+	}
+	s[15] &= 0x7f
+	tag := make([]byte, aesGCMSIVTagSize)
+	encBlock.Encrypt(tag, s[:])
+	return tag
+}
+
+// Apply the keystream using the tag as the initial counter, the counter is the little endian first 32 bits
+func aesGCMSIVCTR(encBlock cipher.Block, tag, dst, src []byte) {
+	var counter, keystream [aes.BlockSize]byte
+	copy(counter[:], tag)
+	counter[15] |= 0x80
+	for len(src) > 0 {
+		encBlock.Encrypt(keystream[:], counter[:])
+		n := subtle.XORBytes(dst, src, keystream[:])
+		dst, src = dst[n:], src[n:]
+		binary.LittleEndian.PutUint32(counter[:4], binary.LittleEndian.Uint32(counter[:4])+1)
+	}
+}
+
+func (a *aesGCMSIV) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != aesGCMSIVNonceSize {
+		panic("cipher: incorrect nonce length given to AES-GCM-SIV")
+	}
+	authKey, encBlock, err := a.deriveKeys(nonce)
+	if err != nil {
+		panic(err)
+	}
+	defer WipeBufferSecure(authKey)
+	tag := a.tag(authKey, encBlock, nonce, plaintext, additionalData)
+	out := make([]byte, len(plaintext)+aesGCMSIVTagSize)
+	aesGCMSIVCTR(encBlock, tag, out, plaintext)
+	copy(out[len(plaintext):], tag)
+	return append(dst, out...)
+}
+
+func (a *aesGCMSIV) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != aesGCMSIVNonceSize {
+		return nil, ErrGCMNonceSizeMismatch
+	}
+	if len(ciphertext) < aesGCMSIVTagSize {
+		return nil, ErrAEADAuthenticationFailed
+	}
+	authKey, encBlock, err := a.deriveKeys(nonce)
+	if err != nil {
+		return nil, err
+	}
+	defer WipeBufferSecure(authKey)
+	tag := ciphertext[len(ciphertext)-aesGCMSIVTagSize:]
+	ciphertext = ciphertext[:len(ciphertext)-aesGCMSIVTagSize]
+	plaintext := make([]byte, len(ciphertext))
+	aesGCMSIVCTR(encBlock, tag, plaintext, ciphertext)
+	if subtle.ConstantTimeCompare(tag, a.tag(authKey, encBlock, nonce, plaintext, additionalData)) != 1 {
+		WipeBufferSecure(plaintext)
+		return nil, ErrAEADAuthenticationFailed
+	}
+	return append(dst, plaintext...), nil
+}
+
+// AESGCMSIVEncryptDirect encrypts plaintext using AES GCM-SIV with the provided key and nonce.
+// It returns the ciphertext or an error if encryption fails.
+//
+// Note: When nonce is nil, a random nonce is generated and prepended to the ciphertext.
+func AESGCMSIVEncryptDirect(key, plaintext, nonce []byte) (cipherText []byte, err error) {
+	aead, err := NewAESGCMSIV(key)
+	if err != nil {
+		return
+	}
+	if nonce != nil {
+		if len(nonce) != aead.NonceSize() {
+			return nil, ErrGCMNonceSizeMismatch
+		}
+		return aead.Seal(nil, nonce, plaintext, nil), nil
+	}
+	randomNonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(randomNonce); err != nil {
+		return
+	}
+	return aead.Seal(randomNonce, randomNonce, plaintext, nil), nil
+}
+
+// AESGCMSIVDecryptDirect decrypts ciphertext using AES GCM-SIV with the provided key and nonce.
+// It returns the plaintext or an error if decryption fails.
+//
+// Note: When nonce is nil, the nonce is taken from the front of the ciphertext.
+func AESGCMSIVDecryptDirect(key, ciphertext, nonce []byte) (plaintext []byte, err error) {
+	aead, err := NewAESGCMSIV(key)
+	if err != nil {
+		return
+	}
+	if nonce == nil {
+		if len(ciphertext) < aead.NonceSize() {
+			return nil, ErrAEADAuthenticationFailed
+		}
+		nonce, ciphertext = ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	}
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// POLYVAL universal hash from RFC 8452, elements are 128 bits little endian polynomials
+// modulo x^128 + x^127 + x^126 + x^121 + 1
+type polyval struct {
+	hLo, hHi uint64
+	sLo, sHi uint64
+}
+
+func newPolyval(key []byte) *polyval {
+	return &polyval{
+		hLo: binary.LittleEndian.Uint64(key[:8]),
+		hHi: binary.LittleEndian.Uint64(key[8:16]),
+	}
+}
+
+// Absorb the data zero padded to the block size
+func (p *polyval) update(data []byte) {
+	for len(data) > 0 {
+		var block [16]byte
+		n := copy(block[:], data)
+		data = data[n:]
+		p.sLo ^= binary.LittleEndian.Uint64(block[:8])
+		p.sHi ^= binary.LittleEndian.Uint64(block[8:])
+		p.sLo, p.sHi = polyvalDot(p.sLo, p.sHi, p.hLo, p.hHi)
+	}
+}
+
+func (p *polyval) sum() [16]byte {
+	var out [16]byte
+	binary.LittleEndian.PutUint64(out[:8], p.sLo)
+	binary.LittleEndian.PutUint64(out[8:], p.sHi)
+	return out
+}
+
+// Compute a * b * x^-128, bit by bit without secret dependent branches
+func polyvalDot(aLo, aHi, bLo, bHi uint64) (rLo, rHi uint64) {
+	for i := 0; i < 128; i++ {
+		var bit uint64
+		if i < 64 {
+			bit = (bLo >> i) & 1
+		} else {
+			bit = (bHi >> (i - 64)) & 1
+		}
+		mask := -bit
+		rLo ^= aLo & mask
+		rHi ^= aHi & mask
+		// Multiply r by x^-1
+		reduce := -(rLo & 1)
+		rLo = rLo>>1 | rHi<<63
+		rHi = rHi>>1 ^ (0xE100000000000000 & reduce)
+	}
+	return
+}
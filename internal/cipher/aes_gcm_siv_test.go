@@ -0,0 +1,50 @@
+package cipher_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	"github.com/stretchr/testify/assert"
+)
+
+// Known answer tests from RFC 8452 appendix C
+func TestAESGCMSIVKnownAnswer(t *testing.T) {
+	vectors := []struct {
+		key, nonce, plaintext, result string
+	}{
+		{"01000000000000000000000000000000", "030000000000000000000000", "", "dc20e2d83f25705bb49e439eca56de25"},
+		{"01000000000000000000000000000000", "030000000000000000000000", "0100000000000000", "b5d839330ac7b786578782fff6013b815b287c22493a364c"},
+		{"0100000000000000000000000000000000000000000000000000000000000000", "030000000000000000000000", "", "07f5f4169bbf55a8400cd47ea6fd400f"},
+		{"0100000000000000000000000000000000000000000000000000000000000000", "030000000000000000000000", "0100000000000000", "c2ef328e5c71c83b843122130f7364b761e0b97427e3df28"},
+	}
+	for _, vector := range vectors {
+		key, _ := hex.DecodeString(vector.key)
+		nonce, _ := hex.DecodeString(vector.nonce)
+		plaintext, _ := hex.DecodeString(vector.plaintext)
+		ciphertext, err := ic.AESGCMSIVEncryptDirect(key, plaintext, nonce)
+		assert.NoError(t, err, "Encryption failed")
+		assert.Equal(t, vector.result, hex.EncodeToString(ciphertext))
+		decrypted, err := ic.AESGCMSIVDecryptDirect(key, ciphertext, nonce)
+		assert.NoError(t, err, "Decryption failed")
+		assert.Equal(t, vector.plaintext, hex.EncodeToString(decrypted))
+	}
+}
+
+// Round trip using a random nonce, then make sure tampering is detected
+func TestAESGCMSIVRoundTrip(t *testing.T) {
+	key, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "Failed to generate key")
+	plaintext, err := ic.GenerateRandomBytes(100)
+	assert.NoError(t, err, "Failed to generate plaintext")
+
+	ciphertext, err := ic.AESGCMSIVEncryptDirect(key, plaintext, nil)
+	assert.NoError(t, err, "Encryption failed")
+	decrypted, err := ic.AESGCMSIVDecryptDirect(key, ciphertext, nil)
+	assert.NoError(t, err, "Decryption failed")
+	assert.Equal(t, plaintext, decrypted, "Decrypted text does not match original")
+
+	ciphertext[len(ciphertext)/2] ^= 0x01
+	_, err = ic.AESGCMSIVDecryptDirect(key, ciphertext, nil)
+	assert.ErrorIs(t, err, ic.ErrAEADAuthenticationFailed)
+}
@@ -0,0 +1,21 @@
+//go:build !no_argon2
+
+package cipher
+
+// File: internal/cipher/argon2id.go
+// This file provides Argon2id (RFC 9106), the memory-hard function deriving keys from passphrases.
+// It is left out of the builds tagged no_argon2.
+
+import (
+	"golang.org/x/crypto/argon2"
+)
+
+func init() {
+	registerPrimitive(PrimitiveArgon2id)
+}
+
+// Argon2IDKey derives a key of keyLen bytes from the password and the salt.
+// The memory is in KiB and is raised to 8 KiB per thread, time and threads must not be zero
+func Argon2IDKey(password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) ([]byte, error) {
+	return argon2.IDKey(password, salt, time, memory, threads, keyLen), nil
+}
@@ -0,0 +1,11 @@
+//go:build no_argon2
+
+package cipher
+
+// File: internal/cipher/argon2id_absent.go
+// This file stands in for Argon2id in the builds tagged no_argon2.
+
+// Argon2IDKey always fails with ErrNotCompiledIn in this build.
+func Argon2IDKey(password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) ([]byte, error) {
+	return nil, ErrNotCompiledIn
+}
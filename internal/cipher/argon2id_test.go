@@ -0,0 +1,44 @@
+//go:build !no_argon2
+
+package cipher_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	"github.com/stretchr/testify/assert"
+)
+
+// Known answer tests generated with the reference implementation of Argon2
+func TestArgon2IDKnownAnswer(t *testing.T) {
+	vectors := []struct {
+		time, memory uint32
+		threads      uint8
+		result       string
+	}{
+		{1, 64, 1, "655ad15eac652dc59f7170a7332bf49b8469be1fdb9c28bb"},
+		{2, 64, 1, "068d62b26455936aa6ebe60060b0a65870dbfa3ddf8d41f7"},
+		{2, 64, 2, "350ac37222f436ccb5c0972f1ebd3bf6b958bf2071841362"},
+		{3, 256, 2, "4668d30ac4187e6878eedeacf0fd83c5a0a30db2cc16ef0b"},
+		{4, 4096, 4, "145db9733a9f4ee43edf33c509be96b934d505a4efb33c5a"},
+		{4, 1024, 8, "8dafa8e004f8ea96bf7c0f93eecf67a6047476143d15577f"},
+		{2, 64, 3, "4a15b31aec7c2590b87d1f520be7d96f56658172deaa3079"},
+		{3, 1024, 6, "1640b932f4b60e272f5d2207b9a9c626ffa1bd88d2349016"},
+	}
+	for _, vector := range vectors {
+		key, err := ic.Argon2IDKey([]byte("password"), []byte("somesalt"), vector.time, vector.memory, vector.threads, uint32(len(vector.result)/2))
+		assert.NoError(t, err, "Failed to derive the key")
+		assert.Equal(t, vector.result, hex.EncodeToString(key))
+	}
+}
+
+// Keys longer than a BLAKE2b digest go through the variable-length hash
+func TestArgon2IDLongKey(t *testing.T) {
+	key, err := ic.Argon2IDKey([]byte("password"), []byte("somesalt"), 1, 64, 1, 100)
+	assert.NoError(t, err, "Failed to derive the key")
+	assert.Len(t, key, 100)
+	other, err := ic.Argon2IDKey([]byte("passwore"), []byte("somesalt"), 1, 64, 1, 100)
+	assert.NoError(t, err, "Failed to derive the key")
+	assert.NotEqual(t, key, other)
+}
@@ -0,0 +1,45 @@
+//go:build !no_chacha20poly1305
+
+package cipher
+
+// File: internal/cipher/chacha20poly1305.go
+// This file provides ChaCha20-Poly1305 (RFC 8439), an AEAD running in constant time without AES hardware acceleration.
+// It is left out of the builds tagged no_chacha20poly1305.
+
+import (
+	"crypto/cipher"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func init() {
+	registerPrimitive(PrimitiveChaCha20Poly1305)
+}
+
+// Reports the errors of the package with the ones of this package
+type chaCha20Poly1305 struct {
+	cipher.AEAD
+}
+
+// NewChaCha20Poly1305 creates a ChaCha20-Poly1305 AEAD from a 32 bytes key.
+func NewChaCha20Poly1305(key []byte) (cipher.AEAD, error) {
+	if len(key) != chacha20poly1305.KeySize {
+		return nil, ErrKeySizeInvalid
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return &chaCha20Poly1305{aead}, nil
+}
+
+func (c *chaCha20Poly1305) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != chacha20poly1305.NonceSize {
+		return nil, ErrGCMNonceSizeMismatch
+	}
+	plaintext, err := c.AEAD.Open(dst, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrAEADAuthenticationFailed
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,15 @@
+//go:build no_chacha20poly1305
+
+package cipher
+
+// File: internal/cipher/chacha20poly1305_absent.go
+// This file stands in for ChaCha20-Poly1305 in the builds tagged no_chacha20poly1305.
+
+import (
+	"crypto/cipher"
+)
+
+// NewChaCha20Poly1305 always fails with ErrNotCompiledIn in this build.
+func NewChaCha20Poly1305(key []byte) (cipher.AEAD, error) {
+	return nil, ErrNotCompiledIn
+}
@@ -0,0 +1,43 @@
+package cipher
+
+// File: internal/cipher/chacha20poly1305_chunk.go
+// This file frames the chunks sealed by ChaCha20-Poly1305, the same way as the AES-GCM chunks.
+
+import (
+	"crypto/rand"
+)
+
+const (
+	chaCha20NonceSize = 12
+	poly1305TagSize   = 16
+)
+
+// ChaCha20Poly1305ChunkOverhead is the number of bytes added to each chunk
+const ChaCha20Poly1305ChunkOverhead = chaCha20NonceSize + poly1305TagSize
+
+// ChaCha20Poly1305SealChunk encrypts and authenticates a single chunk using a fresh random nonce.
+// It returns the framed chunk (nonce || ciphertext || tag) or an error if the operation fails.
+func ChaCha20Poly1305SealChunk(key []byte, index uint64, final bool, plaintext []byte) ([]byte, error) {
+	aead, err := NewChaCha20Poly1305(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, chaCha20NonceSize, len(plaintext)+ChaCha20Poly1305ChunkOverhead)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aeadChunkAdditionalData(index, final)), nil
+}
+
+// ChaCha20Poly1305OpenChunk verifies and decrypts a single framed chunk (nonce || ciphertext || tag).
+// It returns the plaintext or ErrAEADAuthenticationFailed when the chunk, its index or its final marker does not match.
+func ChaCha20Poly1305OpenChunk(key []byte, index uint64, final bool, chunk []byte) ([]byte, error) {
+	if len(chunk) < ChaCha20Poly1305ChunkOverhead {
+		return nil, ErrInvalidLength
+	}
+	aead, err := NewChaCha20Poly1305(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, chunk[:chaCha20NonceSize], chunk[chaCha20NonceSize:], aeadChunkAdditionalData(index, final))
+}
@@ -0,0 +1,66 @@
+//go:build !no_chacha20poly1305
+
+package cipher_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	"github.com/stretchr/testify/assert"
+)
+
+// Known answer test from RFC 8439 section 2.8.2
+func TestChaCha20Poly1305KnownAnswer(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = 0x80 + byte(i)
+	}
+	nonce, _ := hex.DecodeString("070000004041424344454647")
+	additionalData, _ := hex.DecodeString("50515253c0c1c2c3c4c5c6c7")
+	plaintext := []byte("Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it.")
+	const expected = "d31a8d34648e60db7b86afbc53ef7ec2a4aded51296e08fea9e2b5a736ee62d63dbea45e8ca9671282fafb69da92728b" +
+		"1a71de0a9e060b2905d6a5b67ecd3b3692ddbd7f2d778b8c9803aee328091b58fab324e4fad675945585808b4831d7bc3ff4def08e4b7a9de576d26586cec64b6116" +
+		"1ae10b594f09e26a7e902ecbd0600691"
+
+	aead, err := ic.NewChaCha20Poly1305(key)
+	assert.NoError(t, err, "Cannot create the AEAD")
+	ciphertext := aead.Seal(nil, nonce, plaintext, additionalData)
+	assert.Equal(t, expected, hex.EncodeToString(ciphertext))
+	decrypted, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	assert.NoError(t, err, "Decryption failed")
+	assert.Equal(t, plaintext, decrypted)
+
+	ciphertext[0] ^= 0x01
+	_, err = aead.Open(nil, nonce, ciphertext, additionalData)
+	assert.ErrorIs(t, err, ic.ErrAEADAuthenticationFailed)
+
+	_, err = ic.NewChaCha20Poly1305(key[:16])
+	assert.ErrorIs(t, err, ic.ErrKeySizeInvalid)
+}
+
+// Test sealing and opening a ChaCha20-Poly1305 chunk, with the index and final marker bound as additional data.
+func TestChaCha20Poly1305Chunk(t *testing.T) {
+	plaintext := []byte("This is a test message for chunks.")
+	key, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "Failed to generate key")
+
+	chunk, err := ic.ChaCha20Poly1305SealChunk(key, 3, false, plaintext)
+	assert.NoError(t, err, "Encryption failed")
+	assert.Len(t, chunk, len(plaintext)+ic.ChaCha20Poly1305ChunkOverhead)
+
+	decrypted, err := ic.ChaCha20Poly1305OpenChunk(key, 3, false, chunk)
+	assert.NoError(t, err, "Decryption failed")
+	assert.Equal(t, plaintext, decrypted, "Decrypted text does not match original")
+
+	// Moved or marked as the last chunk
+	_, err = ic.ChaCha20Poly1305OpenChunk(key, 4, false, chunk)
+	assert.ErrorIs(t, err, ic.ErrAEADAuthenticationFailed)
+	_, err = ic.ChaCha20Poly1305OpenChunk(key, 3, true, chunk)
+	assert.ErrorIs(t, err, ic.ErrAEADAuthenticationFailed)
+
+	// Tampered
+	chunk[20] ^= 1
+	_, err = ic.ChaCha20Poly1305OpenChunk(key, 3, false, chunk)
+	assert.ErrorIs(t, err, ic.ErrAEADAuthenticationFailed)
+}
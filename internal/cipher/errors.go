@@ -5,6 +5,8 @@ package cipher
 
 import (
 	"errors"
+	"fmt"
+	"io"
 )
 
 var (
@@ -23,13 +25,25 @@ var (
 	// ErrAuthenticationFailed is returned when HMAC authentication fails.
 	ErrAuthenticationFailed = errors.New("authentication failed, HMAC tag does not match")
 
+	// ErrAEADAuthenticationFailed is returned when the tag of an AEAD ciphertext does not match.
+	ErrAEADAuthenticationFailed = errors.New("authentication failed, AEAD tag does not match")
+
 	// ErrAuthenticationKeyReused is returned when the authentication key is reused as the encryption key.
 	ErrAuthenticationKeyReused = errors.New("authentication key should be different from the encryption key to ensure security")
 
 	// ErrInvalidLength is returned when the length of the provided data is invalid.
 	ErrInvalidLength = errors.New("invalid length specified for the operation")
 
+	// ErrTruncated is returned when the stream ends before the authentication tag, it wraps io.ErrUnexpectedEOF.
+	ErrTruncated = fmt.Errorf("the ciphertext is truncated: %w", io.ErrUnexpectedEOF)
+
 	ErrInternalError = errors.New("internal error occurred, please check the implementation")
 
 	ErrKeySizeInvalid = errors.New("the size of the key provided is not compatible with the mode specified")
+
+	// ErrNotCompiledIn is returned by the primitives left out of the build by their build tag.
+	ErrNotCompiledIn = errors.New("the primitive is not compiled into this build")
+
+	// ErrScryptParamsInvalid is returned when the cost parameters of scrypt are out of range.
+	ErrScryptParamsInvalid = errors.New("scrypt: invalid cost parameters")
 )
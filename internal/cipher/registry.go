@@ -0,0 +1,28 @@
+package cipher
+
+// File: internal/cipher/registry.go
+// This file keeps the registry of the primitives coming from golang.org/x/crypto.
+// Each of them lives in a file excluded by its build tag (no_argon2, no_scrypt or no_chacha20poly1305), so a build
+// vendoring only a subset of golang.org/x/crypto still compiles. The file registers the primitive when it is compiled in,
+// otherwise its functions return ErrNotCompiledIn.
+
+// Identifier of a primitive which can be left out of the build
+type Primitive uint8
+
+const (
+	PrimitiveArgon2id         Primitive = iota // Argon2id of golang.org/x/crypto/argon2
+	PrimitiveScrypt                            // scrypt of golang.org/x/crypto/scrypt
+	PrimitiveChaCha20Poly1305                  // ChaCha20-Poly1305 of golang.org/x/crypto/chacha20poly1305
+)
+
+var compiledIn = map[Primitive]bool{}
+
+// Called by the file of the primitive when it is compiled in
+func registerPrimitive(p Primitive) {
+	compiledIn[p] = true
+}
+
+// IsCompiledIn reports whether the primitive is part of this build.
+func IsCompiledIn(p Primitive) bool {
+	return compiledIn[p]
+}
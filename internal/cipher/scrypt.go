@@ -0,0 +1,29 @@
+//go:build !no_scrypt
+
+package cipher
+
+// File: internal/cipher/scrypt.go
+// This file provides scrypt (RFC 7914), the memory-hard function deriving keys from passphrases
+// on the systems where Argon2id is not available. It is left out of the builds tagged no_scrypt.
+
+import (
+	"golang.org/x/crypto/scrypt"
+)
+
+func init() {
+	registerPrimitive(PrimitiveScrypt)
+}
+
+// ScryptKey derives a key of keyLen bytes from the password and the salt with the cost N = 2^logN.
+// It takes 128 * r * N bytes of memory, logN must be between 1 and 31, r and p must not be zero
+// and r * p must be below 2^30
+func ScryptKey(password, salt []byte, logN uint8, r, p uint32, keyLen int) ([]byte, error) {
+	if logN == 0 || logN > 31 || r == 0 || p == 0 {
+		return nil, ErrScryptParamsInvalid
+	}
+	key, err := scrypt.Key(password, salt, 1<<logN, int(r), int(p), keyLen)
+	if err != nil {
+		return nil, ErrScryptParamsInvalid
+	}
+	return key, nil
+}
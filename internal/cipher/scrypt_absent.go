@@ -0,0 +1,11 @@
+//go:build no_scrypt
+
+package cipher
+
+// File: internal/cipher/scrypt_absent.go
+// This file stands in for scrypt in the builds tagged no_scrypt.
+
+// ScryptKey always fails with ErrNotCompiledIn in this build.
+func ScryptKey(password, salt []byte, logN uint8, r, p uint32, keyLen int) ([]byte, error) {
+	return nil, ErrNotCompiledIn
+}
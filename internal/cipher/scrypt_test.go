@@ -0,0 +1,44 @@
+//go:build !no_scrypt
+
+package cipher_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test vectors of RFC 7914 section 12
+func TestScryptKnownAnswer(t *testing.T) {
+	vectors := []struct {
+		password, salt string
+		logN           uint8
+		r, p           uint32
+		result         string
+	}{
+		{"", "", 4, 1, 1, "77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442fcd0069ded0948f8326a753a0fc81f17e8d3e0fb2e0d3628cf35e20c38d18906"},
+		{"password", "NaCl", 10, 8, 16, "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+		{"pleaseletmein", "SodiumChloride", 14, 8, 1, "7023bdcb3afd7348461c06cd81fd38ebfda8fbba904f8e3ea9b543f6545da1f2d5432955613f0fcf62d49705242a9af9e61e85dc0d651e40dfcf017b45575887"},
+	}
+	for _, vector := range vectors {
+		key, err := ic.ScryptKey([]byte(vector.password), []byte(vector.salt), vector.logN, vector.r, vector.p, len(vector.result)/2)
+		assert.NoError(t, err, "Failed to derive the key")
+		assert.Equal(t, vector.result, hex.EncodeToString(key))
+	}
+}
+
+func TestScryptInvalidParams(t *testing.T) {
+	for _, params := range []struct {
+		logN uint8
+		r, p uint32
+	}{
+		{0, 8, 1},
+		{10, 0, 1},
+		{10, 1 << 15, 1 << 15},
+	} {
+		_, err := ic.ScryptKey([]byte("password"), nil, params.logN, params.r, params.p, 32)
+		assert.ErrorIs(t, err, ic.ErrScryptParamsInvalid)
+	}
+}
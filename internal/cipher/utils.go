@@ -6,15 +6,15 @@ package cipher
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hkdf"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"runtime"
 	_ "unsafe"
-
-	"golang.org/x/crypto/hkdf"
 )
 
 // AESVerifyKeySize checks if the provided key is a valid AES key size.
@@ -68,23 +68,45 @@ func GenerateAESIV() ([]byte, error) {
 	return iv, nil
 }
 
+// Number of consecutive empty reads tolerated before giving up, same as bufio
+const maxConsecutiveEmptyReads = 100
+
 // XORKeyStreamApply applies the XOR operation on a stream using the provided cipher.Stream.
 // It reads from the provided io.Reader and writes to the io.Writer, returning the total number
 // of bytes written or an error if the operation fails.
+//
+// Reader contract: the reader may occasionally return (0, nil), but if it does so for
+// more than maxConsecutiveEmptyReads times in a row io.ErrNoProgress is returned instead of spinning forever.
+// Bytes returned together with an error, including io.EOF, are always processed before the error is handled.
+// A writer accepting fewer bytes than offered without an error fails with io.ErrShortWrite.
 func XORKeyStreamApply(stream cipher.Stream, from io.Reader, to io.Writer, bufSize int) (int64, error) {
 	if bufSize <= 0 {
 		return 0, ErrInvalidLength
 	}
 	buf := make([]byte, bufSize)
 	var totalBytesWritten int64
+	emptyReads := 0
 	for {
 		n, err := from.Read(buf)
+		if n == 0 && err == nil {
+			emptyReads++
+			if emptyReads >= maxConsecutiveEmptyReads {
+				return totalBytesWritten, io.ErrNoProgress
+			}
+			continue
+		}
+		emptyReads = 0
 		if n > 0 {
 			stream.XORKeyStream(buf[:n], buf[:n])
-			if _, err := to.Write(buf[:n]); err != nil {
+			written, err := to.Write(buf[:n])
+			totalBytesWritten += int64(written)
+			if err != nil {
 				return totalBytesWritten, err
 			}
-			totalBytesWritten += int64(n)
+			// Writers must return an error on short writes, do not lose the data if they do not
+			if written != n {
+				return totalBytesWritten, io.ErrShortWrite
+			}
 		}
 		if err == io.EOF {
 			break
@@ -100,10 +122,16 @@ func XORKeyStreamApply(stream cipher.Stream, from io.Reader, to io.Writer, bufSi
 //
 //go:linkname DeriveKeysFromMasterKey github.com/ngeojiajun/go-filecrypt/pkg/utils.DeriveKeysFromMasterKey
 func DeriveKeysFromMasterKey(masterKey []byte, keySizes []int) (keys [][]byte, salt []byte, err error) {
+	return DeriveKeysFromMasterKeyWithSaltSize(masterKey, sha256.Size, keySizes)
+}
+
+// DeriveKeysFromMasterKeyWithSaltSize derives multiple keys from a master key using HKDF with a random salt of the given size.
+// It returns the derived keys, a salt used for key derivation, or an error if the operation fails.
+func DeriveKeysFromMasterKeyWithSaltSize(masterKey []byte, saltSize int, keySizes []int) (keys [][]byte, salt []byte, err error) {
 	if len(masterKey) == 0 {
 		return nil, nil, ErrInvalidLength
 	}
-	salt, err = GenerateRandomBytes(sha256.Size)
+	salt, err = GenerateRandomBytes(saltSize)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -116,6 +144,17 @@ func DeriveKeysFromMasterKey(masterKey []byte, keySizes []int) (keys [][]byte, s
 //
 //go:linkname DeriveKeysFromMasterKeyEx github.com/ngeojiajun/go-filecrypt/pkg/utils.DeriveKeysFromMasterKeyEx
 func DeriveKeysFromMasterKeyEx(masterKey, salt []byte, keySizes []int) (keys [][]byte, err error) {
+	return DeriveKeysFromMasterKeyWithContext(masterKey, salt, nil, keySizes)
+}
+
+// DeriveKeysFromMasterKeyWithContext derives multiple keys from a master key using HKDF and salt,
+// with the context mixed into the HKDF info so keys derived under different contexts are independent.
+// An empty context derives the same keys as DeriveKeysFromMasterKeyEx.
+// It returns the derived keys, or an error if the operation fails.
+func DeriveKeysFromMasterKeyWithContext(masterKey, salt, context []byte, keySizes []int) (keys [][]byte, err error) {
+	if len(context) > 0xFFFF {
+		return nil, ErrInvalidLength
+	}
 	if len(masterKey) == 0 {
 		return nil, ErrInvalidLength
 	}
@@ -124,21 +163,29 @@ func DeriveKeysFromMasterKeyEx(masterKey, salt []byte, keySizes []int) (keys [][
 	}
 	keys = make([][]byte, len(keySizes))
 	for i, size := range keySizes {
-		ctx := hkdf.New(sha256.New, masterKey, salt, []byte(fmt.Sprintf("key-%d", i)))
 		if size <= 0 {
 			return nil, ErrInvalidLength
 		}
 		if size > 255*sha256.Size {
 			return nil, ErrInvalidLength // Security limit
 		}
-		keys[i] = make([]byte, size)
-		if _, err := io.ReadFull(ctx, keys[i]); err != nil {
+		if keys[i], err = hkdf.Key(sha256.New, masterKey, salt, string(deriveKeyInfo(context, i)), size); err != nil {
 			return nil, err
 		}
 	}
 	return keys, nil
 }
 
+// HKDF info of the i-th key, the context is length prefixed so it cannot be confused with the index
+func deriveKeyInfo(context []byte, i int) []byte {
+	info := []byte(fmt.Sprintf("key-%d", i))
+	if len(context) == 0 {
+		return info
+	}
+	prefix := binary.BigEndian.AppendUint16(nil, uint16(len(context)))
+	return append(append(prefix, context...), info...)
+}
+
 // Securely wipe the content of a buffer
 //
 //go:noinline
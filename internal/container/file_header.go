@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"io"
 
 	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
@@ -17,74 +18,400 @@ import (
 // Magic 0x43, 0x52, 0x50, 0x54
 // Version Major, Minor (uint8, uint8)
 // Flags (uint16)
+// Header length (uint16) -- Only when HeaderFlagCompactHeader is set
 // Algorithm (EncryptionAlgorithm)
 // Number of slots (uint8)
 // Slots (ContainerKeySlot[]) -- Up to number specified by number of slots
+// Content salt size (uint8) -- Only when HeaderFlagContentSaltSize is set
+// Volume index, volume count (uint16, uint16), continuation offset (uint64) -- Only when HeaderFlagMultiVolume is set
+// Reserved length (uint16), reserved data -- Only when not empty or a field below follows, the zero padding of older files reads as empty
+// Header MAC (HMAC-SHA256) -- Only when HeaderFlagAuthenticated is set, readers not knowing the flag take it as padding
+// Metadata length (uint16), encrypted metadata -- Only when HeaderFlagMetadata is set, readers not knowing the flag take it as padding
+// Content authentication salt (32 bytes) -- Only when HeaderFlagReauthenticated is set
+//
+// With HeaderFlagDoubleBuffered the header is stored twice in two 4096 bytes copies, the content starts after both.
+// Each copy ends with a sequence number (uint32) and the CRC32C of the copy before the checksum (uint32).
+// Writes alternate between the copies, so a crash midway leaves the other copy intact,
+// and the parser picks the valid copy with the highest sequence number.
+
+// Size of the serialized header including its padding, also the limit of the compact header
+const HeaderSize = 4096
+
+// Size of the magic, version and flags which are read before anything else
+const headerFixedSize = 8
+
+// The compact header is introduced in the minor version 1
+const compactHeaderMinVersionMinor = 1
+
+// The double-buffered header is introduced in the minor version 2
+const doubleBufferedMinVersionMinor = 2
+
+// The minor version a header with the flags must carry when written. An older file raised to a critical flag
+// gets the current minor version, as the older releases cannot tell which of the critical flags they know
+func minVersionMinor(flags uint16) uint8 {
+	if flags&types.HeaderFlagCriticalMask != 0 {
+		return types.FormatVersionMinor
+	}
+	return 0
+}
+
+// Size of the MAC of the authenticated header
+const HeaderMACSize = 32
+
+// Size of the salt of the key of the content tag once re-authenticated
+const AuthSaltSize = 32
+
+// Size of the sequence number and the checksum ending every copy of the double-buffered header
+const headerCopyTrailerSize = 8
+
+var headerCopyCRCTable = crc32.MakeTable(crc32.Castagnoli)
 
 // ContainerFileHeader defines the structure of the file header for encrypted files.
-// It is 4KB aligned
+// It is 4KB aligned unless HeaderFlagCompactHeader is set
 type ContainerFileHeader struct {
 	VersionMajor uint8                     // Major version of the file format
 	VersionMinor uint8                     // Minor version of the file format
 	Flags        uint16                    // Flags for additional options
 	Algorithm    types.EncryptionAlgorithm // Encryption algorithm used
 	Slots        []*ContainerKeySlot       // Slots containing keys for decryption
+
+	ContentSaltSize uint8 // Size of the salt in front of the content, only used with HeaderFlagContentSaltSize
+
+	VolumeIndex  uint16 // Position of this file in the volumes, only used with HeaderFlagMultiVolume
+	VolumeCount  uint16 // Total number of volumes, only used with HeaderFlagMultiVolume
+	VolumeOffset uint64 // Offset of this volume in the logical content, only used with HeaderFlagMultiVolume
+
+	Length uint16 // Size of the serialized header, only used with HeaderFlagCompactHeader. Set by the parser and the writer
+
+	Reserved []byte // Application data kept in the padding, opaque to the library
+
+	MAC []byte // HMAC of the header keyed by the root key, only used with HeaderFlagAuthenticated. Computed by the container
+
+	Metadata []byte // Encrypted metadata of the original file, only used with HeaderFlagMetadata. Opaque to the header
+
+	AuthSalt []byte // Salt of the key of the content tag, only used with HeaderFlagReauthenticated
+
+	Sequence uint32 // Sequence number of the copy, only used with HeaderFlagDoubleBuffered. Set by the parser
+}
+
+// Size of the serialized header, the content starts right after it
+func (header *ContainerFileHeader) Size() int64 {
+	if header.Flags&types.HeaderFlagCompactHeader != 0 {
+		return int64(header.Length)
+	}
+	if header.Flags&types.HeaderFlagDoubleBuffered != 0 {
+		return 2 * HeaderSize
+	}
+	return HeaderSize
+}
+
+// Number of bytes the serialized header may take, HeaderSize unless part of it holds the trailer of the copy
+func (header *ContainerFileHeader) Capacity() int {
+	if header.Flags&types.HeaderFlagDoubleBuffered != 0 {
+		return HeaderSize - headerCopyTrailerSize
+	}
+	return HeaderSize
+}
+
+// Offset of the copy of the double-buffered header holding the sequence number
+func (header *ContainerFileHeader) CopyOffset() int64 {
+	return int64(header.Sequence%2) * HeaderSize
+}
+
+// Bytes taken by a slot in the header besides its content: algorithm (uint16) || flags (uint16) || size (uint16)
+const SlotHeaderOverhead = 6
+
+// Number of bytes the serialized header takes before the padding, which must not exceed HeaderSize.
+// It may be computed before any slot is added
+func (header *ContainerFileHeader) UsedSize() int {
+	// Magic number, version, flags, algorithm and number of slots
+	size := headerFixedSize + 2 + 1
+	if header.Flags&types.HeaderFlagCompactHeader != 0 {
+		size += 2
+	}
+	for _, slot := range header.Slots {
+		if slot.Flags&FlagSlotDestroyed == 0 {
+			size += SlotHeaderOverhead + len(slot.SlotContent)
+		}
+	}
+	if header.Flags&types.HeaderFlagContentSaltSize != 0 {
+		size += 1
+	}
+	if header.Flags&types.HeaderFlagMultiVolume != 0 {
+		size += 2 + 2 + 8
+	}
+	if len(header.Reserved) > 0 || header.Flags&(types.HeaderFlagAuthenticated|types.HeaderFlagMetadata|types.HeaderFlagReauthenticated) != 0 {
+		size += 2 + len(header.Reserved)
+	}
+	if header.Flags&types.HeaderFlagAuthenticated != 0 {
+		size += HeaderMACSize
+	}
+	if header.Flags&types.HeaderFlagMetadata != 0 {
+		size += 2 + len(header.Metadata)
+	}
+	if header.Flags&types.HeaderFlagReauthenticated != 0 {
+		size += AuthSaltSize
+	}
+	return size
 }
 
 // ParseContainerFileHeader parses the file header from the provided reader.
 // It returns a ContainerFileHeader or an error if parsing fails.
 func ParseContainerFileHeader(reader io.Reader) (*ContainerFileHeader, error) {
+	return ParseContainerFileHeaderWithOptions(reader, nil)
+}
+
+// ParseContainerFileHeaderWithOptions parses the file header from the provided reader using the options.
+// When options is nil, the default lenient parsing is used.
+// It returns a ContainerFileHeader or an error if parsing fails.
+func ParseContainerFileHeaderWithOptions(reader io.Reader, options *types.ParseOptions) (*ContainerFileHeader, error) {
+	if options == nil {
+		options = &types.ParseOptions{}
+	}
 	if reader == nil {
 		return nil, types.ErrParameterMissing
 	}
-	var header ContainerFileHeader
-	data := make([]byte, 4096) // Read 4KB for the header
+	// Read the fixed part first to know how large the header is
+	data := make([]byte, headerFixedSize)
 	if _, err := io.ReadFull(reader, data); err != nil {
 		return nil, err
 	}
-	if !bytes.Equal(data[:4], types.FileMagicNumber) {
-		return nil, types.ErrInvalidFileHeader
-	}
-	// Create a scoped reader to read the rest of the header
-	scopedReader := bytes.NewReader(data[4:])
-	var err error
-	header.VersionMajor, err = scopedReader.ReadByte()
+	header, err := parseHeaderFixed(data, options)
 	if err != nil {
+		// The first copy of a double-buffered header may be torn by a crash while the second one is intact
+		if second, secondErr := parseSecondHeaderCopy(reader, options); secondErr == nil {
+			return second, nil
+		}
 		return nil, err
 	}
-	header.VersionMinor, err = scopedReader.ReadByte()
-	if err != nil {
+	if header.Flags&types.HeaderFlagDoubleBuffered != 0 {
+		return parseDoubleBufferedHeader(reader, data, options)
+	}
+	remaining := HeaderSize - headerFixedSize
+	if header.Flags&types.HeaderFlagCompactHeader != 0 {
+		if header.VersionMinor < compactHeaderMinVersionMinor {
+			return nil, types.ErrInvalidFileHeader
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(reader, length[:]); err != nil {
+			return nil, err
+		}
+		header.Length = binary.BigEndian.Uint16(length[:])
+		if header.Length < headerFixedSize+2 || header.Length > HeaderSize {
+			return nil, types.ErrInvalidFileHeader
+		}
+		remaining = int(header.Length) - headerFixedSize - 2
+	}
+	data = make([]byte, remaining)
+	if _, err := io.ReadFull(reader, data); err != nil {
 		return nil, err
 	}
-	// We support only one version for now
-	if header.VersionMajor != 1 || header.VersionMinor != 0 {
-		return nil, types.ErrUnsupportedVersion
+	if err := parseHeaderBody(header, data, options); err != nil {
+		// A torn first copy may have lost the double-buffered flag, the second copy follows the padded one
+		if header.Flags&types.HeaderFlagCompactHeader == 0 {
+			if second, secondErr := readHeaderCopy(reader, options); secondErr == nil {
+				return second, nil
+			}
+		}
+		return nil, err
 	}
-	if err = binary.Read(scopedReader, binary.BigEndian, &header.Flags); err != nil {
+	return header, nil
+}
+
+// Parse the magic, the version and the flags
+func parseHeaderFixed(data []byte, options *types.ParseOptions) (*ContainerFileHeader, error) {
+	var header ContainerFileHeader
+	if !bytes.Equal(data[:4], types.FileMagicNumber) {
 		return nil, types.ErrInvalidFileHeader
 	}
+	header.VersionMajor, header.VersionMinor = data[4], data[5]
+	// Refuse anything newer than what we understand
+	if header.VersionMajor != types.FormatVersionMajor || header.VersionMinor > types.FormatVersionMinor {
+		return nil, types.ErrUnsupportedVersion
+	}
+	if header.VersionMinor < options.MinVersionMinor {
+		return nil, types.ErrVersionTooOld
+	}
+	header.Flags = binary.BigEndian.Uint16(data[6:8])
+	if options.Strict && types.HasUnknownCriticalFlags(header.Flags) {
+		unknown := header.Flags & types.HeaderFlagCriticalMask &^ types.HeaderFlagKnownMask
+		return nil, types.NewHeaderFlagsUnavailableError(types.ErrUnsupportedFeature, unknown)
+	}
+	return &header, nil
+}
+
+// Parse everything following the fixed part and the length of the compact header
+func parseHeaderBody(header *ContainerFileHeader, data []byte, options *types.ParseOptions) error {
+	limits := options.Limits
+	if limits == nil {
+		limits = &types.ResourceLimits{}
+	}
+	// Create a scoped reader to read the rest of the header
+	scopedReader := bytes.NewReader(data)
+	var err error
 	if err = binary.Read(scopedReader, binary.BigEndian, (*uint16)(&header.Algorithm)); err != nil {
-		return nil, types.ErrInvalidFileHeader
+		return types.ErrInvalidFileHeader
 	}
-	if header.Algorithm >= types.EncAlgEnd {
-		return nil, types.ErrUnsupportedEncAlgo
+	if err := CheckEncryptionAlgorithm(header.Algorithm); err != nil {
+		return err
+	}
+	// The AEAD only exists in the chunked framing
+	if header.Algorithm.IsAEAD() && header.Flags&types.HeaderFlagChunkedContent == 0 {
+		return types.ErrInvalidFileHeader
 	}
 	var nslots uint8
 	if nslots, err = scopedReader.ReadByte(); err != nil {
-		return nil, types.ErrInvalidFileHeader
+		return types.ErrInvalidFileHeader
 	}
 	if nslots == 0 {
-		return nil, types.ErrEmptySlotContent
+		return types.ErrEmptySlotContent
+	}
+	if err := types.CheckResourceLimit("the number of slots", int64(nslots), int64(limits.MaxSlots)); err != nil {
+		return err
 	}
 	header.Slots = make([]*ContainerKeySlot, nslots)
 	for i := uint8(0); i < nslots; i++ {
 		header.Slots[i] = &ContainerKeySlot{}
-		if err := containerReadSlot(scopedReader, header.Slots[i]); err != nil {
-			return nil, err
+		if err := containerReadSlot(scopedReader, header.Slots[i], limits); err != nil {
+			return err
 		}
 	}
-	// We do not care about padding, as long it is aligned to 4KB
-	return &header, nil
+	if header.Flags&types.HeaderFlagContentSaltSize != 0 {
+		if header.ContentSaltSize, err = scopedReader.ReadByte(); err != nil {
+			return types.ErrInvalidFileHeader
+		}
+		if header.ContentSaltSize == 0 {
+			return types.ErrInvalidFileHeader
+		}
+	}
+	if header.Flags&types.HeaderFlagMultiVolume != 0 {
+		if err = binary.Read(scopedReader, binary.BigEndian, &header.VolumeIndex); err != nil {
+			return types.ErrInvalidFileHeader
+		}
+		if err = binary.Read(scopedReader, binary.BigEndian, &header.VolumeCount); err != nil {
+			return types.ErrInvalidFileHeader
+		}
+		if err = binary.Read(scopedReader, binary.BigEndian, &header.VolumeOffset); err != nil {
+			return types.ErrInvalidFileHeader
+		}
+		if header.VolumeIndex >= header.VolumeCount {
+			return types.ErrInvalidFileHeader
+		}
+	}
+	// Anything after the reserved data is padding, we do not care about it as long it is aligned to 4KB
+	if scopedReader.Len() >= 2 {
+		var length uint16
+		if err = binary.Read(scopedReader, binary.BigEndian, &length); err != nil {
+			return types.ErrInvalidFileHeader
+		}
+		if err := types.CheckResourceLimit("the reserved data", int64(length), int64(limits.MaxHeaderMetadata)); err != nil {
+			return err
+		}
+		if length > 0 {
+			header.Reserved = make([]byte, length)
+			if _, err = io.ReadFull(scopedReader, header.Reserved); err != nil {
+				return types.ErrInvalidFileHeader
+			}
+		}
+	}
+	if header.Flags&types.HeaderFlagAuthenticated != 0 {
+		header.MAC = make([]byte, HeaderMACSize)
+		if _, err = io.ReadFull(scopedReader, header.MAC); err != nil {
+			return types.ErrInvalidFileHeader
+		}
+	}
+	if header.Flags&types.HeaderFlagMetadata != 0 {
+		var length uint16
+		if err = binary.Read(scopedReader, binary.BigEndian, &length); err != nil || length == 0 {
+			return types.ErrInvalidFileHeader
+		}
+		if err := types.CheckResourceLimit("the metadata", int64(length), int64(limits.MaxHeaderMetadata)); err != nil {
+			return err
+		}
+		header.Metadata = make([]byte, length)
+		if _, err = io.ReadFull(scopedReader, header.Metadata); err != nil {
+			return types.ErrInvalidFileHeader
+		}
+	}
+	if header.Flags&types.HeaderFlagReauthenticated != 0 {
+		header.AuthSalt = make([]byte, AuthSaltSize)
+		if _, err = io.ReadFull(scopedReader, header.AuthSalt); err != nil {
+			return types.ErrInvalidFileHeader
+		}
+	}
+	return nil
+}
+
+// Parse a single copy of the double-buffered header, failing when its checksum does not match
+func parseHeaderCopy(data []byte, options *types.ParseOptions) (*ContainerFileHeader, error) {
+	checksumOffset := HeaderSize - 4
+	if crc32.Checksum(data[:checksumOffset], headerCopyCRCTable) != binary.BigEndian.Uint32(data[checksumOffset:]) {
+		return nil, types.ErrInvalidFileHeader
+	}
+	header, err := parseHeaderFixed(data[:headerFixedSize], options)
+	if err != nil {
+		return nil, err
+	}
+	if header.Flags&types.HeaderFlagDoubleBuffered == 0 || header.Flags&types.HeaderFlagCompactHeader != 0 ||
+		header.VersionMinor < doubleBufferedMinVersionMinor {
+		return nil, types.ErrInvalidFileHeader
+	}
+	header.Sequence = binary.BigEndian.Uint32(data[HeaderSize-headerCopyTrailerSize:])
+	if err := parseHeaderBody(header, data[headerFixedSize:HeaderSize-headerCopyTrailerSize], options); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// Read both copies of the double-buffered header and pick the valid one with the highest sequence number.
+// The fixed part of the first copy is already read
+func parseDoubleBufferedHeader(reader io.Reader, fixed []byte, options *types.ParseOptions) (*ContainerFileHeader, error) {
+	first := make([]byte, HeaderSize)
+	copy(first, fixed)
+	if _, err := io.ReadFull(reader, first[headerFixedSize:]); err != nil {
+		return nil, err
+	}
+	firstHeader, firstErr := parseHeaderCopy(first, options)
+	second := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(reader, second); err != nil {
+		// The file was cut while the first header was being written, before any content
+		if firstErr == nil && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+			return firstHeader, nil
+		}
+		return nil, err
+	}
+	secondHeader, secondErr := parseHeaderCopy(second, options)
+	switch {
+	case firstErr != nil && secondErr != nil:
+		return nil, firstErr
+	case firstErr != nil:
+		return secondHeader, nil
+	case secondErr != nil:
+		return firstHeader, nil
+	case int32(secondHeader.Sequence-firstHeader.Sequence) > 0:
+		// Compared as serial numbers so the sequence can wrap around
+		return secondHeader, nil
+	default:
+		return firstHeader, nil
+	}
+}
+
+// Parse the second copy of a double-buffered header whose first copy is unreadable.
+// The fixed part of the first copy is already read
+func parseSecondHeaderCopy(reader io.Reader, options *types.ParseOptions) (*ContainerFileHeader, error) {
+	if _, err := io.CopyN(io.Discard, reader, HeaderSize-headerFixedSize); err != nil {
+		return nil, err
+	}
+	return readHeaderCopy(reader, options)
+}
+
+// Read and parse the copy of a double-buffered header at the position of the reader
+func readHeaderCopy(reader io.Reader, options *types.ParseOptions) (*ContainerFileHeader, error) {
+	data := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	return parseHeaderCopy(data, options)
 }
 
 // WriteContainerFileHeader writes the ContainerFileHeader to the provided writer.
@@ -93,6 +420,47 @@ func WriteContainerFileHeader(writer io.Writer, header *ContainerFileHeader) err
 	if writer == nil || header == nil {
 		return types.ErrParameterMissing
 	}
+	if header.Flags&types.HeaderFlagDoubleBuffered != 0 {
+		// Both copies hold the same header here, the container updates them one at a time with SerializeHeaderCopy
+		region, err := SerializeHeaderCopy(header)
+		if err != nil {
+			return err
+		}
+		for range 2 {
+			if _, err := writer.Write(region); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	buffer, err := serializeHeader(header, HeaderSize)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, buffer)
+	return err
+}
+
+// Serialize a single copy of the double-buffered header, ending with the sequence number and the checksum.
+// It is written at CopyOffset
+func SerializeHeaderCopy(header *ContainerFileHeader) ([]byte, error) {
+	if header == nil {
+		return nil, types.ErrParameterMissing
+	}
+	if header.Flags&types.HeaderFlagDoubleBuffered == 0 || header.Flags&types.HeaderFlagCompactHeader != 0 {
+		return nil, types.ErrUnsupportedFeature
+	}
+	buffer, err := serializeHeader(header, HeaderSize-headerCopyTrailerSize)
+	if err != nil {
+		return nil, err
+	}
+	binary.Write(buffer, binary.BigEndian, header.Sequence)
+	binary.Write(buffer, binary.BigEndian, crc32.Checksum(buffer.Bytes(), headerCopyCRCTable))
+	return buffer.Bytes(), nil
+}
+
+// Serialize the header, padded to limit bytes unless it is compact
+func serializeHeader(header *ContainerFileHeader, limit int) (*bytes.Buffer, error) {
 	var slots []*ContainerKeySlot = make([]*ContainerKeySlot, 0, len(header.Slots))
 	for _, slot := range header.Slots {
 		if slot.Flags&FlagSlotDestroyed == 0 {
@@ -101,54 +469,127 @@ func WriteContainerFileHeader(writer io.Writer, header *ContainerFileHeader) err
 	}
 	nslots := len(slots)
 	if nslots == 0 {
-		return types.ErrEmptySlotContent
+		return nil, types.ErrEmptySlotContent
 	}
 	if nslots > 255 {
-		return types.ErrSlotTooMuch
+		return nil, types.ErrSlotTooMuch
 	}
+	// The version is raised when a flag needing a newer reader is set, it is never lowered
+	header.VersionMinor = max(header.VersionMinor, minVersionMinor(header.Flags))
 	buffer := bytes.NewBuffer(nil)
 	// Write te magic number first
 	if _, err := buffer.Write(types.FileMagicNumber); err != nil {
-		return err
+		return nil, err
 	}
 	if _, err := buffer.Write([]byte{header.VersionMajor, header.VersionMinor}); err != nil {
-		return err
+		return nil, err
 	}
 	if err := binary.Write(buffer, binary.BigEndian, header.Flags); err != nil {
-		return err
+		return nil, err
+	}
+	compact := header.Flags&types.HeaderFlagCompactHeader != 0
+	if compact {
+		// Placeholder of the length, filled once the header is complete
+		if _, err := buffer.Write([]byte{0, 0}); err != nil {
+			return nil, err
+		}
 	}
 	if err := binary.Write(buffer, binary.BigEndian, (uint16)(header.Algorithm)); err != nil {
-		return err
+		return nil, err
 	}
 	if err := buffer.WriteByte((uint8)(nslots)); err != nil {
-		return err
+		return nil, err
 	}
 	for _, slot := range slots {
 		if err := containerWriteSlot(buffer, slot); err != nil {
-			return err
+			return nil, err
 		}
 	}
-	if buffer.Len() > 4096 {
-		return types.ErrProducedHeaderTooBig
+	if header.Flags&types.HeaderFlagContentSaltSize != 0 {
+		if err := buffer.WriteByte(header.ContentSaltSize); err != nil {
+			return nil, err
+		}
 	}
-	paddingBytesNeeded := 4096 - buffer.Len()
-	if paddingBytesNeeded > 0 {
-		padding := make([]byte, paddingBytesNeeded)
-		buffer.Write(padding)
+	if header.Flags&types.HeaderFlagMultiVolume != 0 {
+		if err := binary.Write(buffer, binary.BigEndian, header.VolumeIndex); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(buffer, binary.BigEndian, header.VolumeCount); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(buffer, binary.BigEndian, header.VolumeOffset); err != nil {
+			return nil, err
+		}
 	}
-
-	_, err := io.Copy(writer, buffer)
-	return err
+	authenticated := header.Flags&types.HeaderFlagAuthenticated != 0
+	metadata := header.Flags&types.HeaderFlagMetadata != 0
+	reauthenticated := header.Flags&types.HeaderFlagReauthenticated != 0
+	// The fields below must not be read as the length of the reserved data, so the length is always written before them
+	if len(header.Reserved) > 0 || authenticated || metadata || reauthenticated {
+		if len(header.Reserved) > HeaderSize {
+			return nil, types.ErrProducedHeaderTooBig
+		}
+		if err := binary.Write(buffer, binary.BigEndian, uint16(len(header.Reserved))); err != nil {
+			return nil, err
+		}
+		if _, err := buffer.Write(header.Reserved); err != nil {
+			return nil, err
+		}
+	}
+	if authenticated {
+		if len(header.MAC) != HeaderMACSize {
+			return nil, types.ErrParameterMissing
+		}
+		if _, err := buffer.Write(header.MAC); err != nil {
+			return nil, err
+		}
+	}
+	if metadata {
+		if len(header.Metadata) == 0 {
+			return nil, types.ErrParameterMissing
+		}
+		if len(header.Metadata) > HeaderSize {
+			return nil, types.ErrProducedHeaderTooBig
+		}
+		if err := binary.Write(buffer, binary.BigEndian, uint16(len(header.Metadata))); err != nil {
+			return nil, err
+		}
+		if _, err := buffer.Write(header.Metadata); err != nil {
+			return nil, err
+		}
+	}
+	if reauthenticated {
+		if len(header.AuthSalt) != AuthSaltSize {
+			return nil, types.ErrParameterMissing
+		}
+		if _, err := buffer.Write(header.AuthSalt); err != nil {
+			return nil, err
+		}
+	}
+	if buffer.Len() > limit {
+		return nil, types.ErrProducedHeaderTooBig
+	}
+	if compact {
+		header.Length = uint16(buffer.Len())
+		binary.BigEndian.PutUint16(buffer.Bytes()[headerFixedSize:], header.Length)
+	} else {
+		paddingBytesNeeded := limit - buffer.Len()
+		if paddingBytesNeeded > 0 {
+			padding := make([]byte, paddingBytesNeeded)
+			buffer.Write(padding)
+		}
+	}
+	return buffer, nil
 }
 
 // ReadContainerKeySlot reads a single ContainerKeySlot from the provided byte reader.
 // It returns an error if the slot cannot be read or is invalid.
-func containerReadSlot(reader *bytes.Reader, slot *ContainerKeySlot) error {
+func containerReadSlot(reader *bytes.Reader, slot *ContainerKeySlot, limits *types.ResourceLimits) error {
 	if err := binary.Read(reader, binary.BigEndian, (*uint16)(&slot.SlotKeyAlgorithm)); err != nil {
 		return err
 	}
 	if slot.SlotKeyAlgorithm >= types.SlotKeyAlgEnd {
-		return types.ErrUnsupportedSlotAlgo
+		return types.NewSlotAlgorithmUnavailableError(types.ErrUnsupportedSlotAlgo, slot.SlotKeyAlgorithm)
 	}
 	if err := binary.Read(reader, binary.BigEndian, &slot.Flags); err != nil {
 		return err
@@ -156,6 +597,9 @@ func containerReadSlot(reader *bytes.Reader, slot *ContainerKeySlot) error {
 	if err := binary.Read(reader, binary.BigEndian, &slot.Size); err != nil {
 		return err
 	}
+	if err := types.CheckResourceLimit("the slot content", int64(slot.Size), int64(limits.MaxSlotSize)); err != nil {
+		return err
+	}
 	slot.SlotContent = make([]byte, slot.Size)
 	if _, err := io.ReadFull(reader, slot.SlotContent); err != nil {
 		return err
@@ -2,6 +2,9 @@ package container_test
 
 import (
 	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
 	"testing"
 
 	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
@@ -84,3 +87,357 @@ func TestContainerSerializationDeadSlot(t *testing.T) {
 		t.Fatalf("The deserialized slot cannot be unsealed: %v", err)
 	}
 }
+
+// Build a serialized header carrying the given flags
+func serializeHeaderWithFlags(t *testing.T, flags uint16) []byte {
+	rootKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "Failed to generate root key")
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "Failed to generate slot key")
+	slot, err := container.NewContainerKeySlot(types.SlotKeyAlgAESGCM128, 0, rootKey, slotKey)
+	assert.NoError(t, err, "Failed to create slot")
+	header := &container.ContainerFileHeader{
+		VersionMajor: types.FormatVersionMajor,
+		VersionMinor: types.FormatVersionMinor,
+		Flags:        flags,
+		Algorithm:    types.EncAlgAESCTR128,
+		Slots:        []*container.ContainerKeySlot{slot},
+	}
+	buffer := bytes.NewBuffer(nil)
+	if err := container.WriteContainerFileHeader(buffer, header); err != nil {
+		t.Fatalf("Cannot serialize the header: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+// Every critical flag is known to this library, so a file carrying one is never refused by a reader of the same version
+func TestHeaderFlagMasks(t *testing.T) {
+	assert.Equal(t, types.HeaderFlagCriticalMask, types.HeaderFlagKnownMask&types.HeaderFlagCriticalMask)
+	assert.False(t, types.HasUnknownCriticalFlags(types.HeaderFlagCriticalMask))
+	assert.Zero(t, types.HeaderFlagUpdatableMask&types.HeaderFlagCriticalMask, "a critical flag is updatable")
+	assert.Equal(t, types.HeaderFlagUpdatableMask, types.HeaderFlagUpdatableMask&types.HeaderFlagKnownMask, "an unknown flag is updatable")
+}
+
+// Unknown critical flags are only rejected in strict mode
+func TestContainerParseUnknownCriticalFlag(t *testing.T) {
+	unknownCritical := types.HeaderFlagCriticalMask &^ types.HeaderFlagKnownMask
+	if unknownCritical == 0 {
+		t.Skip("every critical flag is known")
+	}
+	data := serializeHeaderWithFlags(t, unknownCritical)
+
+	decodedHeader, err := container.ParseContainerFileHeader(bytes.NewReader(data))
+	assert.NoError(t, err, "Lenient parsing should ignore the unknown flag")
+	assert.Equal(t, unknownCritical, decodedHeader.Flags)
+
+	_, err = container.ParseContainerFileHeaderWithOptions(bytes.NewReader(data), &types.ParseOptions{Strict: true})
+	assert.ErrorIs(t, err, types.ErrUnsupportedFeature)
+	assert.ErrorIs(t, err, types.ErrFeatureUnavailable)
+	assert.ErrorContains(t, err, fmt.Sprintf("the header flags unknown 0x%04x", unknownCritical))
+}
+
+// Algorithms unknown to this build are named in the error
+func TestContainerParseUnavailableAlgorithm(t *testing.T) {
+	data := serializeHeaderWithFlags(t, 0)
+	// The algorithm follows the magic number, the version and the flags
+	binary.BigEndian.PutUint16(data[8:10], 0x1234)
+	_, err := container.ParseContainerFileHeader(bytes.NewReader(data))
+	assert.ErrorIs(t, err, types.ErrUnsupportedEncAlgo)
+	assert.ErrorIs(t, err, types.ErrFeatureUnavailable)
+	var featureErr *types.FeatureUnavailableError
+	assert.ErrorAs(t, err, &featureErr)
+	assert.Equal(t, types.FeatureEncryptionAlgorithm, featureErr.Kind)
+	assert.Equal(t, uint16(0x1234), featureErr.ID)
+	assert.EqualError(t, err, "the file uses the unknown encryption algorithm 4660 which this build does not support")
+
+	// The first slot follows the number of slots
+	data = serializeHeaderWithFlags(t, 0)
+	binary.BigEndian.PutUint16(data[11:13], 0x0100)
+	_, err = container.ParseContainerFileHeader(bytes.NewReader(data))
+	assert.ErrorIs(t, err, types.ErrUnsupportedSlotAlgo)
+	assert.ErrorIs(t, err, types.ErrFeatureUnavailable)
+	assert.ErrorContains(t, err, "the unknown slot algorithm 256")
+}
+
+// Every known algorithm and flag is reported by its name
+func TestFeatureUnavailableErrorNames(t *testing.T) {
+	for alg := types.EncryptionAlgorithm(0); alg < types.EncAlgEnd; alg++ {
+		err := types.NewEncryptionAlgorithmUnavailableError(types.ErrAlgorithmNotCompiledIn, alg)
+		assert.NotContains(t, err.Error(), "unknown", "no name for the encryption algorithm %d", alg)
+	}
+	for alg := types.SlotKeyAlgorithm(0); alg < types.SlotKeyAlgEnd; alg++ {
+		err := types.NewSlotAlgorithmUnavailableError(types.ErrAlgorithmNotCompiledIn, alg)
+		assert.NotContains(t, err.Error(), "unknown", "no name for the slot algorithm %d", alg)
+	}
+	err := types.NewHeaderFlagsUnavailableError(types.ErrUnsupportedFeature, types.HeaderFlagKnownMask)
+	assert.NotContains(t, err.Error(), "unknown")
+
+	err = types.NewEncryptionAlgorithmUnavailableError(types.ErrAlgorithmNotCompiledIn, types.EncAlgChaCha20Poly1305)
+	assert.EqualError(t, err, "the file uses the encryption algorithm ChaCha20-Poly1305 which this build does not support")
+	err = types.NewSlotAlgorithmUnavailableError(types.ErrAlgorithmNotCompiledIn, types.SlotKeyAlgScrypt)
+	assert.EqualError(t, err, "the file uses the slot algorithm scrypt which this build does not support")
+	err = types.NewHeaderFlagsUnavailableError(types.ErrUnsupportedFeature, types.HeaderFlagChunkedContent|1<<6)
+	assert.EqualError(t, err, "the file uses the header flags chunked content, unknown 0x0040 which this build does not support")
+}
+
+// The AEAD algorithms are only valid with the chunked content
+func TestContainerParseAEADRequiresChunked(t *testing.T) {
+	for _, alg := range []types.EncryptionAlgorithm{types.EncAlgAESGCM256, types.EncAlgChaCha20Poly1305} {
+		// Left out of this build, see the no_* build tags
+		if !container.EncryptionAlgorithmAvailable(alg) {
+			continue
+		}
+		data := serializeHeaderWithFlags(t, types.HeaderFlagChunkedContent)
+		binary.BigEndian.PutUint16(data[8:10], uint16(alg))
+		decodedHeader, err := container.ParseContainerFileHeader(bytes.NewReader(data))
+		assert.NoError(t, err, "Cannot parse the chunked AEAD header")
+		assert.Equal(t, alg, decodedHeader.Algorithm)
+
+		data = serializeHeaderWithFlags(t, 0)
+		binary.BigEndian.PutUint16(data[8:10], uint16(alg))
+		_, err = container.ParseContainerFileHeader(bytes.NewReader(data))
+		assert.ErrorIs(t, err, types.ErrInvalidFileHeader)
+	}
+}
+
+// Unknown optional flags are accepted even in strict mode
+func TestContainerParseUnknownOptionalFlag(t *testing.T) {
+	const unknownOptional uint16 = 1 << 6
+	data := serializeHeaderWithFlags(t, unknownOptional)
+
+	decodedHeader, err := container.ParseContainerFileHeaderWithOptions(bytes.NewReader(data), &types.ParseOptions{Strict: true})
+	assert.NoError(t, err, "Strict parsing should ignore the unknown optional flag")
+	assert.Equal(t, unknownOptional, decodedHeader.Flags)
+}
+
+// The compact header is only as large as needed and can be parsed back
+func TestContainerSerializationCompact(t *testing.T) {
+	aligned := serializeHeaderWithFlags(t, 0)
+	assert.Len(t, aligned, container.HeaderSize)
+
+	data := serializeHeaderWithFlags(t, types.HeaderFlagCompactHeader)
+	assert.Less(t, len(data), container.HeaderSize)
+	// Append some content which must not be consumed by the parser
+	reader := bytes.NewReader(append(data, "content"...))
+	decodedHeader, err := container.ParseContainerFileHeader(reader)
+	assert.NoError(t, err, "Failed to parse the compact header")
+	assert.Equal(t, int64(len(data)), decodedHeader.Size())
+	assert.Equal(t, 7, reader.Len())
+
+	// The compact header does not exist before the minor version 1
+	data[5] = 0
+	_, err = container.ParseContainerFileHeader(bytes.NewReader(data))
+	assert.ErrorIs(t, err, types.ErrInvalidFileHeader)
+}
+
+// The used size matches the serialized compact header with every optional field
+func TestContainerUsedSize(t *testing.T) {
+	rootKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "Failed to generate root key")
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "Failed to generate slot key")
+	slot, err := container.NewContainerKeySlot(types.SlotKeyAlgAESGCM128, 0, rootKey, slotKey)
+	assert.NoError(t, err, "Failed to create slot")
+	header := &container.ContainerFileHeader{
+		VersionMajor:    types.FormatVersionMajor,
+		VersionMinor:    types.FormatVersionMinor,
+		Flags:           types.HeaderFlagCompactHeader | types.HeaderFlagContentSaltSize | types.HeaderFlagMultiVolume,
+		Algorithm:       types.EncAlgAESCTR128,
+		Slots:           []*container.ContainerKeySlot{slot},
+		ContentSaltSize: 16,
+		VolumeCount:     2,
+		Reserved:        []byte("application data"),
+	}
+	buffer := bytes.NewBuffer(nil)
+	err = container.WriteContainerFileHeader(buffer, header)
+	assert.NoError(t, err, "Failed to serialize the header")
+	assert.Equal(t, buffer.Len(), header.UsedSize())
+}
+
+// Files older than the minimum version are refused
+func TestContainerParseMinVersion(t *testing.T) {
+	data := serializeHeaderWithFlags(t, 0)
+	options := &types.ParseOptions{MinVersionMinor: types.FormatVersionMinor}
+	_, err := container.ParseContainerFileHeaderWithOptions(bytes.NewReader(data), options)
+	assert.NoError(t, err, "The current version should pass the minimum")
+
+	data[5] = types.FormatVersionMinor - 1
+	_, err = container.ParseContainerFileHeader(bytes.NewReader(data))
+	assert.NoError(t, err, "Older versions are accepted by default")
+	_, err = container.ParseContainerFileHeaderWithOptions(bytes.NewReader(data), options)
+	assert.ErrorIs(t, err, types.ErrVersionTooOld)
+}
+
+// The reserved data survives a round trip in both layouts, while the zero padding reads as empty
+func TestContainerSerializationReserved(t *testing.T) {
+	data := serializeHeaderWithFlags(t, 0)
+	decodedHeader, err := container.ParseContainerFileHeader(bytes.NewReader(data))
+	assert.NoError(t, err, "Failed to parse the header")
+	assert.Nil(t, decodedHeader.Reserved)
+
+	for _, flags := range []uint16{0, types.HeaderFlagCompactHeader} {
+		decodedHeader.Flags = flags
+		decodedHeader.Reserved = []byte("application data")
+		buffer := bytes.NewBuffer(nil)
+		err = container.WriteContainerFileHeader(buffer, decodedHeader)
+		assert.NoError(t, err, "Failed to serialize the header")
+		reparsed, err := container.ParseContainerFileHeader(bytes.NewReader(buffer.Bytes()))
+		assert.NoError(t, err, "Failed to parse the header")
+		assert.Equal(t, []byte("application data"), reparsed.Reserved)
+	}
+
+	decodedHeader.Reserved = make([]byte, container.HeaderSize)
+	err = container.WriteContainerFileHeader(io.Discard, decodedHeader)
+	assert.ErrorIs(t, err, types.ErrProducedHeaderTooBig)
+}
+
+// The MAC of the authenticated header follows the reserved data, readers not knowing the flag take it as padding
+func TestContainerSerializationAuthenticated(t *testing.T) {
+	data := serializeHeaderWithFlags(t, 0)
+	header, err := container.ParseContainerFileHeader(bytes.NewReader(data))
+	assert.NoError(t, err, "Failed to parse the header")
+	header.Flags = types.HeaderFlagAuthenticated | types.HeaderFlagCompactHeader
+	err = container.WriteContainerFileHeader(io.Discard, header)
+	assert.ErrorIs(t, err, types.ErrParameterMissing, "The MAC must be computed before writing")
+
+	header.MAC = bytes.Repeat([]byte{0xa5}, container.HeaderMACSize)
+	buffer := bytes.NewBuffer(nil)
+	err = container.WriteContainerFileHeader(buffer, header)
+	assert.NoError(t, err, "Failed to serialize the header")
+	assert.Equal(t, buffer.Len(), header.UsedSize())
+	reparsed, err := container.ParseContainerFileHeader(bytes.NewReader(buffer.Bytes()))
+	assert.NoError(t, err, "Failed to parse the header")
+	assert.Equal(t, header.MAC, reparsed.MAC)
+	assert.Nil(t, reparsed.Reserved, "The MAC must not be read as the reserved data")
+
+	// Without the flag the MAC is ignored
+	data = buffer.Bytes()
+	binary.BigEndian.PutUint16(data[6:8], types.HeaderFlagCompactHeader)
+	reparsed, err = container.ParseContainerFileHeaderWithOptions(bytes.NewReader(data), &types.ParseOptions{Strict: true})
+	assert.NoError(t, err, "Failed to parse the header without the flag")
+	assert.Nil(t, reparsed.MAC)
+	assert.Nil(t, reparsed.Reserved)
+}
+
+// The metadata is written last, after the reserved data and the MAC
+func TestContainerSerializationMetadata(t *testing.T) {
+	data := serializeHeaderWithFlags(t, 0)
+	header, err := container.ParseContainerFileHeader(bytes.NewReader(data))
+	assert.NoError(t, err, "Failed to parse the header")
+	header.Flags = types.HeaderFlagMetadata | types.HeaderFlagAuthenticated | types.HeaderFlagCompactHeader
+	header.MAC = bytes.Repeat([]byte{0xa5}, container.HeaderMACSize)
+	err = container.WriteContainerFileHeader(io.Discard, header)
+	assert.ErrorIs(t, err, types.ErrParameterMissing, "The flag requires the metadata")
+
+	header.Metadata = []byte("sealed-metadata")
+	buffer := bytes.NewBuffer(nil)
+	err = container.WriteContainerFileHeader(buffer, header)
+	assert.NoError(t, err, "Failed to serialize the header")
+	assert.Equal(t, buffer.Len(), header.UsedSize())
+	reparsed, err := container.ParseContainerFileHeader(bytes.NewReader(buffer.Bytes()))
+	assert.NoError(t, err, "Failed to parse the header")
+	assert.Equal(t, header.MAC, reparsed.MAC)
+	assert.Equal(t, header.Metadata, reparsed.Metadata)
+	assert.Nil(t, reparsed.Reserved)
+
+	_, err = container.ParseContainerFileHeaderWithOptions(bytes.NewReader(buffer.Bytes()), &types.ParseOptions{
+		Limits: &types.ResourceLimits{MaxHeaderMetadata: len(header.Metadata) - 1},
+	})
+	assert.ErrorIs(t, err, types.ErrResourceLimitExceeded)
+
+	// Without the flag the metadata is ignored
+	data = buffer.Bytes()
+	binary.BigEndian.PutUint16(data[6:8], types.HeaderFlagAuthenticated|types.HeaderFlagCompactHeader)
+	reparsed, err = container.ParseContainerFileHeaderWithOptions(bytes.NewReader(data), &types.ParseOptions{Strict: true})
+	assert.NoError(t, err, "Failed to parse the header without the flag")
+	assert.Nil(t, reparsed.Metadata)
+}
+
+// The valid copy of the double-buffered header with the highest sequence wins, even across a wrap around
+func TestContainerParseDoubleBuffered(t *testing.T) {
+	header, err := container.ParseContainerFileHeader(bytes.NewReader(serializeHeaderWithFlags(t, types.HeaderFlagDoubleBuffered)))
+	assert.NoError(t, err, "Failed to parse the header")
+	assert.Equal(t, int64(2*container.HeaderSize), header.Size())
+
+	copies := func(first, second uint32) []byte {
+		data := make([]byte, 2*container.HeaderSize)
+		for _, sequence := range []uint32{first, second} {
+			header.Sequence = sequence
+			header.Reserved = binary.BigEndian.AppendUint32(nil, sequence)
+			region, err := container.SerializeHeaderCopy(header)
+			assert.NoError(t, err, "Failed to serialize the copy")
+			copy(data[header.CopyOffset():], region)
+		}
+		return data
+	}
+	for _, test := range []struct {
+		first, second, expected uint32
+	}{
+		{4, 5, 5},
+		{6, 5, 6},
+		{0, 0xffffffff, 0},
+	} {
+		data := copies(test.first, test.second)
+		decodedHeader, err := container.ParseContainerFileHeader(bytes.NewReader(data))
+		assert.NoError(t, err, "Failed to parse the header")
+		assert.Equal(t, test.expected, decodedHeader.Sequence)
+		assert.Equal(t, binary.BigEndian.AppendUint32(nil, test.expected), decodedHeader.Reserved)
+	}
+
+	// A torn copy is ignored, including when the magic itself is lost
+	data := copies(4, 5)
+	data[container.HeaderSize+100] ^= 1
+	decodedHeader, err := container.ParseContainerFileHeader(bytes.NewReader(data))
+	assert.NoError(t, err, "Failed to parse the header")
+	assert.Equal(t, uint32(4), decodedHeader.Sequence)
+	data = copies(4, 5)
+	data[0] ^= 1
+	decodedHeader, err = container.ParseContainerFileHeader(bytes.NewReader(data))
+	assert.NoError(t, err, "Failed to parse the header")
+	assert.Equal(t, uint32(5), decodedHeader.Sequence)
+	data[container.HeaderSize+100] ^= 1
+	_, err = container.ParseContainerFileHeader(bytes.NewReader(data))
+	assert.ErrorIs(t, err, types.ErrInvalidFileHeader)
+
+	// Any other torn field of the first copy falls back to the second one as well
+	data = copies(4, 5)
+	data[4] = 0xff
+	decodedHeader, err = container.ParseContainerFileHeader(bytes.NewReader(data))
+	assert.NoError(t, err, "Failed to parse the header")
+	assert.Equal(t, uint32(5), decodedHeader.Sequence)
+	data = copies(4, 5)
+	binary.BigEndian.PutUint16(data[6:8], 0)
+	data[9] = 0xff
+	decodedHeader, err = container.ParseContainerFileHeader(bytes.NewReader(data))
+	assert.NoError(t, err, "Failed to parse the header")
+	assert.Equal(t, uint32(5), decodedHeader.Sequence)
+}
+
+// The resource limits are enforced before the declared sizes are allocated
+func TestContainerParseResourceLimits(t *testing.T) {
+	data := serializeHeaderWithFlags(t, 0)
+	header, err := container.ParseContainerFileHeader(bytes.NewReader(data))
+	assert.NoError(t, err, "Failed to parse the header")
+	header.Slots = append(header.Slots, header.Slots[0])
+	header.Reserved = []byte("application data")
+	buffer := bytes.NewBuffer(nil)
+	err = container.WriteContainerFileHeader(buffer, header)
+	assert.NoError(t, err, "Failed to serialize the header")
+
+	for _, test := range []struct {
+		limits types.ResourceLimits
+		what   string
+	}{
+		{types.ResourceLimits{MaxSlots: 1}, "the number of slots"},
+		{types.ResourceLimits{MaxSlotSize: len(header.Slots[0].SlotContent) - 1}, "the slot content"},
+		{types.ResourceLimits{MaxHeaderMetadata: len(header.Reserved) - 1}, "the reserved data"},
+	} {
+		options := &types.ParseOptions{Limits: &test.limits}
+		_, err = container.ParseContainerFileHeaderWithOptions(bytes.NewReader(buffer.Bytes()), options)
+		assert.ErrorIs(t, err, types.ErrResourceLimitExceeded)
+		assert.ErrorContains(t, err, test.what)
+	}
+	limits := &types.ResourceLimits{MaxSlots: 2, MaxSlotSize: len(header.Slots[0].SlotContent), MaxHeaderMetadata: len(header.Reserved)}
+	_, err = container.ParseContainerFileHeaderWithOptions(bytes.NewReader(buffer.Bytes()), &types.ParseOptions{Limits: limits})
+	assert.NoError(t, err, "The header is within the limits")
+}
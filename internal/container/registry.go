@@ -0,0 +1,64 @@
+package container
+
+import (
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: internal/container/registry.go
+// This file keeps the registries of the algorithms implemented by this build.
+// The algorithms built on a primitive which can be left out of the build are registered only when the primitive
+// is compiled in, see internal/cipher/registry.go. The others only need the standard library and are always present.
+
+// Primitive needed by the encryption algorithms which can be left out of the build
+var encryptionAlgorithmPrimitives = map[types.EncryptionAlgorithm]ic.Primitive{
+	types.EncAlgChaCha20Poly1305: ic.PrimitiveChaCha20Poly1305,
+}
+
+// Primitive needed by the slot algorithms which can be left out of the build
+var slotAlgorithmPrimitives = map[types.SlotKeyAlgorithm]ic.Primitive{
+	types.SlotKeyAlgArgon2id: ic.PrimitiveArgon2id,
+	types.SlotKeyAlgScrypt:   ic.PrimitiveScrypt,
+}
+
+// Whether the encryption algorithm is known and compiled into this build
+func EncryptionAlgorithmAvailable(alg types.EncryptionAlgorithm) bool {
+	if alg >= types.EncAlgEnd {
+		return false
+	}
+	primitive, optional := encryptionAlgorithmPrimitives[alg]
+	return !optional || ic.IsCompiledIn(primitive)
+}
+
+// Whether the slot algorithm is known and compiled into this build
+func SlotAlgorithmAvailable(alg types.SlotKeyAlgorithm) bool {
+	if alg >= types.SlotKeyAlgEnd {
+		return false
+	}
+	primitive, optional := slotAlgorithmPrimitives[alg]
+	return !optional || ic.IsCompiledIn(primitive)
+}
+
+// Check the encryption algorithm can be used by this build.
+// A known algorithm left out of the build fails with types.ErrAlgorithmNotCompiledIn
+func CheckEncryptionAlgorithm(alg types.EncryptionAlgorithm) error {
+	if alg >= types.EncAlgEnd {
+		return types.NewEncryptionAlgorithmUnavailableError(types.ErrUnsupportedEncAlgo, alg)
+	}
+	if !EncryptionAlgorithmAvailable(alg) {
+		return types.NewEncryptionAlgorithmUnavailableError(types.ErrAlgorithmNotCompiledIn, alg)
+	}
+	return nil
+}
+
+// Check the slot algorithm can be used by this build.
+// A known algorithm left out of the build fails with types.ErrAlgorithmNotCompiledIn
+func CheckSlotAlgorithm(alg types.SlotKeyAlgorithm) error {
+	if alg >= types.SlotKeyAlgEnd {
+		return types.NewSlotAlgorithmUnavailableError(types.ErrUnsupportedSlotAlgo, alg)
+	}
+	if !SlotAlgorithmAvailable(alg) {
+		return types.NewSlotAlgorithmUnavailableError(types.ErrAlgorithmNotCompiledIn, alg)
+	}
+	return nil
+}
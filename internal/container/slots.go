@@ -1,7 +1,9 @@
 package container
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 
 	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
@@ -14,6 +16,10 @@ import (
 // The slot is marked as destroyed
 const FlagSlotDestroyed uint16 = 1 << 15
 
+// The slot was written under an authenticated header, unsealing it requires the header MAC
+// even when the header flag is stripped
+const FlagSlotHeaderAuthenticated uint16 = 1 << 0
+
 type ContainerKeySlot struct {
 	SlotKeyAlgorithm types.SlotKeyAlgorithm // Algorithm used for the slot encryption
 	Flags            uint16                 // Flags for the slot
@@ -49,6 +55,14 @@ func NewContainerKeySlot(alg types.SlotKeyAlgorithm, flags uint16, rootKey, slot
 		if err != nil {
 			return nil, err
 		}
+	case types.SlotKeyAlgAESGCMSIV256:
+		if len(slotKey) != alg.KeySize() {
+			return nil, ic.ErrKeySizeInvalid
+		}
+		slot.SlotContent, err = ic.AESGCMSIVEncryptDirect(slotKey, rootKey, nil)
+		if err != nil {
+			return nil, err
+		}
 
 	default:
 		return nil, types.ErrUnsupportedSlotAlgo
@@ -61,6 +75,73 @@ func NewContainerKeySlot(alg types.SlotKeyAlgorithm, flags uint16, rootKey, slot
 	return slot, nil
 }
 
+// Size of the random nonce in front of the content of the GCM and GCM-SIV slots
+const slotNonceSize = 12
+
+// Bytes added to the root key in the content of the GCM slots: nonce || ciphertext || tag
+const GCMSlotContentOverhead = slotNonceSize + 16
+
+// Get the nonce in front of the slot content, nil when the slot does not store it there
+func (slot *ContainerKeySlot) nonce() []byte {
+	switch slot.SlotKeyAlgorithm {
+	case types.SlotKeyAlgAESGCM128, types.SlotKeyAlgAESGCM256, types.SlotKeyAlgAnonymous, types.SlotKeyAlgAESGCMSIV256:
+		if len(slot.SlotContent) >= slotNonceSize {
+			return slot.SlotContent[:slotNonceSize]
+		}
+	}
+	return nil
+}
+
+// CheckSlotNonceUnique makes sure the nonce of the new slot is not used by any of the slots.
+// Random nonces colliding is astronomically unlikely, this is only a safety net against a broken random source.
+//
+// Returns ErrSlotNonceCollision if the nonce is already used
+func CheckSlotNonceUnique(slots []*ContainerKeySlot, slot *ContainerKeySlot) error {
+	nonce := slot.nonce()
+	if nonce == nil {
+		return nil
+	}
+	for _, other := range slots {
+		if bytes.Equal(other.nonce(), nonce) {
+			return types.ErrSlotNonceCollision
+		}
+	}
+	return nil
+}
+
+// Create a slot whose content is a length prefixed non-secret value followed by the wrapped root key.
+// Content layout: prefix length (uint16) || prefix || wrapped root key
+func newPrefixedSlot(alg types.SlotKeyAlgorithm, flags uint16, prefix, wrapped []byte) (*ContainerKeySlot, error) {
+	if len(prefix) > 0xFFFF {
+		return nil, types.ErrSlotContentTooLarge
+	}
+	content := make([]byte, 2, 2+len(prefix)+len(wrapped))
+	binary.BigEndian.PutUint16(content, uint16(len(prefix)))
+	content = append(content, prefix...)
+	content = append(content, wrapped...)
+	if len(content) > 0xFFFF {
+		return nil, types.ErrSlotContentTooLarge
+	}
+	return &ContainerKeySlot{
+		SlotKeyAlgorithm: alg,
+		Flags:            flags,
+		Size:             uint16(len(content)),
+		SlotContent:      content,
+	}, nil
+}
+
+// Split the content created by newPrefixedSlot into the prefix and the wrapped root key
+func (slot *ContainerKeySlot) splitPrefixedContent() (prefix, wrapped []byte, err error) {
+	if len(slot.SlotContent) < 2 {
+		return nil, nil, types.ErrSlotContentMalformed
+	}
+	prefixLength := int(binary.BigEndian.Uint16(slot.SlotContent))
+	if len(slot.SlotContent) < 2+prefixLength {
+		return nil, nil, types.ErrSlotContentMalformed
+	}
+	return slot.SlotContent[2 : 2+prefixLength], slot.SlotContent[2+prefixLength:], nil
+}
+
 // Unseal the slot using the key to reveal the rootkey
 //
 // TODO: maybe create a version that its underlaying buffer are pinned in memory?
@@ -68,6 +149,9 @@ func (slot *ContainerKeySlot) Unseal(slotkey []byte) (rootkey []byte, err error)
 	if slot.SlotKeyAlgorithm >= types.SlotKeyAlgEnd {
 		return nil, types.ErrUnsupportedSlotAlgo
 	}
+	if err := CheckSlotAlgorithm(slot.SlotKeyAlgorithm); err != nil {
+		return nil, err
+	}
 	if len(slotkey) == 0 {
 		return nil, types.ErrParameterMissing
 	}
@@ -79,6 +163,34 @@ func (slot *ContainerKeySlot) Unseal(slotkey []byte) (rootkey []byte, err error)
 			return nil, ic.ErrKeySizeInvalid
 		}
 		return ic.AESGCMDecryptDirect(slotkey, slot.SlotContent, nil)
+	case types.SlotKeyAlgExternalKMS:
+		if len(slotkey) != slot.SlotKeyAlgorithm.KeySize() {
+			return nil, ic.ErrKeySizeInvalid
+		}
+		_, wrapped, err := slot.splitKMSContent()
+		if err != nil {
+			return nil, err
+		}
+		return ic.AESGCMDecryptDirect(slotkey, wrapped, nil)
+	case types.SlotKeyAlgTokenHMAC:
+		return slot.unsealToken(slotkey)
+	case types.SlotKeyAlgArgon2id:
+		return slot.unsealPassword(slotkey)
+	case types.SlotKeyAlgScrypt:
+		return slot.unsealScrypt(slotkey)
+	case types.SlotKeyAlgPBKDF2SHA256:
+		return slot.unsealPBKDF2(slotkey)
+	case types.SlotKeyAlgRSAOAEP2048:
+		return slot.unsealRSA(slotkey)
+	case types.SlotKeyAlgX25519:
+		return slot.unsealX25519(slotkey)
+	case types.SlotKeyAlgAnonymous:
+		return slot.unsealAnonymous(slotkey)
+	case types.SlotKeyAlgAESGCMSIV256:
+		if len(slotkey) != slot.SlotKeyAlgorithm.KeySize() {
+			return nil, ic.ErrKeySizeInvalid
+		}
+		return ic.AESGCMSIVDecryptDirect(slotkey, slot.SlotContent, nil)
 	default:
 		return nil, types.ErrUnsupportedSlotAlgo
 	}
@@ -0,0 +1,58 @@
+package container
+
+import (
+	"slices"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: internal/container/slots_anonymous.go
+// This file contain APIs for anonymous slots, where the slot algorithm is replaced by SlotKeyAlgAnonymous
+// so an observer of the header cannot tell which kind of credential unlocks the slot.
+//
+// Only the algorithms whose slot content has the same layout and size can be hidden, otherwise the
+// content itself would leak the algorithm.
+
+// Algorithms that can be hidden behind an anonymous slot, attempted in order on unseal
+var anonymousSlotAlgorithms = []types.SlotKeyAlgorithm{
+	types.SlotKeyAlgAESGCM128,
+	types.SlotKeyAlgAESGCM256,
+}
+
+// Whether the algorithm can be hidden behind an anonymous slot
+func CanBeAnonymous(alg types.SlotKeyAlgorithm) bool {
+	return slices.Contains(anonymousSlotAlgorithms, alg)
+}
+
+// NewContainerAnonymousSlot initialize a slot using the algorithm, then hide the algorithm
+func NewContainerAnonymousSlot(alg types.SlotKeyAlgorithm, flags uint16, rootKey, slotKey []byte) (*ContainerKeySlot, error) {
+	if !CanBeAnonymous(alg) {
+		return nil, types.ErrUnsupportedSlotAlgo
+	}
+	slot, err := NewContainerKeySlot(alg, flags, rootKey, slotKey)
+	if err != nil {
+		return nil, err
+	}
+	slot.SlotKeyAlgorithm = types.SlotKeyAlgAnonymous
+	return slot, nil
+}
+
+// Whether the slot may be unsealed by a key of the algorithm
+func (slot *ContainerKeySlot) Accepts(alg types.SlotKeyAlgorithm) bool {
+	return slot.SlotKeyAlgorithm == alg || (slot.SlotKeyAlgorithm == types.SlotKeyAlgAnonymous && CanBeAnonymous(alg))
+}
+
+// Unseal the anonymous slot by attempting every algorithm which accepts the key
+func (slot *ContainerKeySlot) unsealAnonymous(slotkey []byte) (rootKey []byte, err error) {
+	err = ic.ErrKeySizeInvalid
+	for _, alg := range anonymousSlotAlgorithms {
+		if len(slotkey) != alg.KeySize() {
+			continue
+		}
+		if rootKey, err = ic.AESGCMDecryptDirect(slotkey, slot.SlotContent, nil); err == nil {
+			return rootKey, nil
+		}
+	}
+	return nil, err
+}
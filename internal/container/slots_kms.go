@@ -0,0 +1,48 @@
+package container
+
+import (
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: internal/container/slots_kms.go
+// This file contain APIs for slots where the unwrapping key is held by an external keyring/KMS.
+//
+// Slot content layout:
+// Key identifier length (uint16)
+// Key identifier (non-secret, e.g. URI of the KMS key)
+// AES-GCM wrapped root key (nonce || ciphertext || tag)
+
+// NewContainerKMSSlot initialize a slot where the rootKey is wrapped by the key resolved from the keyring.
+// Only the identifier is stored in the slot, the key itself must be supplied again on unseal
+func NewContainerKMSSlot(flags uint16, rootKey []byte, keyID string, kmsKey []byte) (*ContainerKeySlot, error) {
+	if len(rootKey) == 0 || len(keyID) == 0 || len(kmsKey) == 0 {
+		return nil, types.ErrParameterMissing
+	}
+	if len(keyID) > 0xFFFF {
+		return nil, types.ErrSlotContentTooLarge
+	}
+	if len(kmsKey) != types.SlotKeyAlgExternalKMS.KeySize() {
+		return nil, ic.ErrKeySizeInvalid
+	}
+	wrapped, err := ic.AESGCMEncryptDirect(kmsKey, rootKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newPrefixedSlot(types.SlotKeyAlgExternalKMS, flags, []byte(keyID), wrapped)
+}
+
+// Split the content of the KMS slot into the key identifier and the wrapped root key
+func (slot *ContainerKeySlot) splitKMSContent() (keyID string, wrapped []byte, err error) {
+	if slot.SlotKeyAlgorithm != types.SlotKeyAlgExternalKMS {
+		return "", nil, types.ErrUnsupportedSlotAlgo
+	}
+	prefix, wrapped, err := slot.splitPrefixedContent()
+	return string(prefix), wrapped, err
+}
+
+// Get the identifier of the key used to wrap the root key in the KMS slot
+func (slot *ContainerKeySlot) KMSKeyID() (string, error) {
+	keyID, _, err := slot.splitKMSContent()
+	return keyID, err
+}
@@ -0,0 +1,134 @@
+package container
+
+import (
+	"encoding/binary"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: internal/container/slots_password.go
+// This file contain APIs for slots unlocked by a passphrase.
+//
+// Slot content layout:
+// Parameters length (uint16)
+// Time (uint32), memory in KiB (uint32), threads (uint8), salt
+// AES-GCM-256 wrapped root key, where the key is Argon2id(passphrase, salt, time, memory, threads)
+
+// Size of the parameters in front of the salt
+const passwordParamsSize = 9
+
+// Upper bounds of the cost accepted from a file, so a crafted slot cannot exhaust the memory (4 GiB) or stall the unseal.
+// Use ResourceLimits.MaxKDFMemory for a tighter bound on the memory
+const (
+	maxPasswordMemory  = 4 * 1024 * 1024
+	maxPasswordTime    = 64
+	maxPasswordThreads = 64
+)
+
+// Derive the wrapping key from the passphrase
+func derivePasswordWrappingKey(password, salt []byte, params types.PasswordParams) ([]byte, error) {
+	return ic.Argon2IDKey(password, salt, params.Time, params.Memory, params.Threads, 32)
+}
+
+// Check the parameters are usable and within the bounds accepted from a file
+func validatePasswordParams(params types.PasswordParams) error {
+	if params.Time == 0 || params.Time > maxPasswordTime || params.Threads == 0 || params.Threads > maxPasswordThreads ||
+		params.Memory == 0 || params.Memory > maxPasswordMemory {
+		return types.ErrSlotContentMalformed
+	}
+	return nil
+}
+
+// NewContainerPasswordSlot initialize a slot where the rootKey is wrapped by the key derived from the passphrase.
+// The salt must be random and unique to the slot, it is stored in the slot along the parameters
+func NewContainerPasswordSlot(flags uint16, rootKey, password, salt []byte, params types.PasswordParams) (*ContainerKeySlot, error) {
+	if len(rootKey) == 0 || len(password) == 0 || len(salt) == 0 {
+		return nil, types.ErrParameterMissing
+	}
+	if err := CheckSlotAlgorithm(types.SlotKeyAlgArgon2id); err != nil {
+		return nil, err
+	}
+	if err := validatePasswordParams(params); err != nil {
+		return nil, err
+	}
+	key, err := derivePasswordWrappingKey(password, salt, params)
+	if err != nil {
+		return nil, err
+	}
+	defer ic.WipeBufferSecure(key)
+	wrapped, err := ic.AESGCMEncryptDirect(key, rootKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, passwordParamsSize, passwordParamsSize+len(salt))
+	binary.BigEndian.PutUint32(prefix[0:], params.Time)
+	binary.BigEndian.PutUint32(prefix[4:], params.Memory)
+	prefix[8] = params.Threads
+	return newPrefixedSlot(types.SlotKeyAlgArgon2id, flags, append(prefix, salt...), wrapped)
+}
+
+// Get the parameters and the salt stored in the passphrase slot
+func (slot *ContainerKeySlot) PasswordParams() (params types.PasswordParams, salt []byte, err error) {
+	if slot.SlotKeyAlgorithm != types.SlotKeyAlgArgon2id {
+		return params, nil, types.ErrUnsupportedSlotAlgo
+	}
+	prefix, _, err := slot.splitPrefixedContent()
+	if err != nil {
+		return params, nil, err
+	}
+	if len(prefix) <= passwordParamsSize {
+		return params, nil, types.ErrSlotContentMalformed
+	}
+	params = types.PasswordParams{
+		Time:    binary.BigEndian.Uint32(prefix[0:]),
+		Memory:  binary.BigEndian.Uint32(prefix[4:]),
+		Threads: prefix[8],
+	}
+	return params, append([]byte(nil), prefix[passwordParamsSize:]...), nil
+}
+
+// Bytes of memory the key derivation of the slot takes, zero for the slots without a memory-hard derivation
+func (slot *ContainerKeySlot) DerivationMemory() (int64, error) {
+	switch slot.SlotKeyAlgorithm {
+	case types.SlotKeyAlgArgon2id:
+		params, _, err := slot.PasswordParams()
+		if err != nil {
+			return 0, err
+		}
+		return int64(params.Memory) * 1024, nil
+	case types.SlotKeyAlgScrypt:
+		params, _, err := slot.ScryptParams()
+		if err != nil {
+			return 0, err
+		}
+		if err := validateScryptParams(params); err != nil {
+			return 0, err
+		}
+		// 128 * r * N for the mixing and 128 * r * p for the blocks
+		return 128 * int64(params.BlockSize) * (int64(1)<<params.LogN + int64(params.Parallelism)), nil
+	default:
+		return 0, nil
+	}
+}
+
+// Unseal the passphrase slot, the parameters are checked before the costly derivation
+func (slot *ContainerKeySlot) unsealPassword(password []byte) ([]byte, error) {
+	params, salt, err := slot.PasswordParams()
+	if err != nil {
+		return nil, err
+	}
+	if err := validatePasswordParams(params); err != nil {
+		return nil, err
+	}
+	_, wrapped, err := slot.splitPrefixedContent()
+	if err != nil {
+		return nil, err
+	}
+	key, err := derivePasswordWrappingKey(password, salt, params)
+	if err != nil {
+		return nil, err
+	}
+	defer ic.WipeBufferSecure(key)
+	return ic.AESGCMDecryptDirect(key, wrapped, nil)
+}
@@ -0,0 +1,190 @@
+package container
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/binary"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: internal/container/slots_password_compat.go
+// This file contain APIs for passphrase slots derived with scrypt or PBKDF2, for the environments lacking Argon2id.
+//
+// Slot content layout:
+// Parameters length (uint16)
+// Scrypt: log2 of N (uint8), r (uint32), p (uint32), salt
+// PBKDF2: iterations (uint32), salt
+// AES-GCM-256 wrapped root key, where the key is derived from the passphrase and the salt with the parameters
+
+// Size of the parameters in front of the salt
+const (
+	scryptParamsSize = 9
+	pbkdf2ParamsSize = 4
+)
+
+// Upper bounds of the cost accepted from a file, so a crafted slot cannot stall the unseal
+const (
+	maxScryptParallelism = 64
+	maxPBKDF2Iterations  = 1 << 26
+)
+
+// Check the scrypt parameters are usable and within the bounds accepted from a file, the memory bound is the one of Argon2id
+func validateScryptParams(params types.ScryptParams) error {
+	if params.LogN == 0 || params.LogN > 31 || params.BlockSize == 0 || params.Parallelism == 0 || params.Parallelism > maxScryptParallelism {
+		return types.ErrSlotContentMalformed
+	}
+	if uint64(params.BlockSize)*uint64(params.Parallelism) >= 1<<30 {
+		return types.ErrSlotContentMalformed
+	}
+	// 128 * r * N bytes, compared in KiB
+	if uint64(params.BlockSize)<<params.LogN/8 > maxPasswordMemory {
+		return types.ErrSlotContentMalformed
+	}
+	return nil
+}
+
+// Check the PBKDF2 parameters are usable and within the bounds accepted from a file
+func validatePBKDF2Params(params types.PBKDF2Params) error {
+	if params.Iterations == 0 || params.Iterations > maxPBKDF2Iterations {
+		return types.ErrSlotContentMalformed
+	}
+	return nil
+}
+
+// Derive the wrapping key from the passphrase with PBKDF2-HMAC-SHA256
+func derivePBKDF2WrappingKey(password, salt []byte, params types.PBKDF2Params) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, string(password), salt, int(params.Iterations), 32)
+}
+
+// Wrap the root key under the key derived from the passphrase
+func newPasswordCompatSlot(alg types.SlotKeyAlgorithm, flags uint16, rootKey, key, prefix []byte) (*ContainerKeySlot, error) {
+	defer ic.WipeBufferSecure(key)
+	wrapped, err := ic.AESGCMEncryptDirect(key, rootKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newPrefixedSlot(alg, flags, prefix, wrapped)
+}
+
+// NewContainerScryptSlot initialize a slot where the rootKey is wrapped by the key derived from the passphrase with scrypt.
+// The salt must be random and unique to the slot, it is stored in the slot along the parameters
+func NewContainerScryptSlot(flags uint16, rootKey, password, salt []byte, params types.ScryptParams) (*ContainerKeySlot, error) {
+	if len(rootKey) == 0 || len(password) == 0 || len(salt) == 0 {
+		return nil, types.ErrParameterMissing
+	}
+	if err := CheckSlotAlgorithm(types.SlotKeyAlgScrypt); err != nil {
+		return nil, err
+	}
+	if err := validateScryptParams(params); err != nil {
+		return nil, err
+	}
+	key, err := ic.ScryptKey(password, salt, params.LogN, params.BlockSize, params.Parallelism, 32)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, scryptParamsSize, scryptParamsSize+len(salt))
+	prefix[0] = params.LogN
+	binary.BigEndian.PutUint32(prefix[1:], params.BlockSize)
+	binary.BigEndian.PutUint32(prefix[5:], params.Parallelism)
+	return newPasswordCompatSlot(types.SlotKeyAlgScrypt, flags, rootKey, key, append(prefix, salt...))
+}
+
+// NewContainerPBKDF2Slot initialize a slot where the rootKey is wrapped by the key derived from the passphrase with PBKDF2-HMAC-SHA256.
+// The salt must be random and unique to the slot, it is stored in the slot along the iterations
+func NewContainerPBKDF2Slot(flags uint16, rootKey, password, salt []byte, params types.PBKDF2Params) (*ContainerKeySlot, error) {
+	if len(rootKey) == 0 || len(password) == 0 || len(salt) == 0 {
+		return nil, types.ErrParameterMissing
+	}
+	if err := validatePBKDF2Params(params); err != nil {
+		return nil, err
+	}
+	key, err := derivePBKDF2WrappingKey(password, salt, params)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, pbkdf2ParamsSize, pbkdf2ParamsSize+len(salt))
+	binary.BigEndian.PutUint32(prefix, params.Iterations)
+	return newPasswordCompatSlot(types.SlotKeyAlgPBKDF2SHA256, flags, rootKey, key, append(prefix, salt...))
+}
+
+// Split the parameters of the given size and the salt stored in the slot
+func (slot *ContainerKeySlot) passwordCompatPrefix(alg types.SlotKeyAlgorithm, paramsSize int) (params, salt []byte, err error) {
+	if slot.SlotKeyAlgorithm != alg {
+		return nil, nil, types.ErrUnsupportedSlotAlgo
+	}
+	prefix, _, err := slot.splitPrefixedContent()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(prefix) <= paramsSize {
+		return nil, nil, types.ErrSlotContentMalformed
+	}
+	return prefix[:paramsSize], append([]byte(nil), prefix[paramsSize:]...), nil
+}
+
+// Get the parameters and the salt stored in the scrypt slot
+func (slot *ContainerKeySlot) ScryptParams() (params types.ScryptParams, salt []byte, err error) {
+	raw, salt, err := slot.passwordCompatPrefix(types.SlotKeyAlgScrypt, scryptParamsSize)
+	if err != nil {
+		return params, nil, err
+	}
+	params = types.ScryptParams{
+		LogN:        raw[0],
+		BlockSize:   binary.BigEndian.Uint32(raw[1:]),
+		Parallelism: binary.BigEndian.Uint32(raw[5:]),
+	}
+	return params, salt, nil
+}
+
+// Get the parameters and the salt stored in the PBKDF2 slot
+func (slot *ContainerKeySlot) PBKDF2Params() (params types.PBKDF2Params, salt []byte, err error) {
+	raw, salt, err := slot.passwordCompatPrefix(types.SlotKeyAlgPBKDF2SHA256, pbkdf2ParamsSize)
+	if err != nil {
+		return params, nil, err
+	}
+	return types.PBKDF2Params{Iterations: binary.BigEndian.Uint32(raw)}, salt, nil
+}
+
+// Unwrap the root key with the key derived from the passphrase
+func (slot *ContainerKeySlot) unwrapPasswordCompat(key []byte) ([]byte, error) {
+	defer ic.WipeBufferSecure(key)
+	_, wrapped, err := slot.splitPrefixedContent()
+	if err != nil {
+		return nil, err
+	}
+	return ic.AESGCMDecryptDirect(key, wrapped, nil)
+}
+
+// Unseal the scrypt slot, the parameters are checked before the costly derivation
+func (slot *ContainerKeySlot) unsealScrypt(password []byte) ([]byte, error) {
+	params, salt, err := slot.ScryptParams()
+	if err != nil {
+		return nil, err
+	}
+	if err := validateScryptParams(params); err != nil {
+		return nil, err
+	}
+	key, err := ic.ScryptKey(password, salt, params.LogN, params.BlockSize, params.Parallelism, 32)
+	if err != nil {
+		return nil, err
+	}
+	return slot.unwrapPasswordCompat(key)
+}
+
+// Unseal the PBKDF2 slot, the parameters are checked before the costly derivation
+func (slot *ContainerKeySlot) unsealPBKDF2(password []byte) ([]byte, error) {
+	params, salt, err := slot.PBKDF2Params()
+	if err != nil {
+		return nil, err
+	}
+	if err := validatePBKDF2Params(params); err != nil {
+		return nil, err
+	}
+	key, err := derivePBKDF2WrappingKey(password, salt, params)
+	if err != nil {
+		return nil, err
+	}
+	return slot.unwrapPasswordCompat(key)
+}
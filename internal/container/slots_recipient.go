@@ -0,0 +1,147 @@
+package container
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: internal/container/slots_recipient.go
+// This file contain APIs for slots wrapping the root key to the public key of a recipient.
+//
+// RSA slot content layout:
+// RSA-OAEP-SHA256 ciphertext of the root key, labelled with rsaSlotLabel
+// It is unsealed with the PKCS #8 (or PKCS #1) DER encoding of the private key.
+//
+// X25519 slot content layout:
+// Prefix length (uint16)
+// Ephemeral public key (32 bytes)
+// AES-GCM-256 wrapped root key, where the key is HKDF-SHA256(X25519(ephemeral, recipient), ephemeral || recipient)
+// It is unsealed with the 32 bytes private key.
+
+// Smallest RSA modulus accepted, in bits
+const minRSASlotBits = 2048
+
+// Labels binding the ciphertexts to their use
+var (
+	rsaSlotLabel    = []byte("filecrypt-rsa-slot")
+	x25519SlotLabel = []byte("filecrypt-x25519-slot")
+)
+
+// NewContainerRSASlot initialize a slot where the rootKey is encrypted to the RSA public key, which must have at least 2048 bits
+func NewContainerRSASlot(flags uint16, rootKey []byte, publicKey *rsa.PublicKey) (*ContainerKeySlot, error) {
+	if len(rootKey) == 0 || publicKey == nil {
+		return nil, types.ErrParameterMissing
+	}
+	if publicKey.N.BitLen() < minRSASlotBits {
+		return nil, ic.ErrKeySizeInvalid
+	}
+	content, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, rootKey, rsaSlotLabel)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > 0xFFFF {
+		return nil, types.ErrSlotContentTooLarge
+	}
+	return &ContainerKeySlot{
+		SlotKeyAlgorithm: types.SlotKeyAlgRSAOAEP2048,
+		Flags:            flags,
+		Size:             uint16(len(content)),
+		SlotContent:      content,
+	}, nil
+}
+
+// Parse the DER encoded RSA private key, PKCS #8 or PKCS #1
+func parseRSAPrivateKey(der []byte) (*rsa.PrivateKey, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+			return rsaKey, nil
+		}
+		return nil, ic.ErrKeySizeInvalid
+	}
+	key, err := x509.ParsePKCS1PrivateKey(der)
+	if err != nil {
+		return nil, ic.ErrKeySizeInvalid
+	}
+	return key, nil
+}
+
+// Unseal the RSA slot with the DER encoded private key
+func (slot *ContainerKeySlot) unsealRSA(der []byte) ([]byte, error) {
+	privateKey, err := parseRSAPrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	return rsa.DecryptOAEP(sha256.New(), nil, privateKey, slot.SlotContent, rsaSlotLabel)
+}
+
+// Derive the wrapping key from the shared secret, bound to both public keys
+func deriveX25519WrappingKey(shared, ephemeral, recipient []byte) ([]byte, error) {
+	keys, err := ic.DeriveKeysFromMasterKeyWithContext(shared, append(append([]byte(nil), ephemeral...), recipient...), x25519SlotLabel, []int{32})
+	if err != nil {
+		return nil, err
+	}
+	return keys[0], nil
+}
+
+// NewContainerX25519Slot initialize a slot where the rootKey is wrapped by the key agreed with the X25519 public key.
+// A fresh ephemeral key is generated for every slot and its public part is stored in the slot
+func NewContainerX25519Slot(flags uint16, rootKey []byte, publicKey *ecdh.PublicKey) (*ContainerKeySlot, error) {
+	if len(rootKey) == 0 || publicKey == nil {
+		return nil, types.ErrParameterMissing
+	}
+	if publicKey.Curve() != ecdh.X25519() {
+		return nil, types.ErrUnsupportedSlotAlgo
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	defer ic.WipeBufferSecure(shared)
+	key, err := deriveX25519WrappingKey(shared, ephemeral.PublicKey().Bytes(), publicKey.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	defer ic.WipeBufferSecure(key)
+	wrapped, err := ic.AESGCMEncryptDirect(key, rootKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newPrefixedSlot(types.SlotKeyAlgX25519, flags, ephemeral.PublicKey().Bytes(), wrapped)
+}
+
+// Unseal the X25519 slot with the 32 bytes private key
+func (slot *ContainerKeySlot) unsealX25519(privateKeyBytes []byte) ([]byte, error) {
+	privateKey, err := ecdh.X25519().NewPrivateKey(privateKeyBytes)
+	if err != nil {
+		return nil, ic.ErrKeySizeInvalid
+	}
+	prefix, wrapped, err := slot.splitPrefixedContent()
+	if err != nil {
+		return nil, err
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(prefix)
+	if err != nil {
+		return nil, types.ErrSlotContentMalformed
+	}
+	shared, err := privateKey.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	defer ic.WipeBufferSecure(shared)
+	key, err := deriveX25519WrappingKey(shared, prefix, privateKey.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	defer ic.WipeBufferSecure(key)
+	return ic.AESGCMDecryptDirect(key, wrapped, nil)
+}
@@ -1,6 +1,12 @@
 package container_test
 
 import (
+	"bytes"
+	"crypto/ecdh"
+	crand "crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"math/rand/v2"
 	"testing"
 
 	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
@@ -24,3 +30,246 @@ func TestSlotCreationAndUnsealing(t *testing.T) {
 
 	assert.ElementsMatch(t, rootKey, unsealedRoot, "the unsealed key does not match with root key")
 }
+
+func TestKMSSlotCreationAndUnsealing(t *testing.T) {
+	rootKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "Failed to generate root key")
+
+	kmsKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "Failed to generate kms key")
+
+	slot, err := container.NewContainerKMSSlot(0, rootKey, "kms://keys/1", kmsKey)
+	assert.NoError(t, err, "Failed to create slot")
+
+	keyID, err := slot.KMSKeyID()
+	assert.NoError(t, err, "Failed to read the key id")
+	assert.Equal(t, "kms://keys/1", keyID)
+
+	unsealedRoot, err := slot.Unseal(kmsKey)
+	assert.NoError(t, err, "Failed to unseal slot")
+	assert.Equal(t, rootKey, unsealedRoot, "the unsealed key does not match with root key")
+}
+
+func TestTokenSlotCreationAndUnsealing(t *testing.T) {
+	rootKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "Failed to generate root key")
+
+	challenge := []byte("challenge")
+	response := []byte("20 bytes of response")
+
+	slot, err := container.NewContainerTokenSlot(0, rootKey, challenge, response)
+	assert.NoError(t, err, "Failed to create slot")
+
+	storedChallenge, err := slot.TokenChallenge()
+	assert.NoError(t, err, "Failed to read the challenge")
+	assert.Equal(t, challenge, storedChallenge)
+
+	_, err = slot.Unseal([]byte("a different response"))
+	assert.Error(t, err, "the slot should not unseal with a wrong response")
+
+	unsealedRoot, err := slot.Unseal(response)
+	assert.NoError(t, err, "Failed to unseal slot")
+	assert.Equal(t, rootKey, unsealedRoot, "the unsealed key does not match with root key")
+}
+
+func TestTPMSlotContent(t *testing.T) {
+	_, err := container.NewContainerTPMSlot(0, nil, nil)
+	assert.ErrorIs(t, err, types.ErrParameterMissing)
+
+	slot, err := container.NewContainerTPMSlot(0, []byte("pcr 0,7"), []byte("sealed blob"))
+	assert.NoError(t, err, "Failed to create slot")
+	policy, sealed, err := slot.TPMSealedContent()
+	assert.NoError(t, err, "Failed to read the sealed content")
+	assert.Equal(t, []byte("pcr 0,7"), policy)
+	assert.Equal(t, []byte("sealed blob"), sealed)
+
+	// The TPM unseals the root key, there is no slot key
+	_, err = slot.Unseal([]byte("any key"))
+	assert.ErrorIs(t, err, types.ErrUnsupportedSlotAlgo)
+}
+
+// Skip the test when the slot algorithm is left out of this build, see the no_* build tags
+func skipUnlessSlotAlgorithm(t *testing.T, alg types.SlotKeyAlgorithm) {
+	t.Helper()
+	if !container.SlotAlgorithmAvailable(alg) {
+		t.Skipf("the slot algorithm %d is not compiled in", alg)
+	}
+}
+
+func TestPasswordSlotContent(t *testing.T) {
+	skipUnlessSlotAlgorithm(t, types.SlotKeyAlgArgon2id)
+	rootKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "Failed to generate root key")
+	params := types.PasswordParams{Time: 1, Memory: 64, Threads: 1}
+	_, err = container.NewContainerPasswordSlot(0, rootKey, []byte("hunter2"), []byte("somesalt"), types.PasswordParams{})
+	assert.ErrorIs(t, err, types.ErrSlotContentMalformed)
+	slot, err := container.NewContainerPasswordSlot(0, rootKey, []byte("hunter2"), []byte("somesalt"), params)
+	assert.NoError(t, err, "Failed to create slot")
+	storedParams, salt, err := slot.PasswordParams()
+	assert.NoError(t, err, "Failed to read the parameters")
+	assert.Equal(t, params, storedParams)
+	assert.Equal(t, []byte("somesalt"), salt)
+
+	unsealedRoot, err := slot.Unseal([]byte("hunter2"))
+	assert.NoError(t, err, "Failed to unseal slot")
+	assert.Equal(t, rootKey, unsealedRoot, "the unsealed key does not match with root key")
+	_, err = slot.Unseal([]byte("hunter3"))
+	assert.Error(t, err, "a wrong passphrase must not unseal the slot")
+
+	memory, err := slot.DerivationMemory()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(64*1024), memory)
+
+	// A crafted time or thread count is refused before the derivation
+	for _, offset := range []int{2, 2 + 8} {
+		crafted := *slot
+		crafted.SlotContent = bytes.Clone(slot.SlotContent)
+		crafted.SlotContent[offset] = 0xff
+		_, err = crafted.Unseal([]byte("hunter2"))
+		assert.ErrorIs(t, err, types.ErrSlotContentMalformed)
+	}
+
+	// A crafted memory cost is refused before anything is allocated
+	slot.SlotContent[2+4] = 0xff
+	_, err = slot.Unseal([]byte("hunter2"))
+	assert.ErrorIs(t, err, types.ErrSlotContentMalformed)
+}
+
+func TestPasswordCompatSlotContent(t *testing.T) {
+	skipUnlessSlotAlgorithm(t, types.SlotKeyAlgScrypt)
+	rootKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "Failed to generate root key")
+	scryptParams := types.ScryptParams{LogN: 4, BlockSize: 1, Parallelism: 1}
+	_, err = container.NewContainerScryptSlot(0, rootKey, []byte("hunter2"), []byte("somesalt"), types.ScryptParams{LogN: 4})
+	assert.ErrorIs(t, err, types.ErrSlotContentMalformed)
+	scryptSlot, err := container.NewContainerScryptSlot(0, rootKey, []byte("hunter2"), []byte("somesalt"), scryptParams)
+	assert.NoError(t, err, "Failed to create slot")
+	storedScrypt, salt, err := scryptSlot.ScryptParams()
+	assert.NoError(t, err, "Failed to read the parameters")
+	assert.Equal(t, scryptParams, storedScrypt)
+	assert.Equal(t, []byte("somesalt"), salt)
+	memory, err := scryptSlot.DerivationMemory()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(128*(16+1)), memory)
+
+	pbkdf2Params := types.PBKDF2Params{Iterations: 100}
+	_, err = container.NewContainerPBKDF2Slot(0, rootKey, []byte("hunter2"), []byte("somesalt"), types.PBKDF2Params{})
+	assert.ErrorIs(t, err, types.ErrSlotContentMalformed)
+	pbkdf2Slot, err := container.NewContainerPBKDF2Slot(0, rootKey, []byte("hunter2"), []byte("somesalt"), pbkdf2Params)
+	assert.NoError(t, err, "Failed to create slot")
+	storedPBKDF2, _, err := pbkdf2Slot.PBKDF2Params()
+	assert.NoError(t, err, "Failed to read the parameters")
+	assert.Equal(t, pbkdf2Params, storedPBKDF2)
+	_, _, err = pbkdf2Slot.ScryptParams()
+	assert.ErrorIs(t, err, types.ErrUnsupportedSlotAlgo)
+
+	for _, slot := range []*container.ContainerKeySlot{scryptSlot, pbkdf2Slot} {
+		unsealedRoot, err := slot.Unseal([]byte("hunter2"))
+		assert.NoError(t, err, "Failed to unseal slot")
+		assert.Equal(t, rootKey, unsealedRoot, "the unsealed key does not match with root key")
+		_, err = slot.Unseal([]byte("hunter3"))
+		assert.Error(t, err, "a wrong passphrase must not unseal the slot")
+	}
+
+	// Crafted costs are refused before anything is derived
+	scryptSlot.SlotContent[2] = 32
+	_, err = scryptSlot.Unseal([]byte("hunter2"))
+	assert.ErrorIs(t, err, types.ErrSlotContentMalformed)
+	pbkdf2Slot.SlotContent[2] = 0xff
+	_, err = pbkdf2Slot.Unseal([]byte("hunter2"))
+	assert.ErrorIs(t, err, types.ErrSlotContentMalformed)
+}
+
+func TestRecipientSlotContent(t *testing.T) {
+	rootKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "Failed to generate root key")
+
+	rsaKey, err := rsa.GenerateKey(crand.Reader, 2048)
+	assert.NoError(t, err, "Failed to generate the RSA key")
+	slot, err := container.NewContainerRSASlot(0, rootKey, &rsaKey.PublicKey)
+	assert.NoError(t, err, "Failed to create slot")
+	assert.Equal(t, types.SlotKeyAlgRSAOAEP2048, slot.SlotKeyAlgorithm)
+	der, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	assert.NoError(t, err, "Failed to encode the RSA key")
+	unsealedRoot, err := slot.Unseal(der)
+	assert.NoError(t, err, "Failed to unseal slot")
+	assert.Equal(t, rootKey, unsealedRoot, "the unsealed key does not match with root key")
+	unsealedRoot, err = slot.Unseal(x509.MarshalPKCS1PrivateKey(rsaKey))
+	assert.NoError(t, err, "Failed to unseal slot with the PKCS #1 key")
+	assert.Equal(t, rootKey, unsealedRoot, "the unsealed key does not match with root key")
+	weakKey, err := rsa.GenerateKey(crand.Reader, 1024)
+	assert.NoError(t, err, "Failed to generate the RSA key")
+	_, err = container.NewContainerRSASlot(0, rootKey, &weakKey.PublicKey)
+	assert.ErrorIs(t, err, ic.ErrKeySizeInvalid)
+
+	x25519Key, err := ecdh.X25519().GenerateKey(crand.Reader)
+	assert.NoError(t, err, "Failed to generate the X25519 key")
+	slot, err = container.NewContainerX25519Slot(0, rootKey, x25519Key.PublicKey())
+	assert.NoError(t, err, "Failed to create slot")
+	unsealedRoot, err = slot.Unseal(x25519Key.Bytes())
+	assert.NoError(t, err, "Failed to unseal slot")
+	assert.Equal(t, rootKey, unsealedRoot, "the unsealed key does not match with root key")
+	otherKey, err := ecdh.X25519().GenerateKey(crand.Reader)
+	assert.NoError(t, err, "Failed to generate the X25519 key")
+	_, err = slot.Unseal(otherKey.Bytes())
+	assert.Error(t, err, "another private key must not unseal the slot")
+}
+
+func TestGCMSIVSlotCreationAndUnsealing(t *testing.T) {
+	rootKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "Failed to generate root key")
+
+	slotKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "Failed to generate slot key")
+
+	_, err = container.NewContainerKeySlot(types.SlotKeyAlgAESGCMSIV256, 0, rootKey, slotKey[:16])
+	assert.ErrorIs(t, err, ic.ErrKeySizeInvalid)
+	slot, err := container.NewContainerKeySlot(types.SlotKeyAlgAESGCMSIV256, 0, rootKey, slotKey)
+	assert.NoError(t, err, "Failed to create slot")
+
+	unsealedRoot, err := slot.Unseal(slotKey)
+	assert.NoError(t, err, "Failed to unseal slot")
+	assert.Equal(t, rootKey, unsealedRoot, "the unsealed key does not match with root key")
+}
+
+// Create a GCM slot whose nonce is drawn from a seeded random source, laid out like NewContainerKeySlot does
+func newSeededSlot(t *testing.T, seed byte, rootKey, slotKey []byte) *container.ContainerKeySlot {
+	nonce := make([]byte, 12)
+	rand.NewChaCha8([32]byte{seed}).Read(nonce)
+	wrapped, err := ic.AESGCMEncryptDirect(slotKey, rootKey, nonce)
+	assert.NoError(t, err, "Failed to wrap the root key")
+	content := append(nonce, wrapped...)
+	return &container.ContainerKeySlot{
+		SlotKeyAlgorithm: types.SlotKeyAlgAESGCM128,
+		Size:             uint16(len(content)),
+		SlotContent:      content,
+	}
+}
+
+func TestSlotNonceUnique(t *testing.T) {
+	rootKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "Failed to generate root key")
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "Failed to generate slot key")
+	otherKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "Failed to generate slot key")
+
+	slots := []*container.ContainerKeySlot{newSeededSlot(t, 1, rootKey, slotKey)}
+	// The layout must match the real slots
+	unsealed, err := slots[0].Unseal(slotKey)
+	assert.NoError(t, err, "Failed to unseal slot")
+	assert.Equal(t, rootKey, unsealed)
+
+	assert.NoError(t, container.CheckSlotNonceUnique(slots, newSeededSlot(t, 2, rootKey, otherKey)))
+	// The same seed replays the same nonce
+	err = container.CheckSlotNonceUnique(slots, newSeededSlot(t, 1, rootKey, otherKey))
+	assert.ErrorIs(t, err, types.ErrSlotNonceCollision)
+
+	// Real slots with random nonces never collide
+	for range 100 {
+		slot, err := container.NewContainerKeySlot(types.SlotKeyAlgAESGCMSIV256, 0, rootKey, make([]byte, 32))
+		assert.NoError(t, err, "Failed to create slot")
+		assert.NoError(t, container.CheckSlotNonceUnique(slots, slot))
+		slots = append(slots, slot)
+	}
+}
@@ -0,0 +1,70 @@
+package container
+
+import (
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: internal/container/slots_token.go
+// This file contain APIs for slots unlocked by a hardware token challenge-response (e.g. YubiKey HMAC-SHA1, FIDO2 hmac-secret).
+//
+// Slot content layout:
+// Challenge length (uint16)
+// Challenge (non-secret)
+// AES-GCM-256 wrapped root key, where the key is HKDF(response, salt=challenge)
+
+// Size of the wrapping key derived from the token response
+const tokenWrappingKeySize = 32
+
+// Derive the wrapping key from the response of the token
+func deriveTokenWrappingKey(response, challenge []byte) ([]byte, error) {
+	keys, err := ic.DeriveKeysFromMasterKeyEx(response, challenge, []int{tokenWrappingKeySize})
+	if err != nil {
+		return nil, err
+	}
+	return keys[0], nil
+}
+
+// NewContainerTokenSlot initialize a slot where the rootKey is wrapped by the key derived from the token response to the challenge.
+// Only the challenge is stored in the slot, the token must answer it again on unseal
+func NewContainerTokenSlot(flags uint16, rootKey, challenge, response []byte) (*ContainerKeySlot, error) {
+	if len(rootKey) == 0 || len(challenge) == 0 || len(response) == 0 {
+		return nil, types.ErrParameterMissing
+	}
+	key, err := deriveTokenWrappingKey(response, challenge)
+	if err != nil {
+		return nil, err
+	}
+	defer ic.WipeBufferSecure(key)
+	wrapped, err := ic.AESGCMEncryptDirect(key, rootKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newPrefixedSlot(types.SlotKeyAlgTokenHMAC, flags, challenge, wrapped)
+}
+
+// Get the challenge stored in the token slot
+func (slot *ContainerKeySlot) TokenChallenge() ([]byte, error) {
+	if slot.SlotKeyAlgorithm != types.SlotKeyAlgTokenHMAC {
+		return nil, types.ErrUnsupportedSlotAlgo
+	}
+	challenge, _, err := slot.splitPrefixedContent()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), challenge...), nil
+}
+
+// Unseal the token slot using the response of the token
+func (slot *ContainerKeySlot) unsealToken(response []byte) ([]byte, error) {
+	challenge, wrapped, err := slot.splitPrefixedContent()
+	if err != nil {
+		return nil, err
+	}
+	key, err := deriveTokenWrappingKey(response, challenge)
+	if err != nil {
+		return nil, err
+	}
+	defer ic.WipeBufferSecure(key)
+	return ic.AESGCMDecryptDirect(key, wrapped, nil)
+}
@@ -0,0 +1,36 @@
+package container
+
+import (
+	"bytes"
+
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: internal/container/slots_tpm.go
+// This file contain APIs for slots where the root key is sealed by a TPM, optionally bound to PCR values.
+//
+// Slot content layout:
+// Policy reference length (uint16)
+// Policy reference (non-secret, e.g. the serialized PCR selection, empty when not bound)
+// Blob sealed by the TPM, opaque to this package
+
+// NewContainerTPMSlot initialize a slot holding the root key sealed by the TPM under the policy.
+// The TPM must unseal the blob again on unseal, so the file can only be decrypted on that machine
+func NewContainerTPMSlot(flags uint16, policy, sealed []byte) (*ContainerKeySlot, error) {
+	if len(sealed) == 0 {
+		return nil, types.ErrParameterMissing
+	}
+	return newPrefixedSlot(types.SlotKeyAlgTPM, flags, policy, sealed)
+}
+
+// Get the policy reference and the sealed blob stored in the TPM slot
+func (slot *ContainerKeySlot) TPMSealedContent() (policy, sealed []byte, err error) {
+	if slot.SlotKeyAlgorithm != types.SlotKeyAlgTPM {
+		return nil, nil, types.ErrUnsupportedSlotAlgo
+	}
+	policy, sealed, err = slot.splitPrefixedContent()
+	if err != nil {
+		return nil, nil, err
+	}
+	return bytes.Clone(policy), bytes.Clone(sealed), nil
+}
@@ -0,0 +1,41 @@
+package container
+
+import (
+	"bytes"
+	"errors"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+)
+
+// File: pkg/container/application_id.go
+// This file contains the application ID namespacing every key derived from the root key.
+//
+// Applications sharing master keys, e.g. through a common KMS key, set different IDs so they never derive the same content keys.
+// The ID is not stored in the file, the application must set the same ID before encrypting and decrypting.
+// The slot keys are used as given and are not affected.
+
+// Longest application ID accepted
+const maxApplicationIDSize = 0xFFFF
+
+var (
+	ErrInvalidApplicationID = errors.New("the application ID must not be longer than 65535 bytes")
+)
+
+// Mix the application ID into every key derived from the root key, nil or empty restores the default derivation.
+// It must be called before any content operation, with the same ID on both the encrypting and the decrypting side
+func (f *ContainerFile) SetApplicationID(id []byte) error {
+	if len(id) > maxApplicationIDSize {
+		return ErrInvalidApplicationID
+	}
+	f.applicationID = bytes.Clone(id)
+	return nil
+}
+
+// Derive the keys from the root key within the namespace of the application, bound to the header if enabled
+func (f *ContainerFile) deriveContentKeys(salt []byte, keySizes []int) ([][]byte, error) {
+	context, err := f.keyContext()
+	if err != nil {
+		return nil, err
+	}
+	return ic.DeriveKeysFromMasterKeyWithContext(f.rootKey, salt, context, keySizes)
+}
@@ -0,0 +1,60 @@
+package container_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplicationID(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR128, []byte(plainText))
+	encryptedContainer, err := container_pkg.OpenContainerFileForUpdate(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the container")
+	err = encryptedContainer.SetApplicationID(make([]byte, 0x10000))
+	assert.ErrorIs(t, err, container_pkg.ErrInvalidApplicationID)
+
+	// Every application derives its own content keys from the same root key
+	salt, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "cannot generate salt")
+	defaultKey, err := encryptedContainer.ContentAuthKey(salt)
+	assert.NoError(t, err, "cannot derive the key")
+	err = encryptedContainer.SetApplicationID([]byte("app-a"))
+	assert.NoError(t, err, "cannot set the application ID")
+	keyA, err := encryptedContainer.ContentAuthKey(salt)
+	assert.NoError(t, err, "cannot derive the key")
+	err = encryptedContainer.SetApplicationID([]byte("app-b"))
+	assert.NoError(t, err, "cannot set the application ID")
+	keyB, err := encryptedContainer.ContentAuthKey(salt)
+	assert.NoError(t, err, "cannot derive the key")
+	assert.NotEqual(t, defaultKey, keyA)
+	assert.NotEqual(t, keyA, keyB)
+
+	// Content encrypted by one application cannot be decrypted by another
+	err = encryptedContainer.SetApplicationID([]byte("app-a"))
+	assert.NoError(t, err, "cannot set the application ID")
+	err = encryptedContainer.ReplaceContent(bytes.NewBufferString(plainText))
+	assert.NoError(t, err, "cannot encrypt the content")
+	err = encryptedContainer.SetApplicationID([]byte("app-b"))
+	assert.NoError(t, err, "cannot set the application ID")
+	err = encryptedContainer.DecryptStream(io.Discard)
+	assert.ErrorIs(t, err, ic.ErrAuthenticationFailed)
+	err = encryptedContainer.SetApplicationID(nil)
+	assert.NoError(t, err, "cannot clear the application ID")
+	err = encryptedContainer.DecryptStream(io.Discard)
+	assert.ErrorIs(t, err, ic.ErrAuthenticationFailed)
+	err = encryptedContainer.SetApplicationID([]byte("app-a"))
+	assert.NoError(t, err, "cannot set the application ID")
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the content")
+	assert.Equal(t, plainText, buf.String())
+}
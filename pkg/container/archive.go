@@ -0,0 +1,308 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/archive.go
+// This file contains APIs for archive containers holding several named entries.
+//
+// The archive lives entirely in the encrypted content, so the names and sizes are only visible after unseal.
+// Plaintext layout:
+// Table of contents length (uint32) -- the top bit marks the hidden entries mode
+// Table of contents -- for each entry: name length (uint16) || name || size (uint64)
+// Data of the entries in the order of the table of contents
+//
+// The names are only visible after unseal, but the length of the table of contents still hints at the number of entries
+// and the length of their names. In the hidden entries mode it is padded with padding entries, which have no data and
+// a name made of NUL bytes only, up to a multiple of archiveTOCPaddingBlock. Padding entries are only skipped when
+// listing an archive in this mode, the same entries are listed as is in any other archive.
+
+// Upper bound of the table of contents, so a corrupted length cannot exhaust the memory
+const maxArchiveTOCSize = 16 * 1024 * 1024
+
+// The table of contents is padded to a multiple of this in the hidden entries mode
+const archiveTOCPaddingBlock = 4096
+
+// Size of a padding entry without its name: name length (uint16) || size (uint64)
+const archivePaddingEntryOverhead = 2 + 8
+
+// Bit of the length of the table of contents marking the hidden entries mode
+const archiveTOCHiddenEntries uint32 = 1 << 31
+
+var (
+	ErrNotArchive         = errors.New("the container is not an archive")
+	ErrArchiveCorrupted   = errors.New("the table of contents of the archive is corrupted")
+	ErrEntrySizeMismatch  = errors.New("the entry does not have the declared size")
+	ErrEntryNameTooLong   = errors.New("the name of the entry is too long")
+	ErrArchiveTOCTooLarge = errors.New("the table of contents of the archive is too large")
+)
+
+// Entry to be written into an archive, the reader must produce exactly Size bytes
+type Entry struct {
+	Name   string
+	Size   int64
+	Reader io.Reader
+}
+
+// Store the content as an archive of named entries, it must be called before WriteHeader and EncryptEntries
+func (f *ContainerFile) EnableArchive() {
+	f.header.Flags |= types.HeaderFlagArchive
+}
+
+// Pad the table of contents so its length does not reveal the number of entries nor the length of their names.
+// Archives whose tables of contents fit in the same multiple of 4096 bytes cannot be told apart by their entries.
+// It must be called before EncryptEntries. Readers not aware of the mode refuse the archive as corrupted
+func (f *ContainerFile) EnableHiddenEntries() {
+	f.hiddenEntries = true
+}
+
+// Whether the content is an archive
+func (f *ContainerFile) isArchive() bool {
+	return f.header.Flags&types.HeaderFlagArchive != 0
+}
+
+// Encrypt the entries as the content of the archive
+func (f *ContainerFile) EncryptEntries(entries []Entry) error {
+	if !f.isArchive() {
+		return ErrNotArchive
+	}
+	toc, err := encodeArchiveTOC(entries, f.hiddenEntries)
+	if err != nil {
+		return err
+	}
+	readers := make([]io.Reader, 0, len(entries)+1)
+	readers = append(readers, bytes.NewReader(toc))
+	for _, entry := range entries {
+		readers = append(readers, &entryReader{reader: entry.Reader, remaining: entry.Size})
+	}
+	return f.EncryptStream(io.MultiReader(readers...))
+}
+
+// Serialize the table of contents including its length, padded if requested
+func encodeArchiveTOC(entries []Entry, padded bool) ([]byte, error) {
+	buffer := bytes.NewBuffer(make([]byte, 4))
+	for _, entry := range entries {
+		if len(entry.Name) > 0xFFFF {
+			return nil, ErrEntryNameTooLong
+		}
+		if entry.Size < 0 || entry.Reader == nil {
+			return nil, types.ErrParameterMissing
+		}
+		// It would be taken for padding
+		if padded && isArchivePadding([]byte(entry.Name), uint64(entry.Size)) {
+			return nil, types.ErrParameterMissing
+		}
+		binary.Write(buffer, binary.BigEndian, uint16(len(entry.Name)))
+		buffer.WriteString(entry.Name)
+		binary.Write(buffer, binary.BigEndian, uint64(entry.Size))
+	}
+	if padded {
+		padArchiveTOC(buffer)
+	}
+	if buffer.Len()-4 > maxArchiveTOCSize {
+		return nil, ErrArchiveTOCTooLarge
+	}
+	toc := buffer.Bytes()
+	length := uint32(len(toc) - 4)
+	if padded {
+		length |= archiveTOCHiddenEntries
+	}
+	binary.BigEndian.PutUint32(toc, length)
+	return toc, nil
+}
+
+// Append a padding entry so the table of contents reaches a multiple of archiveTOCPaddingBlock.
+// The gap is at most a block and the overhead, so a single entry always fits in the name length
+func padArchiveTOC(buffer *bytes.Buffer) {
+	length := buffer.Len() - 4
+	target := (length + archivePaddingEntryOverhead + archiveTOCPaddingBlock - 1) / archiveTOCPaddingBlock * archiveTOCPaddingBlock
+	nameLength := target - length - archivePaddingEntryOverhead
+	binary.Write(buffer, binary.BigEndian, uint16(nameLength))
+	buffer.Write(make([]byte, nameLength))
+	binary.Write(buffer, binary.BigEndian, uint64(0))
+}
+
+// Whether the entry of the table of contents only pads it
+func isArchivePadding(name []byte, size uint64) bool {
+	return size == 0 && len(bytes.Trim(name, "\x00")) == 0
+}
+
+// Split the stored length of the table of contents into its length and whether the hidden entries mode is used
+func splitArchiveTOCLength(stored uint32) (length uint32, hidden bool) {
+	return stored &^ archiveTOCHiddenEntries, stored&archiveTOCHiddenEntries != 0
+}
+
+// Read the table of contents from the start of the decrypted content
+func decodeArchiveTOC(reader io.Reader, limits *types.ResourceLimits) ([]types.EntryInfo, error) {
+	var stored uint32
+	if err := binary.Read(reader, binary.BigEndian, &stored); err != nil {
+		return nil, err
+	}
+	length, hidden := splitArchiveTOCLength(stored)
+	if length > maxArchiveTOCSize {
+		return nil, ErrArchiveCorrupted
+	}
+	if err := types.CheckResourceLimit("the table of contents", int64(length), limits.MaxBuffer); err != nil {
+		return nil, err
+	}
+	toc := make([]byte, length)
+	if _, err := io.ReadFull(reader, toc); err != nil {
+		return nil, err
+	}
+	scopedReader := bytes.NewReader(toc)
+	offset := int64(4 + length)
+	entries := []types.EntryInfo{}
+	for scopedReader.Len() > 0 {
+		var nameLength uint16
+		if err := binary.Read(scopedReader, binary.BigEndian, &nameLength); err != nil {
+			return nil, ErrArchiveCorrupted
+		}
+		name := make([]byte, nameLength)
+		if _, err := io.ReadFull(scopedReader, name); err != nil {
+			return nil, ErrArchiveCorrupted
+		}
+		var size uint64
+		if err := binary.Read(scopedReader, binary.BigEndian, &size); err != nil {
+			return nil, ErrArchiveCorrupted
+		}
+		if size > uint64(math.MaxInt64-offset) {
+			return nil, ErrArchiveCorrupted
+		}
+		if hidden && isArchivePadding(name, size) {
+			continue
+		}
+		entries = append(entries, types.EntryInfo{Name: string(name), Size: int64(size), Offset: offset})
+		offset += int64(size)
+	}
+	return entries, nil
+}
+
+// List the entries of the archive, the container must be unsealed as the table of contents is encrypted.
+// Note that the table of contents is only authenticated once the whole content is decrypted unless the content is chunked
+func (f *ContainerFile) ListEntries() ([]types.EntryInfo, error) {
+	if !f.isArchive() {
+		return nil, ErrNotArchive
+	}
+	if len(f.rootKey) == 0 {
+		return nil, ErrRootKeySealed
+	}
+	size, err := f.EstimateContentSize()
+	if err != nil {
+		return nil, err
+	}
+	length := bytes.NewBuffer(nil)
+	if err := f.DecryptRange(length, 0, 4); err != nil {
+		return nil, err
+	}
+	stored, _ := splitArchiveTOCLength(binary.BigEndian.Uint32(length.Bytes()))
+	tocLength := int64(stored)
+	if tocLength > maxArchiveTOCSize || 4+tocLength > size {
+		return nil, ErrArchiveCorrupted
+	}
+	if err := types.CheckResourceLimit("the table of contents", tocLength, f.resourceLimits().MaxBuffer); err != nil {
+		return nil, err
+	}
+	toc := bytes.NewBuffer(nil)
+	if err := f.DecryptRange(toc, 0, 4+tocLength); err != nil {
+		return nil, err
+	}
+	entries, err := decodeArchiveTOC(toc, f.resourceLimits())
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Offset+entry.Size > size {
+			return nil, ErrArchiveCorrupted
+		}
+	}
+	return entries, nil
+}
+
+// Decrypt a single entry listed by ListEntries into the writer.
+// Like DecryptRange, the entry is only authenticated when the content is chunked
+func (f *ContainerFile) DecryptEntry(entry types.EntryInfo, writer io.Writer) error {
+	return f.DecryptRange(writer, entry.Offset, entry.Size)
+}
+
+// Decrypt the entries sequentially in a single pass, the callback receives a reader over the data of each entry.
+// Like DecryptStream, the data is released before the tag at the end is verified, so an authentication failure is
+// only reported once all entries are visited. The callback does not have to consume the reader entirely
+func (f *ContainerFile) WalkEntries(callback func(entry types.EntryInfo, reader io.Reader) error) error {
+	if !f.isArchive() {
+		return ErrNotArchive
+	}
+	if len(f.rootKey) == 0 {
+		return ErrRootKeySealed
+	}
+	pipeReader, pipeWriter := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pipeWriter.CloseWithError(f.DecryptStream(pipeWriter))
+	}()
+	// Wait for the decryption to stop before returning, as it uses the backing storage
+	defer func() {
+		pipeReader.Close()
+		<-done
+	}()
+	if err := walkArchive(bufio.NewReaderSize(pipeReader, bufferSize), f.resourceLimits(), callback); err != nil {
+		return err
+	}
+	// Drain the rest so the tag is verified
+	_, err := io.Copy(io.Discard, pipeReader)
+	return err
+}
+
+func walkArchive(content io.Reader, limits *types.ResourceLimits, callback func(entry types.EntryInfo, reader io.Reader) error) error {
+	entries, err := decodeArchiveTOC(content, limits)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		data := io.LimitReader(content, entry.Size)
+		if err := callback(entry, data); err != nil {
+			return err
+		}
+		if _, err := io.Copy(io.Discard, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reader making sure the entry has exactly the declared size
+type entryReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (r *entryReader) Read(p []byte) (int, error) {
+	if r.remaining == 0 {
+		// The entry must end here
+		var probe [1]byte
+		if n, _ := r.reader.Read(probe[:]); n > 0 {
+			return 0, ErrEntrySizeMismatch
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+	if err == io.EOF && r.remaining > 0 {
+		return n, ErrEntrySizeMismatch
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
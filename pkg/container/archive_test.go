@@ -0,0 +1,187 @@
+package container_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveEntries(t *testing.T) {
+	contents := map[string]string{
+		"notes.txt":  "Some secrets is here!",
+		"empty":      "",
+		"docs/a.bin": strings.Repeat("0123456789", 10000),
+	}
+	names := []string{"notes.txt", "empty", "docs/a.bin"}
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	err = encryptedContainer.EncryptEntries(nil)
+	assert.ErrorIs(t, err, container_pkg.ErrNotArchive)
+	encryptedContainer.EnableArchive()
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	entries := make([]container_pkg.Entry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, container_pkg.Entry{Name: name, Size: int64(len(contents[name])), Reader: strings.NewReader(contents[name])})
+	}
+	err = encryptedContainer.EncryptEntries(entries)
+	assert.NoError(t, err, "cannot encrypt the entries")
+	encryptedContainer.Close()
+
+	// The names are encrypted
+	data, err := os.ReadFile(file.Name())
+	assert.NoError(t, err, "cannot read the container")
+	assert.False(t, bytes.Contains(data, []byte("notes.txt")), "the table of contents is leaked")
+
+	encryptedContainer, err = container_pkg.OpenContainerFile(file.Name())
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	_, err = encryptedContainer.ListEntries()
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeySealed)
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+
+	listed, err := encryptedContainer.ListEntries()
+	assert.NoError(t, err, "cannot list the entries")
+	assert.Len(t, listed, len(names))
+	for i, entry := range listed {
+		assert.Equal(t, names[i], entry.Name)
+		assert.Equal(t, int64(len(contents[entry.Name])), entry.Size)
+		buf := bytes.NewBuffer(nil)
+		err = encryptedContainer.DecryptEntry(entry, buf)
+		assert.NoError(t, err, "cannot decrypt the entry")
+		assert.Equal(t, contents[entry.Name], buf.String())
+	}
+
+	visited := 0
+	err = encryptedContainer.WalkEntries(func(entry types.EntryInfo, reader io.Reader) error {
+		data, err := io.ReadAll(reader)
+		assert.NoError(t, err, "cannot read the entry")
+		assert.Equal(t, contents[entry.Name], string(data))
+		visited++
+		return nil
+	})
+	assert.NoError(t, err, "cannot walk the entries")
+	assert.Equal(t, len(names), visited)
+}
+
+func TestArchiveEntrySizeMismatch(t *testing.T) {
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR128)
+	assert.NoError(t, err, "cannot create container")
+	defer encryptedContainer.Close()
+	encryptedContainer.EnableArchive()
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	for _, size := range []int64{3, 10} {
+		err = encryptedContainer.EncryptEntries([]container_pkg.Entry{{Name: "a", Size: size, Reader: strings.NewReader("12345")}})
+		assert.ErrorIs(t, err, container_pkg.ErrEntrySizeMismatch)
+	}
+}
+
+func TestArchiveHiddenEntries(t *testing.T) {
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	create := func(names []string, entrySize int) (string, []container_pkg.Entry) {
+		file, err := os.CreateTemp(t.TempDir(), "filecrypt-ci-")
+		assert.NoError(t, err, "cannot create temp file")
+		encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+		assert.NoError(t, err, "cannot create container")
+		encryptedContainer.EnableArchive()
+		encryptedContainer.EnableHiddenEntries()
+		err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot add slot")
+		err = encryptedContainer.WriteHeader()
+		assert.NoError(t, err, "cannot write out the headers")
+		entries := make([]container_pkg.Entry, 0, len(names))
+		for _, name := range names {
+			entries = append(entries, container_pkg.Entry{Name: name, Size: int64(entrySize), Reader: bytes.NewReader(make([]byte, entrySize))})
+		}
+		err = encryptedContainer.EncryptEntries(entries)
+		assert.NoError(t, err, "cannot encrypt the entries")
+		encryptedContainer.Close()
+		return file.Name(), entries
+	}
+	// Same amount of data spread over a different number of entries
+	single, _ := create([]string{"secret-report.pdf"}, 1000)
+	several, entries := create([]string{"a", "bb", "ccc", "dddd", "eeeee"}, 200)
+	singleInfo, err := os.Stat(single)
+	assert.NoError(t, err, "cannot stat the container")
+	severalInfo, err := os.Stat(several)
+	assert.NoError(t, err, "cannot stat the container")
+	assert.Equal(t, singleInfo.Size(), severalInfo.Size(), "the size reveals the entries")
+	data, err := os.ReadFile(single)
+	assert.NoError(t, err, "cannot read the container")
+	assert.False(t, bytes.Contains(data, []byte("secret-report.pdf")), "the table of contents is leaked")
+
+	// The padding is not listed
+	encryptedContainer, err := container_pkg.OpenContainerFile(several)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	_, err = encryptedContainer.ListEntries()
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeySealed)
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	listed, err := encryptedContainer.ListEntries()
+	assert.NoError(t, err, "cannot list the entries")
+	assert.Len(t, listed, len(entries))
+	for i, entry := range listed {
+		assert.Equal(t, entries[i].Name, entry.Name)
+		buf := bytes.NewBuffer(nil)
+		err = encryptedContainer.DecryptEntry(entry, buf)
+		assert.NoError(t, err, "cannot decrypt the entry")
+		assert.Equal(t, make([]byte, 200), buf.Bytes())
+	}
+	walked := 0
+	err = encryptedContainer.WalkEntries(func(entry types.EntryInfo, reader io.Reader) error {
+		walked++
+		return nil
+	})
+	assert.NoError(t, err, "cannot walk the entries")
+	assert.Equal(t, len(entries), walked)
+
+	// An entry which would be taken for padding is refused in the hidden entries mode only
+	for _, hidden := range []bool{true, false} {
+		file, err := os.CreateTemp(t.TempDir(), "filecrypt-ci-")
+		assert.NoError(t, err, "cannot create temp file")
+		encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+		assert.NoError(t, err, "cannot create container")
+		defer encryptedContainer.Close()
+		encryptedContainer.EnableArchive()
+		if hidden {
+			encryptedContainer.EnableHiddenEntries()
+		}
+		err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot add slot")
+		err = encryptedContainer.WriteHeader()
+		assert.NoError(t, err, "cannot write out the headers")
+		err = encryptedContainer.EncryptEntries([]container_pkg.Entry{{Name: "\x00", Size: 0, Reader: bytes.NewReader(nil)}})
+		if hidden {
+			assert.ErrorIs(t, err, types.ErrParameterMissing)
+			continue
+		}
+		assert.NoError(t, err, "cannot encrypt the entries")
+		listed, err := encryptedContainer.ListEntries()
+		assert.NoError(t, err, "cannot list the entries")
+		assert.Len(t, listed, 1, "the entry was taken for padding")
+	}
+}
@@ -0,0 +1,123 @@
+package container
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/builder.go
+// This file contains the builder creating a complete container in one go,
+// taking care of the ordering of the calls, of writing the header and of closing the file.
+//
+// The container is written into an owner-only temp file next to the destination and only renamed over it once complete,
+// so a failure never leaves a partial container behind.
+
+var (
+	ErrBuilderNoAlgorithm = errors.New("the algorithm of the content is not set")
+	ErrBuilderNoSource    = errors.New("the source of the plaintext is not set")
+)
+
+// Slot to add once the container is created
+type builderSlot struct {
+	alg types.SlotKeyAlgorithm
+	key []byte
+}
+
+// Builder of a container, created by NewBuilder. The methods record the settings and Build creates the container
+type Builder struct {
+	dst      string
+	alg      types.EncryptionAlgorithm
+	algSet   bool
+	slots    []builderSlot
+	source   io.Reader
+	metadata *types.FileMetadata
+}
+
+// Start building a container written to dst
+func NewBuilder(dst string) *Builder {
+	return &Builder{dst: dst}
+}
+
+// Set the algorithm of the content
+func (b *Builder) WithAlgorithm(alg types.EncryptionAlgorithm) *Builder {
+	b.alg = alg
+	b.algSet = true
+	return b
+}
+
+// Add a slot wrapping the root key under the key, the key is copied and wiped by Build
+func (b *Builder) AddSlot(alg types.SlotKeyAlgorithm, slotKey []byte) *Builder {
+	b.slots = append(b.slots, builderSlot{alg: alg, key: bytes.Clone(slotKey)})
+	return b
+}
+
+// Set the reader of the plaintext, it is read until EOF by Build
+func (b *Builder) EncryptFrom(reader io.Reader) *Builder {
+	b.source = reader
+	return b
+}
+
+// Record the metadata of the original file in the header, see SetMetadata
+func (b *Builder) WithMetadata(metadata *types.FileMetadata) *Builder {
+	b.metadata = metadata
+	return b
+}
+
+// Create the container, the destination is replaced only when everything succeeded
+func (b *Builder) Build() error {
+	defer func() {
+		for _, slot := range b.slots {
+			ic.WipeBufferSecure(slot.key)
+		}
+		b.slots = nil
+	}()
+	if !b.algSet {
+		return ErrBuilderNoAlgorithm
+	}
+	if len(b.slots) == 0 {
+		return ErrNoSlots
+	}
+	if b.source == nil {
+		return ErrBuilderNoSource
+	}
+	// Hidden temp file in the same directory so it can be renamed atomically
+	temp, cleanup, err := createSecureTemp(filepath.Dir(b.dst), "."+filepath.Base(b.dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	f, err := NewContainerFileWithHandle(temp, b.alg)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, slot := range b.slots {
+		if err := f.AddKeySlot(slot.alg, slot.key); err != nil {
+			return err
+		}
+	}
+	if b.metadata != nil {
+		if err := f.SetMetadata(b.metadata); err != nil {
+			return err
+		}
+	}
+	if err := f.WriteHeader(); err != nil {
+		return err
+	}
+	if err := f.EncryptStream(b.source); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), b.dst)
+}
@@ -0,0 +1,76 @@
+package container_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuilder(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	firstKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	secondKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "cannot generate slot key")
+	dst := filepath.Join(t.TempDir(), "secret.crpt")
+
+	err = container_pkg.NewBuilder(dst).
+		WithAlgorithm(types.EncAlgAESCTR256).
+		AddSlot(types.SlotKeyAlgAESGCM128, firstKey).
+		AddSlot(types.SlotKeyAlgAESGCM256, secondKey).
+		EncryptFrom(bytes.NewBufferString(plainText)).
+		Build()
+	assert.NoError(t, err, "cannot build the container")
+
+	for alg, key := range map[types.SlotKeyAlgorithm][]byte{types.SlotKeyAlgAESGCM128: firstKey, types.SlotKeyAlgAESGCM256: secondKey} {
+		encryptedContainer, err := container_pkg.OpenContainerFile(dst)
+		assert.NoError(t, err, "cannot open the container")
+		err = encryptedContainer.Unseal(alg, key)
+		assert.NoError(t, err, "cannot unseal the container")
+		buf := bytes.NewBuffer(nil)
+		err = encryptedContainer.DecryptStream(buf)
+		assert.NoError(t, err, "cannot decrypt the data")
+		assert.Equal(t, plainText, buf.String())
+		encryptedContainer.Close()
+	}
+}
+
+func TestBuilderMisuse(t *testing.T) {
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "secret.crpt")
+
+	err = container_pkg.NewBuilder(dst).
+		AddSlot(types.SlotKeyAlgAESGCM128, slotKey).
+		EncryptFrom(bytes.NewBufferString("x")).
+		Build()
+	assert.ErrorIs(t, err, container_pkg.ErrBuilderNoAlgorithm)
+	err = container_pkg.NewBuilder(dst).
+		WithAlgorithm(types.EncAlgAESCTR128).
+		EncryptFrom(bytes.NewBufferString("x")).
+		Build()
+	assert.ErrorIs(t, err, container_pkg.ErrNoSlots)
+	err = container_pkg.NewBuilder(dst).
+		WithAlgorithm(types.EncAlgAESCTR128).
+		AddSlot(types.SlotKeyAlgAESGCM128, slotKey).
+		Build()
+	assert.ErrorIs(t, err, container_pkg.ErrBuilderNoSource)
+	err = container_pkg.NewBuilder(dst).
+		WithAlgorithm(types.EncAlgAESCTR128).
+		AddSlot(types.SlotKeyAlgAESGCM256, slotKey).
+		EncryptFrom(bytes.NewBufferString("x")).
+		Build()
+	assert.Error(t, err, "the key does not match the slot algorithm")
+
+	// Nothing is left behind by the failures
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err, "cannot list the directory")
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,202 @@
+package container
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/checksum.go
+// This file contains the optional checksum trailer, CRC32C checksums of the header and the content
+// allowing accidental corruption such as bit rot to be detected and located without the key.
+//
+// It is not a security measure: anyone modifying the file can recompute the checksums.
+// Only the tag, verified while decrypting, protects the content against tampering.
+//
+// Trailer layout, right after the tag:
+// CRC32C of the header (uint32) || CRC32C of every 64 KiB block of the content (uint32 each) || number of blocks (uint32)
+
+// Size of the blocks of the content covered by one checksum
+const checksumBlockSize = 64 << 10
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	ErrNoChecksumTrailer = errors.New("the container has no checksum trailer")
+	ErrChecksumMismatch  = errors.New("the checksum does not match, the file is corrupted")
+)
+
+// Append the checksum trailer after the content, it must be called before WriteHeader and EncryptStream.
+// The chunked and multi-volume contents are not supported
+func (f *ContainerFile) EnableChecksumTrailer() {
+	f.header.Flags |= types.HeaderFlagChecksumTrailer
+}
+
+// Whether the content is followed by the checksum trailer
+func (f *ContainerFile) hasChecksumTrailer() bool {
+	return f.header.Flags&types.HeaderFlagChecksumTrailer != 0
+}
+
+// Number of checksum blocks covering the content of the size
+func checksumBlocks(contentSize int64) int64 {
+	return (contentSize + checksumBlockSize - 1) / checksumBlockSize
+}
+
+// Compute the checksum of every block of the region
+func checksumRegion(reader io.ReaderAt, offset, length int64) ([]uint32, error) {
+	checksums := make([]uint32, 0, checksumBlocks(length))
+	block := make([]byte, checksumBlockSize)
+	for position := int64(0); position < length; position += checksumBlockSize {
+		n := min(length-position, checksumBlockSize)
+		if _, err := reader.ReadAt(block[:n], offset+position); err != nil {
+			return nil, err
+		}
+		checksums = append(checksums, crc32.Checksum(block[:n], crc32cTable))
+	}
+	return checksums, nil
+}
+
+// Compute the checksum of the header as stored in the file
+func (f *ContainerFile) headerChecksum() (uint32, error) {
+	reader, ok := f.contentReaderAt()
+	if !ok {
+		return 0, types.ErrUnsupportedFeature
+	}
+	checksums, err := checksumRegion(reader, 0, f.contentOffset())
+	if err != nil {
+		return 0, err
+	}
+	return checksums[0], nil
+}
+
+// Write the trailer covering the content ending at contentEnd, the storage is left positioned after the trailer
+func (f *ContainerFile) writeChecksumTrailer(contentEnd int64) error {
+	headerChecksum, err := f.headerChecksum()
+	if err != nil {
+		return err
+	}
+	blocks, err := checksumRegion(f.file, f.contentOffset(), contentEnd-f.contentOffset())
+	if err != nil {
+		return err
+	}
+	trailer := binary.BigEndian.AppendUint32(nil, headerChecksum)
+	for _, checksum := range blocks {
+		trailer = binary.BigEndian.AppendUint32(trailer, checksum)
+	}
+	trailer = binary.BigEndian.AppendUint32(trailer, uint32(len(blocks)))
+	if _, err := f.file.Seek(contentEnd, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = f.file.Write(trailer)
+	return err
+}
+
+// Read the trailer, returning the checksums and where the content ends
+func (f *ContainerFile) readChecksumTrailer() (headerChecksum uint32, blocks []uint32, contentEnd int64, err error) {
+	reader, ok := f.contentReaderAt()
+	if !ok {
+		return 0, nil, -1, types.ErrUnsupportedFeature
+	}
+	size, err := f.FileSize()
+	if err != nil {
+		return 0, nil, -1, err
+	}
+	malformed := fmt.Errorf("%w: the trailer is malformed", ErrChecksumMismatch)
+	var count [4]byte
+	if size < f.contentOffset()+8 {
+		return 0, nil, -1, malformed
+	}
+	if _, err := reader.ReadAt(count[:], size-4); err != nil {
+		return 0, nil, -1, err
+	}
+	blockCount := int64(binary.BigEndian.Uint32(count[:]))
+	contentEnd = size - 8 - 4*blockCount
+	if contentEnd < f.contentOffset() || checksumBlocks(contentEnd-f.contentOffset()) != blockCount {
+		return 0, nil, -1, malformed
+	}
+	trailer := make([]byte, 4+4*blockCount)
+	if _, err := reader.ReadAt(trailer, contentEnd); err != nil {
+		return 0, nil, -1, err
+	}
+	headerChecksum = binary.BigEndian.Uint32(trailer)
+	blocks = make([]uint32, blockCount)
+	for i := range blocks {
+		blocks[i] = binary.BigEndian.Uint32(trailer[4+4*i:])
+	}
+	return headerChecksum, blocks, contentEnd, nil
+}
+
+// Random access to the backing file or to the sequential source when it supports it, e.g. embed.FS
+func (f *ContainerFile) contentReaderAt() (io.ReaderAt, bool) {
+	if f.file != nil {
+		return f.file, true
+	}
+	readerAt, ok := f.stream.(io.ReaderAt)
+	return readerAt, ok
+}
+
+// Offset where the content ends, before the checksum trailer if any
+func (f *ContainerFile) contentEnd() (int64, error) {
+	if f.hasChecksumTrailer() {
+		_, _, contentEnd, err := f.readChecksumTrailer()
+		return contentEnd, err
+	}
+	return f.FileSize()
+}
+
+// Update the checksum of the header in the trailer after the header was rewritten.
+// Nothing is done while nothing follows the header, a malformed trailer past it is reported
+func (f *ContainerFile) refreshHeaderChecksum() error {
+	size, err := f.FileSize()
+	if err != nil {
+		return err
+	}
+	if size <= f.contentOffset() {
+		return nil
+	}
+	_, _, contentEnd, err := f.readChecksumTrailer()
+	if err != nil {
+		return err
+	}
+	headerChecksum, err := f.headerChecksum()
+	if err != nil {
+		return err
+	}
+	_, err = f.file.WriteAt(binary.BigEndian.AppendUint32(nil, headerChecksum), contentEnd)
+	return err
+}
+
+// Check the header and the content against the checksum trailer without the key.
+// The error tells where the corruption is, ErrNoChecksumTrailer is returned when the container has no trailer.
+// It only detects accidental corruption, see the description above
+func (f *ContainerFile) QuickCheck() error {
+	if !f.hasChecksumTrailer() {
+		return ErrNoChecksumTrailer
+	}
+	headerChecksum, blocks, contentEnd, err := f.readChecksumTrailer()
+	if err != nil {
+		return err
+	}
+	actualHeader, err := f.headerChecksum()
+	if err != nil {
+		return err
+	}
+	if actualHeader != headerChecksum {
+		return fmt.Errorf("%w: in the header", ErrChecksumMismatch)
+	}
+	reader, _ := f.contentReaderAt()
+	actual, err := checksumRegion(reader, f.contentOffset(), contentEnd-f.contentOffset())
+	if err != nil {
+		return err
+	}
+	for i, checksum := range actual {
+		if checksum != blocks[i] {
+			return fmt.Errorf("%w: in the block at offset %d", ErrChecksumMismatch, f.contentOffset()+int64(i)*checksumBlockSize)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package container_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecksumTrailer(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(200000)
+	assert.NoError(t, err, "cannot generate the payload")
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	encryptedContainer.EnableChecksumTrailer()
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewReader(plainText))
+	assert.NoError(t, err, "cannot encrypt the payload")
+	// Rewriting the header keeps the trailer in sync
+	otherKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, otherKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	encryptedContainer.Close()
+
+	// The check does not need the key
+	encryptedContainer, err = container_pkg.OpenContainerFile(file.Name())
+	assert.NoError(t, err, "cannot open the container")
+	assert.NoError(t, encryptedContainer.QuickCheck(), "the intact file must pass")
+	size, err := encryptedContainer.EstimateContentSize()
+	assert.NoError(t, err, "cannot estimate the content size")
+	assert.Equal(t, int64(len(plainText)), size)
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the container")
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, plainText, buf.Bytes())
+	encryptedContainer.Close()
+
+	// Flip a bit in the second block of the content
+	data, err := os.ReadFile(file.Name())
+	assert.NoError(t, err, "cannot read the container")
+	data[4096+70000] ^= 1
+	assert.NoError(t, os.WriteFile(file.Name(), data, 0600), "cannot write the container")
+	encryptedContainer, err = container_pkg.OpenContainerFile(file.Name())
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.QuickCheck()
+	assert.ErrorIs(t, err, container_pkg.ErrChecksumMismatch)
+	assert.ErrorContains(t, err, "offset 69632")
+
+	// Containers without trailer cannot be checked
+	name, _ := createTestContainer(t, types.EncAlgAESCTR128, plainText)
+	plain, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer plain.Close()
+	assert.ErrorIs(t, plain.QuickCheck(), container_pkg.ErrNoChecksumTrailer)
+}
+
+// Rewriting the header over a malformed trailer fails instead of leaving the trailer stale
+func TestChecksumTrailerMalformedOnUpdate(t *testing.T) {
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	storage := &memoryStorage{}
+	encryptedContainer, err := container_pkg.NewContainerFileWithStorage(storage, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	encryptedContainer.EnableChecksumTrailer()
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewReader([]byte("Some secrets is here!")))
+	assert.NoError(t, err, "cannot encrypt the payload")
+	// Claim more blocks than the file can hold
+	storage.data[len(storage.data)-1] = 0xff
+	err = encryptedContainer.WriteHeader()
+	assert.ErrorIs(t, err, container_pkg.ErrChecksumMismatch)
+}
@@ -0,0 +1,388 @@
+package container
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/chunked.go
+// This file contains APIs for the chunked content framing.
+//
+// Content layout: salt || chunk 0 || chunk 1 || ... || chunk N
+// Every chunk holds ContentChunkSize bytes of plaintext except the last one, and is framed as
+// iv (16 bytes) || ciphertext || HMAC-SHA256 tag, where the tag binds the chunk index and whether it is the last chunk.
+// With the AEAD algorithms (AES-GCM and ChaCha20-Poly1305) the chunk is framed as nonce (12 bytes) || ciphertext || tag instead,
+// binding the same index and marker as additional data.
+// Hence each chunk can be verified, decrypted and replaced independently.
+
+// Size of the plaintext held by each chunk except the last one
+const ContentChunkSize = 64 * 1024
+
+var (
+	ErrNotChunked           = errors.New("the content of the container is not chunked")
+	ErrChunkOutOfBounds     = errors.New("the chunk index is out of bounds")
+	ErrChunkSizeMismatch    = errors.New("the replacement must have the same size as the chunk unless it is the last chunk")
+	ErrChunkLayoutCorrupted = errors.New("the size of the content does not match the chunk layout")
+)
+
+// Use the chunked framing for the content, it must be called before WriteHeader and EncryptStream
+func (f *ContainerFile) EnableChunkedContent() {
+	f.header.Flags |= types.HeaderFlagChunkedContent
+}
+
+// Whether the content uses the chunked framing
+func (f *ContainerFile) isChunked() bool {
+	return f.header.Flags&types.HeaderFlagChunkedContent != 0
+}
+
+// Bytes added to each chunk by the framing of the algorithm
+func chunkOverheadOf(alg types.EncryptionAlgorithm) int64 {
+	switch alg {
+	case types.EncAlgAESGCM128, types.EncAlgAESGCM256:
+		return ic.AESGCMChunkOverhead
+	case types.EncAlgChaCha20Poly1305:
+		return ic.ChaCha20Poly1305ChunkOverhead
+	default:
+		return ic.AESCTRChunkOverhead
+	}
+}
+
+// Bytes added to each chunk of this container
+func (f *ContainerFile) chunkOverhead() int64 {
+	return chunkOverheadOf(f.header.Algorithm)
+}
+
+// Size of a full chunk on disk
+func (f *ContainerFile) chunkFrameSize() int64 {
+	return ContentChunkSize + f.chunkOverhead()
+}
+
+// Derive the content keys used by the chunks from the salt, the AEAD needs no separate authentication key
+func (f *ContainerFile) chunkKeys(salt []byte) ([][]byte, error) {
+	if f.header.Algorithm.IsAEAD() {
+		return f.deriveContentKeys(salt, []int{f.header.Algorithm.KeySize()})
+	}
+	return f.deriveContentKeys(salt, []int{f.header.Algorithm.KeySize(), authKeySize})
+}
+
+// Encrypt and authenticate a single chunk with the algorithm
+func sealChunkWith(alg types.EncryptionAlgorithm, keys [][]byte, index uint64, final bool, plaintext []byte) ([]byte, error) {
+	switch alg {
+	case types.EncAlgAESGCM128, types.EncAlgAESGCM256:
+		return ic.AESGCMSealChunk(keys[0], index, final, plaintext)
+	case types.EncAlgChaCha20Poly1305:
+		return ic.ChaCha20Poly1305SealChunk(keys[0], index, final, plaintext)
+	default:
+		return ic.AESCTRSealChunk(keys[0], keys[1], index, final, plaintext)
+	}
+}
+
+// Encrypt and authenticate a single chunk with the algorithm of the container
+func (f *ContainerFile) sealChunk(keys [][]byte, index uint64, final bool, plaintext []byte) ([]byte, error) {
+	return sealChunkWith(f.header.Algorithm, keys, index, final, plaintext)
+}
+
+// Verify and decrypt a single chunk with the algorithm of the container
+func (f *ContainerFile) openChunk(keys [][]byte, index uint64, final bool, chunk []byte) ([]byte, error) {
+	switch f.header.Algorithm {
+	case types.EncAlgAESGCM128, types.EncAlgAESGCM256:
+		return ic.AESGCMOpenChunk(keys[0], index, final, chunk)
+	case types.EncAlgChaCha20Poly1305:
+		return ic.ChaCha20Poly1305OpenChunk(keys[0], index, final, chunk)
+	default:
+		return ic.AESCTROpenChunk(keys[0], keys[1], index, final, chunk)
+	}
+}
+
+// Encrypt the stream into chunks until EOF
+func (f *ContainerFile) encryptChunked(reader io.Reader) error {
+	salt, err := ic.GenerateRandomBytes(f.contentSaltSize())
+	if err != nil {
+		return err
+	}
+	keys, err := f.chunkKeys(salt)
+	if err != nil {
+		return err
+	}
+	file_buffered := bufio.NewWriterSize(f.file, bufferSize)
+	if _, err := file_buffered.Write(salt); err != nil {
+		return err
+	}
+	source := bufio.NewReaderSize(reader, bufferSize)
+	buf := make([]byte, ContentChunkSize)
+	for index := uint64(0); ; index++ {
+		n, err := io.ReadFull(source, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		// Look ahead to know whether this is the last chunk
+		final := err != nil
+		if !final {
+			if _, err := source.Peek(1); err == io.EOF {
+				final = true
+			} else if err != nil {
+				return err
+			}
+		}
+		chunk, err := f.sealChunk(keys, index, final, buf[:n])
+		if err != nil {
+			return err
+		}
+		if _, err := file_buffered.Write(chunk); err != nil {
+			return err
+		}
+		if final {
+			break
+		}
+	}
+	return file_buffered.Flush()
+}
+
+// Decrypt the chunks from the content reader into the writer
+func (f *ContainerFile) decryptChunked(content io.Reader, writer io.Writer) error {
+	salt := make([]byte, f.contentSaltSize())
+	if _, err := io.ReadFull(content, salt); err != nil {
+		return truncatedOnEOF(err)
+	}
+	reader, err := f.newChunkedContentReader(content, salt, nil)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, reader)
+	return err
+}
+
+// Reader verifying and decrypting the chunks one by one
+type chunkedContentReader struct {
+	source  *bufio.Reader
+	file    *ContainerFile
+	keys    [][]byte
+	index   uint64
+	frame   []byte
+	pending []byte
+	done    bool
+	closer  io.Closer
+}
+
+// Create a reader over the chunks, the source must be positioned right after the salt
+func (f *ContainerFile) newChunkedContentReader(source io.Reader, salt []byte, closer io.Closer) (*chunkedContentReader, error) {
+	keys, err := f.chunkKeys(salt)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkedContentReader{
+		source: bufio.NewReaderSize(source, bufferSize),
+		file:   f,
+		keys:   keys,
+		frame:  make([]byte, f.chunkFrameSize()),
+		closer: closer,
+	}, nil
+}
+
+func (r *chunkedContentReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// Read, verify and decrypt the next chunk
+func (r *chunkedContentReader) nextChunk() error {
+	n, err := io.ReadFull(r.source, r.frame)
+	if err == io.EOF {
+		// The last chunk was never seen
+		return ic.ErrTruncated
+	} else if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	if int64(n) < r.file.chunkOverhead() {
+		return ic.ErrTruncated
+	}
+	final := err == io.ErrUnexpectedEOF
+	if !final {
+		if _, err := r.source.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	}
+	plaintext, err := r.file.openChunk(r.keys, r.index, final, r.frame[:n])
+	if err != nil {
+		// A full chunk opening as a middle one means the stream was cut right after it
+		if final && n == len(r.frame) {
+			if _, middleErr := r.file.openChunk(r.keys, r.index, false, r.frame[:n]); middleErr == nil {
+				return ic.ErrTruncated
+			}
+		}
+		return err
+	}
+	r.pending = plaintext
+	r.done = final
+	r.index++
+	return nil
+}
+
+func (r *chunkedContentReader) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+// Get the position of every chunk in the content.
+// The chunks are located using the size of the file as all chunks except the last one are full
+func (f *ContainerFile) ChunkMap() ([]types.ChunkRef, error) {
+	if !f.isChunked() {
+		return nil, ErrNotChunked
+	}
+	fileSize, err := f.FileSize()
+	if err != nil {
+		return nil, err
+	}
+	chunksStart := f.contentOffset() + int64(f.contentSaltSize())
+	remaining := fileSize - chunksStart
+	overhead, fullFrameSize := f.chunkOverhead(), f.chunkFrameSize()
+	if remaining < overhead {
+		return nil, fmt.Errorf("%w: %w", ErrChunkLayoutCorrupted, ic.ErrTruncated)
+	}
+	chunks := make([]types.ChunkRef, 0, remaining/fullFrameSize+1)
+	for index := 0; remaining > 0; index++ {
+		frameSize := min(remaining, fullFrameSize)
+		if frameSize < overhead {
+			return nil, fmt.Errorf("%w: %w", ErrChunkLayoutCorrupted, ic.ErrTruncated)
+		}
+		chunks = append(chunks, types.ChunkRef{
+			Index:      index,
+			Offset:     int64(index) * ContentChunkSize,
+			Length:     frameSize - overhead,
+			FileOffset: fileSize - remaining,
+		})
+		remaining -= frameSize
+	}
+	return chunks, nil
+}
+
+// Size of the plaintext held by the chunks
+func (f *ContainerFile) chunkedContentSize() (int64, error) {
+	chunks, err := f.ChunkMap()
+	if err != nil {
+		return -1, err
+	}
+	last := chunks[len(chunks)-1]
+	return last.Offset + last.Length, nil
+}
+
+// Read the salt in front of the chunks, the backing file must be seekable
+func (f *ContainerFile) readChunkSalt() ([]byte, error) {
+	if f.file == nil {
+		return nil, ErrContainerReadOnly
+	}
+	salt := make([]byte, f.contentSaltSize())
+	if _, err := f.file.ReadAt(salt, f.contentOffset()); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// Read, verify and decrypt a single chunk
+func (f *ContainerFile) readChunk(keys [][]byte, chunk types.ChunkRef, final bool) ([]byte, error) {
+	frame := make([]byte, chunk.Length+f.chunkOverhead())
+	if _, err := f.file.ReadAt(frame, chunk.FileOffset); err != nil {
+		return nil, err
+	}
+	return f.openChunk(keys, uint64(chunk.Index), final, frame)
+}
+
+// Replace the plaintext of a single chunk, only that chunk is re-encrypted with a fresh iv.
+// The replacement must be exactly ContentChunkSize bytes except for the last chunk, which may be
+// shorter or longer up to ContentChunkSize, the file is resized accordingly.
+// The container must be unsealed and opened for update
+func (f *ContainerFile) ReplaceChunk(index int, reader io.Reader) error {
+	if len(f.rootKey) == 0 {
+		return ErrRootKeySealed
+	}
+	if f.file == nil {
+		return ErrContainerReadOnly
+	}
+	chunks, err := f.ChunkMap()
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= len(chunks) {
+		return ErrChunkOutOfBounds
+	}
+	plaintext, err := io.ReadAll(io.LimitReader(reader, ContentChunkSize+1))
+	if err != nil {
+		return err
+	}
+	final := index == len(chunks)-1
+	if len(plaintext) > ContentChunkSize || (!final && len(plaintext) != ContentChunkSize) {
+		return ErrChunkSizeMismatch
+	}
+	salt, err := f.readChunkSalt()
+	if err != nil {
+		return err
+	}
+	keys, err := f.chunkKeys(salt)
+	if err != nil {
+		return err
+	}
+	frame, err := f.sealChunk(keys, uint64(index), final, plaintext)
+	if err != nil {
+		return err
+	}
+	if _, err := f.file.WriteAt(frame, chunks[index].FileOffset); err != nil {
+		return err
+	}
+	if final {
+		return f.file.Truncate(chunks[index].FileOffset + int64(len(frame)))
+	}
+	return nil
+}
+
+// Verify every chunk and get the offset in the file of the first one failing the authentication, -1 when all pass.
+// Corruption of the salt makes every chunk fail, so the first chunk is reported.
+// The unchunked content has a single tag and cannot tell where it is corrupted, so only the chunked content is supported.
+// The container must be unsealed
+func (f *ContainerFile) LocateCorruption() (int64, error) {
+	if !f.isChunked() {
+		return -1, ErrNotChunked
+	}
+	if len(f.rootKey) == 0 {
+		return -1, ErrRootKeySealed
+	}
+	chunks, err := f.ChunkMap()
+	if err != nil {
+		return -1, err
+	}
+	salt, err := f.readChunkSalt()
+	if err != nil {
+		return -1, err
+	}
+	keys, err := f.chunkKeys(salt)
+	if err != nil {
+		return -1, err
+	}
+	for i, chunk := range chunks {
+		_, err := f.readChunk(keys, chunk, i == len(chunks)-1)
+		if errors.Is(err, ic.ErrAuthenticationFailed) || errors.Is(err, ic.ErrAEADAuthenticationFailed) {
+			return chunk.FileOffset, nil
+		}
+		if err != nil {
+			return -1, err
+		}
+	}
+	return -1, nil
+}
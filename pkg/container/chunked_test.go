@@ -0,0 +1,232 @@
+package container_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Create a chunked container on a temp file and keep it opened for update.
+func createChunkedTestContainer(t *testing.T, plainText []byte) (*container_pkg.ContainerFile, string, []byte) {
+	t.Helper()
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	t.Cleanup(func() { os.Remove(file.Name()) })
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	encryptedContainer.EnableChunkedContent()
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewReader(plainText))
+	assert.NoError(t, err, "cannot encrypt the test string")
+	return encryptedContainer, file.Name(), slotKey
+}
+
+// Decrypt the whole container from a fresh handle
+func decryptWithFreshHandle(t *testing.T, name string, slotKey []byte) ([]byte, error) {
+	t.Helper()
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	return buf.Bytes(), err
+}
+
+func TestChunkedContentRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 10, container_pkg.ContentChunkSize, 2*container_pkg.ContentChunkSize + 123} {
+		plainText, err := ic.GenerateRandomBytes(size + 1)
+		assert.NoError(t, err, "cannot generate plaintext")
+		plainText = plainText[:size]
+		encryptedContainer, name, slotKey := createChunkedTestContainer(t, plainText)
+		contentSize, err := encryptedContainer.EstimateContentSize()
+		assert.NoError(t, err, "cannot estimate file size")
+		assert.Equal(t, int64(size), contentSize)
+		encryptedContainer.Close()
+
+		decrypted, err := decryptWithFreshHandle(t, name, slotKey)
+		assert.NoError(t, err, "cannot decrypt the data")
+		assert.Equal(t, len(plainText), len(decrypted))
+		assert.True(t, bytes.Equal(plainText, decrypted), "the decrypted content does not match")
+	}
+}
+
+func TestChunkedContentReplaceChunk(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(3*container_pkg.ContentChunkSize + 500)
+	assert.NoError(t, err, "cannot generate plaintext")
+	encryptedContainer, name, slotKey := createChunkedTestContainer(t, plainText)
+	defer encryptedContainer.Close()
+
+	chunks, err := encryptedContainer.ChunkMap()
+	assert.NoError(t, err, "cannot get the chunk map")
+	assert.Len(t, chunks, 4)
+	for i, chunk := range chunks {
+		assert.Equal(t, i, chunk.Index)
+		assert.Equal(t, int64(i*container_pkg.ContentChunkSize), chunk.Offset)
+	}
+	assert.Equal(t, int64(500), chunks[3].Length)
+
+	// Redact the second chunk
+	redacted := bytes.Repeat([]byte{'X'}, container_pkg.ContentChunkSize)
+	err = encryptedContainer.ReplaceChunk(1, bytes.NewReader(redacted))
+	assert.NoError(t, err, "cannot replace the chunk")
+	copy(plainText[container_pkg.ContentChunkSize:], redacted)
+	decrypted, err := decryptWithFreshHandle(t, name, slotKey)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.True(t, bytes.Equal(plainText, decrypted), "the decrypted content does not match")
+
+	// Grow the last chunk
+	tail := bytes.Repeat([]byte{'T'}, 1000)
+	err = encryptedContainer.ReplaceChunk(3, bytes.NewReader(tail))
+	assert.NoError(t, err, "cannot replace the last chunk")
+	plainText = append(plainText[:3*container_pkg.ContentChunkSize], tail...)
+	decrypted, err = decryptWithFreshHandle(t, name, slotKey)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.True(t, bytes.Equal(plainText, decrypted), "the decrypted content does not match")
+
+	// Ranges spanning chunks are decrypted from the chunks
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptRange(buf, container_pkg.ContentChunkSize-10, container_pkg.ContentChunkSize+20)
+	assert.NoError(t, err, "cannot decrypt the range")
+	assert.Equal(t, plainText[container_pkg.ContentChunkSize-10:2*container_pkg.ContentChunkSize+10], buf.Bytes())
+
+	// Non last chunks must keep their size
+	err = encryptedContainer.ReplaceChunk(0, bytes.NewReader(tail))
+	assert.ErrorIs(t, err, container_pkg.ErrChunkSizeMismatch)
+	err = encryptedContainer.ReplaceChunk(4, bytes.NewReader(tail))
+	assert.ErrorIs(t, err, container_pkg.ErrChunkOutOfBounds)
+}
+
+// Reordered and truncated chunks must be detected
+func TestChunkedContentTampering(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(2 * container_pkg.ContentChunkSize)
+	assert.NoError(t, err, "cannot generate plaintext")
+	encryptedContainer, name, slotKey := createChunkedTestContainer(t, plainText)
+	chunks, err := encryptedContainer.ChunkMap()
+	assert.NoError(t, err, "cannot get the chunk map")
+	encryptedContainer.Close()
+
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	// Drop the last chunk
+	err = os.WriteFile(name, data[:chunks[1].FileOffset], 0600)
+	assert.NoError(t, err, "cannot truncate the container")
+	_, err = decryptWithFreshHandle(t, name, slotKey)
+	assert.ErrorIs(t, err, ic.ErrTruncated)
+	assert.NotErrorIs(t, err, ic.ErrAuthenticationFailed)
+	// Cut inside the overhead of the last chunk
+	err = os.WriteFile(name, data[:chunks[1].FileOffset+4], 0600)
+	assert.NoError(t, err, "cannot truncate the container")
+	_, err = decryptWithFreshHandle(t, name, slotKey)
+	assert.ErrorIs(t, err, ic.ErrTruncated)
+	// Swap the chunks
+	swapped := append([]byte(nil), data[:chunks[0].FileOffset]...)
+	swapped = append(swapped, data[chunks[1].FileOffset:]...)
+	swapped = append(swapped, data[chunks[0].FileOffset:chunks[1].FileOffset]...)
+	err = os.WriteFile(name, swapped, 0600)
+	assert.NoError(t, err, "cannot rewrite the container")
+	_, err = decryptWithFreshHandle(t, name, slotKey)
+	assert.ErrorIs(t, err, ic.ErrAuthenticationFailed)
+}
+
+func TestChunkedContentLocateCorruption(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(4*container_pkg.ContentChunkSize + 100)
+	assert.NoError(t, err, "cannot generate plaintext")
+	encryptedContainer, name, slotKey := createChunkedTestContainer(t, plainText)
+	chunks, err := encryptedContainer.ChunkMap()
+	assert.NoError(t, err, "cannot get the chunk map")
+	encryptedContainer.Close()
+
+	locate := func() (int64, error) {
+		encryptedContainer, err := container_pkg.OpenContainerFile(name)
+		assert.NoError(t, err, "cannot open the container")
+		defer encryptedContainer.Close()
+		_, err = encryptedContainer.LocateCorruption()
+		assert.ErrorIs(t, err, container_pkg.ErrRootKeySealed)
+		err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot unseal the root key")
+		return encryptedContainer.LocateCorruption()
+	}
+	offset, err := locate()
+	assert.NoError(t, err, "cannot verify the chunks")
+	assert.Equal(t, int64(-1), offset)
+
+	// Corrupt the middle of the third chunk, then the second one too
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	data[chunks[2].FileOffset+1000] ^= 0x01
+	err = os.WriteFile(name, data, 0600)
+	assert.NoError(t, err, "cannot tamper the container")
+	offset, err = locate()
+	assert.NoError(t, err, "cannot verify the chunks")
+	assert.Equal(t, chunks[2].FileOffset, offset)
+	data[chunks[1].FileOffset+chunks[1].Length] ^= 0x01
+	err = os.WriteFile(name, data, 0600)
+	assert.NoError(t, err, "cannot tamper the container")
+	offset, err = locate()
+	assert.NoError(t, err, "cannot verify the chunks")
+	assert.Equal(t, chunks[1].FileOffset, offset)
+
+	// The single tag of the unchunked content cannot tell where the corruption is
+	name, slotKey = createTestContainer(t, types.EncAlgAESCTR256, plainText)
+	unchunked, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer unchunked.Close()
+	err = unchunked.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	_, err = unchunked.LocateCorruption()
+	assert.ErrorIs(t, err, container_pkg.ErrNotChunked)
+}
+
+// The AEAD algorithms always use the chunked framing, every chunk being sealed by the AEAD
+func TestChunkedContentAEAD(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(2*container_pkg.ContentChunkSize + 77)
+	assert.NoError(t, err, "cannot generate plaintext")
+	for _, alg := range []types.EncryptionAlgorithm{types.EncAlgAESGCM128, types.EncAlgAESGCM256, types.EncAlgChaCha20Poly1305} {
+		name, slotKey := createTestContainer(t, alg, plainText)
+		decrypted, err := decryptWithFreshHandle(t, name, slotKey)
+		assert.NoError(t, err, "cannot decrypt the data")
+		assert.True(t, bytes.Equal(plainText, decrypted), "the decrypted content does not match")
+
+		encryptedContainer, err := container_pkg.OpenContainerFileForUpdate(name)
+		assert.NoError(t, err, "cannot open the container")
+		err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot unseal the root key")
+		chunks, err := encryptedContainer.ChunkMap()
+		assert.NoError(t, err, "cannot get the chunk map")
+		assert.Len(t, chunks, 3)
+		assert.Equal(t, int64(77), chunks[2].Length)
+		_, err = encryptedContainer.ContentAuthKey(make([]byte, 32))
+		assert.ErrorIs(t, err, types.ErrUnsupportedFeature)
+
+		redacted := bytes.Repeat([]byte{'X'}, container_pkg.ContentChunkSize)
+		err = encryptedContainer.ReplaceChunk(1, bytes.NewReader(redacted))
+		assert.NoError(t, err, "cannot replace the chunk")
+		expected := append(append(bytes.Clone(plainText[:container_pkg.ContentChunkSize]), redacted...), plainText[2*container_pkg.ContentChunkSize:]...)
+		buf := bytes.NewBuffer(nil)
+		err = encryptedContainer.DecryptRange(buf, container_pkg.ContentChunkSize-10, container_pkg.ContentChunkSize+20)
+		assert.NoError(t, err, "cannot decrypt the range")
+		assert.Equal(t, expected[container_pkg.ContentChunkSize-10:2*container_pkg.ContentChunkSize+10], buf.Bytes())
+		encryptedContainer.Close()
+
+		// Tampering is reported by the AEAD
+		data, err := os.ReadFile(name)
+		assert.NoError(t, err, "cannot read the container")
+		data[chunks[2].FileOffset+20] ^= 0x01
+		err = os.WriteFile(name, data, 0600)
+		assert.NoError(t, err, "cannot tamper the container")
+		_, err = decryptWithFreshHandle(t, name, slotKey)
+		assert.ErrorIs(t, err, ic.ErrAEADAuthenticationFailed)
+	}
+}
@@ -0,0 +1,40 @@
+package container_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"os"
+	"testing"
+
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Recompute the tag of the content outside of the package and compare it with the stored one
+func TestContentAuthKeyExternalVerification(t *testing.T) {
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR256, []byte("Some secrets is here!"))
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	content := data[encryptedContainer.ContentOffset():]
+	salt := content[:32]
+	ivAndCiphertext := content[32 : len(content)-sha256.Size]
+	storedTag := content[len(content)-sha256.Size:]
+
+	_, err = encryptedContainer.ContentAuthKey(salt)
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeySealed)
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	_, err = encryptedContainer.ContentAuthKey(salt[:16])
+	assert.Error(t, err, "a salt of the wrong size should be refused")
+
+	authKey, err := encryptedContainer.ContentAuthKey(salt)
+	assert.NoError(t, err, "cannot derive the authentication key")
+	h := hmac.New(sha256.New, authKey)
+	h.Write(ivAndCiphertext)
+	assert.True(t, hmac.Equal(storedTag, h.Sum(nil)), "the recomputed tag does not match the stored tag")
+}
@@ -0,0 +1,170 @@
+package container
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/content_cache.go
+// This file contains the opt-in read-through cache of decrypted contents, e.g. for a server delivering the same assets repeatedly.
+//
+// The cache holds plaintexts in memory until they expire or are evicted, only use it when that exposure is acceptable.
+// Every buffer is wiped when it leaves the cache.
+//
+// The entries are keyed by the root key, the header and both ends of the content, which hold the salt, the iv and the tag,
+// so computing the key does not read the whole file. A hit is served without authenticating the content again.
+
+// Bytes read from each end of the content to compute the key of the entry
+const contentCacheProbeSize = 64
+
+// ContentCache is a LRU cache of decrypted contents with a TTL, bounded by the total size of the plaintexts.
+// It is safe for concurrent use
+type ContentCache struct {
+	mu       sync.Mutex
+	capacity int64
+	size     int64
+	ttl      time.Duration
+	now      func() time.Time
+	entries  map[string]*list.Element
+	order    *list.List // most recently used first
+}
+
+// Entry of the cache
+type contentCacheEntry struct {
+	key       string
+	plaintext []byte
+	expires   time.Time
+}
+
+// Create a cache holding up to capacity bytes of plaintext, each content for at most ttl after it was added.
+// Contents larger than the capacity are never cached
+func NewContentCache(capacity int64, ttl time.Duration) *ContentCache {
+	return &ContentCache{
+		capacity: capacity,
+		ttl:      ttl,
+		now:      time.Now,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get a copy of the cached plaintext, false if missing or expired.
+// The presence is reported separately as an empty plaintext is cached like any other
+func (c *ContentCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*contentCacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.remove(element)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return bytes.Clone(entry.plaintext), true
+}
+
+// Add a copy of the plaintext, evicting the least recently used entries until it fits
+func (c *ContentCache) put(key string, plaintext []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if int64(len(plaintext)) > c.capacity {
+		return
+	}
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	for c.size+int64(len(plaintext)) > c.capacity {
+		c.remove(c.order.Back())
+	}
+	c.size += int64(len(plaintext))
+	c.entries[key] = c.order.PushFront(&contentCacheEntry{
+		key:       key,
+		plaintext: bytes.Clone(plaintext),
+		expires:   c.now().Add(c.ttl),
+	})
+}
+
+// Drop the entry and wipe its plaintext, the lock must be held
+func (c *ContentCache) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*contentCacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= int64(len(entry.plaintext))
+	ic.WipeBufferSecure(entry.plaintext)
+}
+
+// Drop and wipe every cached plaintext
+func (c *ContentCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.order.Len() > 0 {
+		c.remove(c.order.Back())
+	}
+}
+
+// Key of the content keyed by the root key, so only the holders of the root key can hit the entry
+func (f *ContainerFile) contentCacheKey() (string, error) {
+	readerAt, ok := f.contentReaderAt()
+	if !ok || f.isMultiVolume() {
+		return "", types.ErrUnsupportedFeature
+	}
+	end, err := f.contentEnd()
+	if err != nil {
+		return "", err
+	}
+	start := f.contentOffset()
+	length := max(end-start, 0)
+	head := make([]byte, min(length, contentCacheProbeSize))
+	tail := make([]byte, min(length, contentCacheProbeSize))
+	if _, err := readerAt.ReadAt(head, start); err != nil {
+		return "", err
+	}
+	if _, err := readerAt.ReadAt(tail, end-int64(len(tail))); err != nil {
+		return "", err
+	}
+	h := hmac.New(sha256.New, f.rootKey)
+	h.Write(f.HeaderFingerprint())
+	binary.Write(h, binary.BigEndian, length)
+	h.Write(head)
+	h.Write(tail)
+	return string(h.Sum(nil)), nil
+}
+
+// Decrypt the whole content, serving it from the cache when it was decrypted before and adding it otherwise.
+// The container must be unsealed, the returned slice is a copy owned by the caller.
+// Streamed and multi-volume containers are not supported
+func (f *ContainerFile) DecryptCached(cache *ContentCache) ([]byte, error) {
+	if len(f.rootKey) == 0 {
+		return nil, ErrRootKeySealed
+	}
+	key, err := f.contentCacheKey()
+	if err != nil {
+		return nil, err
+	}
+	if plaintext, ok := cache.get(key); ok {
+		f.metrics().Inc(MetricContentCacheHits)
+		return plaintext, nil
+	}
+	f.metrics().Inc(MetricContentCacheMisses)
+	limit := f.resourceLimits().MaxBuffer
+	if err := f.checkContentLimit("the cached content", limit); err != nil {
+		return nil, err
+	}
+	buffer := bytes.NewBuffer(nil)
+	if err := f.DecryptStream(newLimitedWriter(buffer, "the cached content", limit)); err != nil {
+		ic.WipeBufferSecure(buffer.Bytes())
+		return nil, err
+	}
+	cache.put(key, buffer.Bytes())
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,108 @@
+package container
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecryptCached(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(10000)
+	assert.NoError(t, err, "cannot generate the payload")
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	encryptedContainer, err := NewContainerFileWithHandle(file, types.EncAlgAESCTR128)
+	assert.NoError(t, err, "cannot create container")
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewReader(plainText))
+	assert.NoError(t, err, "cannot encrypt the payload")
+	encryptedContainer.Close()
+
+	cache := NewContentCache(1<<20, time.Minute)
+	decrypt := func() ([]byte, countingSink, error) {
+		sink := countingSink{}
+		encryptedContainer, err := OpenContainerFile(file.Name())
+		assert.NoError(t, err, "cannot open the container")
+		defer encryptedContainer.Close()
+		encryptedContainer.SetMetricsSink(sink)
+		_, err = encryptedContainer.DecryptCached(cache)
+		assert.ErrorIs(t, err, ErrRootKeySealed)
+		err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot unseal the container")
+		plaintext, err := encryptedContainer.DecryptCached(cache)
+		return plaintext, sink, err
+	}
+	decrypted, sink, err := decrypt()
+	assert.NoError(t, err, "cannot decrypt the content")
+	assert.Equal(t, plainText, decrypted)
+	assert.Equal(t, int64(1), sink[MetricContentCacheMisses])
+
+	// The content must not be decrypted again, and the copy returned is owned by the caller
+	decrypted[0] ^= 0x01
+	decrypted, sink, err = decrypt()
+	assert.NoError(t, err, "cannot decrypt the content")
+	assert.Equal(t, plainText, decrypted)
+	assert.Equal(t, int64(1), sink[MetricContentCacheHits])
+	assert.Zero(t, sink[MetricContentCacheMisses])
+	assert.Zero(t, sink[MetricBytesDecrypted])
+}
+
+// An empty plaintext is a hit like any other
+func TestContentCacheEmptyPlaintext(t *testing.T) {
+	cache := NewContentCache(1<<20, time.Minute)
+	cache.put("empty", nil)
+	plaintext, ok := cache.get("empty")
+	assert.True(t, ok, "the empty plaintext was not cached")
+	assert.Empty(t, plaintext)
+	_, ok = cache.get("missing")
+	assert.False(t, ok)
+}
+
+func TestContentCacheEviction(t *testing.T) {
+	now := time.Now()
+	cache := NewContentCache(6, time.Minute)
+	cache.now = func() time.Time { return now }
+	cache.put("a", []byte{1, 2, 3})
+	cache.put("b", []byte{4, 5, 6})
+	stored := cache.entries["a"].Value.(*contentCacheEntry).plaintext
+
+	// The least recently used entry is evicted and wiped once the size is exceeded
+	plaintext, ok := cache.get("b")
+	assert.True(t, ok)
+	assert.Equal(t, []byte{4, 5, 6}, plaintext)
+	cache.put("c", []byte{7, 8})
+	_, ok = cache.get("a")
+	assert.False(t, ok)
+	assert.Equal(t, []byte{0, 0, 0}, stored)
+	assert.Equal(t, int64(5), cache.size)
+
+	// Contents larger than the capacity are not cached
+	cache.put("d", make([]byte, 7))
+	_, ok = cache.get("d")
+	assert.False(t, ok)
+
+	// Expired entries are dropped and wiped too
+	stored = cache.entries["b"].Value.(*contentCacheEntry).plaintext
+	now = now.Add(time.Minute)
+	_, ok = cache.get("b")
+	assert.False(t, ok)
+	assert.Equal(t, []byte{0, 0, 0}, stored)
+
+	stored = cache.entries["c"].Value.(*contentCacheEntry).plaintext
+	cache.Purge()
+	_, ok = cache.get("c")
+	assert.False(t, ok)
+	assert.Equal(t, []byte{0, 0}, stored)
+	assert.Zero(t, cache.size)
+}
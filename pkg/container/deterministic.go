@@ -0,0 +1,90 @@
+package container
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+)
+
+// File: pkg/container/deterministic.go
+// This file contains the sources of the content salt and iv.
+//
+// By default both are random. In the deterministic mode they are derived from the plaintext and the root key,
+// so the same plaintext encrypted under the same root key always produces the same content (convergent encryption).
+//
+// Privacy trade-off: anyone able to see two containers sharing a root key can tell whether they hold the same plaintext,
+// and anyone able to guess the plaintext can confirm the guess once they hold the root key. Only enable it when
+// deduplication of identical plaintexts is worth leaking their equality.
+
+// Label used to derive the key of the plaintext HMAC from the root key
+var deterministicIVLabel = []byte("filecrypt-deterministic-iv")
+
+var (
+	ErrDeterministicIVUnsupported = errors.New("the deterministic iv is not supported with the chunked content")
+)
+
+// Derive the content salt and iv from the plaintext instead of generating them randomly.
+// The plaintext is read twice, so it is buffered in memory unless the reader passed to EncryptStream is an io.ReadSeeker.
+// It must be called before EncryptStream and is not supported with the chunked content.
+//
+// Warning: identical plaintexts produce identical content, see the privacy trade-off described above
+func (f *ContainerFile) EnableDeterministicIV() {
+	f.deterministicIV = true
+}
+
+// Get the salt and iv for the content and the reader to encrypt from.
+// The returned reader must be used in place of the original one as the plaintext may have been consumed
+func (f *ContainerFile) contentSaltAndIV(reader io.Reader) (salt, iv []byte, source io.Reader, err error) {
+	if !f.deterministicIV {
+		strategy := f.ivStrategy
+		if strategy == nil {
+			strategy = RandomIV
+		}
+		if salt, iv, err = strategy.saltAndIV(f); err != nil {
+			return nil, nil, nil, err
+		}
+		return salt, iv, reader, nil
+	}
+	keys, err := f.deriveContentKeys(deterministicIVLabel, []int{sha256.Size})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	h := hmac.New(sha256.New, keys[0])
+	ic.WipeBufferSecure(keys[0])
+	source, err = hashPlaintext(h, reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	values, err := ic.DeriveKeysFromMasterKeyEx(h.Sum(nil), nil, []int{f.contentSaltSize(), contentIVSize})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return values[0], values[1], source, nil
+}
+
+// Feed the whole plaintext into the hash and return a reader replaying it
+func hashPlaintext(h io.Writer, reader io.Reader) (io.Reader, error) {
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(h, seeker); err != nil {
+			return nil, err
+		}
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return seeker, nil
+	}
+	plaintext, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(plaintext)
+	return bytes.NewReader(plaintext), nil
+}
@@ -0,0 +1,89 @@
+package container_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Encrypt the plaintext with the deterministic iv and return the name of the container
+func createDeterministicContainer(t *testing.T, rootKey, slotKey []byte, reader io.Reader) string {
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	t.Cleanup(func() { os.Remove(file.Name()) })
+	encryptedContainer, err := container_pkg.NewContainerFileWithRootKey(file, types.EncAlgAESCTR256, rootKey)
+	assert.NoError(t, err, "cannot create container")
+	defer encryptedContainer.Close()
+	encryptedContainer.EnableDeterministicIV()
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(reader)
+	assert.NoError(t, err, "cannot encrypt the plaintext")
+	return file.Name()
+}
+
+// Read the content after the aligned header, the header differs as the slots are sealed with random nonces
+func readContent(t *testing.T, name string) []byte {
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	return data[4096:]
+}
+
+func TestDeterministicIV(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(100000)
+	assert.NoError(t, err, "cannot generate the payload")
+	rootKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "cannot generate root key")
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+
+	// Seekable and buffered plaintexts must give the same result
+	first := createDeterministicContainer(t, rootKey, slotKey, bytes.NewReader(plainText))
+	second := createDeterministicContainer(t, rootKey, slotKey, bytes.NewBuffer(plainText))
+	assert.Equal(t, readContent(t, first), readContent(t, second))
+
+	// Another plaintext or root key must not
+	other := createDeterministicContainer(t, rootKey, slotKey, bytes.NewReader(plainText[1:]))
+	assert.NotEqual(t, readContent(t, first)[:48], readContent(t, other)[:48])
+	otherKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "cannot generate root key")
+	other = createDeterministicContainer(t, otherKey, slotKey, bytes.NewReader(plainText))
+	assert.NotEqual(t, readContent(t, first)[:48], readContent(t, other)[:48])
+
+	encryptedContainer, err := container_pkg.OpenContainerFile(first)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the container")
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, plainText, buf.Bytes())
+}
+
+func TestDeterministicIVChunked(t *testing.T) {
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR128)
+	assert.NoError(t, err, "cannot create container")
+	defer encryptedContainer.Close()
+	encryptedContainer.EnableChunkedContent()
+	encryptedContainer.EnableDeterministicIV()
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewBufferString("Some secrets is here!"))
+	assert.ErrorIs(t, err, container_pkg.ErrDeterministicIVUnsupported)
+}
@@ -0,0 +1,56 @@
+package container
+
+import (
+	container_internal "github.com/ngeojiajun/go-filecrypt/internal/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/double_header.go
+// This file contains the double-buffered header, keeping the header readable when a crash interrupts its update.
+//
+// The header is stored twice in two 4096 bytes copies, each ending with a sequence number and a CRC32C.
+// Every update replaces the older copy only, so the newer one stays intact until the write completes.
+// When opening, the valid copy with the highest sequence number wins, so a torn update falls back to the previous header.
+
+// Store the header twice and update the copies alternately, see above. The content starts after 8192 bytes.
+// It must be called before the first WriteHeader and cannot be combined with the compact or the header-bound header
+func (f *ContainerFile) EnableDoubleBufferedHeader() {
+	f.header.Flags |= types.HeaderFlagDoubleBuffered
+}
+
+func (f *ContainerFile) isDoubleBuffered() bool {
+	return f.header.Flags&types.HeaderFlagDoubleBuffered != 0
+}
+
+// Write the header into the older copy, or into both copies when the file does not hold them yet
+func (f *ContainerFile) writeDoubleBufferedHeader() error {
+	if f.header.Flags&types.HeaderFlagCompactHeader != 0 || f.isHeaderBound() {
+		return types.ErrUnsupportedFeature
+	}
+	size, err := f.FileSize()
+	if err != nil {
+		return err
+	}
+	sequences := []uint32{f.header.Sequence + 1}
+	if size < f.contentOffset() {
+		sequences = []uint32{0, 1}
+	}
+	// On failure the sequence goes back to the one of the intact copy, so a retry overwrites the torn copy again
+	previous := f.header.Sequence
+	for _, sequence := range sequences {
+		f.header.Sequence = sequence
+		region, err := container_internal.SerializeHeaderCopy(f.header)
+		if err != nil {
+			f.header.Sequence = previous
+			return err
+		}
+		if written, err := f.file.WriteAt(region, f.header.CopyOffset()); err != nil {
+			f.header.Sequence = previous
+			return &HeaderWriteError{Written: int64(written), Err: err}
+		}
+	}
+	if f.hasChecksumTrailer() {
+		return f.refreshHeaderChecksum()
+	}
+	return nil
+}
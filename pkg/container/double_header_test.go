@@ -0,0 +1,86 @@
+package container_test
+
+import (
+	"bytes"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoubleBufferedHeaderCrash(t *testing.T) {
+	firstKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	secondKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+
+	storage := &failingStorage{limit: 1 << 20}
+	encryptedContainer, err := container_pkg.NewContainerFileWithStorage(storage, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	encryptedContainer.EnableDoubleBufferedHeader()
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, firstKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	assert.Equal(t, int64(8192), encryptedContainer.ContentOffset())
+	err = encryptedContainer.EncryptStream(bytes.NewBufferString("Some secrets is here!"))
+	assert.NoError(t, err, "cannot encrypt the test string")
+
+	// Crash while the update is written, the older copy is torn halfway
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, secondKey)
+	assert.NoError(t, err, "cannot add slot")
+	storage.limit = 100
+	err = encryptedContainer.WriteHeader()
+	var headerErr *container_pkg.HeaderWriteError
+	assert.ErrorAs(t, err, &headerErr)
+	assert.Equal(t, int64(100), headerErr.Written)
+
+	// A failed retry tears the same copy again instead of the intact one
+	storage.limit = 100
+	err = encryptedContainer.WriteHeader()
+	assert.ErrorAs(t, err, &headerErr)
+
+	// The previous header is still readable from the other copy
+	storage.limit = 1 << 20
+	storage.position = 0
+	encryptedContainer, err = container_pkg.OpenContainerFileWithStorage(storage)
+	assert.NoError(t, err, "cannot open the container")
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, secondKey)
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeyUnsealFailed)
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, firstKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, "Some secrets is here!", buf.String())
+
+	// Updates keep working once the storage recovers, the newest copy wins
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, secondKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	storage.position = 0
+	encryptedContainer, err = container_pkg.OpenContainerFileWithStorage(storage)
+	assert.NoError(t, err, "cannot open the container")
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, secondKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	buf.Reset()
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, "Some secrets is here!", buf.String())
+}
+
+func TestDoubleBufferedHeaderUnsupported(t *testing.T) {
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	encryptedContainer, err := container_pkg.NewContainerFileWithStorage(&memoryStorage{}, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	encryptedContainer.EnableDoubleBufferedHeader()
+	encryptedContainer.EnableCompactHeader()
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.ErrorIs(t, err, types.ErrUnsupportedFeature)
+}
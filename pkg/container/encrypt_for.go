@@ -0,0 +1,115 @@
+package container
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"errors"
+	"io"
+
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/encrypt_for.go
+// This file contains the one pass workflow encrypting for several recipients and signing the result,
+// like age and minisign combined. Every recipient gets a slot from AddRecipientSlot.
+//
+// The signature is detached, it covers the SHA-512 digest of the whole container including the header,
+// so neither a slot nor the content can be changed without it. Ed25519 signs the digest as Ed25519ph (RFC 8032)
+// and ECDSA signs it directly. The format does not store the signature, it is kept next to the file.
+
+var (
+	ErrSignerUnsupported = errors.New("the signer must hold an Ed25519 or an ECDSA key")
+	ErrSignatureInvalid  = errors.New("the signature does not match the container")
+)
+
+// Add a slot for every recipient, write the header, encrypt the content from the reader then sign the container.
+// The recipients are the public keys accepted by AddRecipientSlot and the signer holds an Ed25519 or an ECDSA key.
+// It returns the detached signature checked by VerifySignature, or nil when the signer is nil
+func (f *ContainerFile) EncryptFor(recipients []crypto.PublicKey, signer crypto.Signer, reader io.Reader) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, types.ErrParameterMissing
+	}
+	var opts crypto.SignerOpts
+	if signer != nil {
+		var err error
+		if opts, err = signatureOptions(signer.Public()); err != nil {
+			return nil, err
+		}
+	}
+	for _, recipient := range recipients {
+		if err := f.AddRecipientSlot(recipient); err != nil {
+			return nil, err
+		}
+	}
+	if err := f.WriteHeader(); err != nil {
+		return nil, err
+	}
+	if err := f.EncryptStream(reader); err != nil {
+		return nil, err
+	}
+	if signer == nil {
+		return nil, nil
+	}
+	digest, err := f.containerDigest()
+	if err != nil {
+		return nil, err
+	}
+	return signer.Sign(rand.Reader, digest, opts)
+}
+
+// Check the detached signature made by EncryptFor against the public key of the signer.
+// It does not need the root key, so the sender can be checked before unsealing
+func (f *ContainerFile) VerifySignature(publicKey crypto.PublicKey, signature []byte) error {
+	if _, err := signatureOptions(publicKey); err != nil {
+		return err
+	}
+	digest, err := f.containerDigest()
+	if err != nil {
+		return err
+	}
+	var valid bool
+	switch key := publicKey.(type) {
+	case ed25519.PublicKey:
+		valid = ed25519.VerifyWithOptions(key, digest, signature, &ed25519.Options{Hash: crypto.SHA512}) == nil
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(key, digest, signature)
+	}
+	if !valid {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
+
+// Options of the signature of the digest made with the key
+func signatureOptions(publicKey crypto.PublicKey) (crypto.SignerOpts, error) {
+	switch publicKey.(type) {
+	case ed25519.PublicKey:
+		return &ed25519.Options{Hash: crypto.SHA512}, nil
+	case *ecdsa.PublicKey:
+		return crypto.SHA512, nil
+	default:
+		return nil, ErrSignerUnsupported
+	}
+}
+
+// SHA-512 digest of the whole container as stored
+func (f *ContainerFile) containerDigest() ([]byte, error) {
+	if f.file == nil {
+		return nil, ErrContainerReadOnly
+	}
+	if f.isMultiVolume() {
+		return nil, ErrMultiVolume
+	}
+	size, err := f.file.Size()
+	if err != nil {
+		return nil, err
+	}
+	h := sha512.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f.file, 0, size)); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,82 @@
+package container_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"os"
+	"testing"
+
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Encrypt for two recipients and sign, each recipient decrypts and verifies the signature on their own
+func TestEncryptFor(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err, "cannot generate the RSA key")
+	x25519Key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	assert.NoError(t, err, "cannot generate the X25519 key")
+	ed25519Public, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err, "cannot generate the Ed25519 key")
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err, "cannot generate the ECDSA key")
+
+	for _, signer := range []crypto.Signer{ed25519Key, ecdsaKey} {
+		file, err := os.CreateTemp("", "filecrypt-ci-")
+		assert.NoError(t, err, "cannot create temp file")
+		defer os.Remove(file.Name())
+		encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESGCM256)
+		assert.NoError(t, err, "cannot create container")
+		signature, err := encryptedContainer.EncryptFor([]crypto.PublicKey{&rsaKey.PublicKey, x25519Key.PublicKey()}, signer, bytes.NewBufferString(plainText))
+		assert.NoError(t, err, "cannot encrypt for the recipients")
+		assert.NotEmpty(t, signature)
+		encryptedContainer.Close()
+
+		for _, privateKey := range []crypto.PrivateKey{rsaKey, x25519Key} {
+			encryptedContainer, err = container_pkg.OpenContainerFile(file.Name())
+			assert.NoError(t, err, "cannot open the container")
+			assert.NoError(t, encryptedContainer.VerifySignature(signer.Public(), signature), "cannot verify the signature")
+			err = encryptedContainer.UnsealWithPrivateKey(privateKey)
+			assert.NoError(t, err, "cannot unseal with the private key")
+			buf := bytes.NewBuffer(nil)
+			err = encryptedContainer.DecryptStream(buf)
+			assert.NoError(t, err, "cannot decrypt the data")
+			assert.Equal(t, plainText, buf.String())
+			encryptedContainer.Close()
+		}
+
+		// Any change of the container breaks the signature
+		data, err := os.ReadFile(file.Name())
+		assert.NoError(t, err, "cannot read the container")
+		data[len(data)-1] ^= 1
+		assert.NoError(t, os.WriteFile(file.Name(), data, 0600), "cannot tamper the container")
+		encryptedContainer, err = container_pkg.OpenContainerFile(file.Name())
+		assert.NoError(t, err, "cannot open the container")
+		assert.ErrorIs(t, encryptedContainer.VerifySignature(signer.Public(), signature), container_pkg.ErrSignatureInvalid)
+		encryptedContainer.Close()
+	}
+
+	// Unsupported signers and missing recipients are refused before anything is written
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESGCM256)
+	assert.NoError(t, err, "cannot create container")
+	defer encryptedContainer.Close()
+	_, err = encryptedContainer.EncryptFor([]crypto.PublicKey{x25519Key.PublicKey()}, rsaKey, bytes.NewBufferString(plainText))
+	assert.ErrorIs(t, err, container_pkg.ErrSignerUnsupported)
+	_, err = encryptedContainer.EncryptFor(nil, ed25519Key, bytes.NewBufferString(plainText))
+	assert.ErrorIs(t, err, types.ErrParameterMissing)
+	signature, err := encryptedContainer.EncryptFor([]crypto.PublicKey{x25519Key.PublicKey()}, ed25519Key, bytes.NewBufferString(plainText))
+	assert.NoError(t, err, "cannot encrypt for the recipient")
+	assert.NoError(t, encryptedContainer.VerifySignature(ed25519Public, signature))
+	assert.ErrorIs(t, encryptedContainer.VerifySignature(&ecdsaKey.PublicKey, signature), container_pkg.ErrSignatureInvalid)
+}
@@ -0,0 +1,74 @@
+package container
+
+import (
+	"errors"
+	"io"
+)
+
+// File: pkg/container/encryption_stream.go
+// This file contains the writer counterpart of EncryptStream, e.g. for the APIs pushing the data like a http handler.
+//
+// The bytes written are piped into EncryptStream running in the background, so the content is produced exactly
+// like EncryptStream would. The tag (or the last chunk) is only written once the stream is closed.
+
+var (
+	ErrEncryptionStreamClosed = errors.New("the encryption stream is already closed")
+)
+
+// Writer encrypting everything written to it into the content of the container
+type encryptionStream struct {
+	f      *ContainerFile
+	pipe   *io.PipeWriter
+	done   chan error
+	closed bool
+	err    error
+}
+
+// Create a stream encrypting whatever is written to it, the header must be written before.
+// Close must be called to finalize the content, it closes the container like AsDecryptionStream.
+// The content is incomplete and unreadable when Close is not called or fails
+func (f *ContainerFile) AsEncryptionStream() (io.WriteCloser, error) {
+	// Report the misuse now instead of on the first write
+	if len(f.rootKey) == 0 {
+		return nil, ErrRootKeySealed
+	}
+	if f.file == nil {
+		return nil, ErrContainerReadOnly
+	}
+	if !f.hasActiveSlots() {
+		return nil, ErrNoSlots
+	}
+	if f.contentOffset() == 0 {
+		return nil, ErrHeaderNotWritten
+	}
+	pipeReader, pipeWriter := io.Pipe()
+	s := &encryptionStream{f: f, pipe: pipeWriter, done: make(chan error, 1)}
+	go func() {
+		err := f.EncryptStream(pipeReader)
+		// Unblock the writer if the encryption stopped early
+		pipeReader.CloseWithError(err)
+		s.done <- err
+	}()
+	return s, nil
+}
+
+func (s *encryptionStream) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, ErrEncryptionStreamClosed
+	}
+	return s.pipe.Write(p)
+}
+
+// Finalize the content and close the container, the error of the encryption is reported here
+func (s *encryptionStream) Close() error {
+	if s.closed {
+		return s.err
+	}
+	s.closed = true
+	s.pipe.Close()
+	s.err = <-s.done
+	if closeErr := s.f.Close(); s.err == nil {
+		s.err = closeErr
+	}
+	return s.err
+}
@@ -0,0 +1,79 @@
+package container_test
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptionStream(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(2*container_pkg.ContentChunkSize + 123)
+	assert.NoError(t, err, "cannot generate plaintext")
+	for _, chunked := range []bool{false, true} {
+		file, err := os.CreateTemp("", "filecrypt-ci-")
+		assert.NoError(t, err, "cannot create temp file")
+		t.Cleanup(func() { os.Remove(file.Name()) })
+		slotKey, err := ic.GenerateRandomBytes(16)
+		assert.NoError(t, err, "cannot generate slot key")
+		encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+		assert.NoError(t, err, "cannot create container")
+		if chunked {
+			encryptedContainer.EnableChunkedContent()
+		}
+		assert.NoError(t, encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey), "cannot add slot")
+		assert.NoError(t, encryptedContainer.WriteHeader(), "cannot write out the headers")
+		stream, err := encryptedContainer.AsEncryptionStream()
+		assert.NoError(t, err, "cannot create the encryption stream")
+		// Push the plaintext in uneven pieces
+		for remaining := plainText; len(remaining) > 0; {
+			n := min(len(remaining), 1000)
+			written, err := stream.Write(remaining[:n])
+			assert.NoError(t, err, "cannot write into the stream")
+			assert.Equal(t, n, written)
+			remaining = remaining[n:]
+		}
+		assert.NoError(t, stream.Close(), "cannot finalize the stream")
+		_, err = stream.Write([]byte("late"))
+		assert.ErrorIs(t, err, container_pkg.ErrEncryptionStreamClosed)
+
+		decrypted, err := decryptWithFreshHandle(t, file.Name(), slotKey)
+		assert.NoError(t, err, "cannot decrypt the data")
+		assert.Equal(t, plainText, decrypted)
+	}
+}
+
+func TestEncryptionStreamMisuse(t *testing.T) {
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	t.Cleanup(func() { os.Remove(file.Name()) })
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	defer encryptedContainer.Close()
+	_, err = encryptedContainer.AsEncryptionStream()
+	assert.ErrorIs(t, err, container_pkg.ErrNoSlots)
+}
+
+func TestEncryptionStreamEmpty(t *testing.T) {
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	t.Cleanup(func() { os.Remove(file.Name()) })
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	assert.NoError(t, encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey), "cannot add slot")
+	assert.NoError(t, encryptedContainer.WriteHeader(), "cannot write out the headers")
+	stream, err := encryptedContainer.AsEncryptionStream()
+	assert.NoError(t, err, "cannot create the encryption stream")
+	_, err = io.WriteString(stream, "")
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Close(), "cannot finalize the stream")
+	decrypted, err := decryptWithFreshHandle(t, file.Name(), slotKey)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Empty(t, decrypted)
+}
@@ -0,0 +1,30 @@
+package container
+
+import (
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/export_test.go
+// This file exports internals to the external tests only, e.g. to verify the content without decrypting it.
+
+// SENSITIVE: Derive the HMAC-SHA256 key authenticating the unchunked content from the salt stored in front of it.
+// With this key the tests recompute the tag over iv || ciphertext as an external verifier would.
+// The AEAD algorithms have no separate authentication key, so they are not supported
+func (f *ContainerFile) ContentAuthKey(salt []byte) ([]byte, error) {
+	if len(f.rootKey) == 0 {
+		return nil, ErrRootKeySealed
+	}
+	if f.header.Algorithm.IsAEAD() {
+		return nil, types.ErrUnsupportedFeature
+	}
+	if len(salt) != f.contentSaltSize() {
+		return nil, ic.ErrInvalidLength
+	}
+	keys, err := f.contentKeys(salt)
+	if err != nil {
+		return nil, err
+	}
+	ic.WipeBufferSecure(keys[0])
+	return keys[1], nil
+}
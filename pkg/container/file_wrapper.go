@@ -2,9 +2,12 @@ package container
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/sha256"
 	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
 
 	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
@@ -17,9 +20,14 @@ import (
 // This file contains APIs that dealing with file IO
 
 const (
-	containerCiphertextOffset = 4096 // Offset to real cipher text
-	authKeySize               = 32
-	bufferSize                = 4096 * 4
+	rootKeySize            = 32
+	authKeySize            = 32
+	bufferSize             = 4096 * 4
+	defaultContentSaltSize = 32 // the salt is based on sha256 hash size
+	minContentSaltSize     = 16
+	maxContentSaltSize     = 255
+	contentIVSize          = 16
+	contentTagSize         = 32 // HMAC-SHA256 tag
 )
 
 var (
@@ -28,19 +36,55 @@ var (
 	ErrRootKeyUnsealFailed    = errors.New("the root key could not be unsealed")
 	ErrSlotInvalidRemove      = errors.New("cannot remove the slot as it is the only slot remaining or the no slot could be matched")
 	ErrSlotDuplicated         = errors.New("there is already a slot which match the parameter given")
+	ErrSlotIndexInvalid       = errors.New("the index does not designate an active slot")
 	ErrNoSlots                = errors.New("no slots is configured on the file")
+	ErrContainerReadOnly      = errors.New("the container is opened from a read only source")
+	ErrStreamConsumed         = errors.New("the content of the sequential source has already been consumed")
+	ErrInvalidSaltSize        = errors.New("the salt size must be between 16 and 255 bytes")
+	ErrHeaderSizeChanged      = errors.New("the compact header cannot change its size once the content is written")
+	ErrHeaderNotWritten       = errors.New("the header must be written before the content")
+	ErrFlagNotUpdatable       = errors.New("the flag affects how the content is read and cannot be changed")
 )
 
+// Error returned by WriteHeader when the header could not be written completely, the header region on disk is then corrupt.
+// Written is the number of bytes of the header which reached the storage
+type HeaderWriteError struct {
+	Written int64
+	Err     error
+}
+
+func (e *HeaderWriteError) Error() string {
+	return fmt.Sprintf("the header was only partially written (%d bytes): %v", e.Written, e.Err)
+}
+
+func (e *HeaderWriteError) Unwrap() error {
+	return e.Err
+}
+
 type ContainerFile struct {
-	file    *os.File                                // pointer to its backing file
-	header  *container_internal.ContainerFileHeader // pointer to the header and slot
-	rootKey []byte                                  // the root key
+	file             backingStorage                          // its backing storage, usually a file
+	stream           fs.File                                 // sequential source used when the container is not backed by a file
+	streamConsumed   bool                                    // whether the content of the stream was read
+	volumes          []*os.File                              // volumes holding the content in order when it spans several files
+	header           *container_internal.ContainerFileHeader // pointer to the header and slot
+	rootKey          []byte                                  // the root key
+	uniformUnseal    bool                                    // hide the reason of unseal failures
+	anonymous        bool                                    // hide the algorithm of the slots added
+	metricsSink      MetricsSink                             // receives the counters, no-op when nil
+	deterministicIV  bool                                    // derive the content salt and iv from the plaintext
+	ivStrategy       IVStrategy                              // source of the content salt and iv, random when nil
+	applicationID    []byte                                  // namespace mixed into every key derived from the root key
+	hiddenEntries    bool                                    // pad the table of contents of the archive
+	limits           *types.ResourceLimits                   // bounds of the decryption of untrusted files, none when nil
+	progress         ProgressFunc                            // receives the progress of the stream operations, none when nil
+	workers          int                                     // goroutines processing the content, sequential when 0 or 1
+	requireHeaderMAC bool                                    // refuse to unseal a header which is not authenticated
 }
 
 // Create a new container file
 func NewContainerFile(name string, alg types.EncryptionAlgorithm) (*ContainerFile, error) {
-	if alg >= types.EncAlgEnd {
-		return nil, types.ErrUnsupportedEncAlgo
+	if err := checkEncryptionAlgorithm(alg); err != nil {
+		return nil, err
 	}
 	fileHandler, err := os.Create(name)
 	if err != nil {
@@ -49,28 +93,78 @@ func NewContainerFile(name string, alg types.EncryptionAlgorithm) (*ContainerFil
 	return NewContainerFileWithHandle(fileHandler, alg)
 }
 
+// Create a new container file with the given permission, the permission is applied even if the file already exists.
+// Use this instead of NewContainerFile to avoid the permission of the secrets depending on the umask
+func NewContainerFileMode(name string, alg types.EncryptionAlgorithm, mode os.FileMode) (*ContainerFile, error) {
+	if err := checkEncryptionAlgorithm(alg); err != nil {
+		return nil, err
+	}
+	fileHandler, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := fileHandler.Chmod(mode); err != nil {
+		fileHandler.Close()
+		return nil, err
+	}
+	return NewContainerFileWithHandle(fileHandler, alg)
+}
+
 // Create a new container file with an already opened handle
 func NewContainerFileWithHandle(handle *os.File, alg types.EncryptionAlgorithm) (*ContainerFile, error) {
+	return NewContainerFileWithStorage(handle, alg)
+}
+
+// Create a new container over any seekable storage, e.g. an in-memory buffer or an adapter over a blob store.
+// Truncation, syncing and closing are forwarded when the storage supports them
+func NewContainerFileWithStorage(storage io.ReadWriteSeeker, alg types.EncryptionAlgorithm) (*ContainerFile, error) {
+	if err := checkEncryptionAlgorithm(alg); err != nil {
+		return nil, err
+	}
+	rootKey, err := ic.GenerateRandomBytes(rootKeySize)
+	if err != nil {
+		return nil, err
+	}
+	return newContainerFile(storage, alg, rootKey), nil
+}
+
+// Create a new container file with an already opened handle using a known root key, e.g. one kept in escrow.
+// The root key is copied so the caller may wipe its own copy
+func NewContainerFileWithRootKey(handle *os.File, alg types.EncryptionAlgorithm, rootKey []byte) (*ContainerFile, error) {
+	if err := checkEncryptionAlgorithm(alg); err != nil {
+		return nil, err
+	}
+	if len(rootKey) != rootKeySize {
+		return nil, ic.ErrKeySizeInvalid
+	}
+	return newContainerFile(handle, alg, bytes.Clone(rootKey)), nil
+}
+
+// Check the algorithm of a new container is known and compiled into this build
+func checkEncryptionAlgorithm(alg types.EncryptionAlgorithm) error {
 	if alg >= types.EncAlgEnd {
-		return nil, types.ErrUnsupportedEncAlgo
+		return types.ErrUnsupportedEncAlgo
 	}
-	file := &ContainerFile{
-		file: handle,
+	return container_internal.CheckEncryptionAlgorithm(alg)
+}
+
+func newContainerFile(storage io.ReadWriteSeeker, alg types.EncryptionAlgorithm, rootKey []byte) *ContainerFile {
+	var flags uint16
+	// The AEAD seals the content chunk by chunk
+	if alg.IsAEAD() {
+		flags |= types.HeaderFlagChunkedContent
+	}
+	return &ContainerFile{
+		file: newBackingStorage(storage),
 		header: &container_internal.ContainerFileHeader{
-			VersionMajor: 1,
-			VersionMinor: 0,
-			Flags:        0,
+			VersionMajor: types.FormatVersionMajor,
+			VersionMinor: types.FormatVersionMinor,
+			Flags:        flags,
 			Algorithm:    alg,
 			Slots:        []*container_internal.ContainerKeySlot{},
 		},
-		rootKey: []byte{},
+		rootKey: rootKey,
 	}
-	var err error
-	file.rootKey, err = ic.GenerateRandomBytes(32)
-	if err != nil {
-		return nil, err
-	}
-	return file, nil
 }
 
 // Open a container file
@@ -82,18 +176,129 @@ func OpenContainerFile(name string) (*ContainerFile, error) {
 	return OpenContainerFileWithHandle(fileHandler)
 }
 
+// Open a container file for update, where the header and content can be rewritten
+func OpenContainerFileForUpdate(name string) (*ContainerFile, error) {
+	fileHandler, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return OpenContainerFileWithHandle(fileHandler)
+}
+
+// Open a container file with the parsing options
+func OpenContainerFileWithOptions(name string, options *types.ParseOptions) (*ContainerFile, error) {
+	fileHandler, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := OpenContainerFileWithHandleOptions(fileHandler, options)
+	if err != nil {
+		fileHandler.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// Open a container file in strict mode, refusing unknown critical flags and files older than the minor version.
+// Files older than the minimum are refused with types.ErrVersionTooOld
+func OpenContainerFileStrict(name string, minVersionMinor uint8) (*ContainerFile, error) {
+	return OpenContainerFileWithOptions(name, &types.ParseOptions{Strict: true, MinVersionMinor: minVersionMinor})
+}
+
 // Open a container file with an already opened handle
 func OpenContainerFileWithHandle(handle *os.File) (*ContainerFile, error) {
+	return OpenContainerFileWithHandleOptions(handle, nil)
+}
+
+// Open a container file with an already opened handle and the parsing options
+func OpenContainerFileWithHandleOptions(handle *os.File, options *types.ParseOptions) (*ContainerFile, error) {
+	return OpenContainerFileWithStorageOptions(handle, options)
+}
+
+// Open a container over any seekable storage, e.g. an in-memory buffer or an adapter over a blob store
+func OpenContainerFileWithStorage(storage io.ReadWriteSeeker) (*ContainerFile, error) {
+	return OpenContainerFileWithStorageOptions(storage, nil)
+}
+
+// Open a container over any seekable storage with the parsing options
+func OpenContainerFileWithStorageOptions(storage io.ReadWriteSeeker, options *types.ParseOptions) (*ContainerFile, error) {
+	return openContainerFile(newBackingStorage(storage), options)
+}
+
+// Open a container starting at the offset of the storage, e.g. after the stub of a self-extracting file.
+// The bytes before the offset are left untouched
+func OpenContainerFileAtOffset(storage io.ReadWriteSeeker, offset int64) (*ContainerFile, error) {
+	shifted, err := newOffsetStorage(storage, offset)
+	if err != nil {
+		return nil, err
+	}
+	return openContainerFile(shifted, nil)
+}
+
+// Create a new container after the current end of the file, e.g. to embed an encrypted payload into another file.
+// It returns the offset where the container starts, which is needed to open it again with OpenContainerFileAtOffset.
+// The bytes before the offset are left untouched
+func AppendContainerTo(handle *os.File, alg types.EncryptionAlgorithm) (*ContainerFile, int64, error) {
+	if err := checkEncryptionAlgorithm(alg); err != nil {
+		return nil, -1, err
+	}
+	offset, err := handle.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, -1, err
+	}
+	shifted, err := newOffsetStorage(handle, offset)
+	if err != nil {
+		return nil, -1, err
+	}
+	rootKey, err := ic.GenerateRandomBytes(rootKeySize)
+	if err != nil {
+		return nil, -1, err
+	}
+	return newContainerFile(shifted, alg, rootKey), offset, nil
+}
+
+// Parse the header from the current position of the storage
+func openContainerFile(storage backingStorage, options *types.ParseOptions) (*ContainerFile, error) {
 	file := &ContainerFile{
-		file:    handle,
+		file:    storage,
 		header:  nil,
 		rootKey: []byte{},
 	}
 	var err error
+	file.header, err = container_internal.ParseContainerFileHeaderWithOptions(storage, options)
+	if err != nil {
+		return nil, err
+	}
+	if options != nil {
+		file.limits = options.Limits
+	}
+	if file.isMultiVolume() {
+		return nil, ErrMultiVolume
+	}
+	return file, nil
+}
+
+// Open a container file from a file system abstraction such as embed.FS.
+// As fs.File is not seekable, the content is read sequentially and can only be decrypted once
+func OpenContainerFileFS(fsys fs.FS, name string) (*ContainerFile, error) {
+	handle, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	file := &ContainerFile{
+		stream:  handle,
+		header:  nil,
+		rootKey: []byte{},
+	}
 	file.header, err = container_internal.ParseContainerFileHeader(handle)
 	if err != nil {
+		handle.Close()
 		return nil, err
 	}
+	if file.isMultiVolume() {
+		handle.Close()
+		return nil, ErrMultiVolume
+	}
 	return file, nil
 }
 
@@ -106,11 +311,27 @@ func (f *ContainerFile) GetSlots() []*types.ContainerSlotInfo {
 	return slots
 }
 
+// Hide the reason of the unseal failures, every failure returns ErrRootKeyUnsealFailed
+// and every slot is attempted even after a match, so the failures cannot be told apart by error or timing.
+// This prevents the slots from being used as an oracle at the cost of always attempting all slots
+func (f *ContainerFile) SetUniformUnsealErrors(enabled bool) {
+	f.uniformUnseal = enabled
+}
+
+// Hide the algorithm of the slots added by AddKeySlot from the header, only the AES-GCM slots can be hidden.
+// Unsealing is slower as the anonymous slots are attempted with every key of a compatible algorithm
+func (f *ContainerFile) SetAnonymousSlots(enabled bool) {
+	f.anonymous = enabled
+}
+
 // Search the slot which match the incoming crypto info
 func (f *ContainerFile) findMatchingSlot(alg types.SlotKeyAlgorithm, slotKey []byte) (rootKey []byte, index int) {
+	if f.uniformUnseal {
+		return f.findMatchingSlotUniform(alg, slotKey)
+	}
 	for index, slot := range f.header.Slots {
 		// Attempt the slots one by one
-		if slot.SlotKeyAlgorithm != alg {
+		if !slot.Accepts(alg) {
 			continue
 		}
 		if rootKey, err := slot.Unseal(slotKey); err == nil {
@@ -120,7 +341,27 @@ func (f *ContainerFile) findMatchingSlot(alg types.SlotKeyAlgorithm, slotKey []b
 	return nil, -1
 }
 
-// Seal the root key
+// Same as findMatchingSlot but all slots are always attempted, except the passphrase slots.
+// A key never unseals them and their costly derivation would let a crafted slot stall every unseal
+func (f *ContainerFile) findMatchingSlotUniform(alg types.SlotKeyAlgorithm, slotKey []byte) (rootKey []byte, index int) {
+	index = -1
+	for i, slot := range f.header.Slots {
+		if isPasswordSlot(slot.SlotKeyAlgorithm) {
+			continue
+		}
+		key, err := slot.Unseal(slotKey)
+		if err == nil && slot.Accepts(alg) && rootKey == nil {
+			rootKey, index = key, i
+		} else if err == nil {
+			ic.WipeBufferSecure(key)
+		}
+	}
+	return rootKey, index
+}
+
+// Seal the root key, it can be called between operations to keep the root key in memory only while needed.
+// Every later operation requiring the root key fails with ErrRootKeySealed until it is unsealed again.
+// A stream returned by AsDecryptionStream keeps its own content key and remains readable until closed
 func (f *ContainerFile) Seal() error {
 	if len(f.header.Slots) == 0 {
 		return ErrNoSlots
@@ -130,16 +371,66 @@ func (f *ContainerFile) Seal() error {
 	return nil
 }
 
+// Check the key against the size required by the slot algorithm, so wrong input is caught before any IO or slot operation.
+// Algorithms without a fixed key size, e.g. the token slots, cannot take a raw key and always fail with ErrKeySizeInvalid
+func ValidateKey(alg types.SlotKeyAlgorithm, slotKey []byte) error {
+	if alg >= types.SlotKeyAlgEnd {
+		return types.ErrUnsupportedSlotAlgo
+	}
+	if len(slotKey) == 0 {
+		return types.ErrParameterMissing
+	}
+	if len(slotKey) != alg.KeySize() {
+		return ic.ErrKeySizeInvalid
+	}
+	return nil
+}
+
 // Try to unseal the key
 func (f *ContainerFile) Unseal(alg types.SlotKeyAlgorithm, slotKey []byte) error {
 	if len(f.rootKey) != 0 {
 		return ErrRootKeyAlreadyUnsealed
 	}
+	if err := ValidateKey(alg, slotKey); err != nil {
+		if f.uniformUnseal {
+			return f.unsealFailed()
+		}
+		return err
+	}
 	if rootKey, _ := f.findMatchingSlot(alg, slotKey); rootKey != nil {
-		f.rootKey = rootKey
-		return nil
+		return f.acceptRootKey(rootKey)
 	}
-	return ErrRootKeyUnsealFailed
+	return f.unsealFailed()
+}
+
+// Check whether the key would unseal the container without changing its state.
+// The root key found is wiped immediately, so it works whether the container is sealed or not.
+// While sealed the header MAC is verified as Unseal does, once unsealed the header was verified already
+// and may have been changed in memory since
+func (f *ContainerFile) CanUnseal(alg types.SlotKeyAlgorithm, slotKey []byte) bool {
+	if err := ValidateKey(alg, slotKey); err != nil {
+		return false
+	}
+	rootKey, _ := f.findMatchingSlot(alg, slotKey)
+	if rootKey == nil {
+		return false
+	}
+	defer ic.WipeBufferSecure(rootKey)
+	return len(f.rootKey) != 0 || f.verifyHeaderMAC(rootKey) == nil
+}
+
+// Unseal using the root key directly without going through any slot, e.g. when it is recovered from escrow.
+// This allows the content to be decrypted even if all slots are lost, so the root key must be handled with care.
+// A wrong root key is only detected when the content fails the authentication, or at once when the header is authenticated.
+// The root key is copied so the caller may wipe its own copy
+func (f *ContainerFile) UnsealWithRootKey(rootKey []byte) error {
+	if len(f.rootKey) != 0 {
+		return ErrRootKeyAlreadyUnsealed
+	}
+	if len(rootKey) != rootKeySize {
+		return ic.ErrKeySizeInvalid
+	}
+	return f.acceptRootKey(bytes.Clone(rootKey))
 }
 
 // Add a key to the key slot
@@ -147,13 +438,25 @@ func (f *ContainerFile) AddKeySlot(alg types.SlotKeyAlgorithm, slotKey []byte) e
 	if len(f.rootKey) == 0 {
 		return ErrRootKeySealed
 	}
+	if err := ValidateKey(alg, slotKey); err != nil {
+		return err
+	}
 	if _, index := f.findMatchingSlot(alg, slotKey); index != -1 {
 		return ErrSlotDuplicated
 	}
-	slot, err := container_internal.NewContainerKeySlot(alg, 0, f.rootKey, slotKey)
+	var slot *container_internal.ContainerKeySlot
+	var err error
+	if f.anonymous {
+		slot, err = container_internal.NewContainerAnonymousSlot(alg, 0, f.rootKey, slotKey)
+	} else {
+		slot, err = container_internal.NewContainerKeySlot(alg, 0, f.rootKey, slotKey)
+	}
 	if err != nil {
 		return err
 	}
+	if err := container_internal.CheckSlotNonceUnique(f.header.Slots, slot); err != nil {
+		return err
+	}
 	f.header.Slots = append(f.header.Slots, slot)
 	return nil
 }
@@ -170,26 +473,185 @@ func (f *ContainerFile) RemoveKeySlotByIndex(index int) error {
 	return nil
 }
 
-// Write the updated header to the file
+// Whether any slot remains after the destroyed slots are dropped
+func (f *ContainerFile) hasActiveSlots() bool {
+	for _, slot := range f.header.Slots {
+		if slot.Flags&container_internal.FlagSlotDestroyed == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Get how many bytes of the 4096 bytes budget of the header are left and how many more AES-GCM-128 slots fit in them.
+// Slots of other algorithms may be larger, e.g. the prefixed slots also store their identifier.
+// A compact header cannot grow at all once the content follows it, whatever the budget left
+func (f *ContainerFile) RemainingSlotCapacity() (minSlots int, bytesLeft int) {
+	bytesLeft = max(f.header.Capacity()-f.header.UsedSize(), 0)
+	liveSlots := 0
+	for _, slot := range f.header.Slots {
+		if slot.Flags&container_internal.FlagSlotDestroyed == 0 {
+			liveSlots++
+		}
+	}
+	slotSize := container_internal.SlotHeaderOverhead + container_internal.GCMSlotContentOverhead + rootKeySize
+	// The number of slots is stored in a single byte
+	return max(min(bytesLeft/slotSize, 255-liveSlots), 0), bytesLeft
+}
+
+// Write the updated header to the file.
+// A failure of the storage midway is reported as a *HeaderWriteError carrying the number of bytes written
 func (f *ContainerFile) WriteHeader() error {
+	if f.file == nil {
+		return ErrContainerReadOnly
+	}
+	if err := f.authenticateHeader(); err != nil {
+		return err
+	}
+	if f.isDoubleBuffered() {
+		return f.writeDoubleBufferedHeader()
+	}
+	previousSize := f.header.Size()
+	buffer := bytes.NewBuffer(nil)
+	if err := container_internal.WriteContainerFileHeader(buffer, f.header); err != nil {
+		return err
+	}
+	// A compact header cannot grow or shrink once the content follows it
+	if previousSize != 0 && f.header.Size() != previousSize {
+		if size, err := f.FileSize(); err != nil || size > previousSize {
+			f.header.Length = uint16(previousSize)
+			return ErrHeaderSizeChanged
+		}
+	}
+	if err := f.checkHeaderBound(previousSize); err != nil {
+		return err
+	}
 	if _, err := f.file.Seek(0, io.SeekStart); err != nil {
 		return err
 	}
-	return container_internal.WriteContainerFileHeader(f.file, f.header)
+	// The header is fully serialized above, so a failure here can only come from the storage
+	if written, err := io.Copy(f.file, buffer); err != nil {
+		return &HeaderWriteError{Written: written, Err: err}
+	}
+	if f.hasChecksumTrailer() {
+		return f.refreshHeaderChecksum()
+	}
+	return nil
+}
+
+// Set then clear the header flags and rewrite the header, the content and the slots are left untouched.
+// Only the flags in types.HeaderFlagUpdatableMask can be changed
+func (f *ContainerFile) UpdateFlags(set, clear uint16) error {
+	if (set|clear)&^types.HeaderFlagUpdatableMask != 0 {
+		return ErrFlagNotUpdatable
+	}
+	flags := f.header.Flags
+	f.header.Flags = (flags | set) &^ clear
+	if err := f.WriteHeader(); err != nil {
+		f.header.Flags = flags
+		return err
+	}
+	return nil
+}
+
+// Hash of the serialized header, covering the version, the flags, the algorithm and the slots but not the content.
+// It changes whenever the set of slots changes, even before WriteHeader is called.
+// It returns nil when the header cannot be serialized, e.g. when no slot is configured
+func (f *ContainerFile) HeaderFingerprint() []byte {
+	// Serializing the compact header updates its length, which must stay the one on disk until WriteHeader
+	length := f.header.Length
+	defer func() { f.header.Length = length }()
+	// The sequence of the double-buffered header changes on every write, it is not part of the fingerprint
+	sequence := f.header.Sequence
+	f.header.Sequence = 0
+	defer func() { f.header.Sequence = sequence }()
+	// The MAC of the authenticated header covers the fingerprint, so it cannot be part of it
+	if f.isHeaderAuthenticated() {
+		mac := f.header.MAC
+		f.header.MAC = make([]byte, container_internal.HeaderMACSize)
+		defer func() { f.header.MAC = mac }()
+	}
+	h := sha256.New()
+	if err := container_internal.WriteContainerFileHeader(h, f.header); err != nil {
+		return nil
+	}
+	return h.Sum(nil)
+}
+
+// Get the application data kept in the padding of the header, nil when there is none
+func (f *ContainerFile) GetHeaderReserved() []byte {
+	return bytes.Clone(f.header.Reserved)
+}
+
+// Keep the application data in the padding of the header, it is stored in clear and only authenticated with EnableAuthenticatedHeader.
+// The header must stay within 4096 bytes, so the room left depends on the slots, adding slots later may not fit.
+// It takes effect on the next WriteHeader, pass nil to remove it
+func (f *ContainerFile) SetHeaderReserved(data []byte) error {
+	reserved := f.header.Reserved
+	length := f.header.Length
+	defer func() { f.header.Length = length }()
+	// The sequence of the double-buffered header changes on every write, it is not part of the fingerprint
+	sequence := f.header.Sequence
+	f.header.Sequence = 0
+	defer func() { f.header.Sequence = sequence }()
+	f.header.Reserved = bytes.Clone(data)
+	if err := container_internal.WriteContainerFileHeader(io.Discard, f.header); err == types.ErrProducedHeaderTooBig {
+		f.header.Reserved = reserved
+		return err
+	}
+	return nil
+}
+
+// Use the compact header which is only as large as needed instead of being padded to 4096 bytes.
+// It saves space for small files, but the header cannot be resized once the content is written,
+// so slots cannot be added or removed later unless the content is rewritten.
+// It must be called before WriteHeader and EncryptStream
+func (f *ContainerFile) EnableCompactHeader() {
+	f.header.Flags |= types.HeaderFlagCompactHeader
 }
 
 // Encrypt the stream until EOF
 func (f *ContainerFile) EncryptStream(reader io.Reader) error {
+	counter := &countingReader{reader: reader, progress: f.progressReporter(func() int64 { return sourceSize(reader) })}
+	err := f.encryptStream(counter)
+	f.metrics().Add(MetricBytesEncrypted, counter.n)
+	return err
+}
+
+func (f *ContainerFile) encryptStream(reader io.Reader) error {
 	// For now since the key are AES-CTR based so the path could be simplified
 	// but we should do something with it later on
-	if _, err := f.file.Seek(containerCiphertextOffset, io.SeekStart); err != nil {
+	if len(f.rootKey) == 0 {
+		return ErrRootKeySealed
+	}
+	if f.file == nil {
+		return ErrContainerReadOnly
+	}
+	// Without a slot the header can never be written, so the content would be unreadable
+	if !f.hasActiveSlots() {
+		return ErrNoSlots
+	}
+	// The size of the compact header is only known once it is written
+	if f.contentOffset() == 0 {
+		return ErrHeaderNotWritten
+	}
+	if _, err := f.file.Seek(f.contentOffset(), io.SeekStart); err != nil {
 		return err
 	}
-	keys, salt, err := ic.DeriveKeysFromMasterKey(f.rootKey, []int{f.header.Algorithm.KeySize(), authKeySize})
+	if f.isChunked() {
+		if f.deterministicIV {
+			return ErrDeterministicIVUnsupported
+		}
+		if f.hasChecksumTrailer() || (f.ivStrategy != nil && f.ivStrategy != RandomIV) {
+			return types.ErrUnsupportedFeature
+		}
+		return f.encryptChunked(reader)
+	}
+	salt, iv, reader, err := f.contentSaltAndIV(reader)
 	if err != nil {
 		return err
 	}
-	iv, err := ic.GenerateAESIV()
+	keys, err := f.contentKeys(salt)
 	if err != nil {
 		return err
 	}
@@ -202,55 +664,142 @@ func (f *ContainerFile) EncryptStream(reader io.Reader) error {
 	if _, err := file_buffered.Write(iv); err != nil {
 		return err
 	}
-	if _, err = ic.AESCTRStreamEncryptAuthenticatedEx(keys[0], iv, keys[1], reader, file_buffered); err != nil {
+	if _, err = ic.AESCTRStreamEncryptAuthenticatedParallel(keys[0], iv, keys[1], reader, file_buffered, f.workerCount()); err != nil {
+		return err
+	}
+	if err := file_buffered.Flush(); err != nil {
 		return err
 	}
-	return file_buffered.Flush()
+	if f.hasChecksumTrailer() {
+		contentEnd, err := f.file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		return f.writeChecksumTrailer(contentEnd)
+	}
+	return nil
+}
+
+// Replace the content with the plaintext from the reader while keeping the slots and the root key.
+// The content is encrypted with fresh salt and iv, then the file is truncated to the new content length.
+// The container must be unsealed and opened for update
+func (f *ContainerFile) ReplaceContent(reader io.Reader) error {
+	if len(f.rootKey) == 0 {
+		return ErrRootKeySealed
+	}
+	if err := f.EncryptStream(reader); err != nil {
+		return err
+	}
+	// Drop the leftover of the old content if it was longer
+	end, err := f.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	return f.file.Truncate(end)
 }
 
 func (f *ContainerFile) DecryptStream(writer io.Writer) error {
+	limit := f.resourceLimits().MaxDecompressedSize
+	if err := f.checkContentLimit("the decrypted content", limit); err != nil {
+		return err
+	}
+	counter := &countingWriter{writer: newLimitedWriter(writer, "the decrypted content", limit), progress: f.progressReporter(f.decryptionTotal)}
+	err := f.decryptStream(counter)
+	f.recordDecryption(counter.n, err)
+	return err
+}
+
+func (f *ContainerFile) decryptStream(writer io.Writer) error {
 	// For now since the key are AES-CTR based so the path could be simplified
 	// but we should do something with it later on
-	if _, err := f.file.Seek(containerCiphertextOffset, io.SeekStart); err != nil {
+	if len(f.rootKey) == 0 {
+		return ErrRootKeySealed
+	}
+	content, err := f.contentReader()
+	if err != nil {
 		return err
 	}
-	file_buffered := bufio.NewReaderSize(f.file, bufferSize)
-	// the salt is 32 bytes (based on sha256 hash size)
-	salt := make([]byte, 32)
-	iv := make([]byte, 16)
-	if _, err := io.ReadFull(file_buffered, salt); err != nil {
+	file_buffered := bufio.NewReaderSize(content, bufferSize)
+	if f.isChunked() {
+		return f.decryptChunked(file_buffered, writer)
+	}
+	if err := f.checkContentComplete(); err != nil {
 		return err
 	}
-	if _, err := io.ReadFull(file_buffered, iv); err != nil {
+	salt, iv, err := f.readSaltAndIV(file_buffered)
+	if err != nil {
 		return err
 	}
-	keys, err := ic.DeriveKeysFromMasterKeyEx(f.rootKey, salt, []int{f.header.Algorithm.KeySize(), authKeySize})
+	keys, err := f.contentKeys(salt)
 	if err != nil {
 		return err
 	}
-	_, err = ic.AESCTRStreamDecryptAuthenticatedEx(keys[0], iv, keys[1], file_buffered, writer)
+	_, err = ic.AESCTRStreamDecryptAuthenticatedParallel(keys[0], iv, keys[1], file_buffered, writer, f.workerCount())
 	return err
 }
 
+// Writer duplicating the writes to all writers, the first failing writer aborts the write
+type fanOutWriter []io.Writer
+
+func (w fanOutWriter) Write(p []byte) (int, error) {
+	for i, writer := range w {
+		n, err := writer.Write(p)
+		if err != nil {
+			return n, fmt.Errorf("writer %d failed: %w", i, err)
+		}
+		if n != len(p) {
+			return n, fmt.Errorf("writer %d failed: %w", i, io.ErrShortWrite)
+		}
+	}
+	return len(p), nil
+}
+
+// Decrypt the content into all the writers in one pass, e.g. an output file and a hash.
+// The decryption is aborted once any of the writers fails
+func (f *ContainerFile) DecryptStreamTo(writers ...io.Writer) error {
+	if len(writers) == 0 {
+		return types.ErrParameterMissing
+	}
+	return f.DecryptStream(fanOutWriter(writers))
+}
+
 // Create a stream to decrypt the file
 // Note that the authentication tag would not be verified
 func (f *ContainerFile) AsDecryptionStream() (io.ReadCloser, error) {
+	limit := f.resourceLimits().MaxDecompressedSize
+	if err := f.checkContentLimit("the decrypted content", limit); err != nil {
+		return nil, err
+	}
+	stream, err := f.asDecryptionStream()
+	if err != nil || limit <= 0 {
+		return stream, err
+	}
+	return &limitedReadCloser{ReadCloser: stream, what: "the decrypted content", limit: limit}, nil
+}
+
+func (f *ContainerFile) asDecryptionStream() (io.ReadCloser, error) {
 	// For now since the key are AES-CTR based so the path could be simplified
 	// but we should do something with it later on
-	if _, err := f.file.Seek(containerCiphertextOffset, io.SeekStart); err != nil {
-		return nil, err
+	if len(f.rootKey) == 0 {
+		return nil, ErrRootKeySealed
 	}
-	file_buffered := bufio.NewReaderSize(f.file, bufferSize)
-	// the salt is 32 bytes (based on sha256 hash size)
-	salt := make([]byte, 32)
-	iv := make([]byte, 16)
-	if _, err := io.ReadFull(file_buffered, salt); err != nil {
+	content, err := f.contentReader()
+	if err != nil {
 		return nil, err
 	}
-	if _, err := io.ReadFull(file_buffered, iv); err != nil {
+	file_buffered := bufio.NewReaderSize(content, bufferSize)
+	if f.isChunked() {
+		salt := make([]byte, f.contentSaltSize())
+		if _, err := io.ReadFull(file_buffered, salt); err != nil {
+			return nil, err
+		}
+		return f.newChunkedContentReader(file_buffered, salt, f)
+	}
+	salt, iv, err := f.readSaltAndIV(file_buffered)
+	if err != nil {
 		return nil, err
 	}
-	keys, err := ic.DeriveKeysFromMasterKeyEx(f.rootKey, salt, []int{f.header.Algorithm.KeySize()})
+	keys, err := f.deriveContentKeys(salt, []int{f.header.Algorithm.KeySize()})
 	if err != nil {
 		return nil, err
 	}
@@ -258,19 +807,160 @@ func (f *ContainerFile) AsDecryptionStream() (io.ReadCloser, error) {
 	return ic.NewAESCTRStreamReader(reader, keys[0], iv, f)
 }
 
+// Set the size of the salt used to derive the content keys, the size is stored in the header.
+// It must be called before WriteHeader and EncryptStream
+func (f *ContainerFile) SetContentSaltSize(size int) error {
+	if size < minContentSaltSize || size > maxContentSaltSize {
+		return ErrInvalidSaltSize
+	}
+	f.header.Flags |= types.HeaderFlagContentSaltSize
+	f.header.ContentSaltSize = uint8(size)
+	return nil
+}
+
+// Get the size of the salt in front of the content
+func (f *ContainerFile) contentSaltSize() int {
+	if f.header.Flags&types.HeaderFlagContentSaltSize != 0 {
+		return int(f.header.ContentSaltSize)
+	}
+	return defaultContentSaltSize
+}
+
+// Read the salt and iv in front of the ciphertext
+func (f *ContainerFile) readSaltAndIV(reader io.Reader) (salt, iv []byte, err error) {
+	salt = make([]byte, f.contentSaltSize())
+	iv = make([]byte, contentIVSize)
+	if _, err := io.ReadFull(reader, salt); err != nil {
+		return nil, nil, truncatedOnEOF(err)
+	}
+	if _, err := io.ReadFull(reader, iv); err != nil {
+		return nil, nil, truncatedOnEOF(err)
+	}
+	return salt, iv, nil
+}
+
+// Fail with ErrTruncated when the container is smaller than the salt, the iv and the tag of the unchunked content,
+// comparing its size as EstimateContentSize does. Nothing is checked when the size is not known, the reads catch it then
+func (f *ContainerFile) checkContentComplete() error {
+	size, err := f.EstimateContentSize()
+	if err == nil && size < 0 {
+		return ic.ErrTruncated
+	}
+	return nil
+}
+
+// Report the content ending early as ErrTruncated instead of the bare EOF
+func truncatedOnEOF(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ic.ErrTruncated
+	}
+	return err
+}
+
+// Position the backing storage at the start of the content and return the reader for it.
+// The sequential source can only be read once since it cannot be rewinded
+func (f *ContainerFile) contentReader() (io.Reader, error) {
+	if f.volumes != nil {
+		return f.volumesContentReader()
+	}
+	var reader io.Reader
+	if f.file != nil {
+		if _, err := f.file.Seek(f.contentOffset(), io.SeekStart); err != nil {
+			return nil, err
+		}
+		reader = f.file
+	} else {
+		// The header parser already consumed exactly the header
+		if f.streamConsumed {
+			return nil, ErrStreamConsumed
+		}
+		f.streamConsumed = true
+		reader = f.stream
+	}
+	if f.hasChecksumTrailer() {
+		contentEnd, err := f.contentEnd()
+		if err != nil {
+			return nil, err
+		}
+		return io.LimitReader(reader, contentEnd-f.contentOffset()), nil
+	}
+	return reader, nil
+}
+
+// Flush the writes buffered by the container to the backing file.
+// The buffers of WriteHeader and EncryptStream are currently flushed before they return, so this only checks the container is writable
+func (f *ContainerFile) Flush() error {
+	if f.file == nil {
+		return ErrContainerReadOnly
+	}
+	return nil
+}
+
+// Flush the buffered writes and commit the backing file to stable storage without closing it
+func (f *ContainerFile) Sync() error {
+	if err := f.Flush(); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
 // Close the file
 func (f *ContainerFile) Close() error {
+	if f.volumes != nil {
+		return f.closeVolumes()
+	}
 	if f.file != nil {
 		return f.file.Close()
 	}
+	if f.stream != nil {
+		return f.stream.Close()
+	}
 	return nil
 }
 
+// Get the size of the header region in bytes, it is 4096 unless the header is compact or double-buffered
+func (f *ContainerFile) HeaderSize() int64 {
+	return f.header.Size()
+}
+
+// Get the offset where the content region (salt, iv, ciphertext and tag) starts
+func (f *ContainerFile) ContentOffset() int64 {
+	return f.contentOffset()
+}
+
+// Offset to real cipher text
+func (f *ContainerFile) contentOffset() int64 {
+	return f.header.Size()
+}
+
+// Get the size of the backing file in bytes.
+// When the content spans several volumes, the size of the logical container is returned
+func (f *ContainerFile) FileSize() (int64, error) {
+	if f.volumes != nil {
+		return f.volumesSize()
+	}
+	if f.file != nil {
+		return f.file.Size()
+	}
+	info, err := f.stream.Stat()
+	if err != nil {
+		return -1, err
+	}
+	return info.Size(), nil
+}
+
 func (f *ContainerFile) EstimateContentSize() (int64, error) {
-	info, err := f.file.Stat()
+	if f.isChunked() {
+		return f.chunkedContentSize()
+	}
+	size, err := f.contentEnd()
 	if err != nil {
 		return -1, err
 	}
-	size := info.Size()
-	return size - containerCiphertextOffset - 48 - 32, nil
+	return size - contentOverhead(f.contentOffset(), f.contentSaltSize()), nil
+}
+
+// Number of bytes added to the unchunked content in the container, including the header
+func contentOverhead(headerSize int64, saltSize int) int64 {
+	return headerSize + int64(saltSize) + contentIVSize + contentTagSize
 }
@@ -2,13 +2,21 @@ package container_test
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
+	"testing/fstest"
 
 	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
 	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
 	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/ngeojiajun/go-filecrypt/pkg/utils"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -230,3 +238,768 @@ func TestFileWrapperMultiSlot3(t *testing.T) {
 	assert.Equal(t, plainText, buf.String(), "The decryption should give back the same content :-)")
 	encryptedContainer.Close()
 }
+
+// Empty or wrongly sized slot keys must be rejected at the public boundary
+func TestFileWrapperSlotKeyValidation(t *testing.T) {
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR128)
+	assert.NoError(t, err, "cannot create container")
+	defer encryptedContainer.Close()
+
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, nil)
+	assert.ErrorIs(t, err, types.ErrParameterMissing)
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, []byte{})
+	assert.ErrorIs(t, err, types.ErrParameterMissing)
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM256, slotKey)
+	assert.ErrorIs(t, err, utils.ErrKeySizeInvalid)
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgEnd, slotKey)
+	assert.ErrorIs(t, err, types.ErrUnsupportedSlotAlgo)
+
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.Seal()
+	assert.NoError(t, err, "cannot seal the container")
+
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, []byte{})
+	assert.ErrorIs(t, err, types.ErrParameterMissing)
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM256, slotKey)
+	assert.ErrorIs(t, err, utils.ErrKeySizeInvalid)
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the container")
+}
+
+// The container created with explicit mode must have exactly that permission
+func TestFileWrapperCreateMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix permission is not supported on windows")
+	}
+	name := filepath.Join(t.TempDir(), "secret.crpt")
+	// Precreate the file with loose permission to make sure it is tightened
+	err := os.WriteFile(name, []byte("old content"), 0644)
+	assert.NoError(t, err, "cannot create the file")
+	encryptedContainer, err := container_pkg.NewContainerFileMode(name, types.EncAlgAESCTR128, 0600)
+	assert.NoError(t, err, "cannot create container")
+	defer encryptedContainer.Close()
+	info, err := os.Stat(name)
+	assert.NoError(t, err, "cannot stat the file")
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	assert.Equal(t, int64(0), info.Size(), "the file should be truncated")
+}
+
+// Decrypt a container served from a fs.FS
+func TestFileWrapperOpenFS(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR128, []byte(plainText))
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	fsys := fstest.MapFS{
+		"assets/secret.crpt": &fstest.MapFile{Data: data},
+	}
+	encryptedContainer, err := container_pkg.OpenContainerFileFS(fsys, "assets/secret.crpt")
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	size, err := encryptedContainer.EstimateContentSize()
+	assert.NoError(t, err, "cannot estimate file size")
+	assert.Equal(t, len(plainText), int(size))
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, plainText, buf.String())
+	// The source cannot be rewinded
+	err = encryptedContainer.DecryptStream(io.Discard)
+	assert.ErrorIs(t, err, container_pkg.ErrStreamConsumed)
+	err = encryptedContainer.WriteHeader()
+	assert.ErrorIs(t, err, container_pkg.ErrContainerReadOnly)
+}
+
+// Replace the content with both shorter and longer plaintext
+func TestFileWrapperReplaceContent(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR128, []byte(plainText))
+	for _, replacement := range []string{"Short", "A much longer secret which should grow the file beyond the original size"} {
+		encryptedContainer, err := container_pkg.OpenContainerFileForUpdate(name)
+		assert.NoError(t, err, "cannot open the container")
+		err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot unseal the root key")
+		err = encryptedContainer.ReplaceContent(bytes.NewBufferString(replacement))
+		assert.NoError(t, err, "cannot replace the content")
+		err = encryptedContainer.Close()
+		assert.NoError(t, err, "cannot close the container")
+
+		// Reopen with the same slot key
+		encryptedContainer, err = container_pkg.OpenContainerFile(name)
+		assert.NoError(t, err, "cannot open the container")
+		err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot unseal the root key")
+		buf := bytes.NewBuffer(nil)
+		err = encryptedContainer.DecryptStream(buf)
+		assert.NoError(t, err, "cannot decrypt the data")
+		assert.Equal(t, replacement, buf.String())
+		size, err := encryptedContainer.EstimateContentSize()
+		assert.NoError(t, err, "cannot estimate file size")
+		assert.Equal(t, len(replacement), int(size))
+		encryptedContainer.Close()
+	}
+}
+
+// The layout accessors must describe the actual file
+func TestFileWrapperLayoutAccessors(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	name, _ := createTestContainer(t, types.EncAlgAESCTR128, []byte(plainText))
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+
+	headerSize := encryptedContainer.HeaderSize()
+	contentOffset := encryptedContainer.ContentOffset()
+	assert.Equal(t, int64(4096), headerSize)
+	assert.GreaterOrEqual(t, contentOffset, headerSize)
+	// The header can be parsed from the header region alone
+	_, err = container_pkg.OpenContainerFileFS(fstest.MapFS{"header": &fstest.MapFile{Data: data[:headerSize]}}, "header")
+	assert.NoError(t, err, "the header region should be self contained")
+	fileSize, err := encryptedContainer.FileSize()
+	assert.NoError(t, err, "cannot get the file size")
+	assert.Equal(t, int64(len(data)), fileSize)
+	// salt || iv || ciphertext || tag
+	assert.Equal(t, int64(32+16+len(plainText)+32), fileSize-contentOffset)
+}
+
+// A writer which always fails
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk is on fire")
+}
+
+// Decrypt into an output buffer and a hash at the same time
+func TestFileWrapperDecryptStreamTo(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR128, []byte(plainText))
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+
+	buf := bytes.NewBuffer(nil)
+	hasher := sha256.New()
+	err = encryptedContainer.DecryptStreamTo(buf, hasher)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, plainText, buf.String())
+	expected := sha256.Sum256([]byte(plainText))
+	assert.Equal(t, expected[:], hasher.Sum(nil))
+
+	err = encryptedContainer.DecryptStreamTo(io.Discard, failingWriter{})
+	assert.ErrorContains(t, err, "writer 1 failed")
+	err = encryptedContainer.DecryptStreamTo()
+	assert.ErrorIs(t, err, types.ErrParameterMissing)
+}
+
+// A container cut before the end of the tag is reported as truncated, not as tampered
+func TestFileWrapperTruncated(t *testing.T) {
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR128, []byte("Some secrets is here!"))
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	// Inside the salt, inside the iv and inside where the tag should be
+	for _, size := range []int{4096 + 20, 4096 + 40, 4096 + 32 + 16 + 20} {
+		err = os.WriteFile(name, data[:size], 0600)
+		assert.NoError(t, err, "cannot truncate the container")
+		_, err = decryptWithFreshHandle(t, name, slotKey)
+		assert.ErrorIs(t, err, ic.ErrTruncated, "cut at %d", size)
+		assert.NotErrorIs(t, err, ic.ErrAuthenticationFailed, "cut at %d", size)
+	}
+	tampered := bytes.Clone(data)
+	tampered[len(tampered)-40] ^= 0x01
+	err = os.WriteFile(name, tampered, 0600)
+	assert.NoError(t, err, "cannot tamper the container")
+	_, err = decryptWithFreshHandle(t, name, slotKey)
+	assert.ErrorIs(t, err, ic.ErrAuthenticationFailed)
+}
+
+// Round trip the content using non default salt sizes
+func TestFileWrapperContentSaltSize(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	for _, saltSize := range []int{16, 64} {
+		file, err := os.CreateTemp("", "filecrypt-ci-")
+		assert.NoError(t, err, "cannot create temp file")
+		defer os.Remove(file.Name())
+		slotKey, err := ic.GenerateRandomBytes(16)
+		assert.NoError(t, err, "cannot generate slot key")
+		encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR128)
+		assert.NoError(t, err, "cannot create container")
+		err = encryptedContainer.SetContentSaltSize(saltSize)
+		assert.NoError(t, err, "cannot set the salt size")
+		err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot add slot")
+		err = encryptedContainer.WriteHeader()
+		assert.NoError(t, err, "cannot write out the headers")
+		err = encryptedContainer.EncryptStream(bytes.NewBufferString(plainText))
+		assert.NoError(t, err, "cannot encrypt the test string")
+		encryptedContainer.Close()
+
+		encryptedContainer, err = container_pkg.OpenContainerFile(file.Name())
+		assert.NoError(t, err, "cannot open the container")
+		err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot unseal the root key")
+		size, err := encryptedContainer.FileSize()
+		assert.NoError(t, err, "cannot get the file size")
+		assert.Equal(t, encryptedContainer.ContentOffset()+int64(saltSize+16+len(plainText)+32), size)
+		contentSize, err := encryptedContainer.EstimateContentSize()
+		assert.NoError(t, err, "cannot estimate file size")
+		assert.Equal(t, len(plainText), int(contentSize))
+		buf := bytes.NewBuffer(nil)
+		err = encryptedContainer.DecryptStream(buf)
+		assert.NoError(t, err, "cannot decrypt the data")
+		assert.Equal(t, plainText, buf.String())
+		buf.Reset()
+		err = encryptedContainer.DecryptRange(buf, 5, 7)
+		assert.NoError(t, err, "cannot decrypt the range")
+		assert.Equal(t, plainText[5:12], buf.String())
+		encryptedContainer.Close()
+	}
+}
+
+// Salt sizes outside the supported range are refused
+func TestFileWrapperContentSaltSizeInvalid(t *testing.T) {
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR128)
+	assert.NoError(t, err, "cannot create container")
+	defer encryptedContainer.Close()
+	assert.ErrorIs(t, encryptedContainer.SetContentSaltSize(8), container_pkg.ErrInvalidSaltSize)
+	assert.ErrorIs(t, encryptedContainer.SetContentSaltSize(256), container_pkg.ErrInvalidSaltSize)
+}
+
+// All unseal failures look the same in uniform mode
+func TestFileWrapperUniformUnsealErrors(t *testing.T) {
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR128, []byte("Some secrets is here!"))
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	encryptedContainer.SetUniformUnsealErrors(true)
+
+	wrongKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	longKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "cannot generate slot key")
+	failures := []struct {
+		alg types.SlotKeyAlgorithm
+		key []byte
+	}{
+		{types.SlotKeyAlgAESGCM128, wrongKey}, // slot exists but key is wrong
+		{types.SlotKeyAlgAESGCM256, longKey},  // no such slot
+		{types.SlotKeyAlgAESGCM128, nil},      // key missing
+		{types.SlotKeyAlgAESGCM128, longKey},  // key size mismatch
+		{types.SlotKeyAlgEnd, slotKey},        // unknown algorithm
+	}
+	for _, failure := range failures {
+		err = encryptedContainer.Unseal(failure.alg, failure.key)
+		assert.Equal(t, container_pkg.ErrRootKeyUnsealFailed, err)
+	}
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, "Some secrets is here!", buf.String())
+}
+
+func TestFileWrapperCanUnseal(t *testing.T) {
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR128, []byte("Some secrets is here!"))
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+
+	wrongKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	assert.False(t, encryptedContainer.CanUnseal(types.SlotKeyAlgAESGCM128, wrongKey))
+	assert.True(t, encryptedContainer.CanUnseal(types.SlotKeyAlgAESGCM128, slotKey))
+
+	// The container must still be sealed
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, wrongKey)
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeySealed)
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+
+	// And it must not affect the unsealed state either
+	assert.True(t, encryptedContainer.CanUnseal(types.SlotKeyAlgAESGCM128, slotKey))
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, "Some secrets is here!", buf.String())
+}
+
+func TestFileWrapperUnsealWithRootKey(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	rootKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "cannot generate root key")
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	_, err = container_pkg.NewContainerFileWithRootKey(file, types.EncAlgAESCTR128, rootKey[:16])
+	assert.ErrorIs(t, err, ic.ErrKeySizeInvalid)
+	encryptedContainer, err := container_pkg.NewContainerFileWithRootKey(file, types.EncAlgAESCTR128, rootKey)
+	assert.NoError(t, err, "cannot create container")
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewBufferString(plainText))
+	assert.NoError(t, err, "cannot encrypt the test string")
+	encryptedContainer.Close()
+
+	encryptedContainer, err = container_pkg.OpenContainerFile(file.Name())
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.UnsealWithRootKey(rootKey[:16])
+	assert.ErrorIs(t, err, ic.ErrKeySizeInvalid)
+	err = encryptedContainer.UnsealWithRootKey(rootKey)
+	assert.NoError(t, err, "cannot unseal with the root key")
+	err = encryptedContainer.UnsealWithRootKey(rootKey)
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeyAlreadyUnsealed)
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, plainText, buf.String())
+}
+
+func TestFileWrapperSync(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR128)
+	assert.NoError(t, err, "cannot create container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewBufferString(plainText))
+	assert.NoError(t, err, "cannot encrypt the test string")
+	assert.NoError(t, encryptedContainer.Flush(), "cannot flush the container")
+	assert.NoError(t, encryptedContainer.Sync(), "cannot sync the container")
+
+	// The content must be readable from another handle while the container is still open
+	reopened, err := container_pkg.OpenContainerFile(file.Name())
+	assert.NoError(t, err, "cannot open the container")
+	defer reopened.Close()
+	err = reopened.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	buf := bytes.NewBuffer(nil)
+	err = reopened.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, plainText, buf.String())
+}
+
+func TestFileWrapperAnonymousSlots(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	key128, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	key256, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "cannot generate slot key")
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR128)
+	assert.NoError(t, err, "cannot create container")
+	encryptedContainer.SetAnonymousSlots(true)
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, key128)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM256, key256)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, key128)
+	assert.ErrorIs(t, err, container_pkg.ErrSlotDuplicated)
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewBufferString(plainText))
+	assert.NoError(t, err, "cannot encrypt the test string")
+	encryptedContainer.Close()
+
+	// The algorithm field of the first slot follows magic, version, flags, algorithm and slot count
+	data, err := os.ReadFile(file.Name())
+	assert.NoError(t, err, "cannot read the container")
+	assert.Equal(t, uint16(types.SlotKeyAlgAnonymous), binary.BigEndian.Uint16(data[11:13]))
+
+	for _, credential := range []struct {
+		alg types.SlotKeyAlgorithm
+		key []byte
+	}{
+		{types.SlotKeyAlgAESGCM128, key128},
+		{types.SlotKeyAlgAESGCM256, key256},
+	} {
+		encryptedContainer, err = container_pkg.OpenContainerFile(file.Name())
+		assert.NoError(t, err, "cannot open the container")
+		for _, slot := range encryptedContainer.GetSlots() {
+			assert.Equal(t, types.SlotKeyAlgAnonymous, slot.Alg)
+		}
+		err = encryptedContainer.Unseal(credential.alg, credential.key)
+		assert.NoError(t, err, "cannot unseal the root key")
+		buf := bytes.NewBuffer(nil)
+		err = encryptedContainer.DecryptStream(buf)
+		assert.NoError(t, err, "cannot decrypt the data")
+		assert.Equal(t, plainText, buf.String())
+		encryptedContainer.Close()
+	}
+}
+
+func TestFileWrapperCompactHeader(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	for _, compact := range []bool{false, true} {
+		file, err := os.CreateTemp("", "filecrypt-ci-")
+		assert.NoError(t, err, "cannot create temp file")
+		defer os.Remove(file.Name())
+		encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR128)
+		assert.NoError(t, err, "cannot create container")
+		err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot add slot")
+		if compact {
+			encryptedContainer.EnableCompactHeader()
+			err = encryptedContainer.EncryptStream(bytes.NewBufferString(plainText))
+			assert.ErrorIs(t, err, container_pkg.ErrHeaderNotWritten)
+		}
+		err = encryptedContainer.WriteHeader()
+		assert.NoError(t, err, "cannot write out the headers")
+		err = encryptedContainer.EncryptStream(bytes.NewBufferString(plainText))
+		assert.NoError(t, err, "cannot encrypt the test string")
+		encryptedContainer.Close()
+
+		data, err := os.ReadFile(file.Name())
+		assert.NoError(t, err, "cannot read the container")
+		encryptedContainer, err = container_pkg.OpenContainerFileForUpdate(file.Name())
+		assert.NoError(t, err, "cannot open the container")
+		if compact {
+			assert.Less(t, encryptedContainer.HeaderSize(), int64(4096))
+		} else {
+			assert.Equal(t, int64(4096), encryptedContainer.HeaderSize())
+		}
+		// salt || iv || ciphertext || tag
+		assert.Equal(t, int64(32+16+len(plainText)+32), int64(len(data))-encryptedContainer.ContentOffset())
+		err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot unseal the root key")
+		buf := bytes.NewBuffer(nil)
+		err = encryptedContainer.DecryptStream(buf)
+		assert.NoError(t, err, "cannot decrypt the data")
+		assert.Equal(t, plainText, buf.String())
+
+		// Adding a slot grows the header, which only the aligned header can absorb
+		anotherKey, err := ic.GenerateRandomBytes(16)
+		assert.NoError(t, err, "cannot generate slot key")
+		err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, anotherKey)
+		assert.NoError(t, err, "cannot add slot")
+		err = encryptedContainer.WriteHeader()
+		if compact {
+			assert.ErrorIs(t, err, container_pkg.ErrHeaderSizeChanged)
+		} else {
+			assert.NoError(t, err, "cannot rewrite the header")
+		}
+		encryptedContainer.Close()
+
+		// The sequential path must stop exactly at the end of the header
+		fsContainer, err := container_pkg.OpenContainerFileFS(fstest.MapFS{"file": &fstest.MapFile{Data: data}}, "file")
+		assert.NoError(t, err, "cannot open the container from fs")
+		err = fsContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot unseal the root key")
+		buf.Reset()
+		err = fsContainer.DecryptStream(buf)
+		assert.NoError(t, err, "cannot decrypt the data")
+		assert.Equal(t, plainText, buf.String())
+		fsContainer.Close()
+	}
+}
+
+func TestFileWrapperEncryptWithoutSlots(t *testing.T) {
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR128)
+	assert.NoError(t, err, "cannot create container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.EncryptStream(bytes.NewBufferString("Some secrets is here!"))
+	assert.ErrorIs(t, err, container_pkg.ErrNoSlots)
+	// Nothing must have been written
+	info, err := file.Stat()
+	assert.NoError(t, err, "cannot stat the file")
+	assert.Zero(t, info.Size())
+}
+
+// The size of the key derived for each content algorithm is part of the format, decrypt by hand to pin it
+func TestFileWrapperContentKeySize(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	for alg, keySize := range map[types.EncryptionAlgorithm]int{
+		types.EncAlgAESCTR128: 16,
+		types.EncAlgAESCTR192: 24,
+		types.EncAlgAESCTR256: 32,
+	} {
+		file, err := os.CreateTemp("", "filecrypt-ci-")
+		assert.NoError(t, err, "cannot create temp file")
+		defer os.Remove(file.Name())
+		rootKey, err := ic.GenerateRandomBytes(32)
+		assert.NoError(t, err, "cannot generate root key")
+		slotKey, err := ic.GenerateRandomBytes(16)
+		assert.NoError(t, err, "cannot generate slot key")
+		encryptedContainer, err := container_pkg.NewContainerFileWithRootKey(file, alg, rootKey)
+		assert.NoError(t, err, "cannot create container")
+		err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot add slot")
+		err = encryptedContainer.WriteHeader()
+		assert.NoError(t, err, "cannot write out the headers")
+		err = encryptedContainer.EncryptStream(bytes.NewBufferString(plainText))
+		assert.NoError(t, err, "cannot encrypt the test string")
+		encryptedContainer.Close()
+
+		data, err := os.ReadFile(file.Name())
+		assert.NoError(t, err, "cannot read the container")
+		content := data[4096:]
+		keys, err := ic.DeriveKeysFromMasterKeyEx(rootKey, content[:32], []int{keySize, 32})
+		assert.NoError(t, err, "cannot derive the content keys")
+		plain, err := ic.AESCTRDecryptDirectAuthenticatedEx(keys[0], content[48:], content[32:48], keys[1])
+		assert.NoError(t, err, "the content key of %d must be %d bytes", alg, keySize)
+		assert.Equal(t, plainText, string(plain))
+	}
+}
+
+func TestFileWrapperHeaderFingerprint(t *testing.T) {
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR128, []byte("Some secrets is here!"))
+	encryptedContainer, err := container_pkg.OpenContainerFileForUpdate(name)
+	assert.NoError(t, err, "cannot open the container")
+	fingerprint := encryptedContainer.HeaderFingerprint()
+	assert.Len(t, fingerprint, 32)
+	assert.Equal(t, fingerprint, encryptedContainer.HeaderFingerprint())
+
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the container")
+	otherKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, otherKey)
+	assert.NoError(t, err, "cannot add slot")
+	changed := encryptedContainer.HeaderFingerprint()
+	assert.NotEqual(t, fingerprint, changed)
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	encryptedContainer.Close()
+
+	// Stable across reopen
+	encryptedContainer, err = container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	assert.Equal(t, changed, encryptedContainer.HeaderFingerprint())
+}
+
+func TestValidateKey(t *testing.T) {
+	for alg := types.SlotKeyAlgorithm(0); alg < types.SlotKeyAlgEnd; alg++ {
+		if alg.KeySize() == 0 {
+			// No fixed size, a raw key is never accepted
+			assert.ErrorIs(t, container_pkg.ValidateKey(alg, make([]byte, 16)), ic.ErrKeySizeInvalid)
+			continue
+		}
+		assert.NoError(t, container_pkg.ValidateKey(alg, make([]byte, alg.KeySize())), "algorithm %d", alg)
+		assert.ErrorIs(t, container_pkg.ValidateKey(alg, make([]byte, alg.KeySize()-1)), ic.ErrKeySizeInvalid)
+		assert.ErrorIs(t, container_pkg.ValidateKey(alg, make([]byte, alg.KeySize()+1)), ic.ErrKeySizeInvalid)
+		assert.ErrorIs(t, container_pkg.ValidateKey(alg, nil), types.ErrParameterMissing)
+	}
+	assert.ErrorIs(t, container_pkg.ValidateKey(types.SlotKeyAlgEnd, make([]byte, 16)), types.ErrUnsupportedSlotAlgo)
+}
+
+func TestFileWrapperSealBetweenOperations(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR128, []byte(plainText))
+	encryptedContainer, err := container_pkg.OpenContainerFileForUpdate(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the container")
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, plainText, buf.String())
+	stream, err := encryptedContainer.AsDecryptionStream()
+	assert.NoError(t, err, "cannot create the decryption stream")
+
+	err = encryptedContainer.Seal()
+	assert.NoError(t, err, "cannot seal the container")
+	err = encryptedContainer.DecryptStream(io.Discard)
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeySealed)
+	_, err = encryptedContainer.AsDecryptionStream()
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeySealed)
+	err = encryptedContainer.EncryptStream(bytes.NewBufferString(plainText))
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeySealed)
+	err = encryptedContainer.DecryptRange(io.Discard, 0, 1)
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeySealed)
+
+	// The stream created before sealing keeps working
+	data, err := io.ReadAll(stream)
+	assert.NoError(t, err, "cannot read the decryption stream")
+	assert.Equal(t, plainText, string(data))
+
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the container again")
+	buf.Reset()
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, plainText, buf.String())
+}
+
+func TestFileWrapperUpdateFlags(t *testing.T) {
+	plainText := []byte("Some secrets is here!")
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR256, plainText)
+	before, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+
+	encryptedContainer, err := container_pkg.OpenContainerFileForUpdate(name)
+	assert.NoError(t, err, "cannot open the container")
+	err = encryptedContainer.UpdateFlags(types.HeaderFlagArchive, 0)
+	assert.ErrorIs(t, err, container_pkg.ErrFlagNotUpdatable)
+	err = encryptedContainer.UpdateFlags(0, types.HeaderFlagChunkedContent)
+	assert.ErrorIs(t, err, container_pkg.ErrFlagNotUpdatable)
+	// Neither can the undefined flags be set
+	err = encryptedContainer.UpdateFlags(1<<6, 0)
+	assert.ErrorIs(t, err, container_pkg.ErrFlagNotUpdatable)
+	// The container does not need to be unsealed
+	err = encryptedContainer.UpdateFlags(types.HeaderFlagReadOnly, 0)
+	assert.NoError(t, err, "cannot update the flags")
+	encryptedContainer.Close()
+
+	after, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	// The flags follow the magic number and the version, nothing else changed
+	assert.Equal(t, types.HeaderFlagReadOnly, binary.BigEndian.Uint16(after[6:8]))
+	assert.Equal(t, before[8:], after[8:])
+
+	encryptedContainer, err = container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot reopen the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the container")
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, plainText, buf.Bytes())
+}
+
+func TestFileWrapperRemainingSlotCapacity(t *testing.T) {
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	defer encryptedContainer.Close()
+	slots, bytesLeft := encryptedContainer.RemainingSlotCapacity()
+	// Magic number, version, flags, algorithm and number of slots
+	assert.Equal(t, 4096-11, bytesLeft)
+	// Algorithm, flags, size, nonce, wrapped root key and tag
+	const slotSize = 6 + 12 + 32 + 16
+	assert.Equal(t, bytesLeft/slotSize, slots)
+
+	for slots > 0 {
+		slotKey, err := ic.GenerateRandomBytes(16)
+		assert.NoError(t, err, "cannot generate slot key")
+		err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot add slot")
+		remaining, left := encryptedContainer.RemainingSlotCapacity()
+		assert.Equal(t, bytesLeft-slotSize, left)
+		assert.Equal(t, slots-1, remaining)
+		slots, bytesLeft = remaining, left
+	}
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "the reported slots must fit")
+
+	// The next slot does not fit anymore
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	if err == nil {
+		err = encryptedContainer.WriteHeader()
+	}
+	assert.ErrorIs(t, err, types.ErrProducedHeaderTooBig)
+}
+
+func TestFileWrapperHeaderReserved(t *testing.T) {
+	plainText := []byte("Some secrets is here!")
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR256, plainText)
+	encryptedContainer, err := container_pkg.OpenContainerFileForUpdate(name)
+	assert.NoError(t, err, "cannot open the container")
+	assert.Nil(t, encryptedContainer.GetHeaderReserved())
+	err = encryptedContainer.SetHeaderReserved(make([]byte, 4096))
+	assert.ErrorIs(t, err, types.ErrProducedHeaderTooBig)
+	err = encryptedContainer.SetHeaderReserved([]byte("application data"))
+	assert.NoError(t, err, "cannot set the reserved data")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	encryptedContainer.Close()
+
+	// Rewriting the header for another reason keeps the data
+	encryptedContainer, err = container_pkg.OpenContainerFileForUpdate(name)
+	assert.NoError(t, err, "cannot reopen the container")
+	assert.Equal(t, []byte("application data"), encryptedContainer.GetHeaderReserved())
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the container")
+	otherKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, otherKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	encryptedContainer.Close()
+
+	encryptedContainer, err = container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot reopen the container")
+	defer encryptedContainer.Close()
+	assert.Equal(t, []byte("application data"), encryptedContainer.GetHeaderReserved())
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, otherKey)
+	assert.NoError(t, err, "cannot unseal the container")
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, plainText, buf.Bytes())
+}
+
+// Cost of matching a key against the slots, every slot before the match costs one AEAD open
+func BenchmarkUnsealSlots(rootB *testing.B) {
+	for _, count := range []int{1, 10, 50, 200} {
+		file, err := os.CreateTemp("", "filecrypt-ci-")
+		assert.NoError(rootB, err, "cannot create temp file")
+		defer os.Remove(file.Name())
+		encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR128)
+		assert.NoError(rootB, err, "cannot create container")
+		defer encryptedContainer.Close()
+		var lastKey []byte
+		for range count {
+			lastKey, err = ic.GenerateRandomBytes(16)
+			assert.NoError(rootB, err, "cannot generate slot key")
+			err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, lastKey)
+			assert.NoError(rootB, err, "cannot add slot")
+		}
+		wrongKey, err := ic.GenerateRandomBytes(16)
+		assert.NoError(rootB, err, "cannot generate slot key")
+		for _, uniform := range []bool{false, true} {
+			encryptedContainer.SetUniformUnsealErrors(uniform)
+			rootB.Run(fmt.Sprintf("%d-slots-uniform-%t-last-slot", count, uniform), func(b *testing.B) {
+				for b.Loop() {
+					encryptedContainer.CanUnseal(types.SlotKeyAlgAESGCM128, lastKey)
+				}
+			})
+			rootB.Run(fmt.Sprintf("%d-slots-uniform-%t-wrong-key", count, uniform), func(b *testing.B) {
+				for b.Loop() {
+					encryptedContainer.CanUnseal(types.SlotKeyAlgAESGCM128, wrongKey)
+				}
+			})
+		}
+	}
+}
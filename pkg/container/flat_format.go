@@ -0,0 +1,45 @@
+package container
+
+import (
+	"errors"
+	"io"
+
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/flat_format.go
+// This file contains APIs for converting the container into the flat authenticated blob format
+// produced by AESCTREncryptDirectAuthenticated (salt || iv || ciphertext || tag).
+
+// The flat format always derives a 32 bytes encryption key from the master key
+const flatFormatKeySize = 32
+
+// The flat format always uses a 32 bytes salt
+const flatFormatSaltSize = 32
+
+var (
+	ErrFlatFormatIncompatible = errors.New("the content algorithm is not compatible with the flat authenticated format")
+)
+
+// Create a reader which emits the content in the flat authenticated blob format.
+// The stored salt, iv, ciphertext and tag are reused as-is so nothing is re-encrypted,
+// the result can be decrypted with AESCTRDecryptDirectAuthenticated using the root key.
+//
+// Note that only content algorithms that derive a 32 bytes key with the default salt size, no application ID, keys not bound to the header
+// and a tag not re-authenticated are compatible
+func (f *ContainerFile) AsFlatAuthenticatedReader() (io.Reader, error) {
+	if len(f.rootKey) == 0 {
+		return nil, ErrRootKeySealed
+	}
+	if f.header.Algorithm >= types.EncAlgEnd || f.header.Algorithm.KeySize() != flatFormatKeySize || f.contentSaltSize() != flatFormatSaltSize || f.isChunked() || f.isHeaderBound() || f.header.Flags&types.HeaderFlagReauthenticated != 0 || len(f.applicationID) != 0 {
+		return nil, ErrFlatFormatIncompatible
+	}
+	if f.file == nil {
+		return nil, ErrContainerReadOnly
+	}
+	contentEnd, err := f.contentEnd()
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(f.file, f.contentOffset(), contentEnd-f.contentOffset()), nil
+}
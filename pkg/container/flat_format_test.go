@@ -0,0 +1,72 @@
+package container
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Convert the container into the flat format and decrypt it using the direct API
+func TestFlatFormatConversion(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	encryptedContainer, err := NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewBufferString(plainText))
+	assert.NoError(t, err, "cannot encrypt the test string")
+
+	reader, err := encryptedContainer.AsFlatAuthenticatedReader()
+	assert.NoError(t, err, "cannot create the flat format reader")
+	blob, err := io.ReadAll(reader)
+	assert.NoError(t, err, "cannot read the flat format")
+	decrypted, err := ic.AESCTRDecryptDirectAuthenticated(encryptedContainer.rootKey, blob)
+	assert.NoError(t, err, "cannot decrypt the flat format")
+	assert.Equal(t, plainText, string(decrypted))
+}
+
+// The conversion must be refused when the content key size does not match
+func TestFlatFormatConversionIncompatible(t *testing.T) {
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := NewContainerFileWithHandle(file, types.EncAlgAESCTR128)
+	assert.NoError(t, err, "cannot create container")
+	defer encryptedContainer.Close()
+	_, err = encryptedContainer.AsFlatAuthenticatedReader()
+	assert.ErrorIs(t, err, ErrFlatFormatIncompatible)
+}
+
+// The tag of a re-authenticated content is not keyed as the flat format expects
+func TestFlatFormatConversionReauthenticated(t *testing.T) {
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, make([]byte, 16))
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewBufferString("Some secrets is here!"))
+	assert.NoError(t, err, "cannot encrypt the test string")
+	err = encryptedContainer.ReauthContent()
+	assert.NoError(t, err, "cannot re-authenticate the content")
+
+	_, err = encryptedContainer.AsFlatAuthenticatedReader()
+	assert.ErrorIs(t, err, ErrFlatFormatIncompatible)
+}
@@ -0,0 +1,78 @@
+package container
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	container_internal "github.com/ngeojiajun/go-filecrypt/internal/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/follow.go
+// This file contains the follow mode, reading a container while another process is still writing it, like tail -f.
+//
+// Reaching the end of the file only means the writer did not catch up yet, the reads wait for more data
+// until the writer signals completion. The tag is at the very end, so the content is only authenticated
+// once the writer completed.
+
+// Delay between two attempts to read more data from the growing file
+const followPollInterval = 20 * time.Millisecond
+
+// Growing file whose end is only reported once the writer completed
+type followFile struct {
+	*os.File
+	complete func() bool
+	done     bool
+}
+
+func (f *followFile) Read(p []byte) (int, error) {
+	for {
+		n, err := f.File.Read(p)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+		if f.done {
+			return 0, io.EOF
+		}
+		// Read once more after the completion, the last bytes may have been written just before it
+		if f.complete() {
+			f.done = true
+			continue
+		}
+		time.Sleep(followPollInterval)
+	}
+}
+
+// Open a container which is still being written, complete must report whether the writer finished,
+// e.g. by checking a marker file or a flag shared with the writer.
+// The header is waited for as well. As with OpenContainerFileFS the content is read sequentially
+// and can only be decrypted once, with DecryptStream or AsDecryptionStream
+func OpenContainerFileFollow(name string, complete func() bool) (*ContainerFile, error) {
+	handle, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	var stream fs.File = &followFile{File: handle, complete: complete}
+	file := &ContainerFile{
+		stream:  stream,
+		header:  nil,
+		rootKey: []byte{},
+	}
+	file.header, err = container_internal.ParseContainerFileHeader(stream)
+	if err != nil {
+		handle.Close()
+		return nil, err
+	}
+	if file.isMultiVolume() {
+		handle.Close()
+		return nil, ErrMultiVolume
+	}
+	// The trailer cannot be told apart from the content before the writer completed
+	if file.hasChecksumTrailer() {
+		handle.Close()
+		return nil, types.ErrUnsupportedFeature
+	}
+	return file, nil
+}
@@ -0,0 +1,68 @@
+package container_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenContainerFileFollow(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(100000)
+	assert.NoError(t, err, "cannot generate the payload")
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+
+	var complete atomic.Bool
+	written := make(chan error, 1)
+	go func() {
+		defer complete.Store(true)
+		encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+		if err != nil {
+			written <- err
+			return
+		}
+		defer encryptedContainer.Close()
+		// Let the reader wait for the header too
+		time.Sleep(50 * time.Millisecond)
+		if err := encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey); err != nil {
+			written <- err
+			return
+		}
+		if err := encryptedContainer.WriteHeader(); err != nil {
+			written <- err
+			return
+		}
+		pipeReader, pipeWriter := io.Pipe()
+		go func() {
+			for piece := range slices.Chunk(plainText, 20000) {
+				pipeWriter.Write(piece)
+				time.Sleep(30 * time.Millisecond)
+			}
+			pipeWriter.Close()
+		}()
+		written <- encryptedContainer.EncryptStream(pipeReader)
+	}()
+
+	follower, err := container_pkg.OpenContainerFileFollow(file.Name(), complete.Load)
+	assert.NoError(t, err, "cannot open the growing container")
+	defer follower.Close()
+	err = follower.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the growing container")
+	buf := bytes.NewBuffer(nil)
+	err = follower.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the growing container")
+	assert.NoError(t, <-written, "cannot write the container")
+	assert.Equal(t, plainText, buf.Bytes())
+}
@@ -0,0 +1,74 @@
+package container
+
+import (
+	"errors"
+)
+
+// File: pkg/container/frames.go
+// This file adapts the decrypted byte stream to message oriented consumers, e.g. a framed network protocol.
+
+var (
+	ErrInvalidFrameSize = errors.New("the frame size must be positive")
+)
+
+// Frame of decrypted data emitted by DecryptFrames.
+// Every frame but the last one holds up to the frame size of plaintext, the last one holds no data and has Final set.
+// Err of the final frame is nil only when the whole content passed the authentication
+type Frame struct {
+	Data  []byte
+	Final bool
+	Err   error
+}
+
+// Writer cutting the plaintext into frames
+type frameWriter struct {
+	frames    chan<- Frame
+	frameSize int
+	pending   []byte
+}
+
+func (w *frameWriter) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		n := min(len(p), w.frameSize-len(w.pending))
+		w.pending = append(w.pending, p[:n]...)
+		p = p[n:]
+		if len(w.pending) == w.frameSize {
+			w.flush()
+		}
+	}
+	return written, nil
+}
+
+// Emit the pending plaintext as a frame
+func (w *frameWriter) flush() {
+	if len(w.pending) == 0 {
+		return
+	}
+	w.frames <- Frame{Data: w.pending}
+	w.pending = make([]byte, 0, w.frameSize)
+}
+
+// Decrypt the content in the background and emit it in frames of up to frameSize bytes.
+// The channel is closed after the final frame, which carries the result of the decryption.
+//
+// Warning: the frames are emitted before the content is authenticated, like DecryptStream.
+// The consumer must not trust the data of any frame until the final frame reports no error.
+// The channel must be drained, otherwise the background decryption never completes
+func (f *ContainerFile) DecryptFrames(frameSize int) (<-chan Frame, error) {
+	if frameSize <= 0 {
+		return nil, ErrInvalidFrameSize
+	}
+	if len(f.rootKey) == 0 {
+		return nil, ErrRootKeySealed
+	}
+	frames := make(chan Frame)
+	go func() {
+		defer close(frames)
+		writer := &frameWriter{frames: frames, frameSize: frameSize, pending: make([]byte, 0, frameSize)}
+		err := f.DecryptStream(writer)
+		writer.flush()
+		frames <- Frame{Final: true, Err: err}
+	}()
+	return frames, nil
+}
@@ -0,0 +1,66 @@
+package container_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Collect the frames and the final result
+func collectFrames(t *testing.T, encryptedContainer *container_pkg.ContainerFile, frameSize int) ([]byte, error) {
+	frames, err := encryptedContainer.DecryptFrames(frameSize)
+	assert.NoError(t, err, "cannot start decrypting the frames")
+	buf := bytes.NewBuffer(nil)
+	var result error
+	final := false
+	for frame := range frames {
+		assert.False(t, final, "no frame may follow the final frame")
+		if frame.Final {
+			final, result = true, frame.Err
+			continue
+		}
+		assert.LessOrEqual(t, len(frame.Data), frameSize)
+		assert.NotEmpty(t, frame.Data)
+		buf.Write(frame.Data)
+	}
+	assert.True(t, final, "the final frame is missing")
+	return buf.Bytes(), result
+}
+
+func TestDecryptFrames(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(100000)
+	assert.NoError(t, err, "cannot generate the payload")
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR128, plainText)
+
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	_, err = encryptedContainer.DecryptFrames(1000)
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeySealed)
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	_, err = encryptedContainer.DecryptFrames(0)
+	assert.ErrorIs(t, err, container_pkg.ErrInvalidFrameSize)
+	data, err := collectFrames(t, encryptedContainer, 1000)
+	assert.NoError(t, err, "the content must be authenticated")
+	assert.Equal(t, plainText, data)
+	encryptedContainer.Close()
+
+	// Tamper the ciphertext, only the final frame tells
+	content, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	content[len(content)-100] ^= 0x01
+	err = os.WriteFile(name, content, 0600)
+	assert.NoError(t, err, "cannot tamper the container")
+	encryptedContainer, err = container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	_, err = collectFrames(t, encryptedContainer, 4096)
+	assert.ErrorIs(t, err, ic.ErrAuthenticationFailed)
+}
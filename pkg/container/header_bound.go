@@ -0,0 +1,61 @@
+package container
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/header_bound.go
+// This file contains the header-bound mode, where the fingerprint of the header is mixed into every key derived from the root key.
+//
+// Two files sharing a root key then still get distinct content keys, and a header moved onto the content of
+// another file fails the authentication instead of decrypting it. The price is that the header is frozen
+// once the content is written: adding or removing a slot requires the content to be encrypted again.
+
+var (
+	ErrHeaderBound = errors.New("the keys are bound to the header, it cannot change once the content is written")
+)
+
+// Bind the keys derived from the root key to the header, it must be called before WriteHeader and EncryptStream
+func (f *ContainerFile) EnableHeaderBoundKeys() {
+	f.header.Flags |= types.HeaderFlagHeaderBound
+}
+
+// Whether the keys derived from the root key are bound to the header
+func (f *ContainerFile) isHeaderBound() bool {
+	return f.header.Flags&types.HeaderFlagHeaderBound != 0
+}
+
+// Context of the keys derived from the root key: the application ID followed by the fingerprint of the header if bound
+func (f *ContainerFile) keyContext() ([]byte, error) {
+	if !f.isHeaderBound() {
+		return f.applicationID, nil
+	}
+	fingerprint := f.HeaderFingerprint()
+	if fingerprint == nil {
+		return nil, ErrNoSlots
+	}
+	return append(bytes.Clone(f.applicationID), fingerprint...), nil
+}
+
+// Refuse to replace the header on disk by a different one once the content follows it
+func (f *ContainerFile) checkHeaderBound(previousSize int64) error {
+	if !f.isHeaderBound() || previousSize == 0 {
+		return nil
+	}
+	size, err := f.FileSize()
+	if err != nil || size <= previousSize {
+		return err
+	}
+	previous := make([]byte, previousSize)
+	if _, err := f.file.ReadAt(previous, 0); err != nil {
+		return err
+	}
+	if fingerprint := sha256.Sum256(previous); !bytes.Equal(fingerprint[:], f.HeaderFingerprint()) {
+		return ErrHeaderBound
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package container_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Create a container on a temp file with the given root key, returning its path and slot key
+func createRootKeyContainer(t *testing.T, rootKey, plainText []byte, bound bool) (string, []byte) {
+	t.Helper()
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	t.Cleanup(func() { os.Remove(file.Name()) })
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	encryptedContainer, err := container_pkg.NewContainerFileWithRootKey(file, types.EncAlgAESCTR256, rootKey)
+	assert.NoError(t, err, "cannot create container")
+	defer encryptedContainer.Close()
+	if bound {
+		encryptedContainer.EnableHeaderBoundKeys()
+	}
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewReader(plainText))
+	assert.NoError(t, err, "cannot encrypt the payload")
+	return file.Name(), slotKey
+}
+
+// Move the header of the first file onto the content of the second one, then decrypt with the key of the moved header
+func decryptSwapped(t *testing.T, from, to string, slotKey []byte) ([]byte, error) {
+	t.Helper()
+	source, err := os.ReadFile(from)
+	assert.NoError(t, err, "cannot read the container")
+	target, err := os.ReadFile(to)
+	assert.NoError(t, err, "cannot read the container")
+	copy(target, source[:4096])
+	assert.NoError(t, os.WriteFile(to, target, 0600), "cannot write the container")
+	encryptedContainer, err := container_pkg.OpenContainerFile(to)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the container")
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	return buf.Bytes(), err
+}
+
+func TestHeaderBoundKeys(t *testing.T) {
+	rootKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "cannot generate the root key")
+
+	// Without the binding, the headers of files sharing a root key are interchangeable
+	first, firstKey := createRootKeyContainer(t, rootKey, []byte("first secret"), false)
+	second, _ := createRootKeyContainer(t, rootKey, []byte("second secret"), false)
+	plainText, err := decryptSwapped(t, first, second, firstKey)
+	assert.NoError(t, err, "cannot decrypt the swapped container")
+	assert.Equal(t, []byte("second secret"), plainText)
+
+	first, firstKey = createRootKeyContainer(t, rootKey, []byte("first secret"), true)
+	second, _ = createRootKeyContainer(t, rootKey, []byte("second secret"), true)
+	_, err = decryptSwapped(t, first, second, firstKey)
+	assert.ErrorIs(t, err, ic.ErrAuthenticationFailed)
+
+	// The header is frozen once the content is written
+	encryptedContainer, err := container_pkg.OpenContainerFileForUpdate(first)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, firstKey)
+	assert.NoError(t, err, "cannot unseal the container")
+	assert.NoError(t, encryptedContainer.WriteHeader(), "rewriting the same header must be allowed")
+	otherKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, otherKey)
+	assert.NoError(t, err, "cannot add slot")
+	assert.ErrorIs(t, encryptedContainer.WriteHeader(), container_pkg.ErrHeaderBound)
+}
@@ -0,0 +1,131 @@
+package container
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_internal "github.com/ngeojiajun/go-filecrypt/internal/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/header_mac.go
+// This file contains the authenticated header, where a HMAC keyed by the root key covers the whole header.
+//
+// Without it the flags, the algorithm and the slot table can be changed by anyone, e.g. to drop a slot or
+// to downgrade an option, and only the content authentication may notice. With it the MAC is checked as soon as
+// the root key is unsealed, so a modified header is refused before anything is decrypted.
+// The MAC covers the fingerprint of the header, see HeaderFingerprint, and is computed again on every write,
+// which means the header can only be written while the root key is unsealed.
+// The key of the MAC does not depend on the application ID, so it can be verified before it is set.
+// The MAC is checked against the header held in memory, so the header must only be changed after unsealing.
+//
+// The flag is optional, so it alone could be stripped to skip the check. Every slot written under an authenticated
+// header is marked, and a marked slot is only accepted with a valid MAC. RequireAuthenticatedHeader also covers
+// the headers whose marks were stripped along the flag.
+
+// Label used to derive the key of the header MAC from the root key
+var headerMACLabel = []byte("filecrypt-header-mac")
+
+var (
+	ErrHeaderAuthenticationFailed = errors.New("the header was modified without the root key")
+)
+
+// Authenticate the header with the root key, it takes effect on the next WriteHeader and cannot be turned off.
+// The flag is optional, so the versions not knowing it still read the file without checking the MAC
+func (f *ContainerFile) EnableAuthenticatedHeader() {
+	f.header.Flags |= types.HeaderFlagAuthenticated
+}
+
+// Refuse to unseal a header which is not authenticated, so the flag cannot be stripped to skip the check.
+// It must be called before unsealing
+func (f *ContainerFile) RequireAuthenticatedHeader() {
+	f.requireHeaderMAC = true
+}
+
+// Whether the header is authenticated by the root key
+func (f *ContainerFile) isHeaderAuthenticated() bool {
+	return f.header.Flags&types.HeaderFlagAuthenticated != 0
+}
+
+// MAC of the current header under the root key
+func (f *ContainerFile) headerMAC(rootKey []byte) ([]byte, error) {
+	fingerprint := f.HeaderFingerprint()
+	if fingerprint == nil {
+		return nil, ErrNoSlots
+	}
+	keys, err := ic.DeriveKeysFromMasterKeyEx(rootKey, headerMACLabel, []int{sha256.Size})
+	if err != nil {
+		return nil, err
+	}
+	defer ic.WipeBufferSecure(keys[0])
+	h := hmac.New(sha256.New, keys[0])
+	h.Write(fingerprint)
+	return h.Sum(nil), nil
+}
+
+// Compute the MAC of the header before it is written, the root key must be unsealed.
+// The slots are marked first, so the marks are covered by the MAC
+func (f *ContainerFile) authenticateHeader() error {
+	if !f.isHeaderAuthenticated() {
+		return nil
+	}
+	if len(f.rootKey) == 0 {
+		return ErrRootKeySealed
+	}
+	for _, slot := range f.header.Slots {
+		slot.Flags |= container_internal.FlagSlotHeaderAuthenticated
+	}
+	mac, err := f.headerMAC(f.rootKey)
+	if err != nil {
+		return err
+	}
+	f.header.MAC = mac
+	return nil
+}
+
+// Whether the header must carry a valid MAC, because it is required or a slot was written under an authenticated header
+func (f *ContainerFile) headerMACRequired() bool {
+	if f.requireHeaderMAC {
+		return true
+	}
+	for _, slot := range f.header.Slots {
+		if slot.Flags&container_internal.FlagSlotHeaderAuthenticated != 0 && slot.Flags&container_internal.FlagSlotDestroyed == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify the header against the root key unsealed from a slot
+func (f *ContainerFile) verifyHeaderMAC(rootKey []byte) error {
+	if !f.isHeaderAuthenticated() {
+		if f.headerMACRequired() {
+			return ErrHeaderAuthenticationFailed
+		}
+		return nil
+	}
+	mac, err := f.headerMAC(rootKey)
+	if err != nil {
+		return err
+	}
+	if len(f.header.MAC) != container_internal.HeaderMACSize || !hmac.Equal(mac, f.header.MAC) {
+		return ErrHeaderAuthenticationFailed
+	}
+	return nil
+}
+
+// Keep the root key unsealed from a slot once the header is verified against it.
+// The root key is wiped when the header does not match
+func (f *ContainerFile) acceptRootKey(rootKey []byte) error {
+	if err := f.verifyHeaderMAC(rootKey); err != nil {
+		ic.WipeBufferSecure(rootKey)
+		if f.uniformUnseal {
+			return f.unsealFailed()
+		}
+		return err
+	}
+	f.rootKey = rootKey
+	return nil
+}
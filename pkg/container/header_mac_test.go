@@ -0,0 +1,160 @@
+package container_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Create a container with an authenticated header holding the reserved data
+func createAuthenticatedTestContainer(t *testing.T, plainText []byte, options func(*container_pkg.ContainerFile)) (string, []byte) {
+	t.Helper()
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	t.Cleanup(func() { os.Remove(file.Name()) })
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	encryptedContainer.EnableAuthenticatedHeader()
+	if options != nil {
+		options(encryptedContainer)
+	}
+	assert.NoError(t, encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey), "cannot add slot")
+	assert.NoError(t, encryptedContainer.SetHeaderReserved([]byte("reserved-data")), "cannot set the reserved data")
+	assert.NoError(t, encryptedContainer.WriteHeader(), "cannot write out the headers")
+	assert.NoError(t, encryptedContainer.EncryptStream(bytes.NewReader(plainText)), "cannot encrypt the data")
+	assert.NoError(t, encryptedContainer.Close(), "cannot close the container")
+	return file.Name(), slotKey
+}
+
+// Checksum of a copy of the double-buffered header
+func crc32c(data []byte) uint32 {
+	return crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli))
+}
+
+// Unseal a fresh handle of the container
+func unsealFreshHandle(t *testing.T, name string, slotKey []byte, options func(*container_pkg.ContainerFile)) error {
+	t.Helper()
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	if options != nil {
+		options(encryptedContainer)
+	}
+	return encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+}
+
+func TestAuthenticatedHeader(t *testing.T) {
+	plainText := []byte("authenticated header")
+	layouts := map[string]func(*container_pkg.ContainerFile){
+		"padded":          nil,
+		"compact":         (*container_pkg.ContainerFile).EnableCompactHeader,
+		"double-buffered": (*container_pkg.ContainerFile).EnableDoubleBufferedHeader,
+		"header-bound":    (*container_pkg.ContainerFile).EnableHeaderBoundKeys,
+	}
+	for layout, options := range layouts {
+		name, slotKey := createAuthenticatedTestContainer(t, plainText, options)
+		decrypted, err := decryptWithFreshHandle(t, name, slotKey)
+		assert.NoError(t, err, "cannot decrypt the %s container", layout)
+		assert.Equal(t, plainText, decrypted)
+
+		// Any change of the reserved data is caught once the root key is known
+		data, err := os.ReadFile(name)
+		assert.NoError(t, err, "cannot read the container")
+		offset := bytes.Index(data, []byte("reserved-data"))
+		assert.Greater(t, offset, 0)
+		data[offset] ^= 1
+		if layout == "double-buffered" {
+			// Tamper both copies, the checksum of the copies is not keyed
+			second := bytes.Index(data[offset+1:], []byte("reserved-data")) + offset + 1
+			data[second] ^= 1
+			for _, copyOffset := range []int{0, 4096} {
+				binary.BigEndian.PutUint32(data[copyOffset+4092:], crc32c(data[copyOffset:copyOffset+4092]))
+			}
+		}
+		assert.NoError(t, os.WriteFile(name, data, 0600), "cannot tamper the container")
+		err = unsealFreshHandle(t, name, slotKey, nil)
+		assert.ErrorIs(t, err, container_pkg.ErrHeaderAuthenticationFailed, "the tampered %s header is accepted", layout)
+		err = unsealFreshHandle(t, name, slotKey, func(f *container_pkg.ContainerFile) { f.SetUniformUnsealErrors(true) })
+		assert.ErrorIs(t, err, container_pkg.ErrRootKeyUnsealFailed, "the tampered %s header is reported apart", layout)
+	}
+}
+
+func TestAuthenticatedHeaderStripped(t *testing.T) {
+	name, slotKey := createAuthenticatedTestContainer(t, []byte("stripped"), nil)
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	// The flags follow the magic number and the version
+	flags := binary.BigEndian.Uint16(data[6:8])
+	binary.BigEndian.PutUint16(data[6:8], flags&^types.HeaderFlagAuthenticated)
+	assert.NoError(t, os.WriteFile(name, data, 0600), "cannot tamper the container")
+
+	// The slot written under the authenticated header still requires the MAC
+	err = unsealFreshHandle(t, name, slotKey, nil)
+	assert.ErrorIs(t, err, container_pkg.ErrHeaderAuthenticationFailed)
+	err = unsealFreshHandle(t, name, slotKey, func(f *container_pkg.ContainerFile) { f.SetUniformUnsealErrors(true) })
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeyUnsealFailed)
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	assert.False(t, encryptedContainer.CanUnseal(types.SlotKeyAlgAESGCM128, slotKey))
+	encryptedContainer.Close()
+
+	// Without the mark of the slot either, only a reader requiring the MAC notices.
+	// The flags of the slot follow the algorithm, the number of slots and the algorithm of the slot
+	slotFlags := binary.BigEndian.Uint16(data[13:15])
+	assert.NotZero(t, slotFlags&1)
+	binary.BigEndian.PutUint16(data[13:15], slotFlags&^1)
+	assert.NoError(t, os.WriteFile(name, data, 0600), "cannot tamper the container")
+	assert.NoError(t, unsealFreshHandle(t, name, slotKey, nil))
+	err = unsealFreshHandle(t, name, slotKey, (*container_pkg.ContainerFile).RequireAuthenticatedHeader)
+	assert.ErrorIs(t, err, container_pkg.ErrHeaderAuthenticationFailed)
+}
+
+// The authenticated header cannot be turned off on an existing file
+func TestAuthenticatedHeaderNotUpdatable(t *testing.T) {
+	name, slotKey := createAuthenticatedTestContainer(t, []byte("sticky"), nil)
+	encryptedContainer, err := container_pkg.OpenContainerFileForUpdate(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	assert.True(t, encryptedContainer.CanUnseal(types.SlotKeyAlgAESGCM128, slotKey))
+	err = encryptedContainer.UpdateFlags(0, types.HeaderFlagAuthenticated)
+	assert.ErrorIs(t, err, container_pkg.ErrFlagNotUpdatable)
+}
+
+func TestAuthenticatedHeaderUpdate(t *testing.T) {
+	plainText := []byte("updated header")
+	name, slotKey := createAuthenticatedTestContainer(t, plainText, nil)
+	// The MAC cannot be computed without the root key
+	sealedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	assert.NoError(t, sealedContainer.SetHeaderReserved([]byte("changed")))
+	assert.ErrorIs(t, sealedContainer.UpdateHeader(), container_pkg.ErrRootKeySealed)
+	sealedContainer.Close()
+
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	newKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "cannot generate key")
+	assert.NoError(t, encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey), "cannot unseal the root key")
+	assert.NoError(t, encryptedContainer.SetHeaderReserved([]byte("changed")))
+	assert.NoError(t, encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM256, newKey), "cannot add the slot")
+	assert.NoError(t, encryptedContainer.UpdateHeader(), "cannot update the header")
+
+	updated, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer updated.Close()
+	assert.NoError(t, updated.Unseal(types.SlotKeyAlgAESGCM256, newKey), "cannot unseal with the new slot")
+	assert.Equal(t, []byte("changed"), updated.GetHeaderReserved())
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, updated.DecryptStream(buf), "cannot decrypt the data")
+	assert.Equal(t, plainText, buf.Bytes())
+}
@@ -0,0 +1,20 @@
+package container
+
+import (
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/info.go
+// This file contains the description of the container taken from its header, available without unsealing it
+
+// Describe the container as recorded in its header, e.g. to inspect a file without holding any key
+func (f *ContainerFile) Info() *types.ContainerInfo {
+	return &types.ContainerInfo{
+		VersionMajor: f.header.VersionMajor,
+		VersionMinor: f.header.VersionMinor,
+		Algorithm:    f.header.Algorithm,
+		Flags:        f.header.Flags,
+		HeaderSize:   f.header.Size(),
+		Slots:        f.GetSlots(),
+	}
+}
@@ -0,0 +1,100 @@
+package container
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+)
+
+// File: pkg/container/iv_strategy.go
+// This file contains the strategies choosing the content salt and iv when the deterministic mode is not enabled,
+// e.g. for stateless services which must not depend on the random source for every encryption.
+//
+// The content keys are derived from the root key and the salt, so the salt must never repeat under the same root key.
+// With the counter based strategies this is the responsibility of the caller: the counter source must never return
+// the same value twice for a root key, including across restarts and between concurrent encryptions.
+// Only the content salt and iv are affected, the slots are still sealed with random nonces.
+
+// Label used to derive the key of the counter PRF from the root key
+var derivedIVLabel = []byte("filecrypt-derived-iv")
+
+// Source of counter values, it must never return the same value twice for a root key
+type CounterSource func() (uint64, error)
+
+// Strategy choosing the content salt and iv, see SetIVStrategy
+type IVStrategy interface {
+	saltAndIV(f *ContainerFile) (salt, iv []byte, err error)
+}
+
+type randomIVStrategy struct{}
+
+// Random salt and iv, the default
+var RandomIV IVStrategy = randomIVStrategy{}
+
+func (randomIVStrategy) saltAndIV(f *ContainerFile) (salt, iv []byte, err error) {
+	if salt, err = ic.GenerateRandomBytes(f.contentSaltSize()); err != nil {
+		return nil, nil, err
+	}
+	if iv, err = ic.GenerateAESIV(); err != nil {
+		return nil, nil, err
+	}
+	return salt, iv, nil
+}
+
+type counterIVStrategy struct {
+	next CounterSource
+}
+
+// Salt and iv holding the next counter value in clear, anyone can tell the counter value from the file
+func CounterIV(next CounterSource) IVStrategy {
+	return counterIVStrategy{next: next}
+}
+
+func (s counterIVStrategy) saltAndIV(f *ContainerFile) (salt, iv []byte, err error) {
+	counter, err := s.next()
+	if err != nil {
+		return nil, nil, err
+	}
+	// The counter fills the end of the salt and the first half of the iv, the CTR blocks count in the second half
+	salt = make([]byte, f.contentSaltSize())
+	binary.BigEndian.PutUint64(salt[len(salt)-8:], counter)
+	iv = make([]byte, contentIVSize)
+	binary.BigEndian.PutUint64(iv, counter)
+	return salt, iv, nil
+}
+
+type derivedIVStrategy struct {
+	next CounterSource
+}
+
+// Salt and iv derived from the next counter value by a PRF keyed by the root key, the counter value is not revealed
+func DerivedIV(next CounterSource) IVStrategy {
+	return derivedIVStrategy{next: next}
+}
+
+func (s derivedIVStrategy) saltAndIV(f *ContainerFile) (salt, iv []byte, err error) {
+	counter, err := s.next()
+	if err != nil {
+		return nil, nil, err
+	}
+	keys, err := f.deriveContentKeys(derivedIVLabel, []int{sha256.Size})
+	if err != nil {
+		return nil, nil, err
+	}
+	h := hmac.New(sha256.New, keys[0])
+	ic.WipeBufferSecure(keys[0])
+	h.Write(binary.BigEndian.AppendUint64(nil, counter))
+	values, err := ic.DeriveKeysFromMasterKeyEx(h.Sum(nil), nil, []int{f.contentSaltSize(), contentIVSize})
+	if err != nil {
+		return nil, nil, err
+	}
+	return values[0], values[1], nil
+}
+
+// Choose how the content salt and iv are generated, nil restores RandomIV.
+// It is ignored when EnableDeterministicIV is used, and not supported with the chunked content
+func (f *ContainerFile) SetIVStrategy(strategy IVStrategy) {
+	f.ivStrategy = strategy
+}
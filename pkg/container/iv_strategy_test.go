@@ -0,0 +1,95 @@
+package container_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Encrypt the plaintext with the strategy and return the content after the header
+func encryptWithStrategy(t *testing.T, rootKey, slotKey, plainText []byte, strategy container_pkg.IVStrategy) []byte {
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := container_pkg.NewContainerFileWithRootKey(file, types.EncAlgAESCTR256, rootKey)
+	assert.NoError(t, err, "cannot create container")
+	encryptedContainer.SetIVStrategy(strategy)
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewReader(plainText))
+	assert.NoError(t, err, "cannot encrypt the plaintext")
+	encryptedContainer.Close()
+
+	encryptedContainer, err = container_pkg.OpenContainerFile(file.Name())
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the container")
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, plainText, buf.Bytes())
+	return readContent(t, file.Name())
+}
+
+func TestIVStrategies(t *testing.T) {
+	plainText := []byte("Some secrets is here!")
+	rootKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "cannot generate root key")
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	var counter uint64
+	next := func() (uint64, error) {
+		counter++
+		return counter, nil
+	}
+	// Salt and iv in front of the ciphertext
+	prefix := func(content []byte) []byte {
+		return content[:32+16]
+	}
+
+	for name, strategy := range map[string]container_pkg.IVStrategy{
+		"random":  container_pkg.RandomIV,
+		"counter": container_pkg.CounterIV(next),
+		"derived": container_pkg.DerivedIV(next),
+	} {
+		seen := map[string]bool{}
+		for range 10 {
+			content := encryptWithStrategy(t, rootKey, slotKey, plainText, strategy)
+			assert.False(t, seen[string(prefix(content))], "%s strategy repeated a salt and iv", name)
+			seen[string(prefix(content))] = true
+		}
+	}
+
+	// The counter strategies are reproducible from the counter value
+	for _, strategy := range []func(container_pkg.CounterSource) container_pkg.IVStrategy{container_pkg.CounterIV, container_pkg.DerivedIV} {
+		fixed := func() (uint64, error) { return 42, nil }
+		first := encryptWithStrategy(t, rootKey, slotKey, plainText, strategy(fixed))
+		second := encryptWithStrategy(t, rootKey, slotKey, plainText, strategy(fixed))
+		assert.Equal(t, first, second)
+	}
+
+	// The failures of the counter source are reported
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	defer encryptedContainer.Close()
+	counterErr := errors.New("counter store unavailable")
+	encryptedContainer.SetIVStrategy(container_pkg.CounterIV(func() (uint64, error) { return 0, counterErr }))
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewReader(plainText))
+	assert.ErrorIs(t, err, counterErr)
+}
@@ -0,0 +1,66 @@
+package container
+
+import (
+	container_internal "github.com/ngeojiajun/go-filecrypt/internal/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/kms.go
+// This file contains APIs for slots backed by an external keyring/KMS
+
+// Keyring resolves the unwrapping key from the identifier stored in the slot.
+// The resolved key must be an AES-256 key
+type Keyring interface {
+	Resolve(id string) ([]byte, error)
+}
+
+// Add a slot where the root key is wrapped by the key resolved from the keyring.
+// Only the identifier is stored in the file
+func (f *ContainerFile) AddKMSSlot(keyring Keyring, keyID string) error {
+	if len(f.rootKey) == 0 {
+		return ErrRootKeySealed
+	}
+	if keyring == nil || len(keyID) == 0 {
+		return types.ErrParameterMissing
+	}
+	for _, slot := range f.header.Slots {
+		if id, err := slot.KMSKeyID(); err == nil && id == keyID {
+			return ErrSlotDuplicated
+		}
+	}
+	kmsKey, err := keyring.Resolve(keyID)
+	if err != nil {
+		return err
+	}
+	slot, err := container_internal.NewContainerKMSSlot(0, f.rootKey, keyID, kmsKey)
+	if err != nil {
+		return err
+	}
+	f.header.Slots = append(f.header.Slots, slot)
+	return nil
+}
+
+// Try to unseal the key by resolving the key of each KMS slot from the keyring.
+// Slots whose key cannot be resolved are skipped
+func (f *ContainerFile) UnsealWithKeyring(keyring Keyring) error {
+	if len(f.rootKey) != 0 {
+		return ErrRootKeyAlreadyUnsealed
+	}
+	if keyring == nil {
+		return types.ErrParameterMissing
+	}
+	for _, slot := range f.header.Slots {
+		keyID, err := slot.KMSKeyID()
+		if err != nil {
+			continue
+		}
+		kmsKey, err := keyring.Resolve(keyID)
+		if err != nil {
+			continue
+		}
+		if rootKey, err := slot.Unseal(kmsKey); err == nil {
+			return f.acceptRootKey(rootKey)
+		}
+	}
+	return f.unsealFailed()
+}
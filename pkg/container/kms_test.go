@@ -0,0 +1,64 @@
+package container_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Keyring backed by a map
+type mockKeyring map[string][]byte
+
+func (k mockKeyring) Resolve(id string) ([]byte, error) {
+	if key, ok := k[id]; ok {
+		return key, nil
+	}
+	return nil, errors.New("key not found")
+}
+
+func TestKMSSlot(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	const keyID = "kms://keys/backup"
+	kmsKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "cannot generate kms key")
+	keyring := mockKeyring{keyID: kmsKey}
+
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR128)
+	assert.NoError(t, err, "cannot create container")
+	err = encryptedContainer.AddKMSSlot(keyring, keyID)
+	assert.NoError(t, err, "cannot add kms slot")
+	err = encryptedContainer.AddKMSSlot(keyring, keyID)
+	assert.ErrorIs(t, err, container_pkg.ErrSlotDuplicated)
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewBufferString(plainText))
+	assert.NoError(t, err, "cannot encrypt the test string")
+	encryptedContainer.Close()
+
+	// The key itself must not be stored in the file
+	data, err := os.ReadFile(file.Name())
+	assert.NoError(t, err, "cannot read the container")
+	assert.False(t, bytes.Contains(data, kmsKey), "the kms key is leaked into the file")
+	assert.True(t, bytes.Contains(data, []byte(keyID)), "the key identifier should be stored")
+
+	encryptedContainer, err = container_pkg.OpenContainerFile(file.Name())
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.UnsealWithKeyring(mockKeyring{})
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeyUnsealFailed)
+	err = encryptedContainer.UnsealWithKeyring(keyring)
+	assert.NoError(t, err, "cannot unseal with the keyring")
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, plainText, buf.String())
+}
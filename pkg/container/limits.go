@@ -0,0 +1,76 @@
+package container
+
+import (
+	"io"
+
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/limits.go
+// This file contains the enforcement of the resource limits passed with the parse options, see types.ResourceLimits.
+//
+// The header limits are checked by the parser. The limits on the content are checked against the estimated size
+// before decrypting anything, and again while decrypting since the size of a streamed container is unknown upfront.
+
+// Bounds of the container, never nil
+func (f *ContainerFile) resourceLimits() *types.ResourceLimits {
+	if f.limits == nil {
+		return &types.ResourceLimits{}
+	}
+	return f.limits
+}
+
+// Refuse the content upfront when its size is known to exceed the limit
+func (f *ContainerFile) checkContentLimit(what string, limit int64) error {
+	if limit <= 0 {
+		return nil
+	}
+	size, err := f.EstimateContentSize()
+	if err != nil {
+		// Unknown until decrypted, the writer enforces the limit instead
+		return nil
+	}
+	return types.CheckResourceLimit(what, size, limit)
+}
+
+// Writer failing with types.ErrResourceLimitExceeded once more than the limit is written
+type limitedWriter struct {
+	writer  io.Writer
+	what    string
+	limit   int64
+	written int64
+}
+
+// Wrap the writer when the limit is set
+func newLimitedWriter(writer io.Writer, what string, limit int64) io.Writer {
+	if limit <= 0 {
+		return writer
+	}
+	return &limitedWriter{writer: writer, what: what, limit: limit}
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if err := types.CheckResourceLimit(w.what, w.written+int64(len(p)), w.limit); err != nil {
+		return 0, err
+	}
+	n, err := w.writer.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// Reader failing with types.ErrResourceLimitExceeded once more than the limit is read
+type limitedReadCloser struct {
+	io.ReadCloser
+	what  string
+	limit int64
+	read  int64
+}
+
+func (r *limitedReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.read += int64(n)
+	if limitErr := types.CheckResourceLimit(r.what, r.read, r.limit); limitErr != nil {
+		return 0, limitErr
+	}
+	return n, err
+}
@@ -0,0 +1,144 @@
+package container_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Open the container with the limits and unseal it
+func openWithLimits(t *testing.T, name string, slotKey []byte, limits *types.ResourceLimits) *container_pkg.ContainerFile {
+	t.Helper()
+	encryptedContainer, err := container_pkg.OpenContainerFileWithOptions(name, &types.ParseOptions{Limits: limits})
+	assert.NoError(t, err, "cannot open the container")
+	t.Cleanup(func() { encryptedContainer.Close() })
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	return encryptedContainer
+}
+
+func TestResourceLimitsHeader(t *testing.T) {
+	name, _ := createTestContainer(t, types.EncAlgAESCTR256, []byte("Some secrets is here!"))
+	_, err := container_pkg.OpenContainerFileWithOptions(name, &types.ParseOptions{Limits: &types.ResourceLimits{MaxSlotSize: 16}})
+	assert.ErrorIs(t, err, types.ErrResourceLimitExceeded)
+	assert.ErrorContains(t, err, "the slot content")
+
+	encryptedContainer, err := container_pkg.OpenContainerFileWithOptions(name, &types.ParseOptions{
+		Limits: &types.ResourceLimits{MaxSlots: 1, MaxSlotSize: 1024, MaxHeaderMetadata: 1},
+	})
+	assert.NoError(t, err, "the header is within the limits")
+	encryptedContainer.Close()
+}
+
+func TestResourceLimitsDecryptedSize(t *testing.T) {
+	plainText := strings.Repeat("0123456789", 1000)
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR256, []byte(plainText))
+
+	encryptedContainer := openWithLimits(t, name, slotKey, &types.ResourceLimits{MaxDecompressedSize: 1000})
+	buf := bytes.NewBuffer(nil)
+	err := encryptedContainer.DecryptStream(buf)
+	assert.ErrorIs(t, err, types.ErrResourceLimitExceeded)
+	assert.Zero(t, buf.Len(), "nothing is decrypted when the size is known upfront")
+	_, err = encryptedContainer.AsDecryptionStream()
+	assert.ErrorIs(t, err, types.ErrResourceLimitExceeded)
+
+	encryptedContainer = openWithLimits(t, name, slotKey, &types.ResourceLimits{MaxDecompressedSize: int64(len(plainText))})
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "the content is within the limit")
+	assert.Equal(t, plainText, buf.String())
+}
+
+func TestResourceLimitsBuffer(t *testing.T) {
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	value := strings.Repeat("0123456789", 100)
+	err = encryptedContainer.EncryptValue(value)
+	assert.NoError(t, err, "cannot encrypt the value")
+	encryptedContainer.Close()
+
+	encryptedContainer = openWithLimits(t, file.Name(), slotKey, &types.ResourceLimits{MaxBuffer: 100})
+	var decoded string
+	err = encryptedContainer.DecryptValue(&decoded)
+	assert.ErrorIs(t, err, types.ErrResourceLimitExceeded)
+	_, err = encryptedContainer.DecryptCached(container_pkg.NewContentCache(1<<20, 0))
+	assert.ErrorIs(t, err, types.ErrResourceLimitExceeded)
+
+	encryptedContainer = openWithLimits(t, file.Name(), slotKey, &types.ResourceLimits{MaxBuffer: 2000})
+	err = encryptedContainer.DecryptValue(&decoded)
+	assert.NoError(t, err, "the value is within the limit")
+	assert.Equal(t, value, decoded)
+}
+
+func TestResourceLimitsArchiveTOC(t *testing.T) {
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	encryptedContainer.EnableArchive()
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	entries := []container_pkg.Entry{}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		entries = append(entries, container_pkg.Entry{Name: name, Size: 5, Reader: strings.NewReader("12345")})
+	}
+	err = encryptedContainer.EncryptEntries(entries)
+	assert.NoError(t, err, "cannot encrypt the entries")
+	encryptedContainer.Close()
+
+	// Each entry of the table of contents takes 15 bytes
+	encryptedContainer = openWithLimits(t, file.Name(), slotKey, &types.ResourceLimits{MaxBuffer: 40})
+	_, err = encryptedContainer.ListEntries()
+	assert.ErrorIs(t, err, types.ErrResourceLimitExceeded)
+	err = encryptedContainer.WalkEntries(func(entry types.EntryInfo, reader io.Reader) error { return nil })
+	assert.ErrorIs(t, err, types.ErrResourceLimitExceeded)
+
+	encryptedContainer = openWithLimits(t, file.Name(), slotKey, &types.ResourceLimits{MaxBuffer: 45})
+	listed, err := encryptedContainer.ListEntries()
+	assert.NoError(t, err, "the table of contents is within the limit")
+	assert.Len(t, listed, 3)
+}
+
+// The password slots costing more memory than allowed are not tried
+func TestResourceLimitsKDFMemory(t *testing.T) {
+	skipUnlessSlotAlgorithm(t, types.SlotKeyAlgArgon2id)
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR256, []byte("kdf"))
+	encryptedContainer, err := container_pkg.OpenContainerFileForUpdate(name)
+	assert.NoError(t, err, "cannot open the container")
+	assert.NoError(t, encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey))
+	assert.NoError(t, encryptedContainer.AddPasswordSlotWithParams([]byte("hunter2"), types.PasswordParams{Time: 1, Memory: 1024, Threads: 1}))
+	assert.NoError(t, encryptedContainer.UpdateHeader())
+	assert.NoError(t, encryptedContainer.Close())
+
+	open := func(limit int64) *container_pkg.ContainerFile {
+		encryptedContainer, err := container_pkg.OpenContainerFileWithOptions(name, &types.ParseOptions{Limits: &types.ResourceLimits{MaxKDFMemory: limit}})
+		assert.NoError(t, err, "cannot open the container")
+		t.Cleanup(func() { encryptedContainer.Close() })
+		return encryptedContainer
+	}
+	err = open(1024*1024 - 1).UnsealWithPassword([]byte("hunter2"))
+	assert.ErrorIs(t, err, types.ErrResourceLimitExceeded)
+	assert.ErrorContains(t, err, "the memory of the key derivation")
+	uniform := open(1024*1024 - 1)
+	uniform.SetUniformUnsealErrors(true)
+	assert.ErrorIs(t, uniform.UnsealWithPassword([]byte("hunter2")), container_pkg.ErrRootKeyUnsealFailed)
+	assert.NoError(t, open(1024*1024).UnsealWithPassword([]byte("hunter2")))
+}
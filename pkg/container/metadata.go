@@ -0,0 +1,121 @@
+package container
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_internal "github.com/ngeojiajun/go-filecrypt/internal/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/metadata.go
+// This file contains the optional metadata section describing the original file, e.g. to restore its name on decryption.
+//
+// The metadata is encoded as JSON and sealed with AES-GCM under a key derived from the root key,
+// so nothing about the original file is readable without unsealing the container.
+// It is stored last in the header behind an optional flag, older readers take it as padding.
+
+// Label used to derive the key of the metadata from the root key
+var metadataLabel = []byte("filecrypt-metadata")
+
+var (
+	ErrNoMetadata      = errors.New("the container does not hold any metadata")
+	ErrMetadataInvalid = errors.New("the metadata cannot be decrypted")
+)
+
+// Key sealing the metadata, bound to the application ID like the content.
+// It is never bound to the header, which holds the metadata itself
+func (f *ContainerFile) metadataKey() ([]byte, error) {
+	keys, err := ic.DeriveKeysFromMasterKeyWithContext(f.rootKey, metadataLabel, f.applicationID, []int{32})
+	if err != nil {
+		return nil, err
+	}
+	return keys[0], nil
+}
+
+// Encrypt the metadata into the header, nil removes it. The container must be unsealed.
+// It is written by the next WriteHeader or UpdateHeader
+func (f *ContainerFile) SetMetadata(metadata *types.FileMetadata) error {
+	if len(f.rootKey) == 0 {
+		return ErrRootKeySealed
+	}
+	if metadata == nil {
+		f.header.Flags &^= types.HeaderFlagMetadata
+		f.header.Metadata = nil
+		return nil
+	}
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	defer ic.WipeBufferSecure(encoded)
+	key, err := f.metadataKey()
+	if err != nil {
+		return err
+	}
+	defer ic.WipeBufferSecure(key)
+	sealed, err := ic.AESGCMEncryptDirect(key, encoded, nil)
+	if err != nil {
+		return err
+	}
+	flags, previous := f.header.Flags, f.header.Metadata
+	length := f.header.Length
+	defer func() { f.header.Length = length }()
+	f.header.Flags |= types.HeaderFlagMetadata
+	f.header.Metadata = sealed
+	// The MAC of the authenticated header is only computed when it is written, a placeholder takes its size meanwhile
+	if f.isHeaderAuthenticated() && len(f.header.MAC) == 0 {
+		f.header.MAC = make([]byte, container_internal.HeaderMACSize)
+		defer func() { f.header.MAC = nil }()
+	}
+	if err := container_internal.WriteContainerFileHeader(io.Discard, f.header); err != nil {
+		f.header.Flags, f.header.Metadata = flags, previous
+		return err
+	}
+	return nil
+}
+
+// Decrypt the metadata of the header, ErrNoMetadata when there is none. The container must be unsealed
+func (f *ContainerFile) GetMetadata() (*types.FileMetadata, error) {
+	if f.header.Flags&types.HeaderFlagMetadata == 0 {
+		return nil, ErrNoMetadata
+	}
+	if len(f.rootKey) == 0 {
+		return nil, ErrRootKeySealed
+	}
+	key, err := f.metadataKey()
+	if err != nil {
+		return nil, err
+	}
+	defer ic.WipeBufferSecure(key)
+	encoded, err := ic.AESGCMDecryptDirect(key, f.header.Metadata, nil)
+	if err != nil {
+		return nil, ErrMetadataInvalid
+	}
+	defer ic.WipeBufferSecure(encoded)
+	metadata := &types.FileMetadata{}
+	if err := json.NewDecoder(bytes.NewReader(encoded)).Decode(metadata); err != nil {
+		return nil, ErrMetadataInvalid
+	}
+	return metadata, nil
+}
+
+// Describe the file at the path, the MIME type is guessed from its extension
+func MetadataFromFile(path string) (*types.FileMetadata, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &types.FileMetadata{
+		Name:     info.Name(),
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		MIMEType: mime.TypeByExtension(filepath.Ext(path)),
+	}, nil
+}
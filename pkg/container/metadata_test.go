@@ -0,0 +1,137 @@
+package container_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetadata(t *testing.T) {
+	plainText := []byte("metadata of the original file")
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR256, plainText)
+	metadata := &types.FileMetadata{
+		Name:     "report.pdf",
+		Size:     int64(len(plainText)),
+		ModTime:  time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC),
+		MIMEType: "application/pdf",
+		Custom:   map[string]string{"owner": "alice"},
+	}
+
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	_, err = encryptedContainer.GetMetadata()
+	assert.ErrorIs(t, err, container_pkg.ErrNoMetadata)
+	assert.ErrorIs(t, encryptedContainer.SetMetadata(metadata), container_pkg.ErrRootKeySealed)
+	assert.NoError(t, encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey), "cannot unseal the root key")
+	assert.NoError(t, encryptedContainer.SetMetadata(metadata), "cannot set the metadata")
+	assert.NoError(t, encryptedContainer.UpdateHeader(), "cannot update the header")
+	assert.NoError(t, encryptedContainer.Close())
+
+	// Nothing about the original file is readable from the header
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	assert.False(t, bytes.Contains(data, []byte("report.pdf")))
+
+	encryptedContainer, err = container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	_, err = encryptedContainer.GetMetadata()
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeySealed)
+	assert.NoError(t, encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey), "cannot unseal the root key")
+	restored, err := encryptedContainer.GetMetadata()
+	assert.NoError(t, err, "cannot get the metadata")
+	assert.Equal(t, metadata.Name, restored.Name)
+	assert.Equal(t, metadata.Size, restored.Size)
+	assert.True(t, metadata.ModTime.Equal(restored.ModTime))
+	assert.Equal(t, metadata.MIMEType, restored.MIMEType)
+	assert.Equal(t, metadata.Custom, restored.Custom)
+
+	// The metadata can be removed again
+	assert.NoError(t, encryptedContainer.SetMetadata(nil))
+	assert.NoError(t, encryptedContainer.UpdateHeader(), "cannot update the header")
+	assert.NoError(t, encryptedContainer.Close())
+	decrypted, err := decryptWithFreshHandle(t, name, slotKey)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, plainText, decrypted)
+	encryptedContainer, err = container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	_, err = encryptedContainer.GetMetadata()
+	assert.ErrorIs(t, err, container_pkg.ErrNoMetadata)
+}
+
+// The metadata survives the header-bound keys, whose fingerprint covers the metadata
+func TestMetadataHeaderBound(t *testing.T) {
+	plainText := []byte("header bound")
+	name, slotKey := createAuthenticatedTestContainer(t, plainText, func(f *container_pkg.ContainerFile) {
+		f.EnableHeaderBoundKeys()
+		f.EnableCompactHeader()
+	})
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	assert.NoError(t, encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey))
+	_, err = encryptedContainer.GetMetadata()
+	assert.ErrorIs(t, err, container_pkg.ErrNoMetadata)
+	assert.NoError(t, encryptedContainer.SetMetadata(&types.FileMetadata{Name: "bound.txt"}))
+	restored, err := encryptedContainer.GetMetadata()
+	assert.NoError(t, err, "cannot get the metadata")
+	assert.Equal(t, "bound.txt", restored.Name)
+	assert.NoError(t, encryptedContainer.Close())
+}
+
+// The metadata is bound to the application ID like the content
+func TestMetadataApplicationID(t *testing.T) {
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR256, []byte("bound"))
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	assert.NoError(t, encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey))
+	assert.NoError(t, encryptedContainer.SetMetadata(&types.FileMetadata{Name: "bound.txt"}))
+	assert.NoError(t, encryptedContainer.SetApplicationID([]byte("another-app")))
+	_, err = encryptedContainer.GetMetadata()
+	assert.ErrorIs(t, err, container_pkg.ErrMetadataInvalid)
+	assert.NoError(t, encryptedContainer.Close())
+}
+
+// Any error of the header serialization is reported, not only the size, and the metadata is left as it was
+func TestMetadataHeaderInvalid(t *testing.T) {
+	encryptedContainer, err := container_pkg.NewContainerFileWithStorage(&memoryStorage{}, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.SetMetadata(&types.FileMetadata{Name: "no-slots.txt"})
+	assert.ErrorIs(t, err, types.ErrEmptySlotContent)
+	_, err = encryptedContainer.GetMetadata()
+	assert.ErrorIs(t, err, container_pkg.ErrNoMetadata)
+}
+
+func TestBuilderWithMetadata(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "notes.txt")
+	assert.NoError(t, os.WriteFile(source, []byte("some notes"), 0600))
+	metadata, err := container_pkg.MetadataFromFile(source)
+	assert.NoError(t, err, "cannot describe the file")
+	assert.Equal(t, "notes.txt", metadata.Name)
+	assert.Equal(t, int64(10), metadata.Size)
+	assert.Contains(t, metadata.MIMEType, "text/plain")
+
+	slotKey := bytes.Repeat([]byte{7}, 16)
+	dst := filepath.Join(dir, "notes.crpt")
+	err = container_pkg.NewBuilder(dst).
+		WithAlgorithm(types.EncAlgAESCTR256).
+		AddSlot(types.SlotKeyAlgAESGCM128, slotKey).
+		WithMetadata(metadata).
+		EncryptFrom(bytes.NewReader([]byte("some notes"))).
+		Build()
+	assert.NoError(t, err, "cannot build the container")
+	encryptedContainer, err := container_pkg.OpenContainerFile(dst)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	assert.NoError(t, encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey))
+	restored, err := encryptedContainer.GetMetadata()
+	assert.NoError(t, err, "cannot get the metadata")
+	assert.Equal(t, "notes.txt", restored.Name)
+}
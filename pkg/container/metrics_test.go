@@ -0,0 +1,76 @@
+package container_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Sink recording the counters in a map
+type recordingSink map[string]int64
+
+func (s recordingSink) Inc(name string) {
+	s[name]++
+}
+
+func (s recordingSink) Add(name string, delta int64) {
+	s[name] += delta
+}
+
+func TestMetricsSink(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	sink := recordingSink{}
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR128)
+	assert.NoError(t, err, "cannot create container")
+	encryptedContainer.SetMetricsSink(sink)
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewBufferString(plainText))
+	assert.NoError(t, err, "cannot encrypt the test string")
+	encryptedContainer.Close()
+	assert.Equal(t, int64(len(plainText)), sink[container_pkg.MetricBytesEncrypted])
+
+	encryptedContainer, err = container_pkg.OpenContainerFile(file.Name())
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	encryptedContainer.SetMetricsSink(sink)
+	wrongKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, wrongKey)
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeyUnsealFailed)
+	assert.Equal(t, int64(1), sink[container_pkg.MetricUnsealFailures])
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	err = encryptedContainer.DecryptStream(bytes.NewBuffer(nil))
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, int64(len(plainText)), sink[container_pkg.MetricBytesDecrypted])
+	assert.Equal(t, int64(0), sink[container_pkg.MetricAuthenticationFailures])
+
+	// Tamper the content and decrypt again
+	data, err := os.ReadFile(file.Name())
+	assert.NoError(t, err, "cannot read the container")
+	data[len(data)-1] ^= 0x01
+	err = os.WriteFile(file.Name(), data, 0600)
+	assert.NoError(t, err, "cannot tamper the container")
+	err = encryptedContainer.DecryptStream(bytes.NewBuffer(nil))
+	assert.ErrorIs(t, err, ic.ErrAuthenticationFailed)
+	assert.Equal(t, int64(1), sink[container_pkg.MetricAuthenticationFailures])
+
+	// Nil restores the no-op sink
+	encryptedContainer.SetMetricsSink(nil)
+	_ = encryptedContainer.DecryptStream(bytes.NewBuffer(nil))
+	assert.Equal(t, int64(1), sink[container_pkg.MetricAuthenticationFailures])
+}
@@ -0,0 +1,109 @@
+package container
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/nonce_refresh.go
+// This file contains the refresh of the content salt and iv under the same root key, e.g. for a rotation policy
+// which does not require a new root key. The slots are kept as is, only the content is encrypted again.
+
+// Encrypt the content again with a new salt and iv under the same root key, the header and the slots are unchanged.
+// The new container is written to a temp file next to the original and renamed over it once complete,
+// so the file holds either the old or the new content. The old content is authenticated on the way and
+// nothing is replaced when it fails. The container must be unsealed and live in a file of its own.
+// The deterministic iv is not supported as it would produce the same salt and iv
+func (f *ContainerFile) RefreshContentNonce() error {
+	if len(f.rootKey) == 0 {
+		return ErrRootKeySealed
+	}
+	if f.file == nil {
+		return ErrContainerReadOnly
+	}
+	if f.deterministicIV || f.isMultiVolume() {
+		return types.ErrUnsupportedFeature
+	}
+	original, ok := storageFile(f.file)
+	if !ok {
+		return types.ErrUnsupportedFeature
+	}
+	name := original.Name()
+	temp, cleanup, err := createSecureTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	header := *f.header
+	header.Slots = append(header.Slots[:0:0], f.header.Slots...)
+	rootKey := bytes.Clone(f.rootKey)
+	defer ic.WipeBufferSecure(rootKey)
+	refreshed := newContainerFile(temp, header.Algorithm, rootKey)
+	refreshed.header = &header
+	refreshed.ivStrategy = f.ivStrategy
+	refreshed.applicationID = f.applicationID
+	refreshed.metricsSink = f.metricsSink
+	if err := refreshed.WriteHeader(); err != nil {
+		return err
+	}
+	if err := f.reencryptInto(refreshed); err != nil {
+		return err
+	}
+	return f.replaceWithTemp(temp, original)
+}
+
+// Decrypt the content into the other container as it is encrypted, the content is authenticated on the way
+func (f *ContainerFile) reencryptInto(target *ContainerFile) error {
+	pipeReader, pipeWriter := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := f.DecryptStream(pipeWriter)
+		pipeWriter.CloseWithError(err)
+		done <- err
+	}()
+	err := target.EncryptStream(pipeReader)
+	// Unblock the decryption if the encryption stopped early
+	pipeReader.CloseWithError(err)
+	if decryptErr := <-done; decryptErr != nil {
+		return decryptErr
+	}
+	if err != nil {
+		return err
+	}
+	return target.Sync()
+}
+
+// Rename the complete temp file over the original one and continue with it.
+// The temp file gets the permission of the original, and the directory is synced so the rename is durable
+func (f *ContainerFile) replaceWithTemp(temp, original *os.File) error {
+	info, err := original.Stat()
+	if err != nil {
+		return err
+	}
+	name := original.Name()
+	// The temp handle is closed by the cleanup, keep another one to continue with the renamed file
+	handle, err := os.OpenFile(temp.Name(), os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	if err := temp.Chmod(info.Mode().Perm()); err != nil {
+		handle.Close()
+		return err
+	}
+	if err := os.Rename(temp.Name(), name); err != nil {
+		handle.Close()
+		return err
+	}
+	previous := f.file
+	f.file = newBackingStorage(handle)
+	if err := syncDirectory(filepath.Dir(name)); err != nil {
+		previous.Close()
+		return err
+	}
+	return previous.Close()
+}
@@ -0,0 +1,67 @@
+package container_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshContentNonce(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(100000)
+	assert.NoError(t, err, "cannot generate the payload")
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR256, plainText)
+	before, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+
+	encryptedContainer, err := container_pkg.OpenContainerFileForUpdate(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.RefreshContentNonce()
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeySealed)
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	err = encryptedContainer.RefreshContentNonce()
+	assert.NoError(t, err, "cannot refresh the salt and iv")
+	// The container goes on with the refreshed file
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the refreshed content")
+	assert.Equal(t, plainText, buf.Bytes())
+
+	after, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	// Same header and slots, new salt and iv
+	assert.Equal(t, len(before), len(after))
+	assert.Equal(t, before[:4096], after[:4096])
+	assert.NotEqual(t, before[4096:4096+32], after[4096:4096+32], "the salt did not change")
+	assert.NotEqual(t, before[4096+32:4096+48], after[4096+32:4096+48], "the iv did not change")
+	decrypted, err := decryptWithFreshHandle(t, name, slotKey)
+	assert.NoError(t, err, "cannot decrypt the refreshed container")
+	assert.Equal(t, plainText, decrypted)
+}
+
+func TestRefreshContentNonceTampered(t *testing.T) {
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR256, []byte("Some secrets is here!"))
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	data[len(data)-40] ^= 0x01
+	err = os.WriteFile(name, data, 0600)
+	assert.NoError(t, err, "cannot tamper the container")
+
+	encryptedContainer, err := container_pkg.OpenContainerFileForUpdate(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	err = encryptedContainer.RefreshContentNonce()
+	assert.ErrorIs(t, err, ic.ErrAuthenticationFailed)
+	// Nothing was replaced
+	after, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	assert.Equal(t, data, after)
+}
@@ -0,0 +1,50 @@
+//go:build no_argon2 && no_scrypt && no_chacha20poly1305
+
+package container_test
+
+// Simulates a build vendoring none of golang.org/x/crypto, run it with
+// go test -tags no_argon2,no_scrypt,no_chacha20poly1305 -run NotCompiledIn ./pkg/container
+
+import (
+	"encoding/binary"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlgorithmNotCompiledIn(t *testing.T) {
+	capabilities := container_pkg.Capabilities()
+	assert.NotContains(t, capabilities.EncryptionAlgorithms, types.EncAlgChaCha20Poly1305)
+	assert.Contains(t, capabilities.EncryptionAlgorithms, types.EncAlgAESGCM256)
+	assert.NotContains(t, capabilities.SlotAlgorithms, types.SlotKeyAlgArgon2id)
+	assert.NotContains(t, capabilities.SlotAlgorithms, types.SlotKeyAlgScrypt)
+	assert.Contains(t, capabilities.SlotAlgorithms, types.SlotKeyAlgPBKDF2SHA256)
+
+	_, err := container_pkg.NewContainerFileWithStorage(&memoryStorage{}, types.EncAlgChaCha20Poly1305)
+	assert.ErrorIs(t, err, types.ErrAlgorithmNotCompiledIn)
+
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	storage := &memoryStorage{}
+	encryptedContainer, err := container_pkg.NewContainerFileWithStorage(storage, types.EncAlgAESGCM256)
+	assert.NoError(t, err, "cannot create container")
+	err = encryptedContainer.AddPasswordSlot([]byte("password"))
+	assert.ErrorIs(t, err, types.ErrAlgorithmNotCompiledIn)
+	err = encryptedContainer.AddScryptPasswordSlot([]byte("password"), types.DefaultScryptParams)
+	assert.ErrorIs(t, err, types.ErrAlgorithmNotCompiledIn)
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+
+	// A file written by a build with ChaCha20-Poly1305 cannot be opened
+	binary.BigEndian.PutUint16(storage.data[8:], uint16(types.EncAlgChaCha20Poly1305))
+	storage.position = 0
+	_, err = container_pkg.OpenContainerFileWithStorage(storage)
+	assert.ErrorIs(t, err, types.ErrAlgorithmNotCompiledIn)
+	assert.ErrorIs(t, err, types.ErrFeatureUnavailable)
+	assert.ErrorContains(t, err, "the encryption algorithm ChaCha20-Poly1305")
+}
@@ -0,0 +1,25 @@
+package container
+
+import (
+	"runtime"
+)
+
+// File: pkg/container/parallel.go
+// This file contains the option spreading the keystream of the content on several cores, e.g. for multi-gigabyte files.
+//
+// The content produced is the same as the sequential engine, so the files stay readable by any version.
+// Only the unchunked content uses the parallel engine, the HMAC of the content is still computed on a single core.
+
+// Spread the content encryption and decryption on up to workers goroutines, 0 or 1 keeps the sequential engine
+// and a negative count uses every core available (GOMAXPROCS)
+func (f *ContainerFile) SetWorkerCount(workers int) {
+	if workers < 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	f.workers = workers
+}
+
+// Number of goroutines used for the content, at least 1
+func (f *ContainerFile) workerCount() int {
+	return max(f.workers, 1)
+}
@@ -0,0 +1,46 @@
+package container_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParallelWorkers(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(3*1024*1024 + 77)
+	assert.NoError(t, err, "cannot generate plaintext")
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	t.Cleanup(func() { os.Remove(file.Name()) })
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	encryptedContainer.SetWorkerCount(4)
+	assert.NoError(t, encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey), "cannot add slot")
+	assert.NoError(t, encryptedContainer.WriteHeader(), "cannot write out the headers")
+	assert.NoError(t, encryptedContainer.EncryptStream(bytes.NewReader(plainText)), "cannot encrypt the data")
+	assert.NoError(t, encryptedContainer.Close(), "cannot close the container")
+
+	// The sequential engine reads what the parallel one wrote
+	decrypted, err := decryptWithFreshHandle(t, file.Name(), slotKey)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, plainText, decrypted)
+
+	// And the other way around, using every core
+	for _, workers := range []int{-1, 0} {
+		decryptedContainer, err := container_pkg.OpenContainerFile(file.Name())
+		assert.NoError(t, err, "cannot open the container")
+		decryptedContainer.SetWorkerCount(workers)
+		assert.NoError(t, decryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey), "cannot unseal the root key")
+		buf := bytes.NewBuffer(nil)
+		assert.NoError(t, decryptedContainer.DecryptStream(buf), "cannot decrypt the data")
+		decryptedContainer.Close()
+		assert.Equal(t, plainText, buf.Bytes())
+	}
+}
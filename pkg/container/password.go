@@ -0,0 +1,123 @@
+package container
+
+import (
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_internal "github.com/ngeojiajun/go-filecrypt/internal/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/password.go
+// This file contains APIs for slots unlocked by a passphrase instead of a raw key.
+// The wrapping key is derived with Argon2id, whose parameters and salt are stored in the slot.
+// Scrypt and PBKDF2 are offered for the environments and the systems lacking Argon2id.
+
+// Size of the random salt of the passphrase slots
+const passwordSaltSize = 16
+
+// Add a slot where the root key is wrapped by the key derived from the passphrase with types.DefaultPasswordParams
+func (f *ContainerFile) AddPasswordSlot(password []byte) error {
+	return f.AddPasswordSlotWithParams(password, types.DefaultPasswordParams)
+}
+
+// Same as AddPasswordSlot with the given cost, e.g. to raise it on a machine which can afford more memory
+func (f *ContainerFile) AddPasswordSlotWithParams(password []byte, params types.PasswordParams) error {
+	if len(f.rootKey) == 0 {
+		return ErrRootKeySealed
+	}
+	if len(password) == 0 {
+		return types.ErrParameterMissing
+	}
+	salt, err := ic.GenerateRandomBytes(passwordSaltSize)
+	if err != nil {
+		return err
+	}
+	slot, err := container_internal.NewContainerPasswordSlot(0, f.rootKey, password, salt, params)
+	if err != nil {
+		return err
+	}
+	f.header.Slots = append(f.header.Slots, slot)
+	return nil
+}
+
+// Same as AddPasswordSlot with the key derived by scrypt, e.g. to be opened where Argon2id is not available
+func (f *ContainerFile) AddScryptPasswordSlot(password []byte, params types.ScryptParams) error {
+	return f.addPasswordCompatSlot(password, func(salt []byte) (*container_internal.ContainerKeySlot, error) {
+		return container_internal.NewContainerScryptSlot(0, f.rootKey, password, salt, params)
+	})
+}
+
+// Same as AddPasswordSlot with the key derived by PBKDF2-HMAC-SHA256, only to interoperate with the systems
+// supporting neither Argon2id nor scrypt as it is not memory-hard
+func (f *ContainerFile) AddPBKDF2PasswordSlot(password []byte, params types.PBKDF2Params) error {
+	return f.addPasswordCompatSlot(password, func(salt []byte) (*container_internal.ContainerKeySlot, error) {
+		return container_internal.NewContainerPBKDF2Slot(0, f.rootKey, password, salt, params)
+	})
+}
+
+// Add the passphrase slot created with a fresh salt
+func (f *ContainerFile) addPasswordCompatSlot(password []byte, create func(salt []byte) (*container_internal.ContainerKeySlot, error)) error {
+	if len(f.rootKey) == 0 {
+		return ErrRootKeySealed
+	}
+	if len(password) == 0 {
+		return types.ErrParameterMissing
+	}
+	salt, err := ic.GenerateRandomBytes(passwordSaltSize)
+	if err != nil {
+		return err
+	}
+	slot, err := create(salt)
+	if err != nil {
+		return err
+	}
+	f.header.Slots = append(f.header.Slots, slot)
+	return nil
+}
+
+// Whether the slot is unlocked by a passphrase
+func isPasswordSlot(alg types.SlotKeyAlgorithm) bool {
+	return alg == types.SlotKeyAlgArgon2id || alg == types.SlotKeyAlgScrypt || alg == types.SlotKeyAlgPBKDF2SHA256
+}
+
+// Try to unseal the key with the passphrase, every passphrase slot is tried in turn whatever its derivation.
+// The slots whose derivation exceeds ResourceLimits.MaxKDFMemory or is not compiled into this build are skipped,
+// the error is returned when no other slot matched unless the unseal errors are uniform
+func (f *ContainerFile) UnsealWithPassword(password []byte) error {
+	if len(f.rootKey) != 0 {
+		return ErrRootKeyAlreadyUnsealed
+	}
+	if len(password) == 0 {
+		return types.ErrParameterMissing
+	}
+	var skippedErr error
+	for _, slot := range f.header.Slots {
+		if !isPasswordSlot(slot.SlotKeyAlgorithm) || slot.Flags&container_internal.FlagSlotDestroyed != 0 {
+			continue
+		}
+		if err := f.checkDerivationLimit(slot); err != nil {
+			skippedErr = err
+			continue
+		}
+		if err := container_internal.CheckSlotAlgorithm(slot.SlotKeyAlgorithm); err != nil {
+			skippedErr = err
+			continue
+		}
+		if rootKey, err := slot.Unseal(password); err == nil {
+			return f.acceptRootKey(rootKey)
+		}
+	}
+	err := f.unsealFailed()
+	if skippedErr != nil && !f.uniformUnseal {
+		return skippedErr
+	}
+	return err
+}
+
+// Refuse the slot when its key derivation needs more memory than the resource limits allow
+func (f *ContainerFile) checkDerivationLimit(slot *container_internal.ContainerKeySlot) error {
+	memory, err := slot.DerivationMemory()
+	if err != nil {
+		return err
+	}
+	return types.CheckResourceLimit("the memory of the key derivation", memory, f.resourceLimits().MaxKDFMemory)
+}
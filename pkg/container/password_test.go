@@ -0,0 +1,86 @@
+package container_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordSlot(t *testing.T) {
+	skipUnlessSlotAlgorithm(t, types.SlotKeyAlgArgon2id)
+	const plainText = "Some secrets is here!"
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	err = encryptedContainer.AddPasswordSlot(nil)
+	assert.ErrorIs(t, err, types.ErrParameterMissing)
+	err = encryptedContainer.AddPasswordSlot([]byte("correct horse battery staple"))
+	assert.NoError(t, err, "cannot add password slot")
+	// A cheaper slot for a second passphrase
+	err = encryptedContainer.AddPasswordSlotWithParams([]byte("hunter2"), types.PasswordParams{Time: 1, Memory: 64, Threads: 1})
+	assert.NoError(t, err, "cannot add password slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewBufferString(plainText))
+	assert.NoError(t, err, "cannot encrypt the test string")
+	encryptedContainer.Close()
+
+	for _, password := range []string{"correct horse battery staple", "hunter2"} {
+		encryptedContainer, err = container_pkg.OpenContainerFile(file.Name())
+		assert.NoError(t, err, "cannot open the container")
+		slots := encryptedContainer.GetSlots()
+		assert.Len(t, slots, 2)
+		err = encryptedContainer.UnsealWithPassword([]byte(password))
+		assert.NoError(t, err, "cannot unseal with the passphrase")
+		buf := bytes.NewBuffer(nil)
+		err = encryptedContainer.DecryptStream(buf)
+		assert.NoError(t, err, "cannot decrypt the data")
+		assert.Equal(t, plainText, buf.String())
+		encryptedContainer.Close()
+	}
+
+	encryptedContainer, err = container_pkg.OpenContainerFile(file.Name())
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.UnsealWithPassword([]byte("hunter3"))
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeyUnsealFailed)
+}
+
+func TestPasswordCompatSlots(t *testing.T) {
+	skipUnlessSlotAlgorithm(t, types.SlotKeyAlgScrypt)
+	const plainText = "Some secrets for older systems"
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	err = encryptedContainer.AddScryptPasswordSlot([]byte("scrypt passphrase"), types.ScryptParams{LogN: 10, BlockSize: 8, Parallelism: 1})
+	assert.NoError(t, err, "cannot add scrypt slot")
+	err = encryptedContainer.AddPBKDF2PasswordSlot([]byte("pbkdf2 passphrase"), types.PBKDF2Params{Iterations: 1000})
+	assert.NoError(t, err, "cannot add pbkdf2 slot")
+	err = encryptedContainer.AddPBKDF2PasswordSlot(nil, types.DefaultPBKDF2Params)
+	assert.ErrorIs(t, err, types.ErrParameterMissing)
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewBufferString(plainText))
+	assert.NoError(t, err, "cannot encrypt the test string")
+	encryptedContainer.Close()
+
+	for _, password := range []string{"scrypt passphrase", "pbkdf2 passphrase"} {
+		encryptedContainer, err = container_pkg.OpenContainerFile(file.Name())
+		assert.NoError(t, err, "cannot open the container")
+		err = encryptedContainer.UnsealWithPassword([]byte(password))
+		assert.NoError(t, err, "cannot unseal with the passphrase")
+		buf := bytes.NewBuffer(nil)
+		err = encryptedContainer.DecryptStream(buf)
+		assert.NoError(t, err, "cannot decrypt the data")
+		assert.Equal(t, plainText, buf.String())
+		encryptedContainer.Close()
+	}
+}
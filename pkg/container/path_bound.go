@@ -0,0 +1,53 @@
+package container
+
+import (
+	"path/filepath"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/path_bound.go
+// This file contains the slots whose key is derived from a master secret and the path of the file,
+// so a large collection of files can be keyed by a single secret while every file gets its own slot key.
+//
+// The path is only cleaned lexically before the derivation, so the same file must be referred to by the same path,
+// e.g. always relative to the root of the collection. Moving the file requires rewrapping its slot.
+
+// Algorithm of the slot wrapping the root key under the derived key
+const pathBoundSlotAlgorithm = types.SlotKeyAlgAESGCM256
+
+// Salt separating the path-bound keys from the other keys derived by HKDF
+var pathBoundSalt = []byte("filecrypt-path-bound")
+
+// Derive the slot key bound to the path
+func derivePathBoundKey(masterSecret []byte, path string) ([]byte, error) {
+	if len(masterSecret) == 0 || len(path) == 0 {
+		return nil, types.ErrParameterMissing
+	}
+	keys, err := ic.DeriveKeysFromMasterKeyWithContext(masterSecret, pathBoundSalt, []byte(filepath.Clean(path)), []int{pathBoundSlotAlgorithm.KeySize()})
+	if err != nil {
+		return nil, err
+	}
+	return keys[0], nil
+}
+
+// Add a slot whose key is derived from the master secret and the path
+func (f *ContainerFile) AddPathBoundSlot(masterSecret []byte, path string) error {
+	slotKey, err := derivePathBoundKey(masterSecret, path)
+	if err != nil {
+		return err
+	}
+	defer ic.WipeBufferSecure(slotKey)
+	return f.AddKeySlot(pathBoundSlotAlgorithm, slotKey)
+}
+
+// Unseal the root key from a slot added by AddPathBoundSlot with the same master secret and path
+func (f *ContainerFile) UnsealPathBound(masterSecret []byte, path string) error {
+	slotKey, err := derivePathBoundKey(masterSecret, path)
+	if err != nil {
+		return err
+	}
+	defer ic.WipeBufferSecure(slotKey)
+	return f.Unseal(pathBoundSlotAlgorithm, slotKey)
+}
@@ -0,0 +1,47 @@
+package container_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathBoundSlot(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	masterSecret := []byte("collection master secret")
+
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR128)
+	assert.NoError(t, err, "cannot create container")
+	err = encryptedContainer.AddPathBoundSlot(masterSecret, "")
+	assert.ErrorIs(t, err, types.ErrParameterMissing)
+	err = encryptedContainer.AddPathBoundSlot(masterSecret, "photos/2024/a.jpg")
+	assert.NoError(t, err, "cannot add path-bound slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewBufferString(plainText))
+	assert.NoError(t, err, "cannot encrypt the test string")
+	encryptedContainer.Close()
+
+	encryptedContainer, err = container_pkg.OpenContainerFile(file.Name())
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	// The key is bound to the path and to the secret
+	err = encryptedContainer.UnsealPathBound(masterSecret, "photos/2024/b.jpg")
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeyUnsealFailed)
+	err = encryptedContainer.UnsealPathBound([]byte("another secret"), "photos/2024/a.jpg")
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeyUnsealFailed)
+	// Lexically equivalent paths derive the same key
+	err = encryptedContainer.UnsealPathBound(masterSecret, "photos/./2024/a.jpg")
+	assert.NoError(t, err, "cannot unseal the path-bound slot")
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, plainText, buf.String())
+}
@@ -0,0 +1,84 @@
+package container
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_internal "github.com/ngeojiajun/go-filecrypt/internal/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/plan.go
+// This file contains APIs for estimating the cost of an encryption before running it
+
+// Amount of data encrypted by the micro-benchmark
+const planBenchmarkSize = 1024 * 1024
+
+// Estimate the size of the container produced by encrypting srcSize bytes with the default settings,
+// and roughly how long the encryption takes on the current machine.
+// The time is extrapolated from a tiny in-memory benchmark, so disk speed is not taken into account.
+// It returns -1 as the size if the parameters are invalid
+func PlanEncryption(srcSize int64, alg types.EncryptionAlgorithm) (outputSize int64, roughSeconds float64) {
+	if srcSize < 0 || alg >= types.EncAlgEnd {
+		return -1, 0
+	}
+	if alg.IsAEAD() {
+		// The AEAD always uses the chunked framing, with at least one chunk
+		chunks := max((srcSize+ContentChunkSize-1)/ContentChunkSize, 1)
+		outputSize = srcSize + container_internal.HeaderSize + defaultContentSaltSize + chunks*chunkOverheadOf(alg)
+	} else {
+		outputSize = srcSize + contentOverhead(container_internal.HeaderSize, defaultContentSaltSize)
+	}
+	throughput := benchmarkEncryption(alg)
+	if throughput <= 0 {
+		return outputSize, 0
+	}
+	return outputSize, float64(srcSize) / throughput
+}
+
+// Measure the encryption throughput of the algorithm in bytes per second, 0 is returned on failure
+func benchmarkEncryption(alg types.EncryptionAlgorithm) float64 {
+	key, err := ic.GenerateRandomBytes(alg.KeySize())
+	if err != nil {
+		return 0
+	}
+	if alg.IsAEAD() {
+		return benchmarkChunkedAEAD(alg, key)
+	}
+	authKey, err := ic.GenerateRandomBytes(authKeySize)
+	if err != nil {
+		return 0
+	}
+	iv, err := ic.GenerateAESIV()
+	if err != nil {
+		return 0
+	}
+	plaintext := make([]byte, planBenchmarkSize)
+	start := time.Now()
+	if _, err := ic.AESCTRStreamEncryptAuthenticatedEx(key, iv, authKey, bytes.NewReader(plaintext), io.Discard); err != nil {
+		return 0
+	}
+	elapsed := time.Since(start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return planBenchmarkSize / elapsed
+}
+
+// Measure the throughput of sealing the chunks with the AEAD in bytes per second, 0 is returned on failure
+func benchmarkChunkedAEAD(alg types.EncryptionAlgorithm, key []byte) float64 {
+	plaintext := make([]byte, ContentChunkSize)
+	start := time.Now()
+	for index := range uint64(planBenchmarkSize / ContentChunkSize) {
+		if _, err := sealChunkWith(alg, [][]byte{key}, index, false, plaintext); err != nil {
+			return 0
+		}
+	}
+	elapsed := time.Since(start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return planBenchmarkSize / elapsed
+}
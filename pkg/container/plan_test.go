@@ -0,0 +1,31 @@
+package container_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanEncryption(t *testing.T) {
+	for _, alg := range []types.EncryptionAlgorithm{types.EncAlgAESCTR256, types.EncAlgAESGCM128, types.EncAlgChaCha20Poly1305} {
+		for _, size := range []int{0, 1, 100000} {
+			plainText := bytes.Repeat([]byte{0x5a}, size)
+			name, _ := createTestContainer(t, alg, plainText)
+			info, err := os.Stat(name)
+			assert.NoError(t, err, "cannot stat the container")
+
+			outputSize, roughSeconds := container_pkg.PlanEncryption(int64(size), alg)
+			assert.Equal(t, info.Size(), outputSize, "the size estimate does not match the output")
+			assert.GreaterOrEqual(t, roughSeconds, 0.0)
+		}
+	}
+
+	outputSize, _ := container_pkg.PlanEncryption(-1, types.EncAlgAESCTR256)
+	assert.Equal(t, int64(-1), outputSize)
+	outputSize, _ = container_pkg.PlanEncryption(10, types.EncAlgEnd)
+	assert.Equal(t, int64(-1), outputSize)
+}
@@ -0,0 +1,19 @@
+package container
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// File: pkg/container/preallocate_linux.go
+// This file reserves the space of the files with fallocate
+
+// Reserve the blocks of the file up to the size, falling back to extending it when the file system cannot reserve space
+func preallocateFile(file *os.File, size int64) error {
+	err := syscall.Fallocate(int(file.Fd()), 0, 0, size)
+	if errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.ENOSYS) {
+		return file.Truncate(size)
+	}
+	return err
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package container
+
+import (
+	"os"
+)
+
+// File: pkg/container/preallocate_other.go
+// This file extends the files to the expected size where fallocate is not available.
+// The file may be sparse, so running out of space is only detected while writing
+
+// Extend the file up to the size without reserving its blocks
+func preallocateFile(file *os.File, size int64) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() >= size {
+		return nil
+	}
+	return file.Truncate(size)
+}
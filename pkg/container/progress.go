@@ -0,0 +1,63 @@
+package container
+
+import (
+	"io"
+)
+
+// File: pkg/container/progress.go
+// This file contains the optional progress callback of EncryptStream and DecryptStream, e.g. to render a progress bar.
+//
+// The progress is counted in plaintext bytes. The total of a decryption comes from EstimateContentSize,
+// the total of an encryption from the source when it can tell its size (a bytes.Reader, a regular file, ...).
+
+// ProgressFunc receives the plaintext bytes processed so far and the expected total, -1 when it is unknown.
+// It is called synchronously after every block processed, so it must return quickly
+type ProgressFunc func(processed, total int64)
+
+// Report the progress of EncryptStream and DecryptStream to the function, nil disables the reporting
+func (f *ContainerFile) SetProgressFunc(progress ProgressFunc) {
+	f.progress = progress
+}
+
+// Bind the total to the progress function, nil when no progress is reported
+func (f *ContainerFile) progressReporter(total func() int64) func(processed int64) {
+	if f.progress == nil {
+		return nil
+	}
+	progress, expected := f.progress, total()
+	return func(processed int64) {
+		progress(processed, expected)
+	}
+}
+
+// Expected plaintext size of the decryption, -1 when it cannot be estimated
+func (f *ContainerFile) decryptionTotal() int64 {
+	size, err := f.EstimateContentSize()
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// Bytes left in the source, -1 when the source cannot tell
+func sourceSize(reader io.Reader) int64 {
+	switch source := reader.(type) {
+	case interface{ Len() int }:
+		return int64(source.Len())
+	case io.Seeker:
+		current, err := source.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		end, err := source.Seek(0, io.SeekEnd)
+		if err != nil {
+			return -1
+		}
+		if _, err := source.Seek(current, io.SeekStart); err != nil {
+			return -1
+		}
+		return end - current
+	default:
+		return -1
+	}
+}
@@ -0,0 +1,97 @@
+package container_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Progress calls recorded by a ProgressFunc
+type progressRecorder struct {
+	processed []int64
+	totals    []int64
+}
+
+func (r *progressRecorder) record(processed, total int64) {
+	r.processed = append(r.processed, processed)
+	r.totals = append(r.totals, total)
+}
+
+// The progress must only grow and end at the size
+func assertProgress(t *testing.T, recorder *progressRecorder, size, total int64) {
+	t.Helper()
+	if !assert.NotEmpty(t, recorder.processed, "the progress is never reported") {
+		return
+	}
+	for i := 1; i < len(recorder.processed); i++ {
+		assert.Greater(t, recorder.processed[i], recorder.processed[i-1], "the progress must grow")
+	}
+	assert.Equal(t, size, recorder.processed[len(recorder.processed)-1])
+	for _, reported := range recorder.totals {
+		assert.Equal(t, total, reported)
+	}
+}
+
+func TestProgressFunc(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(3*container_pkg.ContentChunkSize + 17)
+	assert.NoError(t, err, "cannot generate plaintext")
+	for _, chunked := range []bool{false, true} {
+		file, err := os.CreateTemp("", "filecrypt-ci-")
+		assert.NoError(t, err, "cannot create temp file")
+		t.Cleanup(func() { os.Remove(file.Name()) })
+		slotKey, err := ic.GenerateRandomBytes(16)
+		assert.NoError(t, err, "cannot generate slot key")
+		encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+		assert.NoError(t, err, "cannot create container")
+		if chunked {
+			encryptedContainer.EnableChunkedContent()
+		}
+		assert.NoError(t, encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey), "cannot add slot")
+		assert.NoError(t, encryptedContainer.WriteHeader(), "cannot write out the headers")
+		encryption := &progressRecorder{}
+		encryptedContainer.SetProgressFunc(encryption.record)
+		assert.NoError(t, encryptedContainer.EncryptStream(bytes.NewReader(plainText)), "cannot encrypt the data")
+		assert.NoError(t, encryptedContainer.Close(), "cannot close the container")
+		assertProgress(t, encryption, int64(len(plainText)), int64(len(plainText)))
+
+		decryptedContainer, err := container_pkg.OpenContainerFile(file.Name())
+		assert.NoError(t, err, "cannot open the container")
+		assert.NoError(t, decryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey), "cannot unseal the root key")
+		decryption := &progressRecorder{}
+		decryptedContainer.SetProgressFunc(decryption.record)
+		buf := bytes.NewBuffer(nil)
+		assert.NoError(t, decryptedContainer.DecryptStream(buf), "cannot decrypt the data")
+		decryptedContainer.Close()
+		assert.Equal(t, plainText, buf.Bytes())
+		assertProgress(t, decryption, int64(len(plainText)), int64(len(plainText)))
+	}
+}
+
+func TestProgressFuncUnknownTotal(t *testing.T) {
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	t.Cleanup(func() { os.Remove(file.Name()) })
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	defer encryptedContainer.Close()
+	assert.NoError(t, encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey), "cannot add slot")
+	assert.NoError(t, encryptedContainer.WriteHeader(), "cannot write out the headers")
+	recorder := &progressRecorder{}
+	encryptedContainer.SetProgressFunc(recorder.record)
+	// The pipe cannot tell its size
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		pipeWriter.Write([]byte("hello world"))
+		pipeWriter.Close()
+	}()
+	assert.NoError(t, encryptedContainer.EncryptStream(pipeReader), "cannot encrypt the data")
+	assertProgress(t, recorder, 11, -1)
+}
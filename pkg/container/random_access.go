@@ -0,0 +1,150 @@
+package container
+
+import (
+	"errors"
+	"io"
+
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/random_access.go
+// This file contains APIs for decrypting part of the content without processing it from the start.
+//
+// Important: the content is authenticated by a single tag at the end, reading only a part of the content
+// does not verify it. Use DecryptStream when the authenticity of the content matters.
+
+var (
+	ErrRangeOutOfBounds = errors.New("the requested range is out of the bounds of the content")
+)
+
+// Read the salt and iv stored in front of the ciphertext.
+// The backing file must be seekable
+func (f *ContainerFile) readContentPrefix() (salt, iv []byte, err error) {
+	if f.file == nil {
+		return nil, nil, ErrContainerReadOnly
+	}
+	return f.readSaltAndIV(io.NewSectionReader(f.file, f.contentOffset(), int64(f.contentSaltSize()+contentIVSize)))
+}
+
+// Decrypt the plaintext bytes in [offset, offset+length) into the writer.
+// The CTR counter is positioned directly at the offset, hence nothing before it is decrypted,
+// the range is read through a SeekableDecryptionStream wiped on return.
+//
+// The multi-volume content has no single file to read at an offset and returns ErrUnsupportedFeature.
+//
+// Note that the authentication tag would not be verified unless the content is chunked
+func (f *ContainerFile) DecryptRange(writer io.Writer, offset, length int64) error {
+	if len(f.rootKey) == 0 {
+		return ErrRootKeySealed
+	}
+	if f.isMultiVolume() {
+		return types.ErrUnsupportedFeature
+	}
+	size, err := f.EstimateContentSize()
+	if err != nil {
+		return err
+	}
+	if offset < 0 || length < 0 || offset > size || length > size-offset {
+		return ErrRangeOutOfBounds
+	}
+	stream, err := f.newSeekableDecryptionStream(size)
+	if err != nil {
+		return err
+	}
+	defer stream.wipe()
+	_, err = io.Copy(writer, io.NewSectionReader(stream, offset, length))
+	return err
+}
+
+// Decrypt the plaintext from the offset skip to the end into the writer.
+// The CTR counter is advanced directly to the block of the offset, so the skipped part costs no decryption.
+//
+// Note that the tag covers the whole content and cannot be verified from the middle,
+// so the output is not authenticated unless the content is chunked, where every chunk touched is verified
+func (f *ContainerFile) DecryptStreamFrom(writer io.Writer, skip int64) error {
+	if len(f.rootKey) == 0 {
+		return ErrRootKeySealed
+	}
+	size, err := f.EstimateContentSize()
+	if err != nil {
+		return err
+	}
+	if skip < 0 || skip > size {
+		return ErrRangeOutOfBounds
+	}
+	return f.DecryptRange(writer, skip, size-skip)
+}
+
+// Resume an interrupted decryption, where the writer already received the plaintext before fromOffset.
+// The rest of the content is decrypted starting at the matching CTR position, see DecryptStreamFrom,
+// then the whole content is authenticated in a final pass like Verify, as the tag cannot be checked from the middle.
+// On ErrAuthenticationFailed the tail is already written, the whole output including the part written before
+// the interruption must be discarded
+func (f *ContainerFile) ResumeDecryption(writer io.Writer, fromOffset int64) error {
+	if err := f.DecryptStreamFrom(writer, fromOffset); err != nil {
+		return err
+	}
+	return f.Verify()
+}
+
+// Reader over the plaintext of an unsealed container, every ReadAt decrypts only the requested bytes
+type contentReaderAt struct {
+	f    *ContainerFile
+	size int64
+}
+
+func (r *contentReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrRangeOutOfBounds
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	n := min(int64(len(p)), r.size-off)
+	writer := &sliceWriter{buf: p[:n]}
+	if err := r.f.DecryptRange(writer, off, n); err != nil {
+		return writer.written, err
+	}
+	if n < int64(len(p)) {
+		return int(n), io.EOF
+	}
+	return int(n), nil
+}
+
+// Writer filling a fixed slice
+type sliceWriter struct {
+	buf     []byte
+	written int
+}
+
+func (w *sliceWriter) Write(p []byte) (int, error) {
+	n := copy(w.buf[w.written:], p)
+	w.written += n
+	if n < len(p) {
+		return n, io.ErrShortWrite
+	}
+	return n, nil
+}
+
+// Create a reader over the plaintext bytes in [offset, offset+length), e.g. for serving HTTP range requests with
+// http.ServeContent. Every read decrypts only the bytes requested through DecryptRange.
+//
+// Like DecryptRange, the multi-volume content returns ErrUnsupportedFeature.
+//
+// Note that the bytes read are not authenticated unless the content is chunked, see DecryptRange
+func (f *ContainerFile) NewContentSectionReader(offset, length int64) (*io.SectionReader, error) {
+	if len(f.rootKey) == 0 {
+		return nil, ErrRootKeySealed
+	}
+	if f.isMultiVolume() {
+		return nil, types.ErrUnsupportedFeature
+	}
+	size, err := f.EstimateContentSize()
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || length < 0 || offset > size || length > size-offset {
+		return nil, ErrRangeOutOfBounds
+	}
+	return io.NewSectionReader(&contentReaderAt{f: f, size: size}, offset, length), nil
+}
@@ -0,0 +1,176 @@
+package container_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Decrypt several ranges and compare to the plaintext
+func TestDecryptRange(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(3 * 4096)
+	assert.NoError(t, err, "cannot generate plaintext")
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR256, plainText)
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+
+	for _, r := range [][2]int64{{0, 10}, {7, 100}, {4095, 2}, {5000, 7288}, {12288, 0}} {
+		buf := bytes.NewBuffer(nil)
+		err = encryptedContainer.DecryptRange(buf, r[0], r[1])
+		assert.NoError(t, err, "cannot decrypt the range %v", r)
+		assert.Equal(t, plainText[r[0]:r[0]+r[1]], buf.Bytes())
+	}
+	err = encryptedContainer.DecryptRange(bytes.NewBuffer(nil), 12000, 289)
+	assert.ErrorIs(t, err, container_pkg.ErrRangeOutOfBounds)
+	err = encryptedContainer.DecryptRange(bytes.NewBuffer(nil), -1, 1)
+	assert.ErrorIs(t, err, container_pkg.ErrRangeOutOfBounds)
+}
+
+// Simulate an interrupted decryption and resume it
+func TestResumeDecryption(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(3*4096 + 123)
+	assert.NoError(t, err, "cannot generate plaintext")
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR128, plainText)
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+
+	// The first run stopped in the middle of a block
+	const interruptedAt = 5003
+	output := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptRange(output, 0, interruptedAt)
+	assert.NoError(t, err, "cannot decrypt the first part")
+	err = encryptedContainer.ResumeDecryption(output, int64(output.Len()))
+	assert.NoError(t, err, "cannot resume the decryption")
+	assert.Equal(t, plainText, output.Bytes())
+
+	err = encryptedContainer.ResumeDecryption(bytes.NewBuffer(nil), int64(len(plainText)+1))
+	assert.ErrorIs(t, err, container_pkg.ErrRangeOutOfBounds)
+}
+
+// The content before the offset is authenticated too when resuming
+func TestResumeDecryptionTampered(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(3*4096 + 123)
+	assert.NoError(t, err, "cannot generate plaintext")
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR128, plainText)
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	// Flip a byte of the first block of the ciphertext, following the header, the salt and the iv
+	data[4096+32+16] ^= 0x01
+	err = os.WriteFile(name, data, 0600)
+	assert.NoError(t, err, "cannot tamper the container")
+
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	output := bytes.NewBuffer(nil)
+	err = encryptedContainer.ResumeDecryption(output, 5003)
+	assert.ErrorIs(t, err, ic.ErrAuthenticationFailed)
+	// The tail itself is intact
+	assert.Equal(t, plainText[5003:], output.Bytes())
+}
+
+// Serve a range request from the plaintext of the container
+func TestNewContentSectionReader(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(3*4096 + 77)
+	assert.NoError(t, err, "cannot generate plaintext")
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR256, plainText)
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	_, err = encryptedContainer.NewContentSectionReader(0, 1)
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeySealed)
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+
+	section, err := encryptedContainer.NewContentSectionReader(0, int64(len(plainText)))
+	assert.NoError(t, err, "cannot create the section reader")
+	request := httptest.NewRequest(http.MethodGet, "/file", nil)
+	request.Header.Set("Range", "bytes=4000-9999")
+	recorder := httptest.NewRecorder()
+	http.ServeContent(recorder, request, "file", time.Time{}, section)
+	assert.Equal(t, http.StatusPartialContent, recorder.Code)
+	assert.Equal(t, plainText[4000:10000], recorder.Body.Bytes())
+
+	// A subrange reads only its own bytes
+	section, err = encryptedContainer.NewContentSectionReader(100, 50)
+	assert.NoError(t, err, "cannot create the section reader")
+	data, err := io.ReadAll(section)
+	assert.NoError(t, err, "cannot read the section")
+	assert.Equal(t, plainText[100:150], data)
+
+	_, err = encryptedContainer.NewContentSectionReader(12000, int64(len(plainText)))
+	assert.ErrorIs(t, err, container_pkg.ErrRangeOutOfBounds)
+}
+
+func TestDecryptStreamFrom(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(3*4096 + 123)
+	assert.NoError(t, err, "cannot generate plaintext")
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR192, plainText)
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+
+	for _, skip := range []int64{0, 1, 15, 16, 4097, int64(len(plainText))} {
+		buf := bytes.NewBuffer(nil)
+		err = encryptedContainer.DecryptStreamFrom(buf, skip)
+		assert.NoError(t, err, "cannot decrypt from %d", skip)
+		assert.Equal(t, plainText[skip:], buf.Bytes())
+	}
+	err = encryptedContainer.DecryptStreamFrom(bytes.NewBuffer(nil), -1)
+	assert.ErrorIs(t, err, container_pkg.ErrRangeOutOfBounds)
+}
+
+// Compare skipping the prefix by advancing the counter against decrypting and discarding it
+func BenchmarkDecryptStreamFrom(b *testing.B) {
+	const size = 16 << 20
+	const skip = size - 4096
+	plainText := make([]byte, size)
+	name, slotKey := createTestContainer(b, types.EncAlgAESCTR256, plainText)
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(b, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(b, err, "cannot unseal the root key")
+
+	b.Run("counter", func(b *testing.B) {
+		for b.Loop() {
+			if err := encryptedContainer.DecryptStreamFrom(io.Discard, skip); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("discard", func(b *testing.B) {
+		for b.Loop() {
+			reader, err := encryptedContainer.AsDecryptionStream()
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := io.CopyN(io.Discard, reader, skip); err != nil {
+				b.Fatal(err)
+			}
+			// Closing the stream would close the container as well
+			if _, err := io.Copy(io.Discard, reader); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
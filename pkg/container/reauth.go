@@ -0,0 +1,128 @@
+package container
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"io"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_internal "github.com/ngeojiajun/go-filecrypt/internal/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/reauth.go
+// This file contains the rotation of the key of the content tag without encrypting the content again.
+//
+// Once re-authenticated the header carries HeaderFlagReauthenticated and a random salt, and the tag key is derived
+// from the root key under a label of its own with that salt, so it shares nothing with the key derived from the content salt.
+// The encryption key, the iv and the ciphertext stay the same.
+
+// Label mixed into the salt of the derivation of the tag key once re-authenticated
+var contentReauthLabel = []byte("filecrypt-content-reauth")
+
+// Derive the encryption key and the tag key of the unchunked content from its salt.
+// The tag key comes from the salt in the header instead once the content was re-authenticated
+func (f *ContainerFile) contentKeys(salt []byte) ([][]byte, error) {
+	if f.header.Flags&types.HeaderFlagReauthenticated == 0 {
+		return f.deriveContentKeys(salt, []int{f.header.Algorithm.KeySize(), authKeySize})
+	}
+	keys, err := f.deriveContentKeys(salt, []int{f.header.Algorithm.KeySize()})
+	if err != nil {
+		return nil, err
+	}
+	authKeys, err := f.reauthKey(f.header.AuthSalt)
+	if err != nil {
+		ic.WipeBufferSecure(keys[0])
+		return nil, err
+	}
+	return append(keys, authKeys...), nil
+}
+
+// Derive the tag key from the salt in the header
+func (f *ContainerFile) reauthKey(authSalt []byte) ([][]byte, error) {
+	label := append(append([]byte(nil), contentReauthLabel...), authSalt...)
+	return f.deriveContentKeys(label, []int{authKeySize})
+}
+
+// Replace the tag of the content with one under a fresh tag key, leaving the ciphertext untouched.
+// The current tag is verified first and nothing is written when it fails.
+// The container must be unsealed and opened for update. The chunked, AEAD, header-bound, checksummed and multi-volume
+// contents are not supported, and the first call fails with ErrHeaderSizeChanged on the compact header as the salt grows it.
+//
+// Warning: the header and the tag are written one after the other, a crash in between leaves the content unauthenticated
+// until ReauthContent is run again with the root key
+func (f *ContainerFile) ReauthContent() error {
+	if len(f.rootKey) == 0 {
+		return ErrRootKeySealed
+	}
+	if f.file == nil {
+		return ErrContainerReadOnly
+	}
+	if f.isChunked() || f.header.Algorithm.IsAEAD() || f.isHeaderBound() || f.hasChecksumTrailer() || f.isMultiVolume() {
+		return types.ErrUnsupportedFeature
+	}
+	contentEnd, err := f.FileSize()
+	if err != nil {
+		return err
+	}
+	ivOffset := f.contentOffset() + int64(f.contentSaltSize())
+	tagOffset := contentEnd - sha256.Size
+	if tagOffset < ivOffset+contentIVSize {
+		return ic.ErrTruncated
+	}
+	salt := make([]byte, f.contentSaltSize())
+	if _, err := f.file.ReadAt(salt, f.contentOffset()); err != nil {
+		return err
+	}
+	tag := make([]byte, sha256.Size)
+	if _, err := f.file.ReadAt(tag, tagOffset); err != nil {
+		return err
+	}
+	keys, err := f.contentKeys(salt)
+	if err != nil {
+		return err
+	}
+	ic.WipeBufferSecure(keys[0])
+	current, err := f.contentTag(keys[1], ivOffset, tagOffset)
+	ic.WipeBufferSecure(keys[1])
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(current, tag) {
+		return ic.ErrAuthenticationFailed
+	}
+
+	authSalt, err := ic.GenerateRandomBytes(container_internal.AuthSaltSize)
+	if err != nil {
+		return err
+	}
+	authKeys, err := f.reauthKey(authSalt)
+	if err != nil {
+		return err
+	}
+	renewed, err := f.contentTag(authKeys[0], ivOffset, tagOffset)
+	ic.WipeBufferSecure(authKeys[0])
+	if err != nil {
+		return err
+	}
+	previousFlags, previousSalt := f.header.Flags, f.header.AuthSalt
+	f.header.Flags |= types.HeaderFlagReauthenticated
+	f.header.AuthSalt = authSalt
+	if err := f.UpdateHeader(); err != nil {
+		f.header.Flags, f.header.AuthSalt = previousFlags, previousSalt
+		return err
+	}
+	if _, err := f.file.WriteAt(renewed, tagOffset); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+// Compute the tag over iv || ciphertext stored between the offsets
+func (f *ContainerFile) contentTag(authKey []byte, start, end int64) ([]byte, error) {
+	h := hmac.New(sha256.New, authKey)
+	if _, err := io.Copy(h, io.NewSectionReader(f.file, start, end-start)); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
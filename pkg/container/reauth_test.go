@@ -0,0 +1,82 @@
+package container_test
+
+import (
+	"os"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReauthContent(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(100000)
+	assert.NoError(t, err, "cannot generate the payload")
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR256, plainText)
+	before, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+
+	encryptedContainer, err := container_pkg.OpenContainerFileForUpdate(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.ReauthContent()
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeySealed)
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	err = encryptedContainer.ReauthContent()
+	assert.NoError(t, err, "cannot re-authenticate the content")
+
+	after, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	// Same ciphertext, new tag
+	assert.Equal(t, len(before), len(after))
+	assert.Equal(t, before[4096:len(before)-32], after[4096:len(after)-32])
+	assert.NotEqual(t, before[len(before)-32:], after[len(after)-32:], "the tag did not change")
+	decrypted, err := decryptWithFreshHandle(t, name, slotKey)
+	assert.NoError(t, err, "cannot decrypt the re-authenticated container")
+	assert.Equal(t, plainText, decrypted)
+
+	// The tag can be rotated again under the new salt
+	err = encryptedContainer.ReauthContent()
+	assert.NoError(t, err, "cannot re-authenticate the content again")
+	again, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	assert.NotEqual(t, after[:4096], again[:4096], "the salt did not change")
+	assert.NotEqual(t, after[len(after)-32:], again[len(again)-32:], "the tag did not change")
+	decrypted, err = decryptWithFreshHandle(t, name, slotKey)
+	assert.NoError(t, err, "cannot decrypt the re-authenticated container")
+	assert.Equal(t, plainText, decrypted)
+}
+
+func TestReauthContentTampered(t *testing.T) {
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR256, []byte("Some secrets is here!"))
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	data[len(data)-40] ^= 0x01
+	err = os.WriteFile(name, data, 0600)
+	assert.NoError(t, err, "cannot tamper the container")
+
+	encryptedContainer, err := container_pkg.OpenContainerFileForUpdate(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	err = encryptedContainer.ReauthContent()
+	assert.ErrorIs(t, err, ic.ErrAuthenticationFailed)
+	// Nothing was written
+	after, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	assert.Equal(t, data, after)
+}
+
+func TestReauthContentUnsupported(t *testing.T) {
+	name, slotKey := createTestContainer(t, types.EncAlgAESGCM256, []byte("Some secrets is here!"))
+	encryptedContainer, err := container_pkg.OpenContainerFileForUpdate(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	err = encryptedContainer.ReauthContent()
+	assert.ErrorIs(t, err, types.ErrUnsupportedFeature)
+}
@@ -0,0 +1,88 @@
+package container
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_internal "github.com/ngeojiajun/go-filecrypt/internal/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/recipient.go
+// This file contains APIs for slots wrapping the root key to the public key of a recipient,
+// so a container can be encrypted for someone without sharing a symmetric key with them.
+// RSA keys of 2048 bits or more and X25519 keys are supported.
+
+var (
+	ErrRecipientKeyUnsupported = errors.New("the key must be a RSA key of 2048 bits or more, or a X25519 key")
+)
+
+// Add a slot where the root key is wrapped to the public key, a *rsa.PublicKey or a X25519 *ecdh.PublicKey
+func (f *ContainerFile) AddRecipientSlot(publicKey crypto.PublicKey) error {
+	if len(f.rootKey) == 0 {
+		return ErrRootKeySealed
+	}
+	var slot *container_internal.ContainerKeySlot
+	var err error
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		slot, err = container_internal.NewContainerRSASlot(0, f.rootKey, key)
+	case *ecdh.PublicKey:
+		if key.Curve() != ecdh.X25519() {
+			return ErrRecipientKeyUnsupported
+		}
+		slot, err = container_internal.NewContainerX25519Slot(0, f.rootKey, key)
+	default:
+		return ErrRecipientKeyUnsupported
+	}
+	if errors.Is(err, ic.ErrKeySizeInvalid) {
+		return ErrRecipientKeyUnsupported
+	}
+	if err != nil {
+		return err
+	}
+	f.header.Slots = append(f.header.Slots, slot)
+	return nil
+}
+
+// Encode the private key as the slots of its algorithm expect it
+func recipientSlotKey(privateKey crypto.PrivateKey) (types.SlotKeyAlgorithm, []byte, error) {
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		return types.SlotKeyAlgRSAOAEP2048, der, err
+	case *ecdh.PrivateKey:
+		if key.Curve() != ecdh.X25519() {
+			return types.SlotKeyAlgEnd, nil, ErrRecipientKeyUnsupported
+		}
+		return types.SlotKeyAlgX25519, key.Bytes(), nil
+	default:
+		return types.SlotKeyAlgEnd, nil, ErrRecipientKeyUnsupported
+	}
+}
+
+// Try to unseal the key with the private key of a recipient, a *rsa.PrivateKey or a X25519 *ecdh.PrivateKey.
+// Every slot of the matching algorithm is tried in turn
+func (f *ContainerFile) UnsealWithPrivateKey(privateKey crypto.PrivateKey) error {
+	if len(f.rootKey) != 0 {
+		return ErrRootKeyAlreadyUnsealed
+	}
+	alg, slotKey, err := recipientSlotKey(privateKey)
+	if err != nil {
+		return err
+	}
+	defer ic.WipeBufferSecure(slotKey)
+	for _, slot := range f.header.Slots {
+		if slot.SlotKeyAlgorithm != alg || slot.Flags&container_internal.FlagSlotDestroyed != 0 {
+			continue
+		}
+		if rootKey, err := slot.Unseal(slotKey); err == nil {
+			return f.acceptRootKey(rootKey)
+		}
+	}
+	return f.unsealFailed()
+}
@@ -0,0 +1,70 @@
+package container_test
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"os"
+	"testing"
+
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Encrypt for a RSA and a X25519 recipient, each of them unseals with their private key only
+func TestRecipientSlots(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err, "cannot generate the RSA key")
+	x25519Key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	assert.NoError(t, err, "cannot generate the X25519 key")
+
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	err = encryptedContainer.AddRecipientSlot(&rsaKey.PublicKey)
+	assert.NoError(t, err, "cannot add the RSA slot")
+	err = encryptedContainer.AddRecipientSlot(x25519Key.PublicKey())
+	assert.NoError(t, err, "cannot add the X25519 slot")
+	p256Key, err := ecdh.P256().GenerateKey(rand.Reader)
+	assert.NoError(t, err, "cannot generate the P-256 key")
+	err = encryptedContainer.AddRecipientSlot(p256Key.PublicKey())
+	assert.ErrorIs(t, err, container_pkg.ErrRecipientKeyUnsupported)
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err, "cannot generate the ECDSA key")
+	err = encryptedContainer.AddRecipientSlot(&ecdsaKey.PublicKey)
+	assert.ErrorIs(t, err, container_pkg.ErrRecipientKeyUnsupported)
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewBufferString(plainText))
+	assert.NoError(t, err, "cannot encrypt the test string")
+	encryptedContainer.Close()
+
+	for _, privateKey := range []any{rsaKey, x25519Key} {
+		encryptedContainer, err = container_pkg.OpenContainerFile(file.Name())
+		assert.NoError(t, err, "cannot open the container")
+		err = encryptedContainer.UnsealWithPrivateKey(privateKey)
+		assert.NoError(t, err, "cannot unseal with the private key")
+		buf := bytes.NewBuffer(nil)
+		err = encryptedContainer.DecryptStream(buf)
+		assert.NoError(t, err, "cannot decrypt the data")
+		assert.Equal(t, plainText, buf.String())
+		encryptedContainer.Close()
+	}
+
+	encryptedContainer, err = container_pkg.OpenContainerFile(file.Name())
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	otherKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	assert.NoError(t, err, "cannot generate the X25519 key")
+	err = encryptedContainer.UnsealWithPrivateKey(otherKey)
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeyUnsealFailed)
+	err = encryptedContainer.UnsealWithPrivateKey(ecdsaKey)
+	assert.ErrorIs(t, err, container_pkg.ErrRecipientKeyUnsupported)
+}
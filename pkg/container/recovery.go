@@ -0,0 +1,115 @@
+package container
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_internal "github.com/ngeojiajun/go-filecrypt/internal/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/recovery.go
+// This file contains the optional recovery record, a sidecar file allowing the header to be rebuilt when it is damaged.
+//
+// The record is itself a container header without content: a copy of the header of the container
+// with one extra slot appended last, which wraps the root key under the recovery key.
+// The recovery key must be kept apart from the container, anyone holding it and the record can decrypt the content.
+// The record only reflects the slots at the time it was written, so write it again after changing the slots.
+
+// Algorithm of the slot holding the root key under the recovery key
+const recoverySlotAlgorithm = types.SlotKeyAlgAESGCM256
+
+var (
+	ErrRecoveryRecordInvalid = errors.New("the recovery record is malformed")
+)
+
+// Write the recovery record of this container into the sidecar file, the recovery key must be 32 bytes.
+// The container must be unsealed
+func (f *ContainerFile) WriteRecoveryRecord(sidecar string, recoveryKey []byte) error {
+	if len(f.rootKey) == 0 {
+		return ErrRootKeySealed
+	}
+	if err := ValidateKey(recoverySlotAlgorithm, recoveryKey); err != nil {
+		return err
+	}
+	if !f.hasActiveSlots() {
+		return ErrNoSlots
+	}
+	if f.isMultiVolume() {
+		return types.ErrUnsupportedFeature
+	}
+	slot, err := container_internal.NewContainerKeySlot(recoverySlotAlgorithm, 0, f.rootKey, recoveryKey)
+	if err != nil {
+		return err
+	}
+	record := *f.header
+	record.Slots = append(append(record.Slots[:0:0], f.header.Slots...), slot)
+	handle, err := os.OpenFile(sidecar, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	if err := container_internal.WriteContainerFileHeader(handle, &record); err != nil {
+		return err
+	}
+	return handle.Close()
+}
+
+// Rebuild the header of the main file from the recovery record in the sidecar file.
+// The content is authenticated with the recovered root key before anything is written,
+// so a record belonging to another container is refused without touching the main file
+func RecoverFromSidecar(main, sidecar string, recoveryKey []byte) error {
+	return RecoverFromSidecarWithApplicationID(main, sidecar, recoveryKey, nil)
+}
+
+// Same as RecoverFromSidecar for a container encrypted with an application ID, see SetApplicationID
+func RecoverFromSidecarWithApplicationID(main, sidecar string, recoveryKey, applicationID []byte) error {
+	if err := ValidateKey(recoverySlotAlgorithm, recoveryKey); err != nil {
+		return err
+	}
+	record, err := os.Open(sidecar)
+	if err != nil {
+		return err
+	}
+	defer record.Close()
+	header, err := container_internal.ParseContainerFileHeader(record)
+	if err != nil {
+		return err
+	}
+	// The recovery slot is always the last one and at least one slot of the container must precede it
+	if len(header.Slots) < 2 || header.Slots[len(header.Slots)-1].SlotKeyAlgorithm != recoverySlotAlgorithm {
+		return ErrRecoveryRecordInvalid
+	}
+	rootKey, err := header.Slots[len(header.Slots)-1].Unseal(recoveryKey)
+	if err != nil {
+		return ErrRootKeyUnsealFailed
+	}
+	defer ic.WipeBufferSecure(rootKey)
+	header.Slots = header.Slots[:len(header.Slots)-1]
+	// Serialize once so the length of a compact header is the one of the container, not of the record
+	if err := container_internal.WriteContainerFileHeader(io.Discard, header); err != nil {
+		return err
+	}
+	handle, err := os.OpenFile(main, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	f := &ContainerFile{
+		file:    newBackingStorage(handle),
+		header:  header,
+		rootKey: rootKey,
+	}
+	defer f.Close()
+	if err := f.SetApplicationID(applicationID); err != nil {
+		return err
+	}
+	if err := f.DecryptStream(io.Discard); err != nil {
+		return err
+	}
+	if err := f.WriteHeader(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
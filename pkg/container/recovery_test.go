@@ -0,0 +1,73 @@
+package container_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoverFromSidecar(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	for _, compact := range []bool{false, true} {
+		dir := t.TempDir()
+		name := filepath.Join(dir, "secret.crpt")
+		sidecar := name + ".recovery"
+		slotKey, err := ic.GenerateRandomBytes(16)
+		assert.NoError(t, err, "cannot generate slot key")
+		recoveryKey, err := ic.GenerateRandomBytes(32)
+		assert.NoError(t, err, "cannot generate recovery key")
+
+		encryptedContainer, err := container_pkg.NewContainerFile(name, types.EncAlgAESCTR128)
+		assert.NoError(t, err, "cannot create container")
+		if compact {
+			encryptedContainer.EnableCompactHeader()
+		}
+		err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot add slot")
+		err = encryptedContainer.WriteHeader()
+		assert.NoError(t, err, "cannot write out the headers")
+		err = encryptedContainer.EncryptStream(bytes.NewBufferString(plainText))
+		assert.NoError(t, err, "cannot encrypt the test string")
+		err = encryptedContainer.WriteRecoveryRecord(sidecar, recoveryKey[:16])
+		assert.ErrorIs(t, err, ic.ErrKeySizeInvalid)
+		err = encryptedContainer.WriteRecoveryRecord(sidecar, recoveryKey)
+		assert.NoError(t, err, "cannot write the recovery record")
+		encryptedContainer.Close()
+
+		// Wipe the start of the header
+		original, err := os.ReadFile(name)
+		assert.NoError(t, err, "cannot read the container")
+		damaged := bytes.Clone(original)
+		clear(damaged[:32])
+		err = os.WriteFile(name, damaged, 0600)
+		assert.NoError(t, err, "cannot damage the container")
+		_, err = container_pkg.OpenContainerFile(name)
+		assert.ErrorIs(t, err, types.ErrInvalidFileHeader)
+
+		wrongKey, err := ic.GenerateRandomBytes(32)
+		assert.NoError(t, err, "cannot generate recovery key")
+		err = container_pkg.RecoverFromSidecar(name, sidecar, wrongKey)
+		assert.ErrorIs(t, err, container_pkg.ErrRootKeyUnsealFailed)
+		err = container_pkg.RecoverFromSidecar(name, sidecar, recoveryKey)
+		assert.NoError(t, err, "cannot recover the container")
+		recovered, err := os.ReadFile(name)
+		assert.NoError(t, err, "cannot read the container")
+		assert.Equal(t, len(original), len(recovered))
+
+		encryptedContainer, err = container_pkg.OpenContainerFile(name)
+		assert.NoError(t, err, "cannot open the recovered container")
+		err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot unseal the recovered container")
+		buf := bytes.NewBuffer(nil)
+		err = encryptedContainer.DecryptStream(buf)
+		assert.NoError(t, err, "cannot decrypt the recovered container")
+		assert.Equal(t, plainText, buf.String())
+		encryptedContainer.Close()
+	}
+}
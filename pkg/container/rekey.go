@@ -0,0 +1,236 @@
+package container
+
+import (
+	"crypto/subtle"
+	"errors"
+	"maps"
+	"path/filepath"
+	"slices"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_internal "github.com/ngeojiajun/go-filecrypt/internal/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/rekey.go
+// This file contains the rotation of the root key, e.g. when a slot key is suspected compromised,
+// and the change of the key of a single slot.
+//
+// Removing a slot does not help once the root key itself may have leaked, since the old slot could have been used
+// to unwrap it already. Rekey generates a fresh root key, rewraps the slots whose credential is given
+// and encrypts the content again under the new key into a new file replacing the old one.
+//
+// Only the slots wrapping the root key under a key or a password can be rewrapped, as the others need a device,
+// a KMS or a private key. The slots without a credential are dropped.
+//
+// Changing the key of a slot keeps the root key and the content, only the slot is replaced in the header
+// at the same index, so the other slots keep their indices.
+
+var (
+	ErrRekeyCredentialInvalid = errors.New("the credential does not unseal its slot")
+)
+
+// Rotate the root key. The credentials map the index of the slots to keep to their key or password,
+// every other slot is removed. The container under the new root key is written to a temp file next to the original
+// and renamed over it once complete, so the file holds either the old or the new container. The old content is
+// authenticated on the way and nothing is replaced when it fails.
+// The container must be unsealed and live in a file of its own, multi-volume containers are not supported
+func (f *ContainerFile) Rekey(credentials map[int][]byte) error {
+	if len(f.rootKey) == 0 {
+		return ErrRootKeySealed
+	}
+	if f.file == nil {
+		return ErrContainerReadOnly
+	}
+	if f.isMultiVolume() {
+		return types.ErrUnsupportedFeature
+	}
+	original, ok := storageFile(f.file)
+	if !ok {
+		return types.ErrUnsupportedFeature
+	}
+	metadata, err := f.GetMetadata()
+	if err != nil && err != ErrNoMetadata {
+		return err
+	}
+	rootKey, err := ic.GenerateRandomBytes(rootKeySize)
+	if err != nil {
+		return err
+	}
+	rekeyed, cleanup, err := f.newRekeyedContainer(original.Name(), credentials, rootKey, metadata)
+	if err != nil {
+		ic.WipeBufferSecure(rootKey)
+		return err
+	}
+	defer cleanup()
+	if err := f.reencryptInto(rekeyed); err != nil {
+		ic.WipeBufferSecure(rootKey)
+		return err
+	}
+	temp, _ := storageFile(rekeyed.file)
+	if err := f.replaceWithTemp(temp, original); err != nil {
+		ic.WipeBufferSecure(rootKey)
+		return err
+	}
+	// The file now holds the new container, continue with its header and root key
+	previous := f.header
+	f.header = rekeyed.header
+	ic.WipeBufferSecure(f.rootKey)
+	f.rootKey = rootKey
+	for _, slot := range previous.Slots {
+		slot.Destroy()
+	}
+	return nil
+}
+
+// Create the container under the new root key in a temp file next to the original, with its header written.
+// It takes the options of this container, the rewrapped slots and the metadata sealed again
+func (f *ContainerFile) newRekeyedContainer(name string, credentials map[int][]byte, rootKey []byte, metadata *types.FileMetadata) (*ContainerFile, func(), error) {
+	slots, err := f.rewrapSlots(credentials, rootKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	temp, cleanup, err := createSecureTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return nil, nil, err
+	}
+	header := *f.header
+	header.Slots = slots
+	header.Metadata = nil
+	header.Flags &^= types.HeaderFlagMetadata
+	rekeyed := newContainerFile(temp, header.Algorithm, rootKey)
+	rekeyed.header = &header
+	rekeyed.deterministicIV = f.deterministicIV
+	rekeyed.ivStrategy = f.ivStrategy
+	rekeyed.applicationID = f.applicationID
+	rekeyed.metricsSink = f.metricsSink
+	rekeyed.workers = f.workers
+	if metadata != nil {
+		if err := rekeyed.SetMetadata(metadata); err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+	}
+	if err := rekeyed.WriteHeader(); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return rekeyed, cleanup, nil
+}
+
+// Replace the key or password of the slot at the index, the root key is unwrapped from the slot with the old key.
+// The slot keeps its algorithm, its cost and its index, and the header is rewritten in place.
+// When the container is sealed, it is left unsealed with the root key of the slot.
+// The container must be opened for update
+func (f *ContainerFile) ChangeSlotKey(index int, oldKey, newKey []byte) error {
+	if index < 0 || index >= len(f.header.Slots) || f.header.Slots[index].Flags&container_internal.FlagSlotDestroyed != 0 {
+		return ErrSlotIndexInvalid
+	}
+	if len(newKey) == 0 {
+		return types.ErrParameterMissing
+	}
+	slot := f.header.Slots[index]
+	if slot.SlotKeyAlgorithm < types.SlotKeyAlgEnd && slot.SlotKeyAlgorithm.KeySize() != 0 {
+		if err := ValidateKey(slot.SlotKeyAlgorithm, newKey); err != nil {
+			return err
+		}
+		if rootKey, other := f.findMatchingSlot(slot.SlotKeyAlgorithm, newKey); other != -1 {
+			ic.WipeBufferSecure(rootKey)
+			return ErrSlotDuplicated
+		}
+	}
+	rootKey, err := slot.Unseal(oldKey)
+	if err != nil {
+		return ErrRootKeyUnsealFailed
+	}
+	if len(f.rootKey) != 0 {
+		equal := subtle.ConstantTimeCompare(rootKey, f.rootKey) == 1
+		ic.WipeBufferSecure(rootKey)
+		if !equal {
+			return ErrRootKeyUnsealFailed
+		}
+	} else if err := f.acceptRootKey(rootKey); err != nil {
+		return err
+	}
+	rewrapped, err := rewrapSlot(slot, newKey, f.rootKey)
+	if err != nil {
+		return err
+	}
+	if err := container_internal.CheckSlotNonceUnique(f.header.Slots, rewrapped); err != nil {
+		return err
+	}
+	f.header.Slots[index] = rewrapped
+	if err := f.UpdateHeader(); err != nil {
+		f.header.Slots[index] = slot
+		return err
+	}
+	slot.Destroy()
+	return nil
+}
+
+// Wrap the new root key into a slot of the same kind for every slot with a credential,
+// after checking the credential unseals the current root key from its slot. The slots keep their order
+func (f *ContainerFile) rewrapSlots(credentials map[int][]byte, rootKey []byte) ([]*container_internal.ContainerKeySlot, error) {
+	slots := make([]*container_internal.ContainerKeySlot, 0, len(credentials))
+	for _, index := range slices.Sorted(maps.Keys(credentials)) {
+		if index < 0 || index >= len(f.header.Slots) || f.header.Slots[index].Flags&container_internal.FlagSlotDestroyed != 0 {
+			return nil, ErrSlotIndexInvalid
+		}
+		slot, credential := f.header.Slots[index], credentials[index]
+		unsealed, err := slot.Unseal(credential)
+		if err != nil || subtle.ConstantTimeCompare(unsealed, f.rootKey) != 1 {
+			ic.WipeBufferSecure(unsealed)
+			return nil, ErrRekeyCredentialInvalid
+		}
+		ic.WipeBufferSecure(unsealed)
+		rewrapped, err := rewrapSlot(slot, credential, rootKey)
+		if err != nil {
+			return nil, err
+		}
+		slots = append(slots, rewrapped)
+	}
+	if len(slots) == 0 {
+		return nil, ErrNoSlots
+	}
+	return slots, nil
+}
+
+// Create the slot of the same kind and cost as the existing one wrapping the new root key
+func rewrapSlot(slot *container_internal.ContainerKeySlot, credential, rootKey []byte) (*container_internal.ContainerKeySlot, error) {
+	switch slot.SlotKeyAlgorithm {
+	case types.SlotKeyAlgAESGCM128, types.SlotKeyAlgAESGCM256, types.SlotKeyAlgAESGCMSIV256:
+		return container_internal.NewContainerKeySlot(slot.SlotKeyAlgorithm, slot.Flags, rootKey, credential)
+	case types.SlotKeyAlgArgon2id:
+		params, _, err := slot.PasswordParams()
+		if err != nil {
+			return nil, err
+		}
+		salt, err := ic.GenerateRandomBytes(passwordSaltSize)
+		if err != nil {
+			return nil, err
+		}
+		return container_internal.NewContainerPasswordSlot(slot.Flags, rootKey, credential, salt, params)
+	case types.SlotKeyAlgScrypt:
+		params, _, err := slot.ScryptParams()
+		if err != nil {
+			return nil, err
+		}
+		salt, err := ic.GenerateRandomBytes(passwordSaltSize)
+		if err != nil {
+			return nil, err
+		}
+		return container_internal.NewContainerScryptSlot(slot.Flags, rootKey, credential, salt, params)
+	case types.SlotKeyAlgPBKDF2SHA256:
+		params, _, err := slot.PBKDF2Params()
+		if err != nil {
+			return nil, err
+		}
+		salt, err := ic.GenerateRandomBytes(passwordSaltSize)
+		if err != nil {
+			return nil, err
+		}
+		return container_internal.NewContainerPBKDF2Slot(slot.Flags, rootKey, credential, salt, params)
+	default:
+		return nil, types.ErrUnsupportedFeature
+	}
+}
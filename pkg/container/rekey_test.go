@@ -0,0 +1,145 @@
+package container_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRekey(t *testing.T) {
+	layouts := map[string]func(*container_pkg.ContainerFile){
+		"padded":          nil,
+		"compact":         (*container_pkg.ContainerFile).EnableCompactHeader,
+		"double-buffered": (*container_pkg.ContainerFile).EnableDoubleBufferedHeader,
+		"header-bound":    (*container_pkg.ContainerFile).EnableHeaderBoundKeys,
+		"authenticated":   (*container_pkg.ContainerFile).EnableAuthenticatedHeader,
+	}
+	for layout, options := range layouts {
+		plainText, err := ic.GenerateRandomBytes(50000)
+		assert.NoError(t, err, "cannot generate the payload")
+		oldRootKey, err := ic.GenerateRandomBytes(32)
+		assert.NoError(t, err, "cannot generate the root key")
+		slotKey, err := ic.GenerateRandomBytes(16)
+		assert.NoError(t, err, "cannot generate the slot key")
+		compromisedKey, err := ic.GenerateRandomBytes(16)
+		assert.NoError(t, err, "cannot generate the slot key")
+		password := []byte("correct horse")
+
+		file, err := os.CreateTemp("", "filecrypt-ci-")
+		assert.NoError(t, err, "cannot create temp file")
+		t.Cleanup(func() { os.Remove(file.Name()) })
+		encryptedContainer, err := container_pkg.NewContainerFileWithRootKey(file, types.EncAlgAESCTR256, oldRootKey)
+		assert.NoError(t, err, "cannot create the container")
+		if options != nil {
+			options(encryptedContainer)
+		}
+		assert.NoError(t, encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey))
+		assert.NoError(t, encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, compromisedKey))
+		assert.NoError(t, encryptedContainer.AddPBKDF2PasswordSlot(password, types.PBKDF2Params{Iterations: 1000}))
+		assert.NoError(t, encryptedContainer.SetMetadata(&types.FileMetadata{Name: "secret.txt"}))
+		assert.NoError(t, encryptedContainer.WriteHeader(), "cannot write out the headers")
+		assert.NoError(t, encryptedContainer.EncryptStream(bytes.NewReader(plainText)), "cannot encrypt the data")
+		assert.NoError(t, encryptedContainer.Close())
+
+		encryptedContainer, err = container_pkg.OpenContainerFileForUpdate(file.Name())
+		assert.NoError(t, err, "cannot open the container")
+		assert.ErrorIs(t, encryptedContainer.Rekey(map[int][]byte{0: slotKey}), container_pkg.ErrRootKeySealed)
+		assert.NoError(t, encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey))
+		assert.ErrorIs(t, encryptedContainer.Rekey(nil), container_pkg.ErrNoSlots)
+		assert.ErrorIs(t, encryptedContainer.Rekey(map[int][]byte{3: slotKey}), container_pkg.ErrSlotIndexInvalid)
+		assert.ErrorIs(t, encryptedContainer.Rekey(map[int][]byte{0: compromisedKey}), container_pkg.ErrRekeyCredentialInvalid)
+		// The compromised slot is dropped
+		err = encryptedContainer.Rekey(map[int][]byte{0: slotKey, 2: password})
+		assert.NoError(t, err, "cannot rotate the root key of the %s container", layout)
+		assert.NoError(t, encryptedContainer.Close())
+
+		decrypted, err := decryptWithFreshHandle(t, file.Name(), slotKey)
+		assert.NoError(t, err, "cannot decrypt the %s container", layout)
+		assert.Equal(t, plainText, decrypted)
+
+		encryptedContainer, err = container_pkg.OpenContainerFile(file.Name())
+		assert.NoError(t, err, "cannot open the container")
+		assert.Len(t, encryptedContainer.GetSlots(), 2)
+		assert.Error(t, encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, compromisedKey))
+		assert.NoError(t, encryptedContainer.UnsealWithPassword(password), "the password slot should be kept")
+		metadata, err := encryptedContainer.GetMetadata()
+		assert.NoError(t, err, "the metadata should follow the new root key")
+		assert.Equal(t, "secret.txt", metadata.Name)
+		assert.NoError(t, encryptedContainer.Close())
+
+		// The leaked root key no longer decrypts the content
+		encryptedContainer, err = container_pkg.OpenContainerFile(file.Name())
+		assert.NoError(t, err, "cannot open the container")
+		if err := encryptedContainer.UnsealWithRootKey(oldRootKey); err == nil {
+			assert.Error(t, encryptedContainer.Verify(), "the old root key must not authenticate the content")
+		}
+		assert.NoError(t, encryptedContainer.Close())
+	}
+}
+
+// The content is authenticated before the file is touched
+func TestRekeyTampered(t *testing.T) {
+	plainText := []byte("tampered before the rotation")
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR256, plainText)
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	data[len(data)-40] ^= 0x01
+	assert.NoError(t, os.WriteFile(name, data, 0600), "cannot tamper the container")
+
+	encryptedContainer, err := container_pkg.OpenContainerFileForUpdate(name)
+	assert.NoError(t, err, "cannot open the container")
+	assert.NoError(t, encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey))
+	assert.ErrorIs(t, encryptedContainer.Rekey(map[int][]byte{0: slotKey}), ic.ErrAuthenticationFailed)
+	assert.NoError(t, encryptedContainer.Close())
+	unchanged, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	assert.Equal(t, data, unchanged)
+}
+
+func TestChangeSlotKey(t *testing.T) {
+	skipUnlessSlotAlgorithm(t, types.SlotKeyAlgArgon2id)
+	plainText := []byte("change the key of a slot")
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR256, plainText)
+	otherKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate the slot key")
+	newKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate the slot key")
+
+	encryptedContainer, err := container_pkg.OpenContainerFileForUpdate(name)
+	assert.NoError(t, err, "cannot open the container")
+	assert.NoError(t, encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey))
+	assert.NoError(t, encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, otherKey))
+	assert.NoError(t, encryptedContainer.AddPasswordSlotWithParams([]byte("old password"), types.PasswordParams{Time: 1, Memory: 64, Threads: 1}))
+	assert.NoError(t, encryptedContainer.UpdateHeader(), "cannot update the header")
+	assert.NoError(t, encryptedContainer.Close())
+
+	// The container does not need to be unsealed first
+	encryptedContainer, err = container_pkg.OpenContainerFileForUpdate(name)
+	assert.NoError(t, err, "cannot open the container")
+	assert.ErrorIs(t, encryptedContainer.ChangeSlotKey(3, slotKey, newKey), container_pkg.ErrSlotIndexInvalid)
+	assert.ErrorIs(t, encryptedContainer.ChangeSlotKey(0, slotKey, make([]byte, 32)), ic.ErrKeySizeInvalid)
+	assert.ErrorIs(t, encryptedContainer.ChangeSlotKey(0, slotKey, otherKey), container_pkg.ErrSlotDuplicated)
+	assert.ErrorIs(t, encryptedContainer.ChangeSlotKey(0, otherKey, newKey), container_pkg.ErrRootKeyUnsealFailed)
+	assert.NoError(t, encryptedContainer.ChangeSlotKey(0, slotKey, newKey), "cannot change the key of the slot")
+	assert.NoError(t, encryptedContainer.ChangeSlotKey(2, []byte("old password"), []byte("new password")), "cannot change the password")
+	assert.NoError(t, encryptedContainer.Close())
+
+	decrypted, err := decryptWithFreshHandle(t, name, newKey)
+	assert.NoError(t, err, "cannot decrypt with the new key")
+	assert.Equal(t, plainText, decrypted)
+	encryptedContainer, err = container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	slots := encryptedContainer.GetSlots()
+	assert.Len(t, slots, 3)
+	assert.Equal(t, types.SlotKeyAlgAESGCM128, slots[0].Alg, "the slot keeps its index")
+	assert.Equal(t, types.SlotKeyAlgArgon2id, slots[2].Alg, "the slot keeps its index")
+	assert.ErrorIs(t, encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey), container_pkg.ErrRootKeyUnsealFailed)
+	assert.Error(t, encryptedContainer.UnsealWithPassword([]byte("old password")))
+	assert.NoError(t, encryptedContainer.UnsealWithPassword([]byte("new password")))
+}
@@ -0,0 +1,152 @@
+package container
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/rolling.go
+// This file contains the writer rolling over to a new container once the current one reaches a size, e.g. for log archival.
+//
+// Unlike the volumes, every file produced is a standalone container with its own salt, iv and tag,
+// so each of them can be opened and decrypted alone. They share the root key and the slots of the template.
+
+var (
+	ErrRollingSizeTooSmall = errors.New("the maximum size cannot hold the header and the content overhead")
+	ErrRollingClosed       = errors.New("the rolling writer is already closed")
+)
+
+// Writer encrypting into prefix.0.crpt, prefix.1.crpt, ... each holding at most the configured number of bytes
+type RollingContainerWriter struct {
+	template  *ContainerFile
+	prefix    string
+	maxSize   int64
+	files     []string
+	current   *ContainerFile
+	pipe      *io.PipeWriter
+	done      chan error
+	remaining int64 // plaintext bytes the current file can still hold
+	closed    bool
+}
+
+// Create a writer rolling over to a new container whenever the current one would exceed maxSize bytes.
+// Every container uses the algorithm, the options and the slots of this container, which must be unsealed.
+// Chunked, archive, multi-volume and checksummed containers cannot be used as template.
+// Close must be called to complete the last container
+func (f *ContainerFile) NewRollingWriter(prefix string, maxSize int64) (*RollingContainerWriter, error) {
+	if len(f.rootKey) == 0 {
+		return nil, ErrRootKeySealed
+	}
+	if !f.hasActiveSlots() {
+		return nil, ErrNoSlots
+	}
+	if f.isChunked() || f.isArchive() || f.isMultiVolume() || f.hasChecksumTrailer() {
+		return nil, types.ErrUnsupportedFeature
+	}
+	return &RollingContainerWriter{
+		template: f,
+		prefix:   prefix,
+		maxSize:  maxSize,
+	}, nil
+}
+
+// Names of the containers produced so far in order
+func (w *RollingContainerWriter) Files() []string {
+	return append([]string(nil), w.files...)
+}
+
+// Create the next container and start encrypting into it
+func (w *RollingContainerWriter) open() error {
+	name := fmt.Sprintf("%s.%d.crpt", w.prefix, len(w.files))
+	handle, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	w.files = append(w.files, name)
+	header := *w.template.header
+	header.Slots = append(header.Slots[:0:0], w.template.header.Slots...)
+	current := newContainerFile(handle, header.Algorithm, bytes.Clone(w.template.rootKey))
+	current.header = &header
+	current.deterministicIV = w.template.deterministicIV
+	current.ivStrategy = w.template.ivStrategy
+	current.applicationID = w.template.applicationID
+	current.metricsSink = w.template.metricsSink
+	current.workers = w.template.workers
+	if err := current.WriteHeader(); err != nil {
+		current.Close()
+		return err
+	}
+	w.remaining = w.maxSize - contentOverhead(current.contentOffset(), current.contentSaltSize())
+	if w.remaining <= 0 {
+		current.Close()
+		return ErrRollingSizeTooSmall
+	}
+	pipeReader, pipeWriter := io.Pipe()
+	w.current, w.pipe, w.done = current, pipeWriter, make(chan error, 1)
+	go func() {
+		err := current.EncryptStream(pipeReader)
+		// Unblock the writer if the encryption stopped early
+		pipeReader.CloseWithError(err)
+		w.done <- err
+	}()
+	return nil
+}
+
+// Complete the current container
+func (w *RollingContainerWriter) finish() error {
+	w.pipe.Close()
+	err := <-w.done
+	if closeErr := w.current.Close(); err == nil {
+		err = closeErr
+	}
+	w.current, w.pipe, w.done = nil, nil, nil
+	return err
+}
+
+func (w *RollingContainerWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, ErrRollingClosed
+	}
+	written := 0
+	for written < len(p) {
+		if w.current != nil && w.remaining == 0 {
+			if err := w.finish(); err != nil {
+				return written, err
+			}
+		}
+		if w.current == nil {
+			if err := w.open(); err != nil {
+				return written, err
+			}
+		}
+		n, err := w.pipe.Write(p[written:min(int64(len(p)), int64(written)+w.remaining)])
+		written += n
+		w.remaining -= int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Complete the last container, at least one container is always produced
+func (w *RollingContainerWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.current == nil && len(w.files) == 0 {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+	if w.current == nil {
+		return nil
+	}
+	return w.finish()
+}
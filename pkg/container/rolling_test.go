@@ -0,0 +1,68 @@
+package container_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollingWriter(t *testing.T) {
+	const partSize = 1000
+	// Header, salt, iv and tag of every file
+	const maxSize = 4096 + 32 + 16 + 32 + partSize
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR256, []byte("Some secrets is here!"))
+	template, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer template.Close()
+	_, err = template.NewRollingWriter(filepath.Join(t.TempDir(), "log"), maxSize)
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeySealed)
+	err = template.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the container")
+
+	writer, err := template.NewRollingWriter(filepath.Join(t.TempDir(), "log"), 4096)
+	assert.NoError(t, err, "cannot create the rolling writer")
+	_, err = writer.Write([]byte("x"))
+	assert.ErrorIs(t, err, container_pkg.ErrRollingSizeTooSmall)
+
+	prefix := filepath.Join(t.TempDir(), "log")
+	writer, err = template.NewRollingWriter(prefix, maxSize)
+	assert.NoError(t, err, "cannot create the rolling writer")
+	plainText, err := ic.GenerateRandomBytes(2*partSize + 500)
+	assert.NoError(t, err, "cannot generate the payload")
+	// Write in pieces not aligned with the rollover threshold
+	for piece := range slices.Chunk(plainText, 300) {
+		n, err := writer.Write(piece)
+		assert.NoError(t, err, "cannot write into the rolling writer")
+		assert.Equal(t, len(piece), n)
+	}
+	err = writer.Close()
+	assert.NoError(t, err, "cannot close the rolling writer")
+	_, err = writer.Write([]byte("x"))
+	assert.ErrorIs(t, err, container_pkg.ErrRollingClosed)
+
+	files := writer.Files()
+	assert.Equal(t, []string{prefix + ".0.crpt", prefix + ".1.crpt", prefix + ".2.crpt"}, files)
+	for i, file := range files {
+		info, err := os.Stat(file)
+		assert.NoError(t, err, "cannot stat the file")
+		assert.LessOrEqual(t, info.Size(), int64(maxSize))
+
+		// Every file decrypts alone
+		part, err := container_pkg.OpenContainerFile(file)
+		assert.NoError(t, err, "cannot open the rolled container")
+		err = part.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot unseal the rolled container")
+		buf := bytes.NewBuffer(nil)
+		err = part.DecryptStream(buf)
+		assert.NoError(t, err, "cannot decrypt the rolled container")
+		assert.Equal(t, plainText[i*partSize:min((i+1)*partSize, len(plainText))], buf.Bytes())
+		part.Close()
+	}
+}
@@ -0,0 +1,136 @@
+package container
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_internal "github.com/ngeojiajun/go-filecrypt/internal/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/root_key_cache.go
+// This file contains the opt-in cache of unsealed root keys, so repeated opens of the same file skip the slot unwrap.
+//
+// The cache holds root keys in memory until they expire or are evicted, only use it when that exposure is acceptable.
+// Every buffer is wiped when it leaves the cache.
+
+// RootKeyCache is a LRU cache of unsealed root keys with a TTL, it is safe for concurrent use
+type RootKeyCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	now      func() time.Time
+	entries  map[string]*list.Element
+	order    *list.List // most recently used first
+}
+
+// Entry of the cache
+type rootKeyCacheEntry struct {
+	fingerprint string
+	rootKey     []byte
+	expires     time.Time
+}
+
+// Create a cache holding up to capacity root keys, each for at most ttl after it was added
+func NewRootKeyCache(capacity int, ttl time.Duration) *RootKeyCache {
+	return &RootKeyCache{
+		capacity: max(capacity, 1),
+		ttl:      ttl,
+		now:      time.Now,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get a copy of the cached root key, nil if missing or expired
+func (c *RootKeyCache) get(fingerprint string) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[fingerprint]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(*rootKeyCacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.remove(element)
+		return nil
+	}
+	c.order.MoveToFront(element)
+	return bytes.Clone(entry.rootKey)
+}
+
+// Add a copy of the root key, evicting the least recently used entry when full
+func (c *RootKeyCache) put(fingerprint string, rootKey []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[fingerprint]; ok {
+		c.remove(element)
+	}
+	for c.order.Len() >= c.capacity {
+		c.remove(c.order.Back())
+	}
+	c.entries[fingerprint] = c.order.PushFront(&rootKeyCacheEntry{
+		fingerprint: fingerprint,
+		rootKey:     bytes.Clone(rootKey),
+		expires:     c.now().Add(c.ttl),
+	})
+}
+
+// Drop the entry and wipe its root key, the lock must be held
+func (c *RootKeyCache) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*rootKeyCacheEntry)
+	delete(c.entries, entry.fingerprint)
+	ic.WipeBufferSecure(entry.rootKey)
+}
+
+// Drop and wipe every cached root key
+func (c *RootKeyCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.order.Len() > 0 {
+		c.remove(c.order.Back())
+	}
+}
+
+// Fingerprint of the slots of the container keyed by the slot key.
+// A hit therefore requires both the same slots and the same key which unsealed them before
+func (f *ContainerFile) slotFingerprint(alg types.SlotKeyAlgorithm, slotKey []byte) string {
+	h := hmac.New(sha256.New, slotKey)
+	binary.Write(h, binary.BigEndian, uint16(alg))
+	for _, slot := range f.header.Slots {
+		if slot.Flags&container_internal.FlagSlotDestroyed != 0 {
+			continue
+		}
+		binary.Write(h, binary.BigEndian, uint16(slot.SlotKeyAlgorithm))
+		binary.Write(h, binary.BigEndian, slot.Flags)
+		binary.Write(h, binary.BigEndian, slot.Size)
+		h.Write(slot.SlotContent)
+	}
+	return string(h.Sum(nil))
+}
+
+// Same as Unseal but the root key is looked up in the cache first and added to it once unsealed.
+// A nil cache behaves as Unseal
+func (f *ContainerFile) UnsealCached(cache *RootKeyCache, alg types.SlotKeyAlgorithm, slotKey []byte) error {
+	if cache == nil || len(f.rootKey) != 0 || ValidateKey(alg, slotKey) != nil {
+		// Let Unseal report the error
+		return f.Unseal(alg, slotKey)
+	}
+	fingerprint := f.slotFingerprint(alg, slotKey)
+	if rootKey := cache.get(fingerprint); rootKey != nil {
+		f.metrics().Inc(MetricRootKeyCacheHits)
+		return f.acceptRootKey(rootKey)
+	}
+	f.metrics().Inc(MetricRootKeyCacheMisses)
+	if err := f.Unseal(alg, slotKey); err != nil {
+		return err
+	}
+	cache.put(fingerprint, f.rootKey)
+	return nil
+}
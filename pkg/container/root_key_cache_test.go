@@ -0,0 +1,96 @@
+package container
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingSink map[string]int64
+
+func (s countingSink) Inc(name string) {
+	s[name]++
+}
+
+func (s countingSink) Add(name string, delta int64) {
+	s[name] += delta
+}
+
+func TestUnsealCached(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	encryptedContainer, err := NewContainerFileWithHandle(file, types.EncAlgAESCTR128)
+	assert.NoError(t, err, "cannot create container")
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewBufferString(plainText))
+	assert.NoError(t, err, "cannot encrypt the test string")
+	encryptedContainer.Close()
+
+	cache := NewRootKeyCache(4, time.Minute)
+	open := func(key []byte) (*ContainerFile, countingSink, error) {
+		sink := countingSink{}
+		encryptedContainer, err := OpenContainerFile(file.Name())
+		assert.NoError(t, err, "cannot open the container")
+		t.Cleanup(func() { encryptedContainer.Close() })
+		encryptedContainer.SetMetricsSink(sink)
+		return encryptedContainer, sink, encryptedContainer.UnsealCached(cache, types.SlotKeyAlgAESGCM128, key)
+	}
+	_, sink, err := open(slotKey)
+	assert.NoError(t, err, "cannot unseal the container")
+	assert.Equal(t, int64(1), sink[MetricRootKeyCacheMisses])
+
+	// The slot must not be unwrapped again
+	encryptedContainer, sink, err = open(slotKey)
+	assert.NoError(t, err, "cannot unseal the container")
+	assert.Equal(t, int64(1), sink[MetricRootKeyCacheHits])
+	assert.Zero(t, sink[MetricRootKeyCacheMisses])
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, plainText, buf.String())
+
+	// The cache must not let a wrong key through
+	wrongKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	_, sink, err = open(wrongKey)
+	assert.ErrorIs(t, err, ErrRootKeyUnsealFailed)
+	assert.Zero(t, sink[MetricRootKeyCacheHits])
+}
+
+func TestRootKeyCacheEviction(t *testing.T) {
+	now := time.Now()
+	cache := NewRootKeyCache(2, time.Minute)
+	cache.now = func() time.Time { return now }
+	cache.put("a", []byte{1, 2, 3})
+	cache.put("b", []byte{4, 5, 6})
+	stored := cache.entries["a"].Value.(*rootKeyCacheEntry).rootKey
+
+	// The least recently used entry is evicted and wiped
+	assert.Equal(t, []byte{4, 5, 6}, cache.get("b"))
+	cache.put("c", []byte{7, 8, 9})
+	assert.Nil(t, cache.get("a"))
+	assert.Equal(t, []byte{0, 0, 0}, stored)
+
+	// Expired entries are dropped and wiped too
+	stored = cache.entries["b"].Value.(*rootKeyCacheEntry).rootKey
+	now = now.Add(time.Minute)
+	assert.Nil(t, cache.get("b"))
+	assert.Equal(t, []byte{0, 0, 0}, stored)
+
+	stored = cache.entries["c"].Value.(*rootKeyCacheEntry).rootKey
+	cache.Purge()
+	assert.Nil(t, cache.get("c"))
+	assert.Equal(t, []byte{0, 0, 0}, stored)
+}
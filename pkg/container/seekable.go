@@ -0,0 +1,216 @@
+package container
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/seekable.go
+// This file contains the seekable counterpart of AsDecryptionStream, e.g. for serving range requests of a video.
+//
+// The content keys are derived once when the stream is created. Every read positions the CTR counter at the
+// requested offset, or decrypts only the chunks overlapping it when the content is chunked.
+// DecryptRange reads through a stream of its own too, so this is the only random access path over the content.
+// The same caveat as DecryptRange applies: the unchunked content is not authenticated by these reads.
+
+var (
+	ErrInvalidWhence          = errors.New("invalid whence for seeking the decryption stream")
+	ErrDecryptionStreamClosed = errors.New("the decryption stream is already closed")
+)
+
+// SeekableDecryptionStream is a io.ReadSeekCloser and io.ReaderAt over the plaintext of a container.
+// ReadAt is safe for concurrent use, also with Close. Read and Seek share a position and are not
+type SeekableDecryptionStream struct {
+	f        *ContainerFile
+	iv       []byte
+	chunks   []types.ChunkRef
+	size     int64
+	position int64
+
+	// Held for reading while the keys are used, Close holds it for writing to wipe them
+	keysMu sync.RWMutex
+	keys   [][]byte
+
+	// Last chunk decrypted, sequential reads smaller than a chunk decrypt it once
+	mu         sync.Mutex
+	chunkIndex int
+	chunkPlain []byte
+}
+
+// Create a seekable stream over the whole plaintext, the container must be unsealed and backed by a seekable file.
+// The multi-volume content and the sequential sources return ErrUnsupportedFeature.
+// Closing the stream closes the container, like AsDecryptionStream.
+//
+// Note that the bytes read are not authenticated unless the content is chunked, see DecryptRange
+func (f *ContainerFile) AsSeekableDecryptionStream() (*SeekableDecryptionStream, error) {
+	if len(f.rootKey) == 0 {
+		return nil, ErrRootKeySealed
+	}
+	if f.file == nil || f.isMultiVolume() {
+		return nil, types.ErrUnsupportedFeature
+	}
+	size, err := f.EstimateContentSize()
+	if err != nil {
+		return nil, err
+	}
+	return f.newSeekableDecryptionStream(size)
+}
+
+// Create the stream over the plaintext of the given size, deriving the content keys
+func (f *ContainerFile) newSeekableDecryptionStream(size int64) (*SeekableDecryptionStream, error) {
+	s := &SeekableDecryptionStream{f: f, size: size, chunkIndex: -1}
+	var err error
+	if f.isChunked() {
+		if s.chunks, err = f.ChunkMap(); err != nil {
+			return nil, err
+		}
+		salt, err := f.readChunkSalt()
+		if err != nil {
+			return nil, err
+		}
+		if s.keys, err = f.chunkKeys(salt); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	salt, iv, err := f.readContentPrefix()
+	if err != nil {
+		return nil, err
+	}
+	if s.keys, err = f.deriveContentKeys(salt, []int{f.header.Algorithm.KeySize()}); err != nil {
+		return nil, err
+	}
+	s.iv = iv
+	return s, nil
+}
+
+// Size of the plaintext
+func (s *SeekableDecryptionStream) Size() int64 {
+	return s.size
+}
+
+func (s *SeekableDecryptionStream) Read(p []byte) (int, error) {
+	n, err := s.ReadAt(p, s.position)
+	s.position += int64(n)
+	if err == io.EOF && n > 0 {
+		// Report the end on the next read like a sequential reader
+		err = nil
+	}
+	return n, err
+}
+
+func (s *SeekableDecryptionStream) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.position
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, ErrInvalidWhence
+	}
+	if offset < 0 {
+		return 0, ErrRangeOutOfBounds
+	}
+	s.position = offset
+	return offset, nil
+}
+
+func (s *SeekableDecryptionStream) ReadAt(p []byte, off int64) (int, error) {
+	s.keysMu.RLock()
+	defer s.keysMu.RUnlock()
+	if s.keys == nil {
+		return 0, ErrDecryptionStreamClosed
+	}
+	if off < 0 {
+		return 0, ErrRangeOutOfBounds
+	}
+	if off >= s.size {
+		return 0, io.EOF
+	}
+	n := min(int64(len(p)), s.size-off)
+	var err error
+	if s.chunks != nil {
+		err = s.readChunksAt(p[:n], off)
+	} else {
+		err = s.readCTRAt(p[:n], off)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if n < int64(len(p)) {
+		return int(n), io.EOF
+	}
+	return int(n), nil
+}
+
+// Decrypt the ciphertext under p with the CTR counter positioned at the offset
+func (s *SeekableDecryptionStream) readCTRAt(p []byte, off int64) error {
+	ciphertextStart := s.f.contentOffset() + int64(s.f.contentSaltSize()) + contentIVSize + off
+	section := io.NewSectionReader(s.f.file, ciphertextStart, int64(len(p)))
+	reader, err := ic.NewAESCTRStreamReaderAt(section, s.keys[0], s.iv, off, nil)
+	if err != nil {
+		return err
+	}
+	_, err = io.ReadFull(reader, p)
+	return err
+}
+
+// Fill p from the chunks overlapping [off, off+len(p)), every chunk is verified
+func (s *SeekableDecryptionStream) readChunksAt(p []byte, off int64) error {
+	for len(p) > 0 {
+		index := int(off / ContentChunkSize)
+		if index >= len(s.chunks) {
+			return ErrChunkLayoutCorrupted
+		}
+		n, err := s.copyChunk(p, index, off-s.chunks[index].Offset)
+		if err != nil {
+			return err
+		}
+		p, off = p[n:], off+int64(n)
+	}
+	return nil
+}
+
+// Copy the plaintext of a chunk from the offset within it, reusing the last chunk decrypted when it matches
+func (s *SeekableDecryptionStream) copyChunk(p []byte, index int, from int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.chunkIndex != index {
+		plaintext, err := s.f.readChunk(s.keys, s.chunks[index], index == len(s.chunks)-1)
+		if err != nil {
+			return 0, err
+		}
+		ic.WipeBufferSecure(s.chunkPlain)
+		s.chunkIndex, s.chunkPlain = index, plaintext
+	}
+	return copy(p, s.chunkPlain[from:]), nil
+}
+
+// Wipe the content keys and close the container
+func (s *SeekableDecryptionStream) Close() error {
+	if !s.wipe() {
+		return nil
+	}
+	return s.f.Close()
+}
+
+// Wipe the content keys and the last chunk decrypted, reporting whether they were not wiped yet.
+// No ReadAt runs meanwhile, so the chunk is not locked
+func (s *SeekableDecryptionStream) wipe() bool {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	if s.keys == nil {
+		return false
+	}
+	for _, key := range s.keys {
+		ic.WipeBufferSecure(key)
+	}
+	ic.WipeBufferSecure(s.chunkPlain)
+	s.keys, s.chunkPlain, s.chunkIndex = nil, nil, -1
+	return true
+}
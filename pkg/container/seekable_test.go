@@ -0,0 +1,116 @@
+package container_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"testing/iotest"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Seek and read at random positions of both the unchunked and the chunked content
+func TestSeekableDecryptionStream(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(2*container_pkg.ContentChunkSize + 999)
+	assert.NoError(t, err, "cannot generate plaintext")
+	for _, alg := range []types.EncryptionAlgorithm{types.EncAlgAESCTR256, types.EncAlgAESGCM256} {
+		name, slotKey := createTestContainer(t, alg, plainText)
+		encryptedContainer, err := container_pkg.OpenContainerFile(name)
+		assert.NoError(t, err, "cannot open the container")
+		_, err = encryptedContainer.AsSeekableDecryptionStream()
+		assert.ErrorIs(t, err, container_pkg.ErrRootKeySealed)
+		err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot unseal the root key")
+		stream, err := encryptedContainer.AsSeekableDecryptionStream()
+		assert.NoError(t, err, "cannot create the stream")
+		assert.Equal(t, int64(len(plainText)), stream.Size())
+
+		// Read, ReadAt and Seek must agree with the plaintext
+		assert.NoError(t, iotest.TestReader(stream, plainText))
+
+		position, err := stream.Seek(container_pkg.ContentChunkSize-5, io.SeekStart)
+		assert.NoError(t, err, "cannot seek")
+		assert.Equal(t, int64(container_pkg.ContentChunkSize-5), position)
+		buf := make([]byte, 10)
+		_, err = io.ReadFull(stream, buf)
+		assert.NoError(t, err, "cannot read across the chunks")
+		assert.Equal(t, plainText[container_pkg.ContentChunkSize-5:container_pkg.ContentChunkSize+5], buf)
+
+		_, err = stream.Seek(-3, io.SeekEnd)
+		assert.NoError(t, err, "cannot seek from the end")
+		rest, err := io.ReadAll(stream)
+		assert.NoError(t, err, "cannot read the tail")
+		assert.Equal(t, plainText[len(plainText)-3:], rest)
+
+		_, err = stream.Seek(-1, io.SeekStart)
+		assert.ErrorIs(t, err, container_pkg.ErrRangeOutOfBounds)
+		_, err = stream.Seek(0, 42)
+		assert.ErrorIs(t, err, container_pkg.ErrInvalidWhence)
+
+		assert.NoError(t, stream.Close())
+		_, err = stream.ReadAt(buf, 0)
+		assert.ErrorIs(t, err, container_pkg.ErrDecryptionStreamClosed)
+	}
+}
+
+// Tampered chunks are still detected when reading at random positions
+func TestSeekableDecryptionStreamTampered(t *testing.T) {
+	plainText := bytes.Repeat([]byte{0x42}, 2*container_pkg.ContentChunkSize)
+	encryptedContainer, name, _ := createChunkedTestContainer(t, plainText)
+	defer encryptedContainer.Close()
+	chunks, err := encryptedContainer.ChunkMap()
+	assert.NoError(t, err, "cannot get the chunk map")
+
+	stream, err := encryptedContainer.AsSeekableDecryptionStream()
+	assert.NoError(t, err, "cannot create the stream")
+	handle, err := os.OpenFile(name, os.O_RDWR, 0)
+	assert.NoError(t, err, "cannot open the container")
+	_, err = handle.WriteAt([]byte{0xff}, chunks[1].FileOffset+100)
+	assert.NoError(t, err, "cannot tamper the container")
+	handle.Close()
+	buf := make([]byte, 10)
+	_, err = stream.ReadAt(buf, 10)
+	assert.NoError(t, err, "the first chunk is intact")
+	_, err = stream.ReadAt(buf, container_pkg.ContentChunkSize+10)
+	assert.ErrorIs(t, err, ic.ErrAuthenticationFailed)
+}
+
+// Closing while other goroutines read either lets the read finish or reports the stream closed, run with -race
+func TestSeekableDecryptionStreamConcurrentClose(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(2*container_pkg.ContentChunkSize + 999)
+	assert.NoError(t, err, "cannot generate plaintext")
+	for _, alg := range []types.EncryptionAlgorithm{types.EncAlgAESCTR256, types.EncAlgAESGCM256} {
+		name, slotKey := createTestContainer(t, alg, plainText)
+		encryptedContainer, err := container_pkg.OpenContainerFile(name)
+		assert.NoError(t, err, "cannot open the container")
+		err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot unseal the root key")
+		stream, err := encryptedContainer.AsSeekableDecryptionStream()
+		assert.NoError(t, err, "cannot create the stream")
+
+		var wg sync.WaitGroup
+		for i := range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				buf := make([]byte, 100)
+				off := int64(i) * container_pkg.ContentChunkSize / 2
+				for {
+					_, err := stream.ReadAt(buf, off)
+					if err != nil {
+						assert.ErrorIs(t, err, container_pkg.ErrDecryptionStreamClosed)
+						return
+					}
+					assert.Equal(t, plainText[off:off+100], buf)
+				}
+			}()
+		}
+		assert.NoError(t, stream.Close())
+		wg.Wait()
+	}
+}
@@ -0,0 +1,101 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// File: pkg/container/self_extracting.go
+// This file contains APIs for wrapping the container after a stub which decrypts it.
+//
+// Layout: stub (padded to StubKind.Size()) || container
+// The container is copied as-is, so it can still be opened with OpenContainerFileAtOffset using the size of the stub.
+
+// Kind of the stub placed in front of the container
+type StubKind uint8
+
+const (
+	// POSIX shell script asking for the hex key and calling the go-filecrypt tool, which must be in PATH
+	StubShell StubKind = iota
+	StubEnd
+)
+
+// Every stub is padded to this size so the container always starts at the same offset
+const stubSize = 1024
+
+// The shell stub, the offset is filled when the stub is rendered.
+// The ciphertext is copied out with tail as the tool expects the container at the start of the file
+const shellStubTemplate = `#!/bin/sh
+# Self-decrypting container produced by go-filecrypt, the go-filecrypt tool must be in PATH
+# Usage: sh <this file> <output file>
+set -e
+if [ $# -ne 1 ]; then
+	echo "usage: $0 <output file>" >&2
+	exit 2
+fi
+printf 'Key (hex): ' >&2
+stty -echo 2>/dev/null || true
+read -r key
+stty echo 2>/dev/null || true
+echo >&2
+tmp=$(mktemp)
+trap 'rm -f "$tmp"' EXIT
+tail -c +%d "$0" > "$tmp"
+go-filecrypt decrypt -k "$key" -f "$tmp" -t "$1"
+exit 0
+`
+
+var (
+	ErrUnsupportedStub = errors.New("the stub kind is not supported")
+)
+
+// Size of the stub, which is also the offset of the container in the self-extracting file
+func (kind StubKind) Size() int64 {
+	return stubSize
+}
+
+// Render the stub padded to its size
+func (kind StubKind) render() ([]byte, error) {
+	var script string
+	switch kind {
+	case StubShell:
+		// tail counts from 1
+		script = fmt.Sprintf(shellStubTemplate, stubSize+1)
+	default:
+		return nil, ErrUnsupportedStub
+	}
+	if len(script) > stubSize {
+		return nil, ErrUnsupportedStub
+	}
+	// Pad with newlines, the script exits before reaching them
+	return []byte(script + strings.Repeat("\n", stubSize-len(script))), nil
+}
+
+// Write the stub followed by the whole container into the writer, the cryptography of the container is unchanged.
+// The header must be written, and the container must be backed by a single seekable storage
+func (f *ContainerFile) WriteSelfExtracting(w io.Writer, stub StubKind) error {
+	if f.file == nil {
+		return ErrContainerReadOnly
+	}
+	if f.isMultiVolume() {
+		return ErrMultiVolume
+	}
+	if f.contentOffset() == 0 {
+		return ErrHeaderNotWritten
+	}
+	script, err := stub.render()
+	if err != nil {
+		return err
+	}
+	size, err := f.file.Size()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(script); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, io.NewSectionReader(f.file, 0, size))
+	return err
+}
@@ -0,0 +1,98 @@
+package container_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelfExtracting(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(10000)
+	assert.NoError(t, err, "cannot generate the payload")
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR128, plainText)
+	original, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.WriteSelfExtracting(bytes.NewBuffer(nil), container_pkg.StubEnd)
+	assert.ErrorIs(t, err, container_pkg.ErrUnsupportedStub)
+
+	output, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(output.Name())
+	defer output.Close()
+	err = encryptedContainer.WriteSelfExtracting(output, container_pkg.StubShell)
+	assert.NoError(t, err, "cannot write the self-extracting file")
+
+	// The container follows the stub unchanged
+	data, err := os.ReadFile(output.Name())
+	assert.NoError(t, err, "cannot read the self-extracting file")
+	offset := container_pkg.StubShell.Size()
+	assert.True(t, bytes.HasPrefix(data, []byte("#!/bin/sh\n")))
+	assert.Equal(t, original, data[offset:])
+
+	_, err = container_pkg.OpenContainerFileAtOffset(output, -1)
+	assert.ErrorIs(t, err, container_pkg.ErrInvalidOffset)
+	_, err = container_pkg.OpenContainerFileAtOffset(output, 0)
+	assert.ErrorIs(t, err, types.ErrInvalidFileHeader)
+	embedded, err := container_pkg.OpenContainerFileAtOffset(output, offset)
+	assert.NoError(t, err, "cannot open the embedded container")
+	err = embedded.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the embedded container")
+	size, err := embedded.EstimateContentSize()
+	assert.NoError(t, err, "cannot estimate the content size")
+	assert.Equal(t, int64(len(plainText)), size)
+	buf := bytes.NewBuffer(nil)
+	err = embedded.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the embedded container")
+	assert.Equal(t, plainText, buf.Bytes())
+}
+
+func TestAppendContainerTo(t *testing.T) {
+	// Start and end markers of a JPEG image with some bytes between them
+	image := append(append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, bytes.Repeat([]byte{0x42}, 1000)...), 0xFF, 0xD9)
+	file, err := os.CreateTemp("", "filecrypt-ci-*.jpg")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	_, err = file.Write(image)
+	assert.NoError(t, err, "cannot write the image")
+
+	plainText, err := ic.GenerateRandomBytes(10000)
+	assert.NoError(t, err, "cannot generate the payload")
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	encryptedContainer, offset, err := container_pkg.AppendContainerTo(file, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create the embedded container")
+	assert.Equal(t, int64(len(image)), offset)
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewReader(plainText))
+	assert.NoError(t, err, "cannot encrypt the payload")
+	encryptedContainer.Close()
+
+	// The image is left untouched
+	data, err := os.ReadFile(file.Name())
+	assert.NoError(t, err, "cannot read the file")
+	assert.Equal(t, image, data[:offset])
+
+	handle, err := os.Open(file.Name())
+	assert.NoError(t, err, "cannot open the file")
+	embedded, err := container_pkg.OpenContainerFileAtOffset(handle, offset)
+	assert.NoError(t, err, "cannot open the embedded container")
+	defer embedded.Close()
+	err = embedded.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the embedded container")
+	buf := bytes.NewBuffer(nil)
+	err = embedded.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the embedded container")
+	assert.Equal(t, plainText, buf.Bytes())
+}
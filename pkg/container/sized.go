@@ -0,0 +1,72 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/sized.go
+// This file contains the encryption of a stream whose size is known in advance.
+//
+// The whole output is reserved before the first byte is encrypted, so running out of space is reported up front
+// instead of leaving a truncated container behind. The space is reserved with fallocate where supported,
+// other file systems only get the file extended, and storages without a way to reserve space are left as is.
+
+var (
+	ErrNoSpace      = errors.New("not enough space to hold the container")
+	ErrSizeMismatch = errors.New("the stream size does not match the declared size")
+)
+
+// Size of the checksum trailer following the content of the size
+func checksumTrailerSize(contentSize int64) int64 {
+	return 4 + 4*checksumBlocks(contentSize) + 4
+}
+
+// Same as EncryptStream but reserves the space of the whole container for size bytes of plaintext first.
+// ErrNoSpace is returned before reading anything when the space cannot be reserved.
+// The container is cut to what was actually written and ErrSizeMismatch is returned when the stream is not exactly size bytes.
+// The chunked content is not supported
+func (f *ContainerFile) EncryptStreamSized(reader io.Reader, size int64) error {
+	if size < 0 {
+		return ErrSizeMismatch
+	}
+	if f.isChunked() {
+		return types.ErrUnsupportedFeature
+	}
+	if f.file == nil {
+		return ErrContainerReadOnly
+	}
+	if f.contentOffset() == 0 {
+		return ErrHeaderNotWritten
+	}
+	total := contentOverhead(f.contentOffset(), f.contentSaltSize()) + size
+	if f.hasChecksumTrailer() {
+		total += checksumTrailerSize(size)
+	}
+	if err := f.file.Allocate(total); err != nil {
+		if errors.Is(err, syscall.ENOSPC) {
+			return fmt.Errorf("%w: %w", ErrNoSpace, err)
+		}
+		return err
+	}
+	counter := &countingReader{reader: reader}
+	if err := f.EncryptStream(counter); err != nil {
+		return err
+	}
+	if counter.n == size {
+		return nil
+	}
+	// Drop the reserved space the content did not use
+	end, err := f.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if err := f.file.Truncate(end); err != nil && !errors.Is(err, ErrStorageNotTruncatable) {
+		return errors.Join(ErrSizeMismatch, err)
+	}
+	return ErrSizeMismatch
+}
@@ -0,0 +1,102 @@
+package container_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Reader recording the size of the file when it is first read
+type sizeProbeReader struct {
+	reader   io.Reader
+	name     string
+	observed int64
+}
+
+func (r *sizeProbeReader) Read(p []byte) (int, error) {
+	if r.observed == 0 {
+		if info, err := os.Stat(r.name); err == nil {
+			r.observed = info.Size()
+		}
+	}
+	return r.reader.Read(p)
+}
+
+func TestEncryptStreamSized(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(200000)
+	assert.NoError(t, err, "cannot generate the payload")
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	name := filepath.Join(t.TempDir(), "sized.crpt")
+
+	encryptedContainer, err := container_pkg.NewContainerFile(name, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	encryptedContainer.EnableChecksumTrailer()
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	probe := &sizeProbeReader{reader: bytes.NewReader(plainText), name: name}
+	err = encryptedContainer.EncryptStreamSized(probe, int64(len(plainText)))
+	assert.NoError(t, err, "cannot encrypt the payload")
+	encryptedContainer.Close()
+
+	// The file is already at its final size before the plaintext is read
+	info, err := os.Stat(name)
+	assert.NoError(t, err, "cannot stat the container")
+	assert.Equal(t, info.Size(), probe.observed)
+	decrypted, err := decryptWithFreshHandle(t, name, slotKey)
+	assert.NoError(t, err, "cannot decrypt the payload")
+	assert.Equal(t, plainText, decrypted)
+
+	// A stream shorter than declared does not leave the reserved space behind
+	encryptedContainer, err = container_pkg.NewContainerFile(name, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStreamSized(bytes.NewReader(plainText[:100]), int64(len(plainText)))
+	assert.ErrorIs(t, err, container_pkg.ErrSizeMismatch)
+	encryptedContainer.Close()
+	decrypted, err = decryptWithFreshHandle(t, name, slotKey)
+	assert.NoError(t, err, "cannot decrypt the payload")
+	assert.Equal(t, plainText[:100], decrypted)
+}
+
+// In-memory storage which has no space left to reserve
+type fullStorage struct {
+	memoryStorage
+}
+
+func (m *fullStorage) Allocate(size int64) error {
+	return syscall.ENOSPC
+}
+
+func TestEncryptStreamSizedNoSpace(t *testing.T) {
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	storage := &fullStorage{}
+	encryptedContainer, err := container_pkg.NewContainerFileWithStorage(storage, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+
+	reader := bytes.NewReader([]byte("Some secrets is here!"))
+	err = encryptedContainer.EncryptStreamSized(reader, reader.Size())
+	assert.ErrorIs(t, err, container_pkg.ErrNoSpace)
+	assert.ErrorIs(t, err, syscall.ENOSPC)
+	// Nothing was consumed nor written past the header
+	assert.Equal(t, reader.Size(), int64(reader.Len()))
+	assert.Len(t, storage.data, 4096)
+}
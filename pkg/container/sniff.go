@@ -0,0 +1,31 @@
+package container
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/sniff.go
+// This file contains the detection of the containers by their magic number, regardless of the file extension
+
+// Check whether the file starts with the magic number of the containers.
+// Only the magic number is read, so a damaged or unsupported header is still reported as a container.
+// Files shorter than the magic number are not containers, only failures to open or read return an error
+func IsContainer(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	magic := make([]byte, len(types.FileMagicNumber))
+	if _, err := io.ReadFull(file, magic); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+		return false, err
+	}
+	return bytes.Equal(magic, types.FileMagicNumber), nil
+}
@@ -0,0 +1,45 @@
+package container_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsContainer(t *testing.T) {
+	dir := t.TempDir()
+	name, _ := createTestContainer(t, types.EncAlgAESCTR128, []byte("Some secrets is here!"))
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	files := map[string][]byte{
+		"container.crpt": data,
+		"container.txt":  data, // the extension does not matter
+		"notes.crpt":     []byte("plain text notes"),
+		"empty":          nil,
+		"short":          types.FileMagicNumber[:2],
+		"magic-only":     types.FileMagicNumber,
+	}
+	for file, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, file), content, 0600), "cannot write %s", file)
+	}
+	expected := map[string]bool{
+		"container.crpt": true,
+		"container.txt":  true,
+		"notes.crpt":     false,
+		"empty":          false,
+		"short":          false,
+		"magic-only":     true,
+	}
+	for file, want := range expected {
+		got, err := container_pkg.IsContainer(filepath.Join(dir, file))
+		assert.NoError(t, err, "cannot sniff %s", file)
+		assert.Equal(t, want, got, file)
+	}
+
+	_, err = container_pkg.IsContainer(filepath.Join(dir, "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
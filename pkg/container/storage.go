@@ -0,0 +1,231 @@
+package container
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// File: pkg/container/storage.go
+// This file adapts the minimal io.ReadWriteSeeker into everything the container needs from its backing storage,
+// so the container can live in a *os.File, an in-memory buffer or a seekable adapter over a blob store.
+// Capabilities beyond io.ReadWriteSeeker are used when the storage implements them and emulated otherwise.
+
+var (
+	ErrStorageNotTruncatable = errors.New("the backing storage cannot be truncated")
+	ErrInvalidOffset         = errors.New("the offset must not point before the start of the container")
+)
+
+// Backing storage of the container
+type backingStorage interface {
+	io.ReadWriteSeeker
+	io.ReaderAt
+	io.WriterAt
+	Size() (int64, error)
+	Truncate(size int64) error
+	Allocate(size int64) error
+	Sync() error
+	Close() error
+}
+
+// Adapter turning an io.ReadWriteSeeker into a backingStorage
+type storageAdapter struct {
+	io.ReadWriteSeeker
+}
+
+func newBackingStorage(rws io.ReadWriteSeeker) backingStorage {
+	return &storageAdapter{ReadWriteSeeker: rws}
+}
+
+// Run the operation at the offset then restore the position, as ReadAt and WriteAt must not move it
+func (s *storageAdapter) at(off int64, operation func() (int, error)) (int, error) {
+	position, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := operation()
+	if _, seekErr := s.Seek(position, io.SeekStart); err == nil {
+		err = seekErr
+	}
+	return n, err
+}
+
+func (s *storageAdapter) ReadAt(p []byte, off int64) (int, error) {
+	if readerAt, ok := s.ReadWriteSeeker.(io.ReaderAt); ok {
+		return readerAt.ReadAt(p, off)
+	}
+	return s.at(off, func() (int, error) {
+		n, err := io.ReadFull(s.ReadWriteSeeker, p)
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return n, err
+	})
+}
+
+func (s *storageAdapter) WriteAt(p []byte, off int64) (int, error) {
+	if writerAt, ok := s.ReadWriteSeeker.(io.WriterAt); ok {
+		return writerAt.WriteAt(p, off)
+	}
+	return s.at(off, func() (int, error) {
+		return s.Write(p)
+	})
+}
+
+func (s *storageAdapter) Size() (int64, error) {
+	if statter, ok := s.ReadWriteSeeker.(interface{ Stat() (fs.FileInfo, error) }); ok {
+		info, err := statter.Stat()
+		if err != nil {
+			return -1, err
+		}
+		return info.Size(), nil
+	}
+	position, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return -1, err
+	}
+	size, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return -1, err
+	}
+	if _, err := s.Seek(position, io.SeekStart); err != nil {
+		return -1, err
+	}
+	return size, nil
+}
+
+func (s *storageAdapter) Truncate(size int64) error {
+	if truncater, ok := s.ReadWriteSeeker.(interface{ Truncate(size int64) error }); ok {
+		return truncater.Truncate(size)
+	}
+	// Nothing to cut when the storage already has the size
+	if current, err := s.Size(); err == nil && current == size {
+		return nil
+	}
+	return ErrStorageNotTruncatable
+}
+
+// Reserve the space of the storage up to the size, a storage which cannot reserve space accepts any size
+func (s *storageAdapter) Allocate(size int64) error {
+	if allocator, ok := s.ReadWriteSeeker.(interface{ Allocate(size int64) error }); ok {
+		return allocator.Allocate(size)
+	}
+	if file, ok := s.ReadWriteSeeker.(*os.File); ok {
+		return preallocateFile(file, size)
+	}
+	return nil
+}
+
+// Commit the storage if it supports it, otherwise there is nothing to commit
+func (s *storageAdapter) Sync() error {
+	if syncer, ok := s.ReadWriteSeeker.(interface{ Sync() error }); ok {
+		return syncer.Sync()
+	}
+	return nil
+}
+
+func (s *storageAdapter) Close() error {
+	if closer, ok := s.ReadWriteSeeker.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Get the file behind the storage, false when the container does not live in a file of its own
+func storageFile(storage backingStorage) (*os.File, bool) {
+	adapter, ok := storage.(*storageAdapter)
+	if !ok {
+		return nil, false
+	}
+	file, ok := adapter.ReadWriteSeeker.(*os.File)
+	return file, ok
+}
+
+// Storage exposing the bytes of another storage from a base offset, used when the container is embedded after a prefix
+type offsetStorage struct {
+	inner backingStorage
+	base  int64
+}
+
+// Wrap the storage so offset 0 maps to base, the storage is positioned at the start of the container
+func newOffsetStorage(rws io.ReadWriteSeeker, base int64) (backingStorage, error) {
+	if base < 0 {
+		return nil, ErrInvalidOffset
+	}
+	storage := &offsetStorage{inner: newBackingStorage(rws), base: base}
+	if _, err := storage.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return storage, nil
+}
+
+func (s *offsetStorage) Read(p []byte) (int, error) {
+	return s.inner.Read(p)
+}
+
+func (s *offsetStorage) Write(p []byte) (int, error) {
+	return s.inner.Write(p)
+}
+
+func (s *offsetStorage) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekStart {
+		if offset < 0 {
+			return 0, ErrInvalidOffset
+		}
+		offset += s.base
+	}
+	position, err := s.inner.Seek(offset, whence)
+	if err != nil {
+		return 0, err
+	}
+	if position < s.base {
+		// Do not let relative seeks escape into the prefix
+		if _, err := s.inner.Seek(s.base, io.SeekStart); err != nil {
+			return 0, err
+		}
+		return 0, ErrInvalidOffset
+	}
+	return position - s.base, nil
+}
+
+func (s *offsetStorage) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrInvalidOffset
+	}
+	return s.inner.ReadAt(p, off+s.base)
+}
+
+func (s *offsetStorage) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrInvalidOffset
+	}
+	return s.inner.WriteAt(p, off+s.base)
+}
+
+func (s *offsetStorage) Size() (int64, error) {
+	size, err := s.inner.Size()
+	if err != nil {
+		return -1, err
+	}
+	return max(size-s.base, 0), nil
+}
+
+func (s *offsetStorage) Truncate(size int64) error {
+	return s.inner.Truncate(size + s.base)
+}
+
+func (s *offsetStorage) Allocate(size int64) error {
+	return s.inner.Allocate(size + s.base)
+}
+
+func (s *offsetStorage) Sync() error {
+	return s.inner.Sync()
+}
+
+func (s *offsetStorage) Close() error {
+	return s.inner.Close()
+}
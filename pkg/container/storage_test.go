@@ -0,0 +1,137 @@
+package container_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// In-memory storage implementing only io.ReadWriteSeeker
+type memoryStorage struct {
+	data     []byte
+	position int64
+}
+
+func (m *memoryStorage) Read(p []byte) (int, error) {
+	if m.position >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[m.position:])
+	m.position += int64(n)
+	return n, nil
+}
+
+func (m *memoryStorage) Write(p []byte) (int, error) {
+	if end := m.position + int64(len(p)); end > int64(len(m.data)) {
+		m.data = append(m.data, make([]byte, end-int64(len(m.data)))...)
+	}
+	n := copy(m.data[m.position:], p)
+	m.position += int64(n)
+	return n, nil
+}
+
+func (m *memoryStorage) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += m.position
+	case io.SeekEnd:
+		offset += int64(len(m.data))
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	m.position = offset
+	return offset, nil
+}
+
+func TestContainerOverMemoryStorage(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(100000)
+	assert.NoError(t, err, "cannot generate the payload")
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+
+	storage := &memoryStorage{}
+	encryptedContainer, err := container_pkg.NewContainerFileWithStorage(storage, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewReader(plainText))
+	assert.NoError(t, err, "cannot encrypt the payload")
+	assert.NoError(t, encryptedContainer.Sync(), "sync should be a no-op")
+	assert.NoError(t, encryptedContainer.Close(), "close should be a no-op")
+
+	storage.position = 0
+	encryptedContainer, err = container_pkg.OpenContainerFileWithStorage(storage)
+	assert.NoError(t, err, "cannot open the container")
+	size, err := encryptedContainer.EstimateContentSize()
+	assert.NoError(t, err, "cannot estimate the content size")
+	assert.Equal(t, int64(len(plainText)), size)
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the payload")
+	assert.Equal(t, plainText, buf.Bytes())
+
+	// Random access goes through the emulated ReadAt
+	buf.Reset()
+	err = encryptedContainer.DecryptRange(buf, 5000, 100)
+	assert.NoError(t, err, "cannot decrypt the range")
+	assert.Equal(t, plainText[5000:5100], buf.Bytes())
+
+	// Shrinking the content needs a storage which can be truncated
+	err = encryptedContainer.ReplaceContent(bytes.NewReader(plainText[:10]))
+	assert.ErrorIs(t, err, container_pkg.ErrStorageNotTruncatable)
+}
+
+// In-memory storage failing once the given number of bytes were written
+type failingStorage struct {
+	memoryStorage
+	limit int
+}
+
+func (m *failingStorage) Write(p []byte) (int, error) {
+	if len(p) > m.limit {
+		n, _ := m.memoryStorage.Write(p[:m.limit])
+		m.limit = 0
+		return n, errors.New("no space left on device")
+	}
+	m.limit -= len(p)
+	return m.memoryStorage.Write(p)
+}
+
+func TestWriteHeaderPartialFailure(t *testing.T) {
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	storage := &failingStorage{limit: 2048}
+	encryptedContainer, err := container_pkg.NewContainerFileWithStorage(storage, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+
+	err = encryptedContainer.WriteHeader()
+	var headerErr *container_pkg.HeaderWriteError
+	assert.ErrorAs(t, err, &headerErr)
+	assert.Equal(t, int64(2048), headerErr.Written)
+	assert.EqualError(t, errors.Unwrap(err), "no space left on device")
+
+	// Retrying once space is available rewrites the whole header
+	storage.limit = 1 << 20
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewBufferString("Some secrets is here!"))
+	assert.NoError(t, err, "cannot encrypt the test string")
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, "Some secrets is here!", buf.String())
+}
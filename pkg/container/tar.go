@@ -0,0 +1,41 @@
+package container
+
+import (
+	"archive/tar"
+	"errors"
+
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/tar.go
+// This file contains the helpers for contents holding a tar stream, so the entries can be read with archive/tar
+// without extracting the whole content to disk first.
+
+var (
+	ErrNotTar = errors.New("the content is not flagged as a tar stream")
+)
+
+// Flag the content as a tar stream, it must be called before WriteHeader and EncryptStream.
+// The caller encrypts the tar stream itself, e.g. produced by tar.Writer.AddFS
+func (f *ContainerFile) EnableTarContent() {
+	f.header.Flags |= types.HeaderFlagTarContent
+}
+
+// Whether the content is a tar stream
+func (f *ContainerFile) isTar() bool {
+	return f.header.Flags&types.HeaderFlagTarContent != 0
+}
+
+// Get a tar reader over the decrypted content, so specific entries can be picked without decrypting the rest to disk.
+// Like AsDecryptionStream the tag of an unchunked content is not verified, as the tar reader stops at the end of the archive.
+// Use the chunked content when the entries must be authenticated as they are read
+func (f *ContainerFile) DecryptTarReader() (*tar.Reader, error) {
+	if !f.isTar() {
+		return nil, ErrNotTar
+	}
+	reader, err := f.AsDecryptionStream()
+	if err != nil {
+		return nil, err
+	}
+	return tar.NewReader(reader), nil
+}
@@ -0,0 +1,87 @@
+package container_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecryptTarReader(t *testing.T) {
+	files := map[string]string{
+		"README":       "Some secrets is here!",
+		"data/big.bin": strings.Repeat("0123456789", 20000),
+		"data/key.pem": "-----BEGIN KEY-----",
+	}
+	archive := bytes.NewBuffer(nil)
+	tarWriter := tar.NewWriter(archive)
+	for _, name := range []string{"README", "data/big.bin", "data/key.pem"} {
+		err := tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(files[name]))})
+		assert.NoError(t, err, "cannot write the tar header")
+		_, err = tarWriter.Write([]byte(files[name]))
+		assert.NoError(t, err, "cannot write the tar entry")
+	}
+	assert.NoError(t, tarWriter.Close(), "cannot complete the tar stream")
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+
+	for _, chunked := range []bool{false, true} {
+		name := filepath.Join(t.TempDir(), "dir.crpt")
+		encryptedContainer, err := container_pkg.NewContainerFile(name, types.EncAlgAESCTR256)
+		assert.NoError(t, err, "cannot create container")
+		encryptedContainer.EnableTarContent()
+		if chunked {
+			encryptedContainer.EnableChunkedContent()
+		}
+		err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot add slot")
+		err = encryptedContainer.WriteHeader()
+		assert.NoError(t, err, "cannot write out the headers")
+		err = encryptedContainer.EncryptStream(bytes.NewReader(archive.Bytes()))
+		assert.NoError(t, err, "cannot encrypt the tar stream")
+		encryptedContainer.Close()
+
+		encryptedContainer, err = container_pkg.OpenContainerFile(name)
+		assert.NoError(t, err, "cannot open the container")
+		_, err = encryptedContainer.DecryptTarReader()
+		assert.ErrorIs(t, err, container_pkg.ErrRootKeySealed)
+		err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot unseal the root key")
+		tarReader, err := encryptedContainer.DecryptTarReader()
+		assert.NoError(t, err, "cannot read the tar stream")
+		// Pick a single entry, skipping the others
+		found := false
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err, "cannot read the next entry")
+			if header.Name != "data/key.pem" {
+				continue
+			}
+			found = true
+			content, err := io.ReadAll(tarReader)
+			assert.NoError(t, err, "cannot read the entry")
+			assert.Equal(t, files[header.Name], string(content))
+		}
+		assert.True(t, found, "the entry is missing")
+		encryptedContainer.Close()
+	}
+
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR256, archive.Bytes())
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	_, err = encryptedContainer.DecryptTarReader()
+	assert.ErrorIs(t, err, container_pkg.ErrNotTar)
+}
@@ -0,0 +1,44 @@
+package container
+
+import (
+	"os"
+	"sync"
+)
+
+// File: pkg/container/tempfile.go
+// This file contains the helper used by every feature that spills secrets to disk
+
+// Permission of the temp files holding secrets
+const secureTempFileMode os.FileMode = 0600
+
+// Create a temp file readable only by the owner in dir.
+// Pass the directory of the final file as dir, so the temp file is on the same file system and can be renamed atomically.
+// The cleanup closes and removes the temp file, it is safe to call it more than once and after the file was renamed
+func createSecureTemp(dir, pattern string) (file *os.File, cleanup func(), err error) {
+	file, err = os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+	// CreateTemp already uses 0600 but do not depend on it
+	if err := file.Chmod(secureTempFileMode); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, nil, err
+	}
+	name := file.Name()
+	cleanup = sync.OnceFunc(func() {
+		file.Close()
+		os.Remove(name)
+	})
+	return file, cleanup, nil
+}
+
+// Sync the directory so the entries created or renamed in it survive a crash
+func syncDirectory(dir string) error {
+	handle, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	return handle.Sync()
+}
@@ -0,0 +1,41 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateSecureTemp(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "secret.crpt")
+	file, cleanup, err := createSecureTemp(filepath.Dir(target), ".secret-*.tmp")
+	assert.NoError(t, err, "cannot create the temp file")
+	name := file.Name()
+	assert.Equal(t, dir, filepath.Dir(name), "the temp file must be next to the target")
+
+	if runtime.GOOS != "windows" {
+		info, err := file.Stat()
+		assert.NoError(t, err, "cannot stat the temp file")
+		assert.Equal(t, secureTempFileMode, info.Mode().Perm())
+	}
+
+	// Being on the same file system, it can be renamed over the target
+	_, err = file.WriteString("content")
+	assert.NoError(t, err, "cannot write the temp file")
+	assert.NoError(t, os.Rename(name, target), "cannot rename the temp file")
+	cleanup()
+	cleanup()
+	_, err = os.Stat(target)
+	assert.NoError(t, err, "the renamed file must survive the cleanup")
+
+	// Without renaming the file is removed
+	file, cleanup, err = createSecureTemp(dir, ".secret-*.tmp")
+	assert.NoError(t, err, "cannot create the temp file")
+	cleanup()
+	_, err = os.Stat(file.Name())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,57 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// File: pkg/container/timeout.go
+// This file contains the variants of the operations bounded by a context or a timeout.
+//
+// The context is checked around every read of the plaintext, so a single read blocking forever is not interrupted.
+
+var (
+	ErrTimeout = errors.New("the operation did not complete in time")
+)
+
+// Reader failing once the context is done
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.reader.Read(p)
+	if ctxErr := r.ctx.Err(); ctxErr != nil {
+		return 0, ctxErr
+	}
+	return n, err
+}
+
+// Same as EncryptStream but aborts with the error of the context once it is done.
+// The partial content is cut off on abort, leaving only the header in the file
+func (f *ContainerFile) EncryptStreamContext(ctx context.Context, reader io.Reader) error {
+	err := f.EncryptStream(&contextReader{ctx: ctx, reader: reader})
+	if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+		if truncErr := f.file.Truncate(f.contentOffset()); truncErr != nil {
+			return errors.Join(err, truncErr)
+		}
+	}
+	return err
+}
+
+// Same as EncryptStream but aborts with ErrTimeout if it takes longer than the duration, see EncryptStreamContext
+func (f *ContainerFile) EncryptStreamTimeout(reader io.Reader, d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	err := f.EncryptStreamContext(ctx, reader)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errors.Join(ErrTimeout, err)
+	}
+	return err
+}
@@ -0,0 +1,61 @@
+package container_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Reader returning a few bytes at a time with a delay before each read
+type slowReader struct {
+	data  []byte
+	delay time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p[:min(len(p), 16)], r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestEncryptStreamTimeout(t *testing.T) {
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR256)
+	assert.NoError(t, err, "cannot create container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+
+	reader := &slowReader{data: bytes.Repeat([]byte("x"), 1024), delay: 10 * time.Millisecond}
+	err = encryptedContainer.EncryptStreamTimeout(reader, 50*time.Millisecond)
+	assert.ErrorIs(t, err, container_pkg.ErrTimeout)
+	// Only the header is left behind
+	size, err := encryptedContainer.FileSize()
+	assert.NoError(t, err, "cannot get the file size")
+	assert.Equal(t, encryptedContainer.ContentOffset(), size)
+
+	// A fast enough operation completes normally
+	err = encryptedContainer.EncryptStreamTimeout(bytes.NewBufferString("Some secrets is here!"), time.Minute)
+	assert.NoError(t, err, "cannot encrypt the test string")
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, "Some secrets is here!", buf.String())
+}
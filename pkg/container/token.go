@@ -0,0 +1,72 @@
+package container
+
+import (
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_internal "github.com/ngeojiajun/go-filecrypt/internal/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/token.go
+// This file contains APIs for slots unlocked by a hardware token challenge-response
+
+// Size of the random challenge stored in the token slots
+const tokenChallengeSize = 32
+
+// TokenResponder answers the challenge using the secret held by the hardware token
+// (e.g. YubiKey HMAC-SHA1 or FIDO2 hmac-secret). The same challenge must always produce the same response
+type TokenResponder interface {
+	Respond(challenge []byte) ([]byte, error)
+}
+
+// Add a slot where the root key is wrapped by the key derived from the token response to a random challenge.
+// Only the challenge is stored in the file
+func (f *ContainerFile) AddTokenSlot(responder TokenResponder) error {
+	if len(f.rootKey) == 0 {
+		return ErrRootKeySealed
+	}
+	if responder == nil {
+		return types.ErrParameterMissing
+	}
+	challenge, err := ic.GenerateRandomBytes(tokenChallengeSize)
+	if err != nil {
+		return err
+	}
+	response, err := responder.Respond(challenge)
+	if err != nil {
+		return err
+	}
+	defer ic.WipeBufferSecure(response)
+	slot, err := container_internal.NewContainerTokenSlot(0, f.rootKey, challenge, response)
+	if err != nil {
+		return err
+	}
+	f.header.Slots = append(f.header.Slots, slot)
+	return nil
+}
+
+// Try to unseal the key by asking the token to answer the challenge of each token slot.
+// Slots the token cannot answer are skipped
+func (f *ContainerFile) UnsealWithToken(responder TokenResponder) error {
+	if len(f.rootKey) != 0 {
+		return ErrRootKeyAlreadyUnsealed
+	}
+	if responder == nil {
+		return types.ErrParameterMissing
+	}
+	for _, slot := range f.header.Slots {
+		challenge, err := slot.TokenChallenge()
+		if err != nil {
+			continue
+		}
+		response, err := responder.Respond(challenge)
+		if err != nil {
+			continue
+		}
+		rootKey, err := slot.Unseal(response)
+		ic.WipeBufferSecure(response)
+		if err == nil {
+			return f.acceptRootKey(rootKey)
+		}
+	}
+	return f.unsealFailed()
+}
@@ -0,0 +1,63 @@
+package container_test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"errors"
+	"os"
+	"testing"
+
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Token answering the challenges with HMAC-SHA1 like a YubiKey
+type mockToken struct {
+	secret []byte
+}
+
+func (t *mockToken) Respond(challenge []byte) ([]byte, error) {
+	if t.secret == nil {
+		return nil, errors.New("token not present")
+	}
+	h := hmac.New(sha1.New, t.secret)
+	h.Write(challenge)
+	return h.Sum(nil), nil
+}
+
+func TestTokenSlot(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	token := &mockToken{secret: []byte("token secret")}
+
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR128)
+	assert.NoError(t, err, "cannot create container")
+	err = encryptedContainer.AddTokenSlot(token)
+	assert.NoError(t, err, "cannot add token slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewBufferString(plainText))
+	assert.NoError(t, err, "cannot encrypt the test string")
+	encryptedContainer.Close()
+
+	encryptedContainer, err = container_pkg.OpenContainerFile(file.Name())
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	slots := encryptedContainer.GetSlots()
+	assert.Len(t, slots, 1)
+	assert.Equal(t, types.SlotKeyAlgTokenHMAC, slots[0].Alg)
+	err = encryptedContainer.UnsealWithToken(&mockToken{})
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeyUnsealFailed)
+	err = encryptedContainer.UnsealWithToken(&mockToken{secret: []byte("another token")})
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeyUnsealFailed)
+	err = encryptedContainer.UnsealWithToken(token)
+	assert.NoError(t, err, "cannot unseal with the token")
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the content")
+	assert.Equal(t, plainText, buf.String())
+}
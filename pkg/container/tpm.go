@@ -0,0 +1,68 @@
+package container
+
+import (
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_internal "github.com/ngeojiajun/go-filecrypt/internal/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/tpm.go
+// This file contains APIs for slots sealed by a TPM, so the file can only be decrypted on the machine in a known boot state.
+// The TPM library is injected through TPMSealer, this package does not talk to the TPM itself.
+
+// TPMSealer seals and unseals secrets with the TPM of the machine.
+// The policy is an opaque reference stored in the slot, e.g. the serialized PCR selection the secret is bound to,
+// empty when the secret is not bound to any PCR value. Unseal must fail when the policy is not satisfied
+type TPMSealer interface {
+	Seal(secret, policy []byte) ([]byte, error)
+	Unseal(sealed, policy []byte) ([]byte, error)
+}
+
+// Add a slot where the root key is sealed by the TPM under the policy, pass nil to not bind it to PCR values.
+// The policy and the sealed blob are stored in the file
+func (f *ContainerFile) AddTPMSlot(sealer TPMSealer, policy []byte) error {
+	if len(f.rootKey) == 0 {
+		return ErrRootKeySealed
+	}
+	if sealer == nil {
+		return types.ErrParameterMissing
+	}
+	sealed, err := sealer.Seal(f.rootKey, policy)
+	if err != nil {
+		return err
+	}
+	slot, err := container_internal.NewContainerTPMSlot(0, policy, sealed)
+	if err != nil {
+		return err
+	}
+	f.header.Slots = append(f.header.Slots, slot)
+	return nil
+}
+
+// Try to unseal the key by asking the TPM to unseal the blob of each TPM slot.
+// Slots the TPM cannot unseal, e.g. because the PCR values changed, are skipped
+func (f *ContainerFile) UnsealWithTPM(sealer TPMSealer) error {
+	if len(f.rootKey) != 0 {
+		return ErrRootKeyAlreadyUnsealed
+	}
+	if sealer == nil {
+		return types.ErrParameterMissing
+	}
+	for _, slot := range f.header.Slots {
+		policy, sealed, err := slot.TPMSealedContent()
+		if err != nil {
+			continue
+		}
+		rootKey, err := sealer.Unseal(sealed, policy)
+		if err != nil {
+			continue
+		}
+		// The TPM authenticates the blob, a secret of another size cannot be a root key
+		if len(rootKey) != rootKeySize {
+			ic.WipeBufferSecure(rootKey)
+			continue
+		}
+		return f.acceptRootKey(rootKey)
+	}
+	return f.unsealFailed()
+}
@@ -0,0 +1,84 @@
+package container_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// TPM sealing with a key that never leaves it and enforcing the policy against its current PCR values
+type mockTPM struct {
+	storageKey []byte
+	pcrs       []byte
+}
+
+func (m *mockTPM) Seal(secret, policy []byte) ([]byte, error) {
+	return ic.AESGCMEncryptDirect(m.storageKey, append(bytes.Clone(policy), secret...), nil)
+}
+
+func (m *mockTPM) Unseal(sealed, policy []byte) ([]byte, error) {
+	if len(policy) != 0 && !bytes.Equal(policy, m.pcrs) {
+		return nil, errors.New("the PCR values do not satisfy the policy")
+	}
+	plaintext, err := ic.AESGCMDecryptDirect(m.storageKey, sealed, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(plaintext, policy) {
+		return nil, errors.New("the policy does not match the sealed object")
+	}
+	return plaintext[len(policy):], nil
+}
+
+func TestTPMSlot(t *testing.T) {
+	const plainText = "Some secrets is here!"
+	storageKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "cannot generate the storage key")
+	tpm := &mockTPM{storageKey: storageKey, pcrs: []byte("measured boot")}
+
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	assert.NoError(t, err, "cannot create temp file")
+	defer os.Remove(file.Name())
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, types.EncAlgAESCTR128)
+	assert.NoError(t, err, "cannot create container")
+	err = encryptedContainer.AddTPMSlot(nil, nil)
+	assert.ErrorIs(t, err, types.ErrParameterMissing)
+	err = encryptedContainer.AddTPMSlot(tpm, []byte("measured boot"))
+	assert.NoError(t, err, "cannot add tpm slot")
+	err = encryptedContainer.WriteHeader()
+	assert.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewBufferString(plainText))
+	assert.NoError(t, err, "cannot encrypt the test string")
+	encryptedContainer.Close()
+
+	open := func() *container_pkg.ContainerFile {
+		encryptedContainer, err := container_pkg.OpenContainerFile(file.Name())
+		assert.NoError(t, err, "cannot open the container")
+		t.Cleanup(func() { encryptedContainer.Close() })
+		slots := encryptedContainer.GetSlots()
+		assert.Len(t, slots, 1)
+		assert.Equal(t, types.SlotKeyAlgTPM, slots[0].Alg)
+		return encryptedContainer
+	}
+	// Another machine or another boot state
+	otherStorageKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "cannot generate the storage key")
+	err = open().UnsealWithTPM(&mockTPM{storageKey: otherStorageKey, pcrs: tpm.pcrs})
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeyUnsealFailed)
+	err = open().UnsealWithTPM(&mockTPM{storageKey: storageKey, pcrs: []byte("tampered boot")})
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeyUnsealFailed)
+
+	encryptedContainer = open()
+	err = encryptedContainer.UnsealWithTPM(tpm)
+	assert.NoError(t, err, "cannot unseal with the tpm")
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, plainText, buf.String())
+}
@@ -0,0 +1,65 @@
+package container_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Add a slot to a container opened read-only, the content region must be left untouched
+func TestUpdateHeader(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(10000)
+	assert.NoError(t, err, "cannot generate plaintext")
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR256, plainText)
+	before, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	// WriteHeader cannot write through the read-only handle
+	assert.Error(t, encryptedContainer.WriteHeader())
+	newKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "cannot generate key")
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM256, newKey)
+	assert.NoError(t, err, "cannot add the slot")
+	err = encryptedContainer.UpdateHeader()
+	assert.NoError(t, err, "cannot update the header")
+	// The upgraded handle still decrypts
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, plainText, buf.Bytes())
+	encryptedContainer.Close()
+
+	after, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	assert.Equal(t, len(before), len(after))
+	assert.Equal(t, before[encryptedContainer.ContentOffset():], after[encryptedContainer.ContentOffset():], "the content region must not change")
+	assert.NotEqual(t, before[:encryptedContainer.ContentOffset()], after[:encryptedContainer.ContentOffset()])
+
+	encryptedContainer, err = container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM256, newKey)
+	assert.NoError(t, err, "cannot unseal with the new slot")
+}
+
+// A container without a writable backing file cannot be updated
+func TestUpdateHeaderReadOnly(t *testing.T) {
+	name, _ := createTestContainer(t, types.EncAlgAESCTR256, []byte("hello"))
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	fsys := fstest.MapFS{"secret.crpt": &fstest.MapFile{Data: data}}
+	encryptedContainer, err := container_pkg.OpenContainerFileFS(fsys, "secret.crpt")
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	assert.ErrorIs(t, encryptedContainer.UpdateHeader(), container_pkg.ErrContainerReadOnly)
+}
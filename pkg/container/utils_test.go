@@ -0,0 +1,52 @@
+package container_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_internal "github.com/ngeojiajun/go-filecrypt/internal/container"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+// Skip the test when the encryption algorithm is left out of this build, see the no_* build tags
+func skipUnlessEncryptionAlgorithm(t testing.TB, alg types.EncryptionAlgorithm) {
+	t.Helper()
+	if !container_internal.EncryptionAlgorithmAvailable(alg) {
+		t.Skipf("the encryption algorithm %d is not compiled in", alg)
+	}
+}
+
+// Skip the test when the slot algorithm is left out of this build, see the no_* build tags
+func skipUnlessSlotAlgorithm(t testing.TB, alg types.SlotKeyAlgorithm) {
+	t.Helper()
+	if !container_internal.SlotAlgorithmAvailable(alg) {
+		t.Skipf("the slot algorithm %d is not compiled in", alg)
+	}
+}
+
+// Create a closed container on a temp file with a single AES-GCM-128 slot holding the plaintext.
+// Returns the path of the container and the slot key, the file is removed when the test ends.
+func createTestContainer(t testing.TB, alg types.EncryptionAlgorithm, plainText []byte) (string, []byte) {
+	t.Helper()
+	skipUnlessEncryptionAlgorithm(t, alg)
+	file, err := os.CreateTemp("", "filecrypt-ci-")
+	require.NoError(t, err, "cannot create temp file")
+	t.Cleanup(func() { os.Remove(file.Name()) })
+	slotKey, err := ic.GenerateRandomBytes(16)
+	require.NoError(t, err, "cannot generate slot key")
+	encryptedContainer, err := container_pkg.NewContainerFileWithHandle(file, alg)
+	require.NoError(t, err, "cannot create container")
+	err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+	require.NoError(t, err, "cannot add slot")
+	err = encryptedContainer.WriteHeader()
+	require.NoError(t, err, "cannot write out the headers")
+	err = encryptedContainer.EncryptStream(bytes.NewReader(plainText))
+	require.NoError(t, err, "cannot encrypt the test string")
+	err = encryptedContainer.Close()
+	require.NoError(t, err, "cannot close the container")
+	return file.Name(), slotKey
+}
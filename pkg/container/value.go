@@ -0,0 +1,91 @@
+package container
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/value.go
+// This file contains the helpers storing a single Go value as the content, e.g. for configurations and secrets.
+//
+// The value is encoded with the codec recorded in the optional header flags, so DecryptValue knows how to decode it.
+// The encoded value is buffered in memory, use the stream API for large payloads.
+
+var (
+	ErrNotValue = errors.New("the container does not hold an encoded value")
+)
+
+// Select the codec used by EncryptValue, JSON is used when none is selected.
+// It must be called before WriteHeader and EncryptValue
+func (f *ContainerFile) SetValueCodec(codec types.ValueCodec) error {
+	if codec == types.ValueCodecNone || codec >= types.ValueCodecEnd {
+		return types.ErrUnsupportedFeature
+	}
+	f.header.Flags = f.header.Flags&^types.HeaderFlagValueCodecMask | uint16(codec)<<types.HeaderFlagValueCodecShift
+	return nil
+}
+
+// Codec of the value stored as the content, ValueCodecNone when the content is plain bytes
+func (f *ContainerFile) ValueCodec() types.ValueCodec {
+	return types.ValueCodec(f.header.Flags & types.HeaderFlagValueCodecMask >> types.HeaderFlagValueCodecShift)
+}
+
+// Encode the value and encrypt it as the content.
+// The header is written again to record the codec, so WriteHeader does not need to be called before
+func (f *ContainerFile) EncryptValue(v any) error {
+	if f.isArchive() || f.isTar() {
+		return types.ErrUnsupportedFeature
+	}
+	if f.ValueCodec() == types.ValueCodecNone {
+		if err := f.SetValueCodec(types.ValueCodecJSON); err != nil {
+			return err
+		}
+	}
+	buffer := bytes.NewBuffer(nil)
+	var err error
+	switch f.ValueCodec() {
+	case types.ValueCodecJSON:
+		err = json.NewEncoder(buffer).Encode(v)
+	case types.ValueCodecGob:
+		err = gob.NewEncoder(buffer).Encode(v)
+	}
+	if err != nil {
+		return err
+	}
+	if err := f.WriteHeader(); err != nil {
+		return err
+	}
+	return f.EncryptStream(buffer)
+}
+
+// Decrypt the content and decode it into the value, which must be a pointer.
+// Nothing is decoded unless the whole content is authenticated
+func (f *ContainerFile) DecryptValue(v any) error {
+	codec := f.ValueCodec()
+	if codec == types.ValueCodecNone {
+		return ErrNotValue
+	}
+	if codec >= types.ValueCodecEnd {
+		return types.ErrUnsupportedFeature
+	}
+	limit := f.resourceLimits().MaxBuffer
+	if err := f.checkContentLimit("the encoded value", limit); err != nil {
+		return err
+	}
+	buffer := bytes.NewBuffer(nil)
+	if err := f.DecryptStream(newLimitedWriter(buffer, "the encoded value", limit)); err != nil {
+		return err
+	}
+	var decoder interface{ Decode(any) error }
+	switch codec {
+	case types.ValueCodecJSON:
+		decoder = json.NewDecoder(buffer)
+	case types.ValueCodecGob:
+		decoder = gob.NewDecoder(buffer)
+	}
+	return decoder.Decode(v)
+}
@@ -0,0 +1,68 @@
+package container_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type testConfig struct {
+	Name     string
+	Port     int
+	Tags     []string
+	Password []byte
+}
+
+func TestEncryptValueRoundTrip(t *testing.T) {
+	slotKey, err := ic.GenerateRandomBytes(16)
+	assert.NoError(t, err, "cannot generate slot key")
+	value := testConfig{Name: "db", Port: 5432, Tags: []string{"primary", "eu"}, Password: []byte("hunter2")}
+	for _, codec := range []types.ValueCodec{types.ValueCodecNone, types.ValueCodecJSON, types.ValueCodecGob} {
+		name := filepath.Join(t.TempDir(), "value.crpt")
+		encryptedContainer, err := container_pkg.NewContainerFile(name, types.EncAlgAESCTR256)
+		assert.NoError(t, err, "cannot create container")
+		err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot add slot")
+		if codec != types.ValueCodecNone {
+			err = encryptedContainer.SetValueCodec(codec)
+			assert.NoError(t, err, "cannot select the codec")
+		}
+		err = encryptedContainer.EncryptValue(value)
+		assert.NoError(t, err, "cannot encrypt the value")
+		encryptedContainer.Close()
+
+		// The codec is recorded in the header, JSON being the default
+		encryptedContainer, err = container_pkg.OpenContainerFile(name)
+		assert.NoError(t, err, "cannot open the container")
+		if codec == types.ValueCodecNone {
+			assert.Equal(t, types.ValueCodecJSON, encryptedContainer.ValueCodec())
+		} else {
+			assert.Equal(t, codec, encryptedContainer.ValueCodec())
+		}
+		err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot unseal the container")
+		var decoded testConfig
+		err = encryptedContainer.DecryptValue(&decoded)
+		assert.NoError(t, err, "cannot decrypt the value")
+		assert.Equal(t, value, decoded)
+		encryptedContainer.Close()
+	}
+}
+
+func TestDecryptValueOfPlainContent(t *testing.T) {
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR256, []byte("Some secrets is here!"))
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the container")
+	var decoded testConfig
+	err = encryptedContainer.DecryptValue(&decoded)
+	assert.ErrorIs(t, err, container_pkg.ErrNotValue)
+	err = encryptedContainer.SetValueCodec(types.ValueCodecEnd)
+	assert.ErrorIs(t, err, types.ErrUnsupportedFeature)
+}
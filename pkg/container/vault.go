@@ -0,0 +1,174 @@
+package container
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_internal "github.com/ngeojiajun/go-filecrypt/internal/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/vault.go
+// This file contains the vault, a store of named secrets kept as one container per secret in a directory.
+//
+// Every container has a single path-bound slot derived from the master secret and the name of the secret,
+// so the whole vault is opened with one secret while no two containers share a slot key.
+// The names are not encrypted, they are the names of the files.
+
+// Extension of the containers in the vault
+const vaultExtension = ".crpt"
+
+// Algorithm of the content of the containers created by the vault
+const vaultAlgorithm = types.EncAlgAESCTR256
+
+var (
+	ErrInvalidSecretName = errors.New("the name of the secret must be a non-empty file name without path separators nor leading dot")
+)
+
+// Store of named secrets in a directory, see the description above
+type Vault struct {
+	dir          string
+	masterSecret []byte
+}
+
+// Open the vault in the directory, which is created if missing.
+// The master secret is copied and wiped by Close
+func OpenVault(dir string, masterSecret []byte) (*Vault, error) {
+	if len(masterSecret) == 0 {
+		return nil, types.ErrParameterMissing
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Vault{dir: dir, masterSecret: bytes.Clone(masterSecret)}, nil
+}
+
+// Path of the container holding the secret
+func (v *Vault) path(name string) (string, error) {
+	// Names starting with a dot are reserved for the temp files
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return "", ErrInvalidSecretName
+	}
+	return filepath.Join(v.dir, name+vaultExtension), nil
+}
+
+// Store the secret under the name, replacing the previous one atomically
+func (v *Vault) Put(name string, plaintext []byte) error {
+	path, err := v.path(name)
+	if err != nil {
+		return err
+	}
+	// Hidden so it never shows up in List
+	temp, cleanup, err := createSecureTemp(v.dir, ".vault-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	f, err := NewContainerFileWithHandle(temp, vaultAlgorithm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := f.AddPathBoundSlot(v.masterSecret, name); err != nil {
+		return err
+	}
+	if err := f.WriteHeader(); err != nil {
+		return err
+	}
+	if err := f.EncryptStream(bytes.NewReader(plaintext)); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// Decrypt the secret stored under the name.
+// ErrRootKeyUnsealFailed is returned when the vault was opened with another master secret
+func (v *Vault) Get(name string) ([]byte, error) {
+	path, err := v.path(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := OpenContainerFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := f.UnsealPathBound(v.masterSecret, name); err != nil {
+		return nil, err
+	}
+	buffer := bytes.NewBuffer(nil)
+	if err := f.DecryptStream(buffer); err != nil {
+		ic.WipeBufferSecure(buffer.Bytes())
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Names of the secrets in the vault in lexical order
+func (v *Vault) List() ([]string, error) {
+	entries, err := os.ReadDir(v.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), vaultExtension)
+		if !ok || !entry.Type().IsRegular() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// Remove the secret. The header holding the slot is overwritten with random bytes and synced first,
+// so the content cannot be decrypted from a copy of the disk blocks even with the master secret
+func (v *Vault) Delete(name string) error {
+	path, err := v.path(name)
+	if err != nil {
+		return err
+	}
+	handle, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	info, err := handle.Stat()
+	if err != nil {
+		return err
+	}
+	if size := min(info.Size(), container_internal.HeaderSize); size > 0 {
+		noise, err := ic.GenerateRandomBytes(int(size))
+		if err != nil {
+			return err
+		}
+		if _, err := handle.WriteAt(noise, 0); err != nil {
+			return err
+		}
+		if err := handle.Sync(); err != nil {
+			return err
+		}
+	}
+	if err := handle.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Wipe the master secret, the vault cannot be used afterwards
+func (v *Vault) Close() {
+	ic.WipeBufferSecure(v.masterSecret)
+	v.masterSecret = nil
+}
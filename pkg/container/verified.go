@@ -0,0 +1,95 @@
+package container
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"io"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+)
+
+// File: pkg/container/verified.go
+// This file contains the verify-then-release decryption and the decryption checked against an expected digest,
+// the integrity check releasing no plaintext and the comparison of the plaintexts of two containers by their digest
+
+var (
+	ErrDigestMismatch = errors.New("the SHA-256 digest of the plaintext does not match the expected one")
+)
+
+// Authenticate the whole content without releasing any plaintext, e.g. to check a backup.
+// The container must be unsealed, a tampered content returns ErrAuthenticationFailed
+func (f *ContainerFile) Verify() error {
+	if len(f.rootKey) == 0 {
+		return ErrRootKeySealed
+	}
+	return f.DecryptStream(io.Discard)
+}
+
+// Decrypt the content into an owner-only temp file first and copy it into the writer only after the
+// authentication succeeded, so the writer never sees unverified plaintext.
+// On failure, e.g. ErrAuthenticationFailed, nothing is written to the writer.
+// It trades temp disk space and an extra copy for the guarantee that DecryptStream cannot provide
+func (f *ContainerFile) DecryptVerifiedBuffered(writer io.Writer) error {
+	if len(f.rootKey) == 0 {
+		return ErrRootKeySealed
+	}
+	temp, cleanup, err := createSecureTemp("", "filecrypt-verify-*")
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if err := f.DecryptStream(temp); err != nil {
+		return err
+	}
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, temp)
+	return err
+}
+
+// Decrypt the content into the writer while computing the SHA-256 digest of the plaintext,
+// e.g. to check a restore against the digest recorded in a manifest.
+// ErrDigestMismatch is returned at the end when the digest differs, after the content passed the authentication.
+// As with DecryptStream, the plaintext reaches the writer before either check completes
+func (f *ContainerFile) DecryptStreamExpect(writer io.Writer, expectedSHA256 []byte) error {
+	if len(expectedSHA256) != sha256.Size {
+		return ic.ErrInvalidLength
+	}
+	h := sha256.New()
+	if err := f.DecryptStream(io.MultiWriter(writer, h)); err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(h.Sum(nil), expectedSHA256) != 1 {
+		return ErrDigestMismatch
+	}
+	return nil
+}
+
+// SHA-256 digest of the authenticated plaintext
+func (f *ContainerFile) plaintextDigest() ([]byte, error) {
+	if len(f.rootKey) == 0 {
+		return nil, ErrRootKeySealed
+	}
+	h := sha256.New()
+	if err := f.DecryptStream(h); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// Whether the two unsealed containers hold the same plaintext, e.g. for deduplication across different keys.
+// Both contents are decrypted into their SHA-256 digest only, so the plaintext never reaches the caller.
+// Both must pass the authentication, otherwise the error of the failing one is returned
+func SamePlaintext(a, b *ContainerFile) (bool, error) {
+	digestA, err := a.plaintextDigest()
+	if err != nil {
+		return false, err
+	}
+	digestB, err := b.plaintextDigest()
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(digestA, digestB) == 1, nil
+}
@@ -0,0 +1,127 @@
+package container_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(100000)
+	assert.NoError(t, err, "cannot generate the payload")
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR256, plainText)
+	verify := func() error {
+		encryptedContainer, err := container_pkg.OpenContainerFile(name)
+		assert.NoError(t, err, "cannot open the container")
+		defer encryptedContainer.Close()
+		assert.ErrorIs(t, encryptedContainer.Verify(), container_pkg.ErrRootKeySealed)
+		assert.NoError(t, encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey), "cannot unseal the root key")
+		return encryptedContainer.Verify()
+	}
+	assert.NoError(t, verify(), "the content should be intact")
+
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	data[len(data)-100] ^= 0x01
+	assert.NoError(t, os.WriteFile(name, data, 0600), "cannot tamper the container")
+	assert.ErrorIs(t, verify(), ic.ErrAuthenticationFailed)
+}
+
+func TestDecryptVerifiedBuffered(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(100000)
+	assert.NoError(t, err, "cannot generate the payload")
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR128, plainText)
+
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	err = encryptedContainer.DecryptVerifiedBuffered(bytes.NewBuffer(nil))
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeySealed)
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptVerifiedBuffered(buf)
+	assert.NoError(t, err, "cannot decrypt the data")
+	assert.Equal(t, plainText, buf.Bytes())
+	encryptedContainer.Close()
+
+	// Tamper the ciphertext, the writer must not receive anything
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	data[len(data)-100] ^= 0x01
+	err = os.WriteFile(name, data, 0600)
+	assert.NoError(t, err, "cannot tamper the container")
+	encryptedContainer, err = container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	buf.Reset()
+	err = encryptedContainer.DecryptVerifiedBuffered(buf)
+	assert.ErrorIs(t, err, ic.ErrAuthenticationFailed)
+	assert.Zero(t, buf.Len(), "unverified plaintext was released")
+}
+
+func TestDecryptStreamExpect(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(100000)
+	assert.NoError(t, err, "cannot generate the payload")
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR128, plainText)
+	expected := sha256.Sum256(plainText)
+
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	err = encryptedContainer.DecryptStreamExpect(io.Discard, expected[:16])
+	assert.ErrorIs(t, err, ic.ErrInvalidLength)
+
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStreamExpect(buf, expected[:])
+	assert.NoError(t, err, "the digest must match")
+	assert.Equal(t, plainText, buf.Bytes())
+
+	expected[0] ^= 0x01
+	err = encryptedContainer.DecryptStreamExpect(io.Discard, expected[:])
+	assert.ErrorIs(t, err, container_pkg.ErrDigestMismatch)
+}
+
+func TestSamePlaintext(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(100000)
+	assert.NoError(t, err, "cannot generate the payload")
+	open := func(alg types.EncryptionAlgorithm, plainText []byte) *container_pkg.ContainerFile {
+		name, slotKey := createTestContainer(t, alg, plainText)
+		encryptedContainer, err := container_pkg.OpenContainerFile(name)
+		assert.NoError(t, err, "cannot open the container")
+		t.Cleanup(func() { encryptedContainer.Close() })
+		err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+		assert.NoError(t, err, "cannot unseal the root key")
+		return encryptedContainer
+	}
+	// Different root keys, salts and ivs
+	a := open(types.EncAlgAESCTR128, plainText)
+	b := open(types.EncAlgAESCTR256, plainText)
+	same, err := container_pkg.SamePlaintext(a, b)
+	assert.NoError(t, err, "cannot compare the containers")
+	assert.True(t, same)
+
+	differing := bytes.Clone(plainText)
+	differing[len(differing)-1] ^= 0x01
+	c := open(types.EncAlgAESCTR128, differing)
+	same, err = container_pkg.SamePlaintext(a, c)
+	assert.NoError(t, err, "cannot compare the containers")
+	assert.False(t, same)
+
+	name, _ := createTestContainer(t, types.EncAlgAESCTR128, plainText)
+	sealed, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer sealed.Close()
+	_, err = container_pkg.SamePlaintext(a, sealed)
+	assert.ErrorIs(t, err, container_pkg.ErrRootKeySealed)
+}
@@ -0,0 +1,43 @@
+package container
+
+import (
+	"fmt"
+
+	container_internal "github.com/ngeojiajun/go-filecrypt/internal/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/version.go
+// This file exposes the version of the container format and the features implemented by this package
+
+// FormatVersion returns the version of the container format written into new files, in the form "major.minor".
+//
+// Stability guarantee:
+//   - The major version changes only when the layout changes incompatibly, files with another major version are refused.
+//   - The minor version changes when features are added in a backward compatible way,
+//     files with the same major but a newer minor version are refused since they may rely on unknown features.
+//   - Files written with an older minor version of the same major version will always remain readable.
+func FormatVersion() string {
+	return fmt.Sprintf("%d.%d", types.FormatVersionMajor, types.FormatVersionMinor)
+}
+
+// Capabilities returns the algorithms and the features this build can read and write.
+// The algorithms left out of the build by their build tag, e.g. no_argon2, are not listed.
+// Compare it with the capabilities of a peer before producing a file the peer must read
+func Capabilities() types.Capabilities {
+	capabilities := types.Capabilities{
+		FormatVersion: FormatVersion(),
+		HeaderFlags:   types.HeaderFlagKnownMask,
+	}
+	for alg := range types.EncAlgEnd {
+		if container_internal.EncryptionAlgorithmAvailable(alg) {
+			capabilities.EncryptionAlgorithms = append(capabilities.EncryptionAlgorithms, alg)
+		}
+	}
+	for alg := range types.SlotKeyAlgEnd {
+		if container_internal.SlotAlgorithmAvailable(alg) {
+			capabilities.SlotAlgorithms = append(capabilities.SlotAlgorithms, alg)
+		}
+	}
+	return capabilities
+}
@@ -0,0 +1,71 @@
+package container_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatVersionMatchesHeader(t *testing.T) {
+	name, _ := createTestContainer(t, types.EncAlgAESCTR128, []byte("Some secrets is here!"))
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	// The version follows the magic number
+	assert.Equal(t, container_pkg.FormatVersion(), fmt.Sprintf("%d.%d", data[4], data[5]))
+
+	for _, enable := range []func(*container_pkg.ContainerFile){
+		(*container_pkg.ContainerFile).EnableCompactHeader,
+		(*container_pkg.ContainerFile).EnableDoubleBufferedHeader,
+	} {
+		storage := &memoryStorage{}
+		encryptedContainer, err := container_pkg.NewContainerFileWithStorage(storage, types.EncAlgAESCTR128)
+		assert.NoError(t, err, "cannot create container")
+		enable(encryptedContainer)
+		err = encryptedContainer.AddKeySlot(types.SlotKeyAlgAESGCM128, make([]byte, 16))
+		assert.NoError(t, err, "cannot add slot")
+		err = encryptedContainer.WriteHeader()
+		assert.NoError(t, err, "cannot write out the headers")
+		assert.Equal(t, container_pkg.FormatVersion(), fmt.Sprintf("%d.%d", storage.data[4], storage.data[5]))
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	capabilities := container_pkg.Capabilities()
+	assert.Equal(t, container_pkg.FormatVersion(), capabilities.FormatVersion)
+	assert.Contains(t, capabilities.EncryptionAlgorithms, types.EncAlgAESCTR128)
+	assert.Contains(t, capabilities.EncryptionAlgorithms, types.EncAlgAESCTR256)
+	assert.NotContains(t, capabilities.EncryptionAlgorithms, types.EncAlgEnd)
+	assert.Contains(t, capabilities.SlotAlgorithms, types.SlotKeyAlgAESGCM128)
+	assert.Contains(t, capabilities.SlotAlgorithms, types.SlotKeyAlgAESGCMSIV256)
+	assert.NotContains(t, capabilities.SlotAlgorithms, types.SlotKeyAlgEnd)
+	assert.True(t, capabilities.SupportsHeaderFlag(types.HeaderFlagChunkedContent|types.HeaderFlagCompactHeader))
+	assert.True(t, capabilities.SupportsHeaderFlag(types.HeaderFlagReauthenticated))
+	assert.False(t, capabilities.SupportsHeaderFlag(1<<6))
+}
+
+func TestOpenContainerFileStrict(t *testing.T) {
+	name, _ := createTestContainer(t, types.EncAlgAESCTR128, []byte("Some secrets is here!"))
+	encryptedContainer, err := container_pkg.OpenContainerFileStrict(name, 0)
+	assert.NoError(t, err, "cannot open a current file")
+	encryptedContainer.Close()
+
+	encryptedContainer, err = container_pkg.OpenContainerFileStrict(name, types.FormatVersionMinor)
+	assert.NoError(t, err, "cannot open a current file at the current version")
+	encryptedContainer.Close()
+
+	// A file written by an older release
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err, "cannot read the container")
+	data[5] = 0
+	err = os.WriteFile(name, data, 0600)
+	assert.NoError(t, err, "cannot write the container")
+	_, err = container_pkg.OpenContainerFileStrict(name, types.FormatVersionMinor)
+	assert.ErrorIs(t, err, types.ErrVersionTooOld)
+	encryptedContainer, err = container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the older file without a minimum")
+	encryptedContainer.Close()
+}
@@ -0,0 +1,161 @@
+package container
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	container_internal "github.com/ngeojiajun/go-filecrypt/internal/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+)
+
+// File: pkg/container/volumes.go
+// This file contains APIs for containers whose content spans several files (volumes), e.g. backups on removable media.
+//
+// Every volume carries a copy of the header with HeaderFlagMultiVolume set, its index, the total number of volumes
+// and the offset where its part starts in the logical content (salt || iv || ciphertext || tag).
+// The volumes are simply concatenated to rebuild the content, so the CTR counter and the tag continue across them.
+
+var (
+	ErrMultiVolume      = errors.New("the container spans multiple volumes, use OpenContainerFileVolumes")
+	ErrVolumeMismatch   = errors.New("the volumes do not belong to the same container or are out of order")
+	ErrVolumeCountLimit = errors.New("the number of volumes must be between 1 and 65535")
+)
+
+// Whether the content continues in other volumes
+func (f *ContainerFile) isMultiVolume() bool {
+	return f.header.Flags&types.HeaderFlagMultiVolume != 0
+}
+
+// Split the content of the container evenly into the given files, each of them receives a copy of the header.
+// The container itself is left untouched and does not need to be unsealed.
+// Chunked content cannot be split as the chunks are located by the size of a single file,
+// nor an authenticated header as every volume changes it without the root key,
+// nor header-bound keys as the volume fields change the fingerprint the keys are derived from
+func (f *ContainerFile) SplitIntoVolumes(names []string) error {
+	if len(names) == 0 || len(names) > 0xFFFF {
+		return ErrVolumeCountLimit
+	}
+	if f.file == nil {
+		return ErrContainerReadOnly
+	}
+	if f.isChunked() || f.isMultiVolume() || f.hasChecksumTrailer() || f.isHeaderAuthenticated() || f.isHeaderBound() {
+		return types.ErrUnsupportedFeature
+	}
+	fileSize, err := f.FileSize()
+	if err != nil {
+		return err
+	}
+	contentSize := fileSize - f.contentOffset()
+	partSize := (contentSize + int64(len(names)) - 1) / int64(len(names))
+	for i, name := range names {
+		offset := min(int64(i)*partSize, contentSize)
+		length := min(partSize, contentSize-offset)
+		header := *f.header
+		header.Flags |= types.HeaderFlagMultiVolume
+		header.VolumeIndex = uint16(i)
+		header.VolumeCount = uint16(len(names))
+		header.VolumeOffset = uint64(offset)
+		if err := writeVolume(name, &header, io.NewSectionReader(f.file, f.contentOffset()+offset, length)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write a single volume
+func writeVolume(name string, header *container_internal.ContainerFileHeader, part io.Reader) error {
+	handle, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	if err := container_internal.WriteContainerFileHeader(handle, header); err != nil {
+		return err
+	}
+	if _, err := io.Copy(handle, part); err != nil {
+		return err
+	}
+	return handle.Close()
+}
+
+// Open the volumes of a container in order and stitch them into a single logical container.
+// The resulting container is read only
+func OpenContainerFileVolumes(names []string) (*ContainerFile, error) {
+	if len(names) == 0 || len(names) > 0xFFFF {
+		return nil, ErrVolumeCountLimit
+	}
+	file := &ContainerFile{
+		volumes: make([]*os.File, 0, len(names)),
+		rootKey: []byte{},
+	}
+	var offset uint64
+	for i, name := range names {
+		handle, err := os.Open(name)
+		if err != nil {
+			file.closeVolumes()
+			return nil, err
+		}
+		file.volumes = append(file.volumes, handle)
+		header, err := container_internal.ParseContainerFileHeader(handle)
+		if err != nil {
+			file.closeVolumes()
+			return nil, err
+		}
+		if header.Flags&types.HeaderFlagMultiVolume == 0 ||
+			int(header.VolumeIndex) != i ||
+			int(header.VolumeCount) != len(names) ||
+			header.VolumeOffset != offset ||
+			(file.header != nil && (header.Flags != file.header.Flags || header.Algorithm != file.header.Algorithm || header.Size() != file.header.Size())) {
+			file.closeVolumes()
+			return nil, ErrVolumeMismatch
+		}
+		if file.header == nil {
+			file.header = header
+		}
+		info, err := handle.Stat()
+		if err != nil {
+			file.closeVolumes()
+			return nil, err
+		}
+		offset += uint64(info.Size() - header.Size())
+	}
+	return file, nil
+}
+
+// Create a reader over the content of all volumes
+func (f *ContainerFile) volumesContentReader() (io.Reader, error) {
+	parts := make([]io.Reader, 0, len(f.volumes))
+	for _, volume := range f.volumes {
+		info, err := volume.Stat()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, io.NewSectionReader(volume, f.contentOffset(), info.Size()-f.contentOffset()))
+	}
+	return io.MultiReader(parts...), nil
+}
+
+// Size of the logical container made of all volumes
+func (f *ContainerFile) volumesSize() (int64, error) {
+	size := f.contentOffset()
+	for _, volume := range f.volumes {
+		info, err := volume.Stat()
+		if err != nil {
+			return -1, err
+		}
+		size += info.Size() - f.contentOffset()
+	}
+	return size, nil
+}
+
+// Close all volumes, the first error is returned
+func (f *ContainerFile) closeVolumes() error {
+	var firstErr error
+	for _, volume := range f.volumes {
+		if err := volume.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
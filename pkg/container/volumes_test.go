@@ -0,0 +1,79 @@
+package container_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ic "github.com/ngeojiajun/go-filecrypt/internal/cipher"
+	container_pkg "github.com/ngeojiajun/go-filecrypt/pkg/container"
+	types "github.com/ngeojiajun/go-filecrypt/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerVolumes(t *testing.T) {
+	plainText, err := ic.GenerateRandomBytes(100000)
+	assert.NoError(t, err, "cannot generate the payload")
+	name, slotKey := createTestContainer(t, types.EncAlgAESCTR256, plainText)
+	dir := t.TempDir()
+	volumes := []string{filepath.Join(dir, "backup.001"), filepath.Join(dir, "backup.002")}
+
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	err = encryptedContainer.SplitIntoVolumes(volumes)
+	assert.NoError(t, err, "cannot split the container")
+	encryptedContainer.Close()
+
+	// A single volume cannot be opened as a container
+	_, err = container_pkg.OpenContainerFile(volumes[0])
+	assert.ErrorIs(t, err, container_pkg.ErrMultiVolume)
+	// Neither can the volumes be opened out of order or incomplete
+	_, err = container_pkg.OpenContainerFileVolumes([]string{volumes[1], volumes[0]})
+	assert.ErrorIs(t, err, container_pkg.ErrVolumeMismatch)
+	_, err = container_pkg.OpenContainerFileVolumes(volumes[:1])
+	assert.ErrorIs(t, err, container_pkg.ErrVolumeMismatch)
+
+	encryptedContainer, err = container_pkg.OpenContainerFileVolumes(volumes)
+	assert.NoError(t, err, "cannot open the volumes")
+	defer encryptedContainer.Close()
+	size, err := encryptedContainer.EstimateContentSize()
+	assert.NoError(t, err, "cannot estimate the content size")
+	assert.Equal(t, int64(len(plainText)), size)
+	err = encryptedContainer.Unseal(types.SlotKeyAlgAESGCM128, slotKey)
+	assert.NoError(t, err, "cannot unseal the root key")
+	buf := bytes.NewBuffer(nil)
+	err = encryptedContainer.DecryptStream(buf)
+	assert.NoError(t, err, "cannot decrypt the volumes")
+	assert.Equal(t, plainText, buf.Bytes())
+	// The volumes cannot be read at an offset
+	err = encryptedContainer.DecryptRange(io.Discard, 0, 1)
+	assert.ErrorIs(t, err, types.ErrUnsupportedFeature)
+	_, err = encryptedContainer.NewContentSectionReader(0, 1)
+	assert.ErrorIs(t, err, types.ErrUnsupportedFeature)
+	_, err = encryptedContainer.AsSeekableDecryptionStream()
+	assert.ErrorIs(t, err, types.ErrUnsupportedFeature)
+
+	// The content really is split
+	for _, volume := range volumes {
+		info, err := os.Stat(volume)
+		assert.NoError(t, err, "cannot stat the volume")
+		assert.Less(t, info.Size(), int64(len(plainText)))
+	}
+}
+
+func TestContainerVolumesHeaderBound(t *testing.T) {
+	rootKey, err := ic.GenerateRandomBytes(32)
+	assert.NoError(t, err, "cannot generate the root key")
+	name, _ := createRootKeyContainer(t, rootKey, []byte("Some secrets is here!"), true)
+	volume := filepath.Join(t.TempDir(), "backup.001")
+
+	encryptedContainer, err := container_pkg.OpenContainerFile(name)
+	assert.NoError(t, err, "cannot open the container")
+	defer encryptedContainer.Close()
+	err = encryptedContainer.SplitIntoVolumes([]string{volume})
+	assert.ErrorIs(t, err, types.ErrUnsupportedFeature)
+	_, err = os.Stat(volume)
+	assert.ErrorIs(t, err, os.ErrNotExist, "a volume was written")
+}
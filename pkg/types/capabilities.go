@@ -0,0 +1,16 @@
+package types
+
+// File: pkg/types/capabilities.go
+// Contains the features of the container format implemented by a build
+
+type Capabilities struct {
+	FormatVersion        string                // version of the format written, in the form "major.minor"
+	EncryptionAlgorithms []EncryptionAlgorithm // algorithms of the content
+	SlotAlgorithms       []SlotKeyAlgorithm    // algorithms of the slots
+	HeaderFlags          uint16                // header flags understood, see HeaderFlagKnownMask
+}
+
+// Whether the header flag is understood, a file carrying an unknown critical flag cannot be read
+func (c Capabilities) SupportsHeaderFlag(flag uint16) bool {
+	return c.HeaderFlags&flag == flag
+}
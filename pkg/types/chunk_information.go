@@ -0,0 +1,11 @@
+package types
+
+// File: pkg/types/chunk_information.go
+// Contains information on the chunks of the content
+
+type ChunkRef struct {
+	Index      int   // Position of the chunk in the content
+	Offset     int64 // Offset of the plaintext held by the chunk
+	Length     int64 // Length of the plaintext held by the chunk
+	FileOffset int64 // Offset of the framed chunk in the file
+}
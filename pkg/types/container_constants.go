@@ -9,16 +9,84 @@ import (
 )
 
 var (
-	FileMagicNumber         = []byte{0x43, 0x52, 0x50, 0x54} // "CRPT" in ASCII
-	ErrInvalidFileHeader    = errors.New("invalid file header")
-	ErrUnsupportedVersion   = errors.New("unsupported file version")
-	ErrUnsupportedEncAlgo   = errors.New("unsupported file encryption algorithm")
-	ErrUnsupportedSlotAlgo  = errors.New("unsupported slot encryption algorithm")
-	ErrEmptySlotContent     = errors.New("slot content is empty")
-	ErrSlotTooMuch          = errors.New("slot content is too many")
-	ErrSlotContentTooLarge  = errors.New("the resulting slot content is too large, check the rootKey and algorithm")
-	ErrParameterMissing     = errors.New("required parameter is missing")
-	ErrProducedHeaderTooBig = errors.New("the operation produce header that is way too big")
+	FileMagicNumber           = []byte{0x43, 0x52, 0x50, 0x54} // "CRPT" in ASCII
+	ErrInvalidFileHeader      = errors.New("invalid file header")
+	ErrUnsupportedVersion     = errors.New("unsupported file version")
+	ErrVersionTooOld          = errors.New("the file version is older than the minimum accepted")
+	ErrUnsupportedEncAlgo     = errors.New("unsupported file encryption algorithm")
+	ErrUnsupportedSlotAlgo    = errors.New("unsupported slot encryption algorithm")
+	ErrAlgorithmNotCompiledIn = errors.New("the algorithm is not compiled into this build")
+	ErrEmptySlotContent       = errors.New("slot content is empty")
+	ErrSlotTooMuch            = errors.New("slot content is too many")
+	ErrSlotContentTooLarge    = errors.New("the resulting slot content is too large, check the rootKey and algorithm")
+	ErrParameterMissing       = errors.New("required parameter is missing")
+	ErrProducedHeaderTooBig   = errors.New("the operation produce header that is way too big")
+	ErrUnsupportedFeature     = errors.New("the file uses a feature which is not supported")
+	ErrSlotContentMalformed   = errors.New("the slot content is malformed")
+	ErrSlotNonceCollision     = errors.New("the nonce of the slot is already used by another slot")
+)
+
+// Header flags are split into two groups.
+// Critical flags (upper 8 bits) change how the file must be processed, a reader must understand them.
+// Optional flags (lower 8 bits) are informational and can be ignored safely by a reader.
+const (
+	HeaderFlagCriticalMask uint16 = 0xFF00
+	HeaderFlagOptionalMask uint16 = 0x00FF
+)
+
+// Optional header flags
+const (
+	HeaderFlagArchive        uint16 = 1 << 0 // The content is an archive of named entries behind an encrypted table of contents
+	HeaderFlagValueCodecMask uint16 = 3 << 1 // The content is a value encoded with the codec stored in these bits, see ValueCodec
+	HeaderFlagTarContent     uint16 = 1 << 3 // The content is a tar stream
+	HeaderFlagAuthenticated  uint16 = 1 << 4 // The header ends with a HMAC keyed by the root key, older readers skip it
+	HeaderFlagMetadata       uint16 = 1 << 5 // The header ends with the encrypted metadata of the original file, older readers skip it
+	HeaderFlagReadOnly       uint16 = 1 << 7 // The user marked the file read-only, only informational as this library does not enforce it
+)
+
+// Position of the codec in the header flags
+const HeaderFlagValueCodecShift = 1
+
+// Critical header flags
+const (
+	HeaderFlagContentSaltSize uint16 = 1 << 8  // The size of the content salt is stored after the slots
+	HeaderFlagChunkedContent  uint16 = 1 << 9  // The content is split into independently authenticated chunks
+	HeaderFlagMultiVolume     uint16 = 1 << 10 // The content continues across several files, the volume fields are stored after the slots
+	HeaderFlagCompactHeader   uint16 = 1 << 11 // The header is length prefixed instead of padded to 4096 bytes, requires the minor version 1
+	HeaderFlagChecksumTrailer uint16 = 1 << 12 // The content is followed by CRC32C checksums of the header and the content
+	HeaderFlagHeaderBound     uint16 = 1 << 13 // The keys derived from the root key are bound to the fingerprint of the header
+	HeaderFlagDoubleBuffered  uint16 = 1 << 14 // The header is stored twice with a sequence number and a checksum, requires the minor version 2
+	HeaderFlagReauthenticated uint16 = 1 << 15 // The tag of the content is keyed by the salt ending the header
+)
+
+// Mask of the header flags known by this library
+const HeaderFlagKnownMask uint16 = HeaderFlagArchive | HeaderFlagValueCodecMask | HeaderFlagTarContent | HeaderFlagAuthenticated | HeaderFlagMetadata | HeaderFlagReadOnly | HeaderFlagContentSaltSize | HeaderFlagChunkedContent | HeaderFlagMultiVolume | HeaderFlagCompactHeader | HeaderFlagChecksumTrailer | HeaderFlagHeaderBound | HeaderFlagDoubleBuffered | HeaderFlagReauthenticated
+
+// Mask of the header flags which can be changed on an existing file, the optional flags set by the user
+// which do not affect how the content is read and are not backed by a field of the header
+const HeaderFlagUpdatableMask uint16 = HeaderFlagReadOnly
+
+// Check whether the flags contain any unknown critical flags
+func HasUnknownCriticalFlags(flags uint16) bool {
+	return flags&HeaderFlagCriticalMask&^HeaderFlagKnownMask != 0
+}
+
+// The newest version of the container format understood and written by this library.
+// Files with the same major version and a minor version not newer than this can be read
+const (
+	FormatVersionMajor uint8 = 1
+	FormatVersionMinor uint8 = 2
+)
+
+// Identifier of the codec of a value stored as the content.
+// The values are stored in files, so they must never be renumbered or change meaning
+type ValueCodec uint8
+
+const (
+	ValueCodecNone ValueCodec = iota // The content is plain bytes
+	ValueCodecJSON                   // The content is a value encoded with encoding/json
+	ValueCodecGob                    // The content is a value encoded with encoding/gob
+	ValueCodecEnd
 )
 
 // Identifier for algorithm used for encrypting the file content
@@ -27,11 +95,15 @@ type EncryptionAlgorithm uint16
 // Identifier for algorithm used for encrypting the slot key
 type SlotKeyAlgorithm uint16
 
-// File encryption algorithms
+// File encryption algorithms.
+// The values and their key sizes are stored in files, so they must never be renumbered or change meaning
 const (
-	EncAlgAESCTR128 EncryptionAlgorithm = iota // AES CTR 128 encryption algorithm
-	EncAlgAESCTR192                            // AES CTR 192 encryption algorithm
-	EncAlgAESCTR256                            // AES CTR 256 encryption algorithm
+	EncAlgAESCTR128        EncryptionAlgorithm = iota // AES CTR 128 encryption algorithm
+	EncAlgAESCTR192                                   // AES CTR 192 encryption algorithm
+	EncAlgAESCTR256                                   // AES CTR 256 encryption algorithm
+	EncAlgAESGCM128                                   // AES GCM 128 encryption of the chunked content
+	EncAlgAESGCM256                                   // AES GCM 256 encryption of the chunked content
+	EncAlgChaCha20Poly1305                            // ChaCha20-Poly1305 encryption of the chunked content, for platforms without AES acceleration
 	EncAlgEnd
 )
 
@@ -44,15 +116,36 @@ func (v EncryptionAlgorithm) KeySize() int {
 		return 24
 	case EncAlgAESCTR256:
 		return 32
+	case EncAlgAESGCM128:
+		return 16
+	case EncAlgAESGCM256:
+		return 32
+	case EncAlgChaCha20Poly1305:
+		return 32
 	default:
 		panic("EncryptionAlgorithm::KeySize called on invalid value")
 	}
 }
 
+// Whether the content is sealed by an AEAD, which always uses the chunked framing
+func (v EncryptionAlgorithm) IsAEAD() bool {
+	return v == EncAlgAESGCM128 || v == EncAlgAESGCM256 || v == EncAlgChaCha20Poly1305
+}
+
 // Slot key algorithms
 const (
 	SlotKeyAlgAESGCM128 SlotKeyAlgorithm = iota // Direct AES-128 key is used to decrypt the slot in GCM mode
 	SlotKeyAlgAESGCM256
+	SlotKeyAlgExternalKMS  // AES-256 key resolved from an external keyring by the identifier stored in the slot
+	SlotKeyAlgTokenHMAC    // Key derived from the response of a hardware token to the challenge stored in the slot
+	SlotKeyAlgAnonymous    // The real algorithm is hidden, the slot is unsealed by trial decryption
+	SlotKeyAlgAESGCMSIV256 // Direct AES-256 key is used to decrypt the slot in the nonce-misuse-resistant GCM-SIV mode
+	SlotKeyAlgTPM          // The root key is sealed by a TPM, optionally bound to the policy stored in the slot
+	SlotKeyAlgArgon2id     // Key derived from a passphrase with Argon2id, the parameters and the salt are stored in the slot
+	SlotKeyAlgRSAOAEP2048  // The root key is encrypted to a RSA public key of 2048 bits or more with OAEP-SHA256
+	SlotKeyAlgX25519       // The root key is wrapped by the key agreed between an ephemeral and the recipient X25519 key
+	SlotKeyAlgScrypt       // Key derived from a passphrase with scrypt, the parameters and the salt are stored in the slot
+	SlotKeyAlgPBKDF2SHA256 // Key derived from a passphrase with PBKDF2-HMAC-SHA256, the iterations and the salt are stored in the slot
 	SlotKeyAlgEnd
 )
 
@@ -63,6 +156,26 @@ func (v SlotKeyAlgorithm) KeySize() int {
 		return 16
 	case SlotKeyAlgAESGCM256:
 		return 32
+	case SlotKeyAlgExternalKMS:
+		return 32
+	case SlotKeyAlgTokenHMAC:
+		return 0 // The response of the token has variable length
+	case SlotKeyAlgAnonymous:
+		return 0 // Any of the algorithms which can be hidden
+	case SlotKeyAlgAESGCMSIV256:
+		return 32
+	case SlotKeyAlgTPM:
+		return 0 // The TPM unseals the root key itself
+	case SlotKeyAlgArgon2id:
+		return 0 // The passphrase has variable length
+	case SlotKeyAlgRSAOAEP2048:
+		return 0 // Unsealed with the private key, see UnsealWithPrivateKey
+	case SlotKeyAlgX25519:
+		return 0 // Unsealed with the private key, see UnsealWithPrivateKey
+	case SlotKeyAlgScrypt:
+		return 0 // The passphrase has variable length
+	case SlotKeyAlgPBKDF2SHA256:
+		return 0 // The passphrase has variable length
 	default:
 		panic("SlotKeyAlgorithm::KeySize called on invalid value")
 	}
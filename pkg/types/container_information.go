@@ -0,0 +1,13 @@
+package types
+
+// File: pkg/types/container_information.go
+// Contains the description of a container readable without any key
+
+type ContainerInfo struct {
+	VersionMajor uint8               // Major version of the format of the file
+	VersionMinor uint8               // Minor version of the format of the file
+	Algorithm    EncryptionAlgorithm // Algorithm of the content
+	Flags        uint16              // Header flags, see HeaderFlagKnownMask
+	HeaderSize   int64               // Size of the header region in bytes
+	Slots        []*ContainerSlotInfo
+}
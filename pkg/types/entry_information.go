@@ -0,0 +1,10 @@
+package types
+
+// File: pkg/types/entry_information.go
+// Contains information on the entries of an archive container
+
+type EntryInfo struct {
+	Name   string // Name of the entry
+	Size   int64  // Size of the plaintext of the entry
+	Offset int64  // Offset of the entry in the decrypted content
+}
@@ -0,0 +1,130 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// File: pkg/types/feature_error.go
+// Contains the error naming the feature of a file which this build does not implement
+
+var (
+	ErrFeatureUnavailable = errors.New("the file uses a feature which is not available in this build")
+)
+
+// Kind of the feature missing from the build
+type FeatureKind int
+
+const (
+	FeatureEncryptionAlgorithm FeatureKind = iota // ID is an EncryptionAlgorithm
+	FeatureSlotAlgorithm                          // ID is a SlotKeyAlgorithm
+	FeatureHeaderFlags                            // ID is the mask of the header flags
+)
+
+// Readable names of the encryption algorithms
+var encryptionAlgorithmNames = map[EncryptionAlgorithm]string{
+	EncAlgAESCTR128:        "AES-128-CTR",
+	EncAlgAESCTR192:        "AES-192-CTR",
+	EncAlgAESCTR256:        "AES-256-CTR",
+	EncAlgAESGCM128:        "AES-128-GCM",
+	EncAlgAESGCM256:        "AES-256-GCM",
+	EncAlgChaCha20Poly1305: "ChaCha20-Poly1305",
+}
+
+// Readable names of the slot algorithms
+var slotAlgorithmNames = map[SlotKeyAlgorithm]string{
+	SlotKeyAlgAESGCM128:    "AES-128-GCM",
+	SlotKeyAlgAESGCM256:    "AES-256-GCM",
+	SlotKeyAlgExternalKMS:  "external KMS",
+	SlotKeyAlgTokenHMAC:    "hardware token HMAC",
+	SlotKeyAlgAnonymous:    "anonymous",
+	SlotKeyAlgAESGCMSIV256: "AES-256-GCM-SIV",
+	SlotKeyAlgTPM:          "TPM",
+	SlotKeyAlgArgon2id:     "Argon2id",
+	SlotKeyAlgRSAOAEP2048:  "RSA-OAEP recipient",
+	SlotKeyAlgX25519:       "X25519 recipient",
+	SlotKeyAlgScrypt:       "scrypt",
+	SlotKeyAlgPBKDF2SHA256: "PBKDF2-HMAC-SHA256",
+}
+
+// Readable names of the header flags in the order of their bits
+var headerFlagNames = []struct {
+	flag uint16
+	name string
+}{
+	{HeaderFlagArchive, "archive"},
+	{HeaderFlagValueCodecMask, "value codec"},
+	{HeaderFlagTarContent, "tar content"},
+	{HeaderFlagAuthenticated, "authenticated header"},
+	{HeaderFlagMetadata, "metadata"},
+	{HeaderFlagReadOnly, "read-only"},
+	{HeaderFlagContentSaltSize, "content salt size"},
+	{HeaderFlagChunkedContent, "chunked content"},
+	{HeaderFlagMultiVolume, "multi-volume"},
+	{HeaderFlagCompactHeader, "compact header"},
+	{HeaderFlagChecksumTrailer, "checksum trailer"},
+	{HeaderFlagHeaderBound, "header-bound keys"},
+	{HeaderFlagDoubleBuffered, "double-buffered header"},
+	{HeaderFlagReauthenticated, "re-authenticated content"},
+}
+
+// FeatureUnavailableError names the missing feature, so it can be reported to the user.
+// It matches both ErrFeatureUnavailable and the specific error, e.g. ErrUnsupportedEncAlgo, with errors.Is
+type FeatureUnavailableError struct {
+	Kind FeatureKind // what ID identifies
+	ID   uint16      // the algorithm or the mask of the header flags as stored in the file
+	Err  error       // the specific error
+}
+
+// Create the error for the encryption algorithm missing from the build
+func NewEncryptionAlgorithmUnavailableError(err error, alg EncryptionAlgorithm) *FeatureUnavailableError {
+	return &FeatureUnavailableError{Kind: FeatureEncryptionAlgorithm, ID: uint16(alg), Err: err}
+}
+
+// Create the error for the slot algorithm missing from the build
+func NewSlotAlgorithmUnavailableError(err error, alg SlotKeyAlgorithm) *FeatureUnavailableError {
+	return &FeatureUnavailableError{Kind: FeatureSlotAlgorithm, ID: uint16(alg), Err: err}
+}
+
+// Create the error for the header flags missing from the build
+func NewHeaderFlagsUnavailableError(err error, flags uint16) *FeatureUnavailableError {
+	return &FeatureUnavailableError{Kind: FeatureHeaderFlags, ID: flags, Err: err}
+}
+
+// Description of the feature, the ids missing from the name tables are shown as numbers
+func (e *FeatureUnavailableError) Feature() string {
+	switch e.Kind {
+	case FeatureEncryptionAlgorithm:
+		if name, ok := encryptionAlgorithmNames[EncryptionAlgorithm(e.ID)]; ok {
+			return "the encryption algorithm " + name
+		}
+		return fmt.Sprintf("the unknown encryption algorithm %d", e.ID)
+	case FeatureSlotAlgorithm:
+		if name, ok := slotAlgorithmNames[SlotKeyAlgorithm(e.ID)]; ok {
+			return "the slot algorithm " + name
+		}
+		return fmt.Sprintf("the unknown slot algorithm %d", e.ID)
+	default:
+		names := []string{}
+		rest := e.ID
+		for _, known := range headerFlagNames {
+			if rest&known.flag != 0 {
+				names = append(names, known.name)
+				rest &^= known.flag
+			}
+		}
+		if rest != 0 {
+			names = append(names, fmt.Sprintf("unknown 0x%04x", rest))
+		}
+		return "the header flags " + strings.Join(names, ", ")
+	}
+}
+
+func (e *FeatureUnavailableError) Error() string {
+	return fmt.Sprintf("the file uses %s which this build does not support", e.Feature())
+}
+
+func (e *FeatureUnavailableError) Unwrap() []error {
+	return []error{ErrFeatureUnavailable, e.Err}
+}
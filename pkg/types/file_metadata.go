@@ -0,0 +1,14 @@
+package types
+
+import "time"
+
+// File: pkg/types/file_metadata.go
+// Contains the description of the original file kept encrypted in the header
+
+type FileMetadata struct {
+	Name     string            `json:"name,omitempty"`   // Base name of the original file
+	Size     int64             `json:"size,omitempty"`   // Size of the original file
+	ModTime  time.Time         `json:"mtime,omitzero"`   // Modification time of the original file
+	MIMEType string            `json:"mime,omitempty"`   // MIME type of the original file, empty when unknown
+	Custom   map[string]string `json:"custom,omitempty"` // Arbitrary key/values of the application
+}
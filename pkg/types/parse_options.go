@@ -0,0 +1,16 @@
+package types
+
+// File: pkg/types/parse_options.go
+// Contains the options used while parsing the container
+
+type ParseOptions struct {
+	// Reject the file when it carries critical flags unknown to this library.
+	// When false, unknown flags are ignored to keep forward compatibility
+	Strict bool
+	// Reject the file with ErrVersionTooOld when its minor version is older than this, e.g. to enforce a migration.
+	// Zero accepts every version
+	MinVersionMinor uint8
+	// Bounds applied to the header and, for the containers opened with these options, the decryption.
+	// Nil applies none
+	Limits *ResourceLimits
+}
@@ -0,0 +1,33 @@
+package types
+
+// File: pkg/types/password_params.go
+// Contains the cost parameters of the passphrase slots
+
+// Cost of the Argon2id derivation of a passphrase slot, stored in the slot so each slot can use its own
+type PasswordParams struct {
+	Time    uint32 // number of passes over the memory
+	Memory  uint32 // memory in KiB
+	Threads uint8  // degree of parallelism
+}
+
+// The second recommended option of RFC 9106, for machines where 2 GiB per derivation is too much
+var DefaultPasswordParams = PasswordParams{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// Cost of the scrypt derivation of a passphrase slot, it takes 128 * BlockSize * 2^LogN bytes of memory
+type ScryptParams struct {
+	LogN        uint8  // base 2 logarithm of the CPU and memory cost N
+	BlockSize   uint32 // block size r
+	Parallelism uint32 // parallelization p
+}
+
+// N = 2^15, r = 8 and p = 1 takes 32 MiB, usable on constrained machines
+var DefaultScryptParams = ScryptParams{LogN: 15, BlockSize: 8, Parallelism: 1}
+
+// Cost of the PBKDF2-HMAC-SHA256 derivation of a passphrase slot. It is not memory-hard,
+// only use it to interoperate with systems lacking Argon2id and scrypt
+type PBKDF2Params struct {
+	Iterations uint32 // number of iterations of HMAC-SHA256
+}
+
+// The iterations recommended by OWASP for PBKDF2-HMAC-SHA256
+var DefaultPBKDF2Params = PBKDF2Params{Iterations: 600000}
@@ -0,0 +1,31 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+// File: pkg/types/resource_limits.go
+// Contains the bounds applied while processing untrusted files, e.g. on a server handling uploads
+
+var (
+	ErrResourceLimitExceeded = errors.New("the file exceeds the resource limits")
+)
+
+// Bounds on what an untrusted file can make the library allocate or produce, zero means unlimited
+type ResourceLimits struct {
+	MaxSlots            int   // slots declared in the header
+	MaxSlotSize         int   // bytes of a single slot content
+	MaxHeaderMetadata   int   // bytes of the reserved data and of the metadata of the header
+	MaxDecompressedSize int64 // plaintext bytes produced when decrypting the content
+	MaxBuffer           int64 // bytes held in memory at once, e.g. by DecryptValue or the table of contents of an archive
+	MaxKDFMemory        int64 // bytes of memory used to derive the key of a password slot, the slots costing more are not tried
+}
+
+// Check the value against the limit, the error names what exceeded it
+func CheckResourceLimit(what string, value, limit int64) error {
+	if limit > 0 && value > limit {
+		return fmt.Errorf("%w: %s is %d, the limit is %d", ErrResourceLimitExceeded, what, value, limit)
+	}
+	return nil
+}
@@ -10,9 +10,12 @@ import (
 )
 
 var (
-	ErrKeyMissing         = c.ErrKeyMissing
-	ErrAESKeySizeMismatch = c.ErrAESKeySizeMismatch
-	ErrInvalidLength      = c.ErrInvalidLength
+	ErrKeyMissing           = c.ErrKeyMissing
+	ErrAESKeySizeMismatch   = c.ErrAESKeySizeMismatch
+	ErrInvalidLength        = c.ErrInvalidLength
+	ErrKeySizeInvalid       = c.ErrKeySizeInvalid
+	ErrAuthenticationFailed = c.ErrAuthenticationFailed
+	ErrTruncated            = c.ErrTruncated
 )
 
 // AESVerifyKeySize checks if the provided key is a valid AES key size.